@@ -1,12 +1,20 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/rokeller/zt-dl/ffmpeg"
+	"github.com/rokeller/zt-dl/ratelimit"
 	"github.com/rokeller/zt-dl/zattoo"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 // downloadRecordingCmd represents the get-recording command
@@ -15,7 +23,8 @@ var downloadRecordingCmd = &cobra.Command{
 	Aliases: []string{"get-recording"},
 	Short:   "Download a recording to a local file",
 	Long: `Downloads audio and video streams of a recording to a local file.
-This requires [1mffmpeg[0m and [1mffprobe[0m to be in the PATH.`,
+This requires [1mffmpeg[0m and [1mffprobe[0m, which are looked up in the PATH
+unless their paths are set with --ffmpeg and --ffprobe or in the config file.`,
 
 	SilenceErrors: false,
 	RunE:          runDownloadRecordingCmd,
@@ -24,13 +33,26 @@ This requires [1mffmpeg[0m and [1mffprobe[0m to be in the PATH.`,
 func init() {
 	addEmailAndDomainFlags(downloadRecordingCmd)
 	addDownloadFlags(downloadRecordingCmd)
+	addConfigFlag(downloadRecordingCmd)
+	addBinaryFlags(downloadRecordingCmd)
 	rootCmd.AddCommand(downloadRecordingCmd)
 
-	downloadRecordingCmd.Flags().StringP("out", "o", "", "Name of the output file")
+	downloadRecordingCmd.Flags().StringP("out", "o", "",
+		"Name of the output file, or - to stream Matroska (or MPEG-TS with --container ts) to stdout")
 	downloadRecordingCmd.MarkFlagRequired("out")
 
-	downloadRecordingCmd.Flags().Int64P("rid", "r", -1, "ID of the recording to get")
+	downloadRecordingCmd.Flags().Int64SliceP("rid", "r", nil,
+		"ID of the recording to get; repeat with --join to join several recordings")
 	downloadRecordingCmd.MarkFlagRequired("rid")
+	downloadRecordingCmd.Flags().Bool(string(Join), false,
+		"Join the recordings into one output, in the order of the --rid flags? Streams are selected on the first recording.")
+	downloadRecordingCmd.Flags().Bool(string(TrimOverlap), false,
+		"Trim the start of joined recordings which overlaps with the end of the previous recording?")
+
+	downloadRecordingCmd.Flags().Bool(string(AudioOnly), false,
+		"Only download the audio, e.g. for concerts and radio shows? Writes .mka if the output has no extension; use .mp3 or .opus to transcode.")
+	downloadRecordingCmd.Flags().IntSlice(string(Streams), nil,
+		"Indices of the streams to download, e.g. 0,2,5. Selects streams without prompting, also when stdin is not a terminal.")
 }
 
 func runDownloadRecordingCmd(cmd *cobra.Command, args []string) error {
@@ -38,18 +60,89 @@ func runDownloadRecordingCmd(cmd *cobra.Command, args []string) error {
 	if nil != err {
 		return err
 	}
-	recordingId, err := cmd.Flags().GetInt64("rid")
+	recordingIds, err := cmd.Flags().GetInt64Slice("rid")
 	if nil != err {
 		return err
 	}
+	join, _ := cmd.Flags().GetBool(string(Join))
+	trimOverlap, _ := cmd.Flags().GetBool(string(TrimOverlap))
+	if len(recordingIds) > 1 && !join {
+		return errors.New("use '--join' to join several recordings into one output")
+	}
+	var pipe io.Writer
+	messages := cmd.OutOrStdout()
+	if out == ffmpeg.StdoutPath {
+		if f, ok := cmd.OutOrStdout().(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+			return errors.New("stdout is a terminal - redirect it to a file or pipe to stream the recording")
+		}
+		// Keep all human-readable output out of the streamed recording.
+		pipe = cmd.OutOrStdout()
+		messages = cmd.ErrOrStderr()
+	}
 
 	email := cmd.Flag(string(Email)).Value.String()
 	domain := cmd.Flag(string(Domain)).Value.String()
 	overwrite, _ := cmd.Flags().GetBool(string(Overwrite))
 	selectStreams, _ := cmd.Flags().GetBool(string(SelectStreams))
+	audioOnly, _ := cmd.Flags().GetBool(string(AudioOnly))
+	container, err := getContainer(cmd)
+	if nil != err {
+		return err
+	}
+	if audioOnly && container == "" && filepath.Ext(out) == "" {
+		container = ffmpeg.ContainerMatroskaAudio
+	}
+	cfg, err := loadConfig(cmd)
+	if nil != err {
+		return err
+	}
+	profile, err := getTranscodingProfile(cmd, cfg)
+	if nil != err {
+		return err
+	}
+	subtitleOpts, err := getSubtitleOptions(cmd)
+	if nil != err {
+		return err
+	}
+	selector, err := getStreamsSelector(cmd, cfg, messages)
+	if nil != err {
+		return err
+	}
+	storageOpts, err := getStorageOptions(cmd, filepath.Dir(out), messages)
+	if nil != err {
+		return err
+	}
+	rateLimit, err := getRateLimit(cmd, cfg)
+	if nil != err {
+		return err
+	}
+	splitOpts, err := getSplitOptions(cmd)
+	if nil != err {
+		return err
+	}
+
+	outputContainer := container
+	if outputContainer == "" {
+		outputContainer = ffmpeg.ContainerFromPath(out)
+	}
+	if outputContainer == "" && nil != pipe {
+		outputContainer = ffmpeg.ContainerMatroska
+	}
+	usage := getFeatureUsage(cmd)
+	usage.Join = join
+	usage.RateLimit = !rateLimit.IsZero()
+	if _, err := detectCapabilities(cmd, cfg, ffmpeg.RequiredFeatures(outputContainer, profile, usage), messages); nil != err {
+		return err
+	}
 
-	if selectStreams {
-		return errors.New("manual stream selection not supported for this command yet - use the 'interactive' command instead")
+	if cmd.Flags().Changed(string(Streams)) {
+		indices, _ := cmd.Flags().GetIntSlice(string(Streams))
+		selector = ffmpeg.NewIndexStreamsSelector(indices...)
+	} else if selectStreams {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return errors.New("stdin is not a terminal - use '--streams' to select streams by index instead")
+		}
+		selector = newTerminalStreamsSelector(os.Stdin, messages, selector)
 	}
 
 	acct := zattoo.NewAccount(email, domain)
@@ -57,19 +150,171 @@ func runDownloadRecordingCmd(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	recordingId := recordingIds[0]
 	url, err := acct.GetRecordingStreamUrl(recordingId)
 	if nil != err {
 		return err
 	}
 
-	d := ffmpeg.NewDownloadable(url, out,
-		ffmpeg.WithOverwrite(overwrite))
+	opts := []ffmpeg.DownloadableOption{
+		ffmpeg.WithOverwrite(overwrite),
+		ffmpeg.WithContainer(container),
+		ffmpeg.WithPostProcessors(getPostProcessors(cmd)...),
+		ffmpeg.WithMessages(messages),
+	}
+	opts = append(opts, subtitleOpts...)
+	opts = append(opts, getProbeOptions(cmd)...)
+	opts = append(opts, storageOpts...)
+	opts = append(opts, splitOpts...)
+	if nil != pipe {
+		opts = append(opts, ffmpeg.WithPipe(pipe))
+	}
+	hook := getPostHook(cmd)
+	if nil != hook {
+		hook.Env = append(hook.Env, "ZTDL_RECORDING_ID="+joinIds(recordingIds))
+		opts = append(opts, ffmpeg.WithPostHook(*hook))
+	}
+	if nil != profile {
+		opts = append(opts, ffmpeg.WithTranscodingProfile(*profile))
+	}
+	if !rateLimit.IsZero() {
+		opts = append(opts, ffmpeg.WithRateLimiter(ratelimit.NewLimiter(rateLimit)))
+	}
+	opts = append(opts, getMetadataOptions(acct, recordingId, audioOnly, nil != hook, messages)...)
+	var d ffmpeg.Downloadable
+	if join {
+		inputs, err := getJoinInputs(acct, recordingIds, url, trimOverlap)
+		if nil != err {
+			return err
+		}
+		d = ffmpeg.NewJoinedDownloadable(inputs, out, opts...)
+	} else {
+		d = ffmpeg.NewDownloadable(streamUrl(acct, recordingId, url), out, opts...)
+	}
 
-	fmt.Println("Detecting streams ...")
+	fmt.Fprintln(messages, "Detecting streams ...")
 	if err := d.DetectStreams(cmd.Context()); nil != err {
 		return err
 	}
 
-	fmt.Println("Starting download ...")
-	return d.Download(cmd.Context(), ffmpeg.NewBestStreamsSelector(), nil)
+	if audioOnly {
+		selector = ffmpeg.NewAudioOnlyStreamsSelector(selector)
+	}
+
+	fmt.Fprintln(messages, "Starting download ...")
+	err = d.Download(cmd.Context(), selector, nil)
+	printDownloadError(err)
+	return err
+}
+
+// getMetadataOptions returns the options to pass the program metadata of the
+// recording to the post-download hook, if any, and to write it and the cover
+// art to the output of audio-only downloads. Metadata is best-effort, so
+// failures to get the recording details are only reported to out.
+func getMetadataOptions(
+	acct *zattoo.Account,
+	recordingId int64,
+	audioOnly bool,
+	hook bool,
+	out io.Writer,
+) []ffmpeg.DownloadableOption {
+	if !audioOnly && !hook {
+		return nil
+	}
+	details, err := acct.GetRecordingDetails(recordingId)
+	if nil != err {
+		fmt.Fprintf(out, "Failed to get recording details, not writing metadata: %v\n", err)
+		return nil
+	}
+	metadata := ffmpeg.Metadata{
+		Title:        details.Title,
+		EpisodeTitle: details.EpisodeTitle,
+		Channel:      details.Channel,
+		Description:  details.Description,
+		Year:         details.Year,
+	}
+	opts := []ffmpeg.DownloadableOption{}
+	if hook {
+		opts = append(opts, ffmpeg.WithHookMetadata(metadata))
+	}
+	if audioOnly {
+		opts = append(opts, ffmpeg.WithMetadata(metadata))
+		if details.ImageUrl != "" {
+			opts = append(opts, ffmpeg.WithCoverArt(details.ImageUrl))
+		}
+	}
+	return opts
+}
+
+// getJoinInputs returns the inputs to join the given recordings, the first of
+// which has the given stream URL. With trimOverlap, the start of recordings
+// which overlaps with the previous recording is trimmed.
+func getJoinInputs(
+	acct *zattoo.Account,
+	recordingIds []int64,
+	firstUrl string,
+	trimOverlap bool,
+) ([]ffmpeg.JoinInput, error) {
+	inputs := []ffmpeg.JoinInput{{Url: streamUrl(acct, recordingIds[0], firstUrl)}}
+	for _, id := range recordingIds[1:] {
+		url, err := acct.GetRecordingStreamUrl(id)
+		if nil != err {
+			return nil, err
+		}
+		inputs = append(inputs, ffmpeg.JoinInput{Url: streamUrl(acct, id, url)})
+	}
+	if !trimOverlap {
+		return inputs, nil
+	}
+
+	previous, err := acct.GetRecordingDetails(recordingIds[0])
+	if nil != err {
+		return nil, fmt.Errorf("failed to get details to trim overlap: %w", err)
+	}
+	for i, id := range recordingIds[1:] {
+		details, err := acct.GetRecordingDetails(id)
+		if nil != err {
+			return nil, fmt.Errorf("failed to get details to trim overlap: %w", err)
+		}
+		inputs[i+1].Trim = details.Overlap(previous)
+		previous = details
+	}
+	return inputs, nil
+}
+
+// streamUrl returns the provider of the stream URL of the recording, which
+// provides the given URL first and gets a fresh URL when it expired.
+func streamUrl(acct *zattoo.Account, recordingId int64, url string) ffmpeg.UrlProvider {
+	return ffmpeg.RefreshableUrl(url, func(ctx context.Context) (string, error) {
+		return acct.GetRecordingStreamUrl(recordingId)
+	})
+}
+
+// joinIds returns the given recording IDs separated by commas.
+func joinIds(ids []int64) string {
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(strs, ",")
+}
+
+// printDownloadError prints the last lines logged by ffmpeg and a hint on how
+// to deal with the failure to stderr when ffmpeg failed.
+func printDownloadError(err error) {
+	var downloadErr *ffmpeg.DownloadError
+	if !errors.As(err, &downloadErr) {
+		return
+	}
+
+	fmt.Fprintln(os.Stderr)
+	if len(downloadErr.LogTail) > 0 {
+		fmt.Fprintln(os.Stderr, "Last lines logged by ffmpeg:")
+		for _, line := range downloadErr.LogTail {
+			fmt.Fprintf(os.Stderr, "    %s\n", line)
+		}
+	}
+	if hint := downloadErr.Class.Hint(); hint != "" {
+		fmt.Fprintln(os.Stderr, hint)
+	}
 }
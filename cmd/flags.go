@@ -1,6 +1,13 @@
 package cmd
 
 import (
+	"fmt"
+	"io"
+
+	"github.com/rokeller/zt-dl/config"
+	"github.com/rokeller/zt-dl/ffmpeg"
+	"github.com/rokeller/zt-dl/ratelimit"
+	"github.com/rokeller/zt-dl/relay"
 	"github.com/spf13/cobra"
 )
 
@@ -11,6 +18,42 @@ const (
 	Domain        = Flag("domain")
 	Overwrite     = Flag("overwrite")
 	SelectStreams = Flag("select-streams")
+	Chapters      = Flag("chapters")
+	Edl           = Flag("edl")
+	Container     = Flag("container")
+	Profile       = Flag("profile")
+	ConfigFile    = Flag("config")
+	Subtitles     = Flag("subtitles")
+	SubtitleFmt   = Flag("subtitle-format")
+	SubtitlesOnly = Flag("subtitles-only")
+	AudioOnly     = Flag("audio-only")
+	Exclude       = Flag("exclude")
+	AudioLang     = Flag("audio-lang")
+	KeepOriginal  = Flag("keep-original")
+	SubtitleLang  = Flag("subtitle-lang")
+	AudioCodecs   = Flag("prefer-audio-codec")
+	VideoCodecs   = Flag("prefer-video-codec")
+	MaxHeight     = Flag("max-height")
+	MaxBitRate    = Flag("max-bitrate")
+	Streams       = Flag("streams")
+	Output        = Flag("output")
+	FullProbe     = Flag("full-probe")
+	StagingDir    = Flag("staging-dir")
+	WarnLowSpace  = Flag("warn-low-space")
+	PostHook      = Flag("post-hook")
+	HookTimeout   = Flag("post-hook-timeout")
+	HookOnFailure = Flag("post-hook-on-failure")
+	LimitRate     = Flag("limit-rate")
+	LimitSchedule = Flag("limit-schedule")
+	SplitDuration = Flag("split-duration")
+	SplitSize     = Flag("split-size")
+	Join          = Flag("join")
+	TrimOverlap   = Flag("trim-overlap")
+	ContactSheet  = Flag("contact-sheet")
+	SheetFrames   = Flag("contact-sheet-frames")
+	FfmpegPath    = Flag("ffmpeg")
+	FfprobePath   = Flag("ffprobe")
+	PlayerCommand = Flag("player")
 )
 
 func addEmailAndDomainFlags(cmd *cobra.Command) {
@@ -23,4 +66,325 @@ func addEmailAndDomainFlags(cmd *cobra.Command) {
 func addDownloadFlags(cmd *cobra.Command) {
 	cmd.Flags().BoolP(string(Overwrite), "y", false, "Overwrite existing files?")
 	cmd.Flags().BoolP(string(SelectStreams), "s", false, "Select streams to download manually?")
+	cmd.Flags().Bool(string(Chapters), false,
+		"Detect breaks using black frames and silence, and embed chapter markers?")
+	cmd.Flags().Bool(string(Edl), false,
+		"Write detected breaks to an EDL (Comskip-compatible) sidecar file? Implies --chapters.")
+	cmd.Flags().Bool(string(ContactSheet), false,
+		"Write a contact sheet JPEG with frames evenly spaced across the output next to it?")
+	cmd.Flags().Int(string(SheetFrames), 16,
+		"Number of frames on the contact sheet, in rows of 4.")
+	cmd.Flags().String(string(Container), "",
+		"The container format of the output (mkv, mka, mp4, ts, m4a, mp3, opus). Derived from the file extension if not set.")
+	cmd.Flags().String(string(Profile), "",
+		"Name of the transcoding profile to use, e.g. hevc-archive, stereo-aac, mobile-720p, or one from the config file. Streams are copied if not set.")
+	cmd.Flags().String(string(Subtitles), string(ffmpeg.SubtitlesEmbed),
+		"How to write subtitles: embed them in the output, write them to sidecar files, or both.")
+	cmd.Flags().String(string(SubtitleFmt), "",
+		"Format of subtitle sidecar files (srt, vtt). Keeps WebVTT and converts others to SRT if not set.")
+	cmd.Flags().Bool(string(SubtitlesOnly), false,
+		"Only write the selected subtitles to sidecar files, without audio and video?")
+	cmd.Flags().String(string(StagingDir), "",
+		"The directory to write downloads to until they are complete, e.g. on a fast local disk. Next to the output if not set.")
+	cmd.Flags().Bool(string(WarnLowSpace), false,
+		"Only warn instead of refusing to download when the estimated size exceeds the free disk space?")
+	cmd.Flags().String(string(PostHook), "",
+		"A command to run after each download, e.g. to move the output or notify a media server. Details are passed in ZTDL_* environment variables.")
+	cmd.Flags().Duration(string(HookTimeout), ffmpeg.DefaultHookTimeout,
+		"How long the post-download hook may run before it gets killed.")
+	cmd.Flags().Bool(string(HookOnFailure), false,
+		"Also run the post-download hook after failed downloads?")
+	cmd.Flags().String(string(LimitRate), "",
+		"Limit the download rate in bytes per second, e.g. 500k or 2M. Unlimited if not set.")
+	cmd.Flags().StringSlice(string(LimitSchedule), nil,
+		"Limit the download rate by time of day, e.g. 18:00-23:00=2M. Overrides --limit-rate at those times.")
+	cmd.Flags().Duration(string(SplitDuration), 0,
+		"Split the output into parts of at most this duration, e.g. 1h. Parts are named like <base>.part01.mkv.")
+	cmd.Flags().String(string(SplitSize), "",
+		"Split the output into parts of about this size at most, e.g. 4G for FAT32, based on the estimated size. Parts are named like <base>.part01.mkv.")
+	addSelectionFlags(cmd)
+	addProbeFlags(cmd)
+}
+
+// getSplitOptions returns the options to split the output into parts.
+func getSplitOptions(cmd *cobra.Command) ([]ffmpeg.DownloadableOption, error) {
+	var split ffmpeg.Split
+	split.Duration, _ = cmd.Flags().GetDuration(string(SplitDuration))
+	if value, _ := cmd.Flags().GetString(string(SplitSize)); value != "" {
+		size, err := ffmpeg.ParseSize(value)
+		if nil != err {
+			return nil, err
+		}
+		split.Size = size
+	}
+	return []ffmpeg.DownloadableOption{ffmpeg.WithSplit(split)}, nil
+}
+
+// getFeatureUsage returns which of the optional ffmpeg features the flags
+// ask for. Joins and rate limits depend on the command and are left to it.
+func getFeatureUsage(cmd *cobra.Command) ffmpeg.FeatureUsage {
+	splitDuration, _ := cmd.Flags().GetDuration(string(SplitDuration))
+	splitSize, _ := cmd.Flags().GetString(string(SplitSize))
+	contactSheet, _ := cmd.Flags().GetBool(string(ContactSheet))
+	chapters, _ := cmd.Flags().GetBool(string(Chapters))
+	edl, _ := cmd.Flags().GetBool(string(Edl))
+	return ffmpeg.FeatureUsage{
+		Split:        splitDuration > 0 || splitSize != "",
+		ContactSheet: contactSheet,
+		Chapters:     chapters || edl,
+	}
+}
+
+// getRateLimit returns the schedule of rate limits from the config file,
+// overridden by flags.
+func getRateLimit(cmd *cobra.Command, cfg config.Config) (ratelimit.Schedule, error) {
+	schedule := cfg.RateLimit
+	flags := cmd.Flags()
+	if flags.Changed(string(LimitRate)) {
+		value, _ := flags.GetString(string(LimitRate))
+		limit, err := ratelimit.ParseRate(value)
+		if nil != err {
+			return schedule, err
+		}
+		schedule.Limit = limit
+	}
+	if flags.Changed(string(LimitSchedule)) {
+		values, _ := flags.GetStringSlice(string(LimitSchedule))
+		schedule.Rules = nil
+		for _, value := range values {
+			rule, err := ratelimit.ParseRule(value)
+			if nil != err {
+				return schedule, err
+			}
+			schedule.Rules = append(schedule.Rules, rule)
+		}
+	}
+	return schedule, nil
+}
+
+// getPostHook returns the post-download hook set with the flags, or nil.
+func getPostHook(cmd *cobra.Command) *ffmpeg.PostHook {
+	command, _ := cmd.Flags().GetString(string(PostHook))
+	if command == "" {
+		return nil
+	}
+	timeout, _ := cmd.Flags().GetDuration(string(HookTimeout))
+	onFailure, _ := cmd.Flags().GetBool(string(HookOnFailure))
+	return &ffmpeg.PostHook{
+		Command:   command,
+		Timeout:   timeout,
+		OnFailure: onFailure,
+	}
+}
+
+// addProbeFlags adds the flags for detecting the streams of recordings.
+func addProbeFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool(string(FullProbe), false,
+		"Always detect streams with ffprobe instead of from the HLS master playlist? Slower, but more detailed.")
+}
+
+func getProbeOptions(cmd *cobra.Command) []ffmpeg.DownloadableOption {
+	fullProbe, _ := cmd.Flags().GetBool(string(FullProbe))
+	return []ffmpeg.DownloadableOption{ffmpeg.WithFullProbe(fullProbe)}
+}
+
+// getStorageOptions returns the options for staging downloads and checking
+// the free disk space, after removing files left behind by earlier downloads
+// that did not finish in the staging directory and the given output directory.
+// Removed files are reported to out.
+func getStorageOptions(cmd *cobra.Command, outdir string, out io.Writer) ([]ffmpeg.DownloadableOption, error) {
+	stagingDir, _ := cmd.Flags().GetString(string(StagingDir))
+	warnLowSpace, _ := cmd.Flags().GetBool(string(WarnLowSpace))
+	for _, dir := range []string{stagingDir, outdir} {
+		if dir == "" {
+			continue
+		}
+		if err := ffmpeg.SweepStaging(dir, out); nil != err {
+			return nil, err
+		}
+	}
+	return []ffmpeg.DownloadableOption{
+		ffmpeg.WithStagingDir(stagingDir),
+		ffmpeg.WithWarnOnLowSpace(warnLowSpace),
+	}, nil
+}
+
+// addSelectionFlags adds the flags for the rules of the automatic selection of
+// streams.
+func addSelectionFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSlice(string(Exclude), nil,
+		"Kinds of streams to never select automatically (audio-description, hearing-impaired/sdh, forced, commentary).")
+	cmd.Flags().StringSlice(string(AudioLang), nil,
+		"Preferred audio languages in order, e.g. de,en. Selects the audio of the first language available.")
+	cmd.Flags().Bool(string(KeepOriginal), false,
+		"Also select the original language audio, if available?")
+	cmd.Flags().StringSlice(string(SubtitleLang), nil,
+		"Languages of subtitles to select, e.g. de, or none. Selects all subtitles if not set.")
+	cmd.Flags().StringSlice(string(AudioCodecs), nil,
+		"Preferred audio codecs in order, e.g. aac,ac3.")
+	cmd.Flags().StringSlice(string(VideoCodecs), nil,
+		"Preferred video codecs in order, e.g. hevc,h264.")
+	cmd.Flags().Int(string(MaxHeight), 0,
+		"Select the best video stream up to this height, e.g. 720.")
+	cmd.Flags().String(string(MaxBitRate), "",
+		"Select the best video stream up to this bit rate, e.g. 5M or 2500k.")
+}
+
+func addConfigFlag(cmd *cobra.Command) {
+	cmd.Flags().String(string(ConfigFile), config.DefaultPath(), "Path to the configuration file.")
+}
+
+// addBinaryFlags adds the flags for the paths of the ffmpeg and ffprobe
+// executables.
+func addBinaryFlags(cmd *cobra.Command) {
+	cmd.Flags().String(string(FfmpegPath), "",
+		"Path to the ffmpeg executable. Looked up in the PATH if not set in the flag or the config file.")
+	cmd.Flags().String(string(FfprobePath), "",
+		"Path to the ffprobe executable. Looked up in the PATH if not set in the flag or the config file.")
+}
+
+// setBinaries sets the paths of the ffmpeg and ffprobe executables from the
+// config file, overridden by flags.
+func setBinaries(cmd *cobra.Command, cfg config.Config) {
+	ffmpegPath, ffprobePath := cfg.Ffmpeg, cfg.Ffprobe
+	if cmd.Flags().Changed(string(FfmpegPath)) {
+		ffmpegPath, _ = cmd.Flags().GetString(string(FfmpegPath))
+	}
+	if cmd.Flags().Changed(string(FfprobePath)) {
+		ffprobePath, _ = cmd.Flags().GetString(string(FfprobePath))
+	}
+	ffmpeg.SetBinaries(ffmpegPath, ffprobePath)
+}
+
+// detectCapabilities sets the paths of the ffmpeg and ffprobe executables,
+// detects their capabilities and verifies that they support the given
+// features. The versions and any warnings are written to out.
+func detectCapabilities(
+	cmd *cobra.Command,
+	cfg config.Config,
+	features []ffmpeg.Feature,
+	out io.Writer,
+) (ffmpeg.Capabilities, error) {
+	setBinaries(cmd, cfg)
+	caps, err := ffmpeg.DetectCapabilities(cmd.Context())
+	if nil != err {
+		return caps, fmt.Errorf("%w - install ffmpeg or set the paths of ffmpeg and ffprobe with --%s and --%s or in the config file",
+			err, FfmpegPath, FfprobePath)
+	}
+	fmt.Fprintf(out, "Using ffmpeg %s and ffprobe %s.\n", caps.FfmpegVersion, caps.FfprobeVersion)
+	for _, warning := range caps.Warnings {
+		fmt.Fprintf(out, "WARN: %s.\n", warning)
+	}
+	return caps, caps.Check(features)
+}
+
+func addPlayerFlag(cmd *cobra.Command) {
+	cmd.Flags().String(string(PlayerCommand), "",
+		"The external player to play recordings with, e.g. mpv or vlc. Overrides the player from the config file.")
+}
+
+// getPlayer returns the external player from the config file, overridden by
+// flags.
+func getPlayer(cmd *cobra.Command, cfg config.Config) relay.Player {
+	if command, _ := cmd.Flags().GetString(string(PlayerCommand)); command != "" {
+		return relay.Player{Command: command}
+	}
+	return cfg.Player
+}
+
+func loadConfig(cmd *cobra.Command) (config.Config, error) {
+	path, _ := cmd.Flags().GetString(string(ConfigFile))
+	return config.Load(path)
+}
+
+func getContainer(cmd *cobra.Command) (ffmpeg.Container, error) {
+	name, _ := cmd.Flags().GetString(string(Container))
+	if name == "" {
+		return "", nil
+	}
+	return ffmpeg.ParseContainer(name)
+}
+
+func getSubtitleOptions(cmd *cobra.Command) ([]ffmpeg.DownloadableOption, error) {
+	modeName, _ := cmd.Flags().GetString(string(Subtitles))
+	mode, err := ffmpeg.ParseSubtitleMode(modeName)
+	if nil != err {
+		return nil, err
+	}
+	subtitlesOnly, _ := cmd.Flags().GetBool(string(SubtitlesOnly))
+	opts := []ffmpeg.DownloadableOption{
+		ffmpeg.WithSubtitleMode(mode),
+		ffmpeg.WithSubtitlesOnly(subtitlesOnly),
+	}
+
+	if formatName, _ := cmd.Flags().GetString(string(SubtitleFmt)); formatName != "" {
+		format, err := ffmpeg.ParseSubtitleFormat(formatName)
+		if nil != err {
+			return nil, err
+		}
+		opts = append(opts, ffmpeg.WithSubtitleFormat(format))
+	}
+
+	return opts, nil
+}
+
+func getTranscodingProfile(cmd *cobra.Command, cfg config.Config) (*ffmpeg.TranscodingProfile, error) {
+	name, _ := cmd.Flags().GetString(string(Profile))
+	if name == "" {
+		return nil, nil
+	}
+	profile, err := cfg.Profile(name)
+	if nil != err {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func getPostProcessors(cmd *cobra.Command) []ffmpeg.PostProcessor {
+	pp := []ffmpeg.PostProcessor{}
+
+	chapters, _ := cmd.Flags().GetBool(string(Chapters))
+	edl, _ := cmd.Flags().GetBool(string(Edl))
+	if chapters || edl {
+		pp = append(pp, ffmpeg.NewChapterDetector(ffmpeg.WithEdlSidecar(edl)))
+	}
+	if contactSheet, _ := cmd.Flags().GetBool(string(ContactSheet)); contactSheet {
+		frames, _ := cmd.Flags().GetInt(string(SheetFrames))
+		pp = append(pp, ffmpeg.NewContactSheetGenerator(ffmpeg.WithContactSheetFrames(frames)))
+	}
+
+	return pp
+}
+
+// getStreamsSelector returns the selector for the automatic selection of
+// streams, using the selection rules from the config file overridden by flags.
+// The scores of the selected streams are explained to out.
+func getStreamsSelector(cmd *cobra.Command, cfg config.Config, out io.Writer) (ffmpeg.StreamsSelector, error) {
+	rules := cfg.Selection
+	flags := cmd.Flags()
+	if flags.Changed(string(AudioLang)) {
+		rules.AudioLanguages, _ = flags.GetStringSlice(string(AudioLang))
+	}
+	if flags.Changed(string(KeepOriginal)) {
+		rules.KeepOriginal, _ = flags.GetBool(string(KeepOriginal))
+	}
+	if flags.Changed(string(SubtitleLang)) {
+		rules.SubtitleLanguages, _ = flags.GetStringSlice(string(SubtitleLang))
+	}
+	if flags.Changed(string(AudioCodecs)) {
+		rules.AudioCodecs, _ = flags.GetStringSlice(string(AudioCodecs))
+	}
+	if flags.Changed(string(VideoCodecs)) {
+		rules.VideoCodecs, _ = flags.GetStringSlice(string(VideoCodecs))
+	}
+	if flags.Changed(string(Exclude)) {
+		rules.Exclude, _ = flags.GetStringSlice(string(Exclude))
+	}
+	if flags.Changed(string(MaxHeight)) {
+		rules.MaxHeight, _ = flags.GetInt(string(MaxHeight))
+	}
+	if flags.Changed(string(MaxBitRate)) {
+		rules.MaxBitRate, _ = flags.GetString(string(MaxBitRate))
+	}
+	return ffmpeg.NewRuleBasedStreamsSelector(rules, out)
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/rokeller/zt-dl/ffmpeg"
 	"github.com/rokeller/zt-dl/server"
 	"github.com/rokeller/zt-dl/zattoo"
 	"github.com/spf13/cobra"
@@ -21,7 +22,8 @@ var interactiveCmd = &cobra.Command{
 	Short: "Run web interface for Zattoo recording download",
 	Long: `Runs a local web server that lets you interact with zt-dl to examine and
 download recordings from your recording library. Initiating downloads from the
-web interface requires [1mffmpeg[0m and [1mffprobe[0m to be in the PATH.`,
+web interface requires [1mffmpeg[0m and [1mffprobe[0m, which are looked up in the PATH unless
+their paths are set with --ffmpeg and --ffprobe or in the config file.`,
 	RunE: runInteractiveCmd,
 }
 
@@ -38,19 +40,77 @@ func runInteractiveCmd(cmd *cobra.Command, args []string) error {
 	overwrite, _ := cmd.Flags().GetBool(string(Overwrite))
 	openUI, _ := cmd.Flags().GetBool(string(OpenWebUI))
 	selectStreams, _ := cmd.Flags().GetBool(string(SelectStreams))
+	container, err := getContainer(cmd)
+	if nil != err {
+		return err
+	}
+	cfg, err := loadConfig(cmd)
+	if nil != err {
+		return err
+	}
+	subtitleOpts, err := getSubtitleOptions(cmd)
+	if nil != err {
+		return err
+	}
+	selector, err := getStreamsSelector(cmd, cfg, cmd.OutOrStdout())
+	if nil != err {
+		return err
+	}
+	storageOpts, err := getStorageOptions(cmd, outdir, cmd.OutOrStdout())
+	if nil != err {
+		return err
+	}
+	rateLimit, err := getRateLimit(cmd, cfg)
+	if nil != err {
+		return err
+	}
+	splitOpts, err := getSplitOptions(cmd)
+	if nil != err {
+		return err
+	}
+	profile, _ := cmd.Flags().GetString(string(Profile))
+	var defaultProfile *ffmpeg.TranscodingProfile
+	if profile != "" {
+		p, err := cfg.Profile(profile)
+		if nil != err {
+			return err
+		}
+		defaultProfile = &p
+	}
+	// The server can join recordings.
+	usage := getFeatureUsage(cmd)
+	usage.Join = true
+	usage.RateLimit = !rateLimit.IsZero()
+	caps, err := detectCapabilities(cmd, cfg, ffmpeg.RequiredFeatures(container, defaultProfile, usage), cmd.OutOrStdout())
+	if nil != err {
+		return err
+	}
 
 	opts := []server.ServeOption{
 		server.WithZattooAccount(acct),
 		server.WithPort(port),
 		server.WithOutputDir(outdir),
 		server.WithOverwrite(overwrite),
+		server.WithContainer(container),
+		server.WithTranscodingProfiles(cfg.Profiles, profile),
+		server.WithDownloadableOptions(subtitleOpts...),
+		server.WithDownloadableOptions(getProbeOptions(cmd)...),
+		server.WithDownloadableOptions(storageOpts...),
+		server.WithDownloadableOptions(splitOpts...),
 		server.WithOpenWebUI(openUI),
-		server.WithBestStreamsSelection(),
+		server.WithStreamsSelector(selector),
+		server.WithPostProcessors(getPostProcessors(cmd)...),
+		server.WithRateLimit(rateLimit),
+		server.WithCapabilities(caps),
+		server.WithPlayer(getPlayer(cmd, cfg)),
 	}
 
 	if selectStreams {
 		opts = append(opts, server.WithInteractiveStreamsSelection())
 	}
+	if hook := getPostHook(cmd); nil != hook {
+		opts = append(opts, server.WithPostHook(*hook))
+	}
 
 	return server.Serve(cmd.Context(), opts...)
 }
@@ -58,6 +118,9 @@ func runInteractiveCmd(cmd *cobra.Command, args []string) error {
 func init() {
 	addEmailAndDomainFlags(interactiveCmd)
 	addDownloadFlags(interactiveCmd)
+	addConfigFlag(interactiveCmd)
+	addBinaryFlags(interactiveCmd)
+	addPlayerFlag(interactiveCmd)
 	rootCmd.AddCommand(interactiveCmd)
 
 	cwd, err := os.Getwd()
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rokeller/zt-dl/relay"
+	"github.com/rokeller/zt-dl/zattoo"
+	"github.com/spf13/cobra"
+)
+
+// playCmd represents the play command
+var playCmd = &cobra.Command{
+	Use:   "play",
+	Short: "Play a recording in an external player",
+	Long: `Relays the stream of a recording through a local HLS proxy, such that it
+can be watched in an external player like mpv or VLC, e.g. to check a recording
+before downloading it. The player is started with the URL of the proxy if one is
+set with --player or in the config file; otherwise the URL is printed and the
+proxy runs until interrupted.`,
+
+	SilenceErrors: false,
+	RunE:          runPlayCmd,
+}
+
+func init() {
+	addEmailAndDomainFlags(playCmd)
+	addConfigFlag(playCmd)
+	addPlayerFlag(playCmd)
+	rootCmd.AddCommand(playCmd)
+
+	playCmd.Flags().Int64P("rid", "r", -1, "ID of the recording to play")
+	playCmd.MarkFlagRequired("rid")
+
+	playCmd.Flags().Uint16P(string(Port), "p", 0,
+		"The local port to run the proxy on. A free port is picked if not set.")
+}
+
+func runPlayCmd(cmd *cobra.Command, args []string) error {
+	recordingId, err := cmd.Flags().GetInt64("rid")
+	if nil != err {
+		return err
+	}
+	port, _ := cmd.Flags().GetUint16(string(Port))
+
+	email := cmd.Flag(string(Email)).Value.String()
+	domain := cmd.Flag(string(Domain)).Value.String()
+	cfg, err := loadConfig(cmd)
+	if nil != err {
+		return err
+	}
+	player := getPlayer(cmd, cfg)
+
+	acct := zattoo.NewAccount(email, domain)
+	if err := acct.Login(); nil != err {
+		return err
+	}
+
+	streamUrl, err := acct.GetRecordingStreamUrl(recordingId)
+	if nil != err {
+		return err
+	}
+	rl, err := relay.New(acct.HttpClient(), "/play", streamUrl)
+	if nil != err {
+		return err
+	}
+
+	// Only listen on the loopback interface, the proxy uses the account's
+	// session.
+	l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port))))
+	if nil != err {
+		return fmt.Errorf("failed to listen for the proxy: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/play/", rl)
+	srv := &http.Server{Handler: mux}
+	go func() {
+		if err := srv.Serve(l); nil != err && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintf(cmd.ErrOrStderr(), "WARN: proxy failed: %v\n", err)
+		}
+	}()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+
+	url := "http://" + l.Addr().String() + rl.PlaylistPath()
+	if player.IsZero() {
+		fmt.Fprintf(cmd.OutOrStdout(), "Playing recording %d at %s\nPress Ctrl+C to stop.\n", recordingId, url)
+		<-cmd.Context().Done()
+		return nil
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Playing recording %d in %s ...\n", recordingId, player.Command)
+	playerCmd, err := player.Start(cmd.Context(), url)
+	if nil != err {
+		return err
+	}
+	if err := playerCmd.Wait(); nil != err && nil == cmd.Context().Err() {
+		return fmt.Errorf("player exited with error: %w", err)
+	}
+	return nil
+}
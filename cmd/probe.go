@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/rokeller/zt-dl/ffmpeg"
+	"github.com/rokeller/zt-dl/zattoo"
+	"github.com/spf13/cobra"
+)
+
+// probeCmd represents the probe command
+var probeCmd = &cobra.Command{
+	Use:   "probe",
+	Short: "Show the streams of a recording",
+	Long: `Detects the audio, video and subtitle streams of a recording and shows
+them along with the streams which would be selected for download.
+This requires [1mffprobe[0m, which is looked up in the PATH unless its path is
+set with --ffprobe or in the config file.`,
+
+	SilenceErrors: false,
+	RunE:          runProbeCmd,
+}
+
+type probeResult struct {
+	Duration string        `json:"duration"`
+	Streams  []probeStream `json:"streams"`
+	Warnings []string      `json:"warnings,omitempty"`
+	// EstimatedSize is the estimated size in bytes of a download of the
+	// selected streams, if it can be estimated.
+	EstimatedSize int64 `json:"estimatedSize,omitempty"`
+}
+
+type probeStream struct {
+	Index       int    `json:"index"`
+	Type        string `json:"type"`
+	Description string `json:"desc"`
+	Selected    bool   `json:"selected"`
+}
+
+func init() {
+	addEmailAndDomainFlags(probeCmd)
+	addSelectionFlags(probeCmd)
+	addProbeFlags(probeCmd)
+	addConfigFlag(probeCmd)
+	addBinaryFlags(probeCmd)
+	rootCmd.AddCommand(probeCmd)
+
+	probeCmd.Flags().Int64P("rid", "r", -1, "ID of the recording to probe")
+	probeCmd.MarkFlagRequired("rid")
+
+	probeCmd.Flags().String(string(Output), "table", "Output format (table, json).")
+}
+
+func runProbeCmd(cmd *cobra.Command, args []string) error {
+	recordingId, err := cmd.Flags().GetInt64("rid")
+	if nil != err {
+		return err
+	}
+	output, _ := cmd.Flags().GetString(string(Output))
+	if output != "table" && output != "json" {
+		return fmt.Errorf("unsupported output format %q", output)
+	}
+	out, messages := cmd.OutOrStdout(), cmd.OutOrStdout()
+	if output == "json" {
+		// Keep diagnostic output, e.g. from ranking streams, out of the JSON.
+		messages = cmd.ErrOrStderr()
+	}
+
+	email := cmd.Flag(string(Email)).Value.String()
+	domain := cmd.Flag(string(Domain)).Value.String()
+	cfg, err := loadConfig(cmd)
+	if nil != err {
+		return err
+	}
+	selector, err := getStreamsSelector(cmd, cfg, messages)
+	if nil != err {
+		return err
+	}
+	if _, err := detectCapabilities(cmd, cfg, ffmpeg.RequiredFeatures("", nil, ffmpeg.FeatureUsage{}), messages); nil != err {
+		return err
+	}
+
+	acct := zattoo.NewAccount(email, domain)
+	if err := acct.Login(); nil != err {
+		return err
+	}
+
+	url, err := acct.GetRecordingStreamUrl(recordingId)
+	if nil != err {
+		return err
+	}
+
+	opts := append(getProbeOptions(cmd), ffmpeg.WithMessages(messages))
+	d := ffmpeg.NewDownloadable(ffmpeg.StaticUrl(url), "", opts...)
+	if err := d.DetectStreams(cmd.Context()); nil != err {
+		return err
+	}
+
+	streams := d.Streams()
+	selected, err := selector.SelectStreams(streams)
+	if nil != err {
+		return fmt.Errorf("failed to select streams: %w", err)
+	}
+	res := probeResult{
+		Duration: d.Duration().String(),
+		Streams: ffmpeg.TransformStreams(streams, func(s ffmpeg.SourceStream) probeStream {
+			return probeStream{
+				Index:       s.Index(),
+				Type:        ffmpeg.StreamType(s),
+				Description: s.String(),
+				Selected:    slices.Contains(selected, s),
+			}
+		}),
+		Warnings:      d.Warnings(),
+		EstimatedSize: d.EstimateSize(selected),
+	}
+
+	if output == "json" {
+		j := json.NewEncoder(out)
+		j.SetIndent("", "  ")
+		return j.Encode(res)
+	}
+
+	fmt.Fprintf(out, "Duration: %s\n", res.Duration)
+	if res.EstimatedSize > 0 {
+		fmt.Fprintf(out, "Estimated size: %s\n", ffmpeg.FormatSize(res.EstimatedSize))
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SELECTED\tINDEX\tTYPE\tDESCRIPTION")
+	for _, s := range res.Streams {
+		mark := ""
+		if s.Selected {
+			mark = "*"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", mark, s.Index, s.Type, s.Description)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/rokeller/zt-dl/ffmpeg"
+	"golang.org/x/term"
+)
+
+type key int
+
+const (
+	keyOther key = iota
+	keyUp
+	keyDown
+	keyToggle
+	keyToggleAll
+	keyConfirm
+	keyCancel
+)
+
+type terminalStreamsSelector struct {
+	// in is where key presses are read from. Terminals are put in raw mode
+	// while selecting.
+	in  io.Reader
+	out io.Writer
+	// rows is the height of the terminal, if known, which limits the number
+	// of streams listed at once.
+	rows int
+
+	// preselector selects the streams which are preselected for the user.
+	preselector ffmpeg.StreamsSelector
+}
+
+// newTerminalStreamsSelector returns a StreamsSelector which lists the streams
+// on the terminal and lets the user toggle them using the keyboard.
+func newTerminalStreamsSelector(in io.Reader, out io.Writer, preselector ffmpeg.StreamsSelector) ffmpeg.StreamsSelector {
+	return terminalStreamsSelector{
+		in:          in,
+		out:         out,
+		preselector: preselector,
+	}
+}
+
+// SelectStreams implements [ffmpeg.StreamsSelector].
+func (s terminalStreamsSelector) SelectStreams(streams []ffmpeg.SourceStream) ([]ffmpeg.SourceStream, error) {
+	if len(streams) <= 0 {
+		return nil, errors.New("no streams available")
+	}
+
+	selected := make([]bool, len(streams))
+	if nil != s.preselector {
+		if preselected, err := s.preselector.SelectStreams(streams); nil == err {
+			for i, stream := range streams {
+				selected[i] = slices.Contains(preselected, stream)
+			}
+		}
+	}
+
+	if f, ok := s.in.(*os.File); ok {
+		fd := int(f.Fd())
+		state, err := term.MakeRaw(fd)
+		if nil != err {
+			return nil, fmt.Errorf("failed to set up terminal: %w", err)
+		}
+		defer term.Restore(fd, state)
+		if _, rows, err := term.GetSize(fd); nil == err {
+			s.rows = rows
+		}
+	}
+
+	r := bufio.NewReader(s.in)
+	cursor := 0
+	hint := ""
+	s.render(streams, selected, cursor, hint, false)
+	for {
+		k, err := readKey(r)
+		if nil != err {
+			return nil, fmt.Errorf("failed to read from terminal: %w", err)
+		}
+
+		hint = ""
+		switch k {
+		case keyUp:
+			cursor = (cursor + len(streams) - 1) % len(streams)
+		case keyDown:
+			cursor = (cursor + 1) % len(streams)
+		case keyToggle:
+			selected[cursor] = !selected[cursor]
+		case keyToggleAll:
+			all := !slices.Contains(selected, false)
+			for i := range selected {
+				selected[i] = !all
+			}
+		case keyConfirm:
+			if slices.Contains(selected, true) {
+				fmt.Fprint(s.out, "\r\n")
+				return ffmpeg.FilterStreams(streams, func(stream ffmpeg.SourceStream) bool {
+					return selected[slices.Index(streams, stream)]
+				}), nil
+			}
+			hint = "Select at least one stream."
+		case keyCancel:
+			fmt.Fprint(s.out, "\r\n")
+			return nil, errors.New("stream selection cancelled")
+		}
+		s.render(streams, selected, cursor, hint, true)
+	}
+}
+
+// visibleStreams returns the range of streams which are listed, such that the
+// list fits on the terminal along with the header and the hint, and such that
+// the stream at the cursor is listed.
+func (s terminalStreamsSelector) visibleStreams(count, cursor int) (first, last int) {
+	// The lines of the rendering must all stay on the screen to be redrawn,
+	// including the empty line after the hint.
+	visible := count
+	if s.rows > 0 {
+		visible = max(1, min(count, s.rows-3))
+	}
+	first = max(0, cursor-visible+1)
+	return first, first + visible
+}
+
+// render writes the list of streams with their selection state. Terminals are
+// in raw mode while rendering, so lines end in CRLF. When redrawing, the cursor
+// is first moved back up to the first line of the previous rendering.
+func (s terminalStreamsSelector) render(
+	streams []ffmpeg.SourceStream,
+	selected []bool,
+	cursor int,
+	hint string,
+	redraw bool,
+) {
+	first, last := s.visibleStreams(len(streams), cursor)
+	if redraw {
+		fmt.Fprintf(s.out, "\x1b[%dA", last-first+2)
+	}
+	fmt.Fprint(s.out, "\r\x1b[2KSelect streams: ↑/↓ move, space toggles, a toggles all, enter confirms, q/esc cancels")
+	if first > 0 || last < len(streams) {
+		fmt.Fprintf(s.out, " (%d-%d of %d)", first+1, last, len(streams))
+	}
+	fmt.Fprint(s.out, "\r\n")
+	for i := first; i < last; i++ {
+		stream := streams[i]
+		pointer, check := " ", " "
+		if i == cursor {
+			pointer = ">"
+		}
+		if selected[i] {
+			check = "x"
+		}
+		fmt.Fprintf(s.out, "\r\x1b[2K%s [%s] %d: %s\r\n", pointer, check, stream.Index(), stream)
+	}
+	fmt.Fprintf(s.out, "\r\x1b[2K%s\r\n", hint)
+}
+
+// readKey reads a single key press from the terminal, including the escape
+// sequences for the arrow keys. Terminals send escape sequences at once, so an
+// escape without anything buffered after it is the escape key itself.
+func readKey(r *bufio.Reader) (key, error) {
+	b, err := r.ReadByte()
+	if nil != err {
+		return keyOther, err
+	}
+
+	switch b {
+	case 'k':
+		return keyUp, nil
+	case 'j':
+		return keyDown, nil
+	case ' ', 'x':
+		return keyToggle, nil
+	case 'a':
+		return keyToggleAll, nil
+	case '\r', '\n':
+		return keyConfirm, nil
+	case 'q', 3 /* Ctrl+C */, 4 /* Ctrl+D */ :
+		return keyCancel, nil
+	case 0x1b:
+		if r.Buffered() <= 0 {
+			return keyCancel, nil
+		}
+		if next, err := r.ReadByte(); nil != err || (next != '[' && next != 'O') {
+			return keyOther, err
+		}
+		b, err = r.ReadByte()
+		if nil != err {
+			return keyOther, err
+		}
+		switch b {
+		case 'A':
+			return keyUp, nil
+		case 'B':
+			return keyDown, nil
+		}
+	}
+	return keyOther, nil
+}
@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rokeller/zt-dl/ffmpeg"
+)
+
+func Test_readKey(t *testing.T) {
+	tests := []struct {
+		name    string // description of this test case
+		input   string
+		want    key
+		wantErr error
+	}{
+		{name: "Up", input: "k", want: keyUp},
+		{name: "Down", input: "j", want: keyDown},
+		{name: "ArrowUp", input: "\x1b[A", want: keyUp},
+		{name: "ArrowDown", input: "\x1b[B", want: keyDown},
+		{name: "ArrowUpApplicationMode", input: "\x1bOA", want: keyUp},
+		{name: "ArrowRight", input: "\x1b[C", want: keyOther},
+		{name: "Escape", input: "\x1bx", want: keyOther},
+		{name: "LoneEscape", input: "\x1b", want: keyCancel},
+		{name: "Space", input: " ", want: keyToggle},
+		{name: "X", input: "x", want: keyToggle},
+		{name: "All", input: "a", want: keyToggleAll},
+		{name: "Enter", input: "\r", want: keyConfirm},
+		{name: "Newline", input: "\n", want: keyConfirm},
+		{name: "Q", input: "q", want: keyCancel},
+		{name: "CtrlC", input: "\x03", want: keyCancel},
+		{name: "CtrlD", input: "\x04", want: keyCancel},
+		{name: "Other", input: "z", want: keyOther},
+		{name: "Empty", input: "", want: keyOther, wantErr: io.EOF},
+		{name: "TruncatedEscape", input: "\x1b[", want: keyOther, wantErr: io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readKey(bufio.NewReader(bytes.NewBufferString(tt.input)))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("readKey() got error %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("readKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_terminalStreamsSelector_render(t *testing.T) {
+	de := &ffmpeg.SubtitleStream{Stream: ffmpeg.Stream{Index: 2, CodecName: "webvtt"}, Language: "de"}
+	en := &ffmpeg.SubtitleStream{Stream: ffmpeg.Stream{Index: 3, CodecName: "webvtt"}, Language: "en"}
+	streams := []ffmpeg.SourceStream{de, en}
+	header := "\r\x1b[2KSelect streams: ↑/↓ move, space toggles, a toggles all, enter confirms, q/esc cancels"
+
+	tests := []struct {
+		name     string // description of this test case
+		selected []bool
+		cursor   int
+		hint     string
+		redraw   bool
+		rows     int
+		want     string
+	}{
+		{
+			name:     "First",
+			selected: []bool{true, false},
+			want: header + "\r\n" +
+				"\r\x1b[2K> [x] 2: webvtt, language \"de\" (stream #2)\r\n" +
+				"\r\x1b[2K  [ ] 3: webvtt, language \"en\" (stream #3)\r\n" +
+				"\r\x1b[2K\r\n",
+		},
+		{
+			name:     "Redraw",
+			selected: []bool{false, true},
+			cursor:   1,
+			hint:     "Select at least one stream.",
+			redraw:   true,
+			want: "\x1b[4A" + header + "\r\n" +
+				"\r\x1b[2K  [ ] 2: webvtt, language \"de\" (stream #2)\r\n" +
+				"\r\x1b[2K> [x] 3: webvtt, language \"en\" (stream #3)\r\n" +
+				"\r\x1b[2KSelect at least one stream.\r\n",
+		},
+		{
+			name:     "LimitedToTerminal",
+			selected: []bool{false, true},
+			cursor:   1,
+			redraw:   true,
+			rows:     4,
+			want: "\x1b[3A" + header + " (2-2 of 2)\r\n" +
+				"\r\x1b[2K> [x] 3: webvtt, language \"en\" (stream #3)\r\n" +
+				"\r\x1b[2K\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			s := terminalStreamsSelector{out: out, rows: tt.rows}
+			s.render(streams, tt.selected, tt.cursor, tt.hint, tt.redraw)
+			if got := out.String(); got != tt.want {
+				t.Errorf("render() wrote %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_terminalStreamsSelector_visibleStreams(t *testing.T) {
+	tests := []struct {
+		name      string // description of this test case
+		rows      int
+		count     int
+		cursor    int
+		wantFirst int
+		wantLast  int
+	}{
+		{name: "UnknownHeight", count: 40, cursor: 39, wantFirst: 0, wantLast: 40},
+		{name: "Fits", rows: 24, count: 5, cursor: 4, wantFirst: 0, wantLast: 5},
+		{name: "CursorAtTop", rows: 13, count: 40, cursor: 0, wantFirst: 0, wantLast: 10},
+		{name: "CursorBelow", rows: 13, count: 40, cursor: 25, wantFirst: 16, wantLast: 26},
+		{name: "CursorAtBottom", rows: 13, count: 40, cursor: 39, wantFirst: 30, wantLast: 40},
+		{name: "TinyTerminal", rows: 2, count: 40, cursor: 3, wantFirst: 3, wantLast: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := terminalStreamsSelector{rows: tt.rows}
+			first, last := s.visibleStreams(tt.count, tt.cursor)
+			if first != tt.wantFirst || last != tt.wantLast {
+				t.Errorf("visibleStreams() = %d, %d, want %d, %d", first, last, tt.wantFirst, tt.wantLast)
+			}
+		})
+	}
+}
+
+func Test_terminalStreamsSelector_SelectStreams(t *testing.T) {
+	video := &ffmpeg.VideoStream{Stream: ffmpeg.Stream{Index: 0}, Width: 1280, Height: 720}
+	audio := &ffmpeg.AudioStream{Stream: ffmpeg.Stream{Index: 1}, SampleRate: 48000}
+	subtitle := &ffmpeg.SubtitleStream{Stream: ffmpeg.Stream{Index: 2}, Language: "de"}
+	all := []ffmpeg.SourceStream{video, audio, subtitle}
+
+	tests := []struct {
+		name        string // description of this test case
+		streams     []ffmpeg.SourceStream
+		preselector ffmpeg.StreamsSelector
+		input       string
+		want        []ffmpeg.SourceStream
+		wantErr     string
+		wantHint    bool
+	}{
+		{
+			name:        "Preselected",
+			streams:     all,
+			preselector: ffmpeg.NewIndexStreamsSelector(0, 1),
+			input:       "\r",
+			want:        []ffmpeg.SourceStream{video, audio},
+		},
+		{
+			name:    "ToggleWithCursor",
+			streams: all,
+			input:   " jj x\r",
+			want:    []ffmpeg.SourceStream{video},
+		},
+		{
+			name:    "CursorWraps",
+			streams: all,
+			input:   "\x1b[A \x1b[B\x1b[B \r",
+			want:    []ffmpeg.SourceStream{audio, subtitle},
+		},
+		{
+			name:        "ToggleAll",
+			streams:     all,
+			preselector: ffmpeg.NewIndexStreamsSelector(1),
+			input:       "a\r",
+			want:        all,
+		},
+		{
+			name:        "ToggleAllOff",
+			streams:     all,
+			preselector: ffmpeg.NewIndexStreamsSelector(0, 1, 2),
+			input:       "aj \r",
+			want:        []ffmpeg.SourceStream{audio},
+		},
+		{
+			name:     "ConfirmNeedsSelection",
+			streams:  all,
+			input:    "\r \r",
+			want:     []ffmpeg.SourceStream{video},
+			wantHint: true,
+		},
+		{
+			name:    "Cancel",
+			streams: all,
+			input:   " q",
+			wantErr: "stream selection cancelled",
+		},
+		{
+			name:    "CancelWithEscape",
+			streams: all,
+			input:   " \x1b",
+			wantErr: "stream selection cancelled",
+		},
+		{
+			name:    "InputClosed",
+			streams: all,
+			input:   " ",
+			wantErr: "failed to read from terminal: EOF",
+		},
+		{
+			name:    "NoStreams",
+			wantErr: "no streams available",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			s := newTerminalStreamsSelector(bytes.NewBufferString(tt.input), out, tt.preselector)
+			got, err := s.SelectStreams(tt.streams)
+			if tt.wantErr == "" && nil != err {
+				t.Errorf("SelectStreams() got error %v, want nil", err)
+			} else if tt.wantErr != "" && (nil == err || err.Error() != tt.wantErr) {
+				t.Errorf("SelectStreams() got error %v, want %q", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SelectStreams() = %v, want %v", got, tt.want)
+			}
+			if hint := strings.Contains(out.String(), "Select at least one stream."); hint != tt.wantHint {
+				t.Errorf("SelectStreams() wrote hint %v, want %v", hint, tt.wantHint)
+			}
+		})
+	}
+}
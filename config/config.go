@@ -0,0 +1,67 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/rokeller/zt-dl/ffmpeg"
+	"github.com/rokeller/zt-dl/ratelimit"
+	"github.com/rokeller/zt-dl/relay"
+)
+
+// Config holds the settings from the zt-dl configuration file.
+type Config struct {
+	// Profiles holds custom transcoding profiles by name.
+	Profiles map[string]ffmpeg.TranscodingProfile `json:"profiles,omitempty"`
+	// Selection holds the rules for the automatic selection of streams.
+	Selection ffmpeg.SelectionRules `json:"selection"`
+	// RateLimit holds the limits of the download rate by time of day.
+	RateLimit ratelimit.Schedule `json:"rateLimit"`
+	// Ffmpeg and Ffprobe hold the paths of the executables, which are looked
+	// up in the PATH if not set.
+	Ffmpeg  string `json:"ffmpeg,omitempty"`
+	Ffprobe string `json:"ffprobe,omitempty"`
+	// Player is the external player which plays relayed recordings, if any.
+	Player relay.Player `json:"player,omitempty"`
+}
+
+// DefaultPath returns the path of the configuration file in the user's
+// configuration directory.
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if nil != err {
+		return ""
+	}
+	return filepath.Join(dir, "zt-dl", "config.json")
+}
+
+// Load reads the configuration from the JSON file at the given path. A missing
+// file yields an empty configuration.
+func Load(path string) (Config, error) {
+	var c Config
+	if path == "" {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	} else if nil != err {
+		return c, fmt.Errorf("failed to read config file %q: %w", path, err)
+	}
+
+	if err := json.Unmarshal(data, &c); nil != err {
+		return c, fmt.Errorf("failed to parse config file %q: %w", path, err)
+	}
+	return c, nil
+}
+
+// Profile returns the transcoding profile with the given name from the custom
+// profiles in the configuration or the built-in profiles.
+func (c Config) Profile(name string) (ffmpeg.TranscodingProfile, error) {
+	return ffmpeg.LookupProfile(name, c.Profiles)
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rokeller/zt-dl/ffmpeg"
+	"github.com/rokeller/zt-dl/ratelimit"
+	"github.com/rokeller/zt-dl/relay"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content *string
+		want    Config
+		wantErr bool
+	}{
+		{
+			name: "MissingFile",
+			want: Config{},
+		},
+		{
+			name:    "MalformedFile",
+			content: ptr("{ not json"),
+			wantErr: true,
+		},
+		{
+			name: "Profiles",
+			content: ptr(`{
+				"profiles": {
+					"small": {
+						"video": { "codec": "libx265", "args": ["-crf", "28"] },
+						"audio": { "codec": "libopus", "bitrate": "96k", "channels": 2 }
+					},
+					"broadcast": {
+						"loudness": { "target": -24, "truePeak": -2 }
+					}
+				}
+			}`),
+			want: Config{
+				Profiles: map[string]ffmpeg.TranscodingProfile{
+					"small": {
+						Video: &ffmpeg.CodecSettings{Codec: "libx265", Args: []string{"-crf", "28"}},
+						Audio: &ffmpeg.CodecSettings{Codec: "libopus", Bitrate: "96k", Channels: 2},
+					},
+					"broadcast": {
+						Loudness: &ffmpeg.LoudnessSettings{Target: -24, TruePeak: -2},
+					},
+				},
+			},
+		},
+		{
+			name: "Selection",
+			content: ptr(`{
+				"selection": {
+					"audioLanguages": ["de", "en"],
+					"keepOriginal": true,
+					"subtitleLanguages": ["de"],
+					"audioCodecs": ["aac", "ac3"],
+					"exclude": ["audio-description"]
+				}
+			}`),
+			want: Config{
+				Selection: ffmpeg.SelectionRules{
+					AudioLanguages:    []string{"de", "en"},
+					KeepOriginal:      true,
+					SubtitleLanguages: []string{"de"},
+					AudioCodecs:       []string{"aac", "ac3"},
+					Exclude:           []string{"audio-description"},
+				},
+			},
+		},
+		{
+			name: "RateLimit",
+			content: ptr(`{
+				"rateLimit": {
+					"limit": "10M",
+					"rules": [ { "from": "18:00", "to": "23:00", "limit": "2M" } ]
+				}
+			}`),
+			want: Config{
+				RateLimit: ratelimit.Schedule{
+					Limit: 10 * 1024 * 1024,
+					Rules: []ratelimit.Rule{{From: 18 * 60, To: 23 * 60, Limit: 2 * 1024 * 1024}},
+				},
+			},
+		},
+		{
+			name:    "Binaries",
+			content: ptr(`{ "ffmpeg": "/opt/ffmpeg/bin/ffmpeg", "ffprobe": "/opt/ffmpeg/bin/ffprobe" }`),
+			want:    Config{Ffmpeg: "/opt/ffmpeg/bin/ffmpeg", Ffprobe: "/opt/ffmpeg/bin/ffprobe"},
+		},
+		{
+			name:    "Player",
+			content: ptr(`{ "player": { "command": "mpv", "args": ["--fs"] } }`),
+			want:    Config{Player: relay.Player{Command: "mpv", Args: []string{"--fs"}}},
+		},
+		{
+			name:    "InvalidRateLimit",
+			content: ptr(`{ "rateLimit": { "limit": "fast" } }`),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if nil != tt.content {
+				if err := os.WriteFile(path, []byte(*tt.content), 0o600); nil != err {
+					t.Fatalf("failed to write config file: %v", err)
+				}
+			}
+
+			got, gotErr := Load(path)
+			if (nil != gotErr) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", gotErr, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Load() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_Profile(t *testing.T) {
+	c := Config{
+		Profiles: map[string]ffmpeg.TranscodingProfile{
+			"stereo-aac": {Audio: &ffmpeg.CodecSettings{Codec: "libfdk_aac"}},
+		},
+	}
+
+	if p, err := c.Profile("stereo-aac"); nil != err || p.Audio.Codec != "libfdk_aac" {
+		t.Errorf("Profile() = %+v, %v; want custom profile to override built-in", p, err)
+	}
+	if p, err := c.Profile("hevc-archive"); nil != err || p.Video.Codec != "libx265" {
+		t.Errorf("Profile() = %+v, %v; want built-in profile", p, err)
+	}
+	if _, err := c.Profile("does-not-exist"); nil == err {
+		t.Error("Profile() succeeded unexpectedly for unknown profile")
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
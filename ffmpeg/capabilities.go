@@ -0,0 +1,303 @@
+package ffmpeg
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"slices"
+	"strings"
+
+	e "github.com/rokeller/zt-dl/exec"
+)
+
+var (
+	// ffmpegBinary and ffprobeBinary are the paths (or names to look up in the
+	// PATH) of the executables to run.
+	ffmpegBinary  = "ffmpeg"
+	ffprobeBinary = "ffprobe"
+)
+
+// SetBinaries sets the paths of the ffmpeg and ffprobe executables. An empty
+// path looks up the executable in the PATH.
+func SetBinaries(ffmpegPath, ffprobePath string) {
+	ffmpegBinary, ffprobeBinary = "ffmpeg", "ffprobe"
+	if ffmpegPath != "" {
+		ffmpegBinary = ffmpegPath
+	}
+	if ffprobePath != "" {
+		ffprobeBinary = ffprobePath
+	}
+}
+
+// Capabilities holds the versions of ffmpeg and ffprobe and the features
+// supported by ffmpeg.
+type Capabilities struct {
+	FfmpegPath     string `json:"ffmpegPath"`
+	FfmpegVersion  string `json:"ffmpegVersion"`
+	FfprobePath    string `json:"ffprobePath"`
+	FfprobeVersion string `json:"ffprobeVersion"`
+	// Protocols lists the supported input protocols.
+	Protocols []string `json:"protocols"`
+	Demuxers  []string `json:"demuxers"`
+	Muxers    []string `json:"muxers"`
+	Encoders  []string `json:"encoders"`
+	Filters   []string `json:"filters"`
+	// Warnings lists issues with the executables which don't prevent
+	// downloads, e.g. differing versions.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// FeatureKind is the kind of an ffmpeg feature.
+type FeatureKind string
+
+const (
+	FeatureProtocol = FeatureKind("protocol")
+	FeatureDemuxer  = FeatureKind("demuxer")
+	FeatureMuxer    = FeatureKind("muxer")
+	FeatureEncoder  = FeatureKind("encoder")
+	FeatureFilter   = FeatureKind("filter")
+)
+
+// Feature is an ffmpeg feature which downloads need.
+type Feature struct {
+	Kind FeatureKind
+	Name string
+	// Purpose tells what the feature is needed for, e.g. "the mp4 container".
+	Purpose string
+}
+
+// RateLimitFeature is the feature needed to download through the proxy of a
+// rate limiter.
+var RateLimitFeature = Feature{FeatureProtocol, "httpproxy", "rate limiting downloads"}
+
+// DetectCapabilities runs ffmpeg and ffprobe to detect their versions and the
+// features supported by ffmpeg.
+func DetectCapabilities(ctx context.Context) (Capabilities, error) {
+	c := Capabilities{FfmpegPath: ffmpegBinary, FfprobePath: ffprobeBinary}
+
+	output, err := runBinary(ctx, ffmpegBinary, "-version")
+	if nil != err {
+		return c, err
+	}
+	c.FfmpegVersion = parseVersion(output)
+	output, err = runBinary(ctx, ffprobeBinary, "-version")
+	if nil != err {
+		return c, err
+	}
+	c.FfprobeVersion = parseVersion(output)
+	if c.FfmpegVersion == "" || c.FfprobeVersion == "" {
+		return c, fmt.Errorf("failed to detect the versions of %q and %q", ffmpegBinary, ffprobeBinary)
+	}
+	if c.FfmpegVersion != c.FfprobeVersion {
+		c.Warnings = append(c.Warnings, fmt.Sprintf("ffmpeg version %s and ffprobe version %s differ",
+			c.FfmpegVersion, c.FfprobeVersion))
+	}
+
+	if output, err = runBinary(ctx, ffmpegBinary, "-protocols"); nil != err {
+		return c, err
+	}
+	c.Protocols = parseProtocols(output)
+	if output, err = runBinary(ctx, ffmpegBinary, "-demuxers"); nil != err {
+		return c, err
+	}
+	c.Demuxers = parseCodecList(output)
+	if output, err = runBinary(ctx, ffmpegBinary, "-muxers"); nil != err {
+		return c, err
+	}
+	c.Muxers = parseCodecList(output)
+	if output, err = runBinary(ctx, ffmpegBinary, "-encoders"); nil != err {
+		return c, err
+	}
+	c.Encoders = parseCodecList(output)
+	if output, err = runBinary(ctx, ffmpegBinary, "-filters"); nil != err {
+		return c, err
+	}
+	c.Filters = parseFilterList(output)
+	return c, nil
+}
+
+// Supports tells whether ffmpeg supports the given feature.
+func (c *Capabilities) Supports(f Feature) bool {
+	switch f.Kind {
+	case FeatureProtocol:
+		return slices.Contains(c.Protocols, f.Name)
+	case FeatureDemuxer:
+		return slices.Contains(c.Demuxers, f.Name)
+	case FeatureMuxer:
+		return slices.Contains(c.Muxers, f.Name)
+	case FeatureEncoder:
+		return slices.Contains(c.Encoders, f.Name)
+	case FeatureFilter:
+		return slices.Contains(c.Filters, f.Name)
+	}
+	return false
+}
+
+// Check verifies that ffmpeg supports all of the given features. Nil
+// capabilities, i.e. ones that were never detected, support everything.
+func (c *Capabilities) Check(features []Feature) error {
+	if nil == c {
+		return nil
+	}
+	var errs []error
+	for _, f := range features {
+		if !c.Supports(f) {
+			errs = append(errs, fmt.Errorf("%s %s does not support the %s %q needed for %s",
+				c.FfmpegPath, c.FfmpegVersion, f.Kind, f.Name, f.Purpose))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// FeatureUsage tells which optional parts of a download are used, beyond
+// the container and the transcoding profile.
+type FeatureUsage struct {
+	// Split is set when outputs are split into parts.
+	Split bool
+	// Join is set when recordings are joined.
+	Join bool
+	// ContactSheet is set when contact sheets are rendered.
+	ContactSheet bool
+	// Chapters is set when chapters are detected from breaks.
+	Chapters bool
+	// RateLimit is set when downloads go through the rate limiting proxy.
+	RateLimit bool
+}
+
+// RequiredFeatures returns the ffmpeg features needed to download to the given
+// container, if any, using the given transcoding profile, if not nil, and the
+// given optional parts.
+func RequiredFeatures(container Container, profile *TranscodingProfile, usage FeatureUsage) []Feature {
+	features := []Feature{{FeatureDemuxer, "hls", "downloading HLS streams"}}
+	for _, protocol := range strings.Split(protocolWhiteList, ",") {
+		features = append(features, Feature{FeatureProtocol, protocol, "downloading HLS streams"})
+	}
+	if usage.RateLimit {
+		features = append(features, RateLimitFeature)
+	}
+
+	if spec, found := containerSpecs[container]; found {
+		purpose := fmt.Sprintf("the %s container", container)
+		features = append(features, Feature{FeatureMuxer, spec.muxer, purpose})
+		if nil != spec.audioTranscode && (nil == profile || nil == profile.Audio) {
+			features = append(features, Feature{FeatureEncoder, spec.audioTranscode.Codec, purpose})
+		}
+	}
+
+	if nil != profile {
+		if nil != profile.Video {
+			features = append(features, Feature{FeatureEncoder, profile.Video.Codec, "the video of the transcoding profile"})
+		}
+		if nil != profile.Audio {
+			features = append(features, Feature{FeatureEncoder, profile.Audio.Codec, "the audio of the transcoding profile"})
+		}
+		if nil != profile.Loudness {
+			features = append(features, Feature{FeatureFilter, "loudnorm", "measuring loudness"})
+		}
+	}
+
+	if usage.Split {
+		features = append(features, Feature{FeatureMuxer, "segment", "splitting outputs into parts"})
+	}
+	if usage.Join {
+		features = append(features, Feature{FeatureDemuxer, "concat", "joining recordings"})
+	}
+	if usage.ContactSheet {
+		features = append(features, Feature{FeatureEncoder, "mjpeg", "contact sheets"})
+		for _, filter := range contactSheetFilters {
+			features = append(features, Feature{FeatureFilter, filter, "contact sheets"})
+		}
+	}
+	if usage.Chapters {
+		for _, filter := range chapterFilters {
+			features = append(features, Feature{FeatureFilter, filter, "detecting chapters"})
+		}
+	}
+	return features
+}
+
+// runBinary runs the given executable with the given arguments and returns
+// what it writes to stdout.
+func runBinary(ctx context.Context, binary string, args ...string) (string, error) {
+	cmd := e.CmdFactory(ctx, binary, append([]string{"-hide_banner"}, args...)...)
+	output, err := cmd.Output()
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%q not found: %w", binary, err)
+	} else if nil != err {
+		return "", fmt.Errorf("failed to run %q: %w", binary, err)
+	}
+	return string(output), nil
+}
+
+// parseVersion returns the version from the output of ffmpeg/ffprobe -version,
+// which starts like "ffmpeg version 6.1.1 Copyright ...".
+func parseVersion(output string) string {
+	line, _, _ := strings.Cut(output, "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 3 || fields[1] != "version" {
+		return ""
+	}
+	return fields[2]
+}
+
+// parseProtocols returns the input protocols listed in the output of
+// ffmpeg -protocols.
+func parseProtocols(output string) []string {
+	protocols := []string{}
+	input := false
+	s := bufio.NewScanner(strings.NewReader(output))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch line {
+		case "Input:":
+			input = true
+		case "Output:":
+			input = false
+		default:
+			if input && line != "" {
+				protocols = append(protocols, line)
+			}
+		}
+	}
+	return protocols
+}
+
+// parseCodecList returns the names listed after the legend in the output of
+// ffmpeg -muxers and -encoders, where each line has flags followed by the
+// name, e.g. " E  matroska  Matroska".
+func parseCodecList(output string) []string {
+	names := []string{}
+	listed := false
+	s := bufio.NewScanner(strings.NewReader(output))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) <= 0 {
+			continue
+		} else if !listed {
+			listed = strings.HasPrefix(fields[0], "--")
+			continue
+		}
+		if len(fields) >= 2 {
+			names = append(names, strings.Split(fields[1], ",")...)
+		}
+	}
+	return names
+}
+
+// parseFilterList returns the names of the filters listed in the output of
+// ffmpeg -filters, where each line has flags followed by the name and the
+// input and output types, e.g. " ..C acompressor  A->A  Audio compressor.".
+func parseFilterList(output string) []string {
+	names := []string{}
+	s := bufio.NewScanner(strings.NewReader(output))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) >= 3 && strings.Contains(fields[2], "->") {
+			names = append(names, fields[1])
+		}
+	}
+	return names
+}
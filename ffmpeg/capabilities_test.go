@@ -0,0 +1,315 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	e "github.com/rokeller/zt-dl/exec"
+	"github.com/rokeller/zt-dl/test"
+)
+
+const protocolsOutput = `Supported file protocols:
+Input:
+  async
+  file
+  https
+  tcp
+  tls
+Output:
+  file
+  rtmp
+`
+
+const muxersOutput = `Formats:
+ D. = Demuxing supported
+ .E = Muxing supported
+ ---
+  E matroska        Matroska
+  E mp4             MP4 (MPEG-4 Part 14)
+  E null            raw null video
+`
+
+const demuxersOutput = `File formats:
+ D. = Demuxing supported
+ .E = Muxing supported
+ ---
+ D  concat          Virtual concatenation script
+ D  hls             Apple HTTP Live Streaming
+ D  matroska,webm   Matroska / WebM
+`
+
+const filtersOutput = `Filters:
+  T.. = Timeline support
+  .S. = Slice threading
+  ..C = Command support
+  A = Audio input/output
+  V = Video input/output
+  N = Dynamic number and/or type of input/output
+  | = Source or sink filter
+ ..C acompressor       A->A       Audio compressor.
+ ... loudnorm          A->A       EBU R128 loudness normalization
+ ... anullsrc          |->A       Null audio source, return empty audio frames.
+`
+
+const encodersOutput = `Encoders:
+ V..... = Video
+ A..... = Audio
+ ------
+ V....D libx264              libx264 H.264 / AVC / MPEG-4 AVC / MPEG-4 part 10 (codec h264)
+ A....D aac                  AAC (Advanced Audio Coding)
+`
+
+func Test_parseVersion(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{output: "ffmpeg version 6.1.1-3ubuntu5 Copyright (c) 2000-2023 the FFmpeg developers\nbuilt with gcc\n", want: "6.1.1-3ubuntu5"},
+		{output: "ffprobe version n7.0 Copyright (c) 2007-2024", want: "n7.0"},
+		{output: "something else entirely", want: ""},
+		{output: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := parseVersion(tt.output); got != tt.want {
+				t.Errorf("parseVersion() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseProtocols(t *testing.T) {
+	want := []string{"async", "file", "https", "tcp", "tls"}
+	if got := parseProtocols(protocolsOutput); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseProtocols() = %v, want %v", got, want)
+	}
+}
+
+func Test_parseCodecList(t *testing.T) {
+	tests := []struct {
+		name   string // description of this test case
+		output string
+		want   []string
+	}{
+		{name: "Muxers", output: muxersOutput, want: []string{"matroska", "mp4", "null"}},
+		{name: "Demuxers", output: demuxersOutput, want: []string{"concat", "hls", "matroska", "webm"}},
+		{name: "Encoders", output: encodersOutput, want: []string{"libx264", "aac"}},
+		{name: "NoList", output: "Formats:\n", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseCodecList(tt.output); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCodecList() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseFilterList(t *testing.T) {
+	want := []string{"acompressor", "loudnorm", "anullsrc"}
+	if got := parseFilterList(filtersOutput); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseFilterList() = %v, want %v", got, want)
+	}
+}
+
+func TestRequiredFeatures(t *testing.T) {
+	hls := Feature{FeatureDemuxer, "hls", "downloading HLS streams"}
+	https := Feature{FeatureProtocol, "https", "downloading HLS streams"}
+	tls := Feature{FeatureProtocol, "tls", "downloading HLS streams"}
+	tcp := Feature{FeatureProtocol, "tcp", "downloading HLS streams"}
+
+	tests := []struct {
+		name      string // description of this test case
+		container Container
+		profile   *TranscodingProfile
+		usage     FeatureUsage
+		want      []Feature
+	}{
+		{
+			name: "Defaults",
+			want: []Feature{hls, https, tls, tcp},
+		},
+		{
+			name:      "Container",
+			container: ContainerMp4,
+			want:      []Feature{hls, https, tls, tcp, {FeatureMuxer, "mp4", "the mp4 container"}},
+		},
+		{
+			name:      "ContainerTranscodesAudio",
+			container: ContainerMp3,
+			want: []Feature{hls, https, tls, tcp,
+				{FeatureMuxer, "mp3", "the mp3 container"},
+				{FeatureEncoder, "libmp3lame", "the mp3 container"},
+			},
+		},
+		{
+			name:      "Profile",
+			container: ContainerOpus,
+			profile: &TranscodingProfile{
+				Video:    &CodecSettings{Codec: "libx265"},
+				Audio:    &CodecSettings{Codec: "libopus"},
+				Loudness: &LoudnessSettings{},
+			},
+			want: []Feature{hls, https, tls, tcp,
+				{FeatureMuxer, "opus", "the opus container"},
+				{FeatureEncoder, "libx265", "the video of the transcoding profile"},
+				{FeatureEncoder, "libopus", "the audio of the transcoding profile"},
+				{FeatureFilter, "loudnorm", "measuring loudness"},
+			},
+		},
+		{
+			name:  "Usage",
+			usage: FeatureUsage{Split: true, Join: true, ContactSheet: true, Chapters: true, RateLimit: true},
+			want: []Feature{hls, https, tls, tcp,
+				{FeatureProtocol, "httpproxy", "rate limiting downloads"},
+				{FeatureMuxer, "segment", "splitting outputs into parts"},
+				{FeatureDemuxer, "concat", "joining recordings"},
+				{FeatureEncoder, "mjpeg", "contact sheets"},
+				{FeatureFilter, "trim", "contact sheets"},
+				{FeatureFilter, "setpts", "contact sheets"},
+				{FeatureFilter, "scale", "contact sheets"},
+				{FeatureFilter, "concat", "contact sheets"},
+				{FeatureFilter, "tile", "contact sheets"},
+				{FeatureFilter, "blackdetect", "detecting chapters"},
+				{FeatureFilter, "silencedetect", "detecting chapters"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RequiredFeatures(tt.container, tt.profile, tt.usage); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RequiredFeatures() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCapabilities_Check(t *testing.T) {
+	c := &Capabilities{
+		FfmpegPath:    "ffmpeg",
+		FfmpegVersion: "7.0",
+		Protocols:     []string{"https", "tls", "tcp"},
+		Demuxers:      []string{"hls"},
+		Muxers:        []string{"matroska", "mp4"},
+		Encoders:      []string{"aac"},
+	}
+
+	tests := []struct {
+		name         string // description of this test case
+		capabilities *Capabilities
+		features     []Feature
+		wantErr      string
+	}{
+		{
+			name:         "Supported",
+			capabilities: c,
+			features:     RequiredFeatures(ContainerMp4, nil, FeatureUsage{}),
+		},
+		{
+			name:         "Unsupported",
+			capabilities: c,
+			features:     RequiredFeatures(ContainerMp3, nil, FeatureUsage{}),
+			wantErr: `ffmpeg 7.0 does not support the muxer "mp3" needed for the mp3 container
+ffmpeg 7.0 does not support the encoder "libmp3lame" needed for the mp3 container`,
+		},
+		{
+			name:         "UnsupportedFilters",
+			capabilities: c,
+			features:     RequiredFeatures(ContainerMp4, nil, FeatureUsage{Chapters: true}),
+			wantErr: `ffmpeg 7.0 does not support the filter "blackdetect" needed for detecting chapters
+ffmpeg 7.0 does not support the filter "silencedetect" needed for detecting chapters`,
+		},
+		{
+			name:     "NotDetected",
+			features: RequiredFeatures(ContainerMp3, nil, FeatureUsage{}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.capabilities.Check(tt.features)
+			if tt.wantErr == "" && nil != err {
+				t.Errorf("Capabilities.Check() got error %v, want nil", err)
+			} else if tt.wantErr != "" && (nil == err || err.Error() != tt.wantErr) {
+				t.Errorf("Capabilities.Check() got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDetectCapabilities(t *testing.T) {
+	if test.IsTestCall() {
+		args := test.GetArgs()
+		switch args[len(args)-1] {
+		case "-version":
+			fmt.Println("ffmpeg version 7.0 Copyright (c) 2000-2024 the FFmpeg developers")
+		case "-protocols":
+			fmt.Print(protocolsOutput)
+		case "-demuxers":
+			fmt.Print(demuxersOutput)
+		case "-muxers":
+			fmt.Print(muxersOutput)
+		case "-encoders":
+			fmt.Print(encodersOutput)
+		case "-filters":
+			fmt.Print(filtersOutput)
+		default:
+			os.Exit(1)
+		}
+		os.Exit(0)
+		return
+	}
+
+	me := test.CallerFuncName(0)
+	names := []string{}
+	e.CmdFactory = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		names = append(names, name)
+		return test.TestCommandContext(t, me, ctx, name, arg...)
+	}
+	SetBinaries("/opt/ffmpeg/bin/ffmpeg", "")
+	defer SetBinaries("", "")
+
+	got, err := DetectCapabilities(t.Context())
+	if nil != err {
+		t.Fatalf("DetectCapabilities() got error %v, want nil", err)
+	}
+	want := Capabilities{
+		FfmpegPath:     "/opt/ffmpeg/bin/ffmpeg",
+		FfmpegVersion:  "7.0",
+		FfprobePath:    "ffprobe",
+		FfprobeVersion: "7.0",
+		Protocols:      []string{"async", "file", "https", "tcp", "tls"},
+		Demuxers:       []string{"concat", "hls", "matroska", "webm"},
+		Muxers:         []string{"matroska", "mp4", "null"},
+		Encoders:       []string{"libx264", "aac"},
+		Filters:        []string{"acompressor", "loudnorm", "anullsrc"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DetectCapabilities() = %+v, want %+v", got, want)
+	}
+	wantNames := []string{
+		"/opt/ffmpeg/bin/ffmpeg", "ffprobe", "/opt/ffmpeg/bin/ffmpeg", "/opt/ffmpeg/bin/ffmpeg",
+		"/opt/ffmpeg/bin/ffmpeg", "/opt/ffmpeg/bin/ffmpeg", "/opt/ffmpeg/bin/ffmpeg",
+	}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("DetectCapabilities() ran %v, want %v", names, wantNames)
+	}
+}
+
+func TestDetectCapabilities_NotFound(t *testing.T) {
+	e.CmdFactory = exec.CommandContext
+	SetBinaries("/does/not/exist/ffmpeg", "")
+	defer SetBinaries("", "")
+
+	_, err := DetectCapabilities(t.Context())
+	if nil == err {
+		t.Fatal("DetectCapabilities() got nil error, want error")
+	}
+	if want := `"/does/not/exist/ffmpeg" not found`; !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("DetectCapabilities() got error %v, want it to start with %q", err, want)
+	}
+}
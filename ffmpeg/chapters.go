@@ -0,0 +1,276 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMinBreakDuration = 500 * time.Millisecond
+	defaultNoiseLevel       = "-50dB"
+	defaultPixelThreshold   = 0.1
+	// breakMergeGap is the maximum gap between two breaks for them to be
+	// considered the same break.
+	breakMergeGap = time.Second
+	// minChapterDuration is the minimum duration of a chapter; breaks closer
+	// than this to the start or end of the recording do not start a chapter.
+	minChapterDuration = 10 * time.Second
+	// edlCommercialBreak is the EDL action for commercial breaks.
+	edlCommercialBreak = 3
+)
+
+// chapterFilters are the ffmpeg filters which detect breaks.
+var chapterFilters = []string{"blackdetect", "silencedetect"}
+
+var (
+	reBlackDetect  = regexp.MustCompile(`black_start:\s*([\d.]+)\s+black_end:\s*([\d.]+)`)
+	reSilenceStart = regexp.MustCompile(`silence_start:\s*(-?[\d.]+)`)
+	reSilenceEnd   = regexp.MustCompile(`silence_end:\s*([\d.]+)`)
+)
+
+type ChapterDetectorOption func(*chapterDetector)
+
+// WithEdlSidecar configures the chapter detector to also write the detected
+// breaks to an EDL (Comskip-compatible) sidecar file next to the output.
+func WithEdlSidecar(writeEdl bool) ChapterDetectorOption {
+	return func(c *chapterDetector) {
+		c.writeEdl = writeEdl
+	}
+}
+
+// WithMinBreakDuration sets the minimum duration of black frames and silence
+// to be considered a break.
+func WithMinBreakDuration(d time.Duration) ChapterDetectorOption {
+	return func(c *chapterDetector) {
+		c.minBreak = d
+	}
+}
+
+type chapterDetector struct {
+	minBreak       time.Duration
+	noiseLevel     string
+	pixelThreshold float64
+	writeEdl       bool
+}
+
+var _ PostProcessor = &chapterDetector{}
+
+// NewChapterDetector creates a [PostProcessor] that analyzes the output using
+// ffmpeg's blackdetect and silencedetect filters and embeds chapter markers at
+// the detected breaks.
+func NewChapterDetector(options ...ChapterDetectorOption) PostProcessor {
+	c := &chapterDetector{
+		minBreak:       defaultMinBreakDuration,
+		noiseLevel:     defaultNoiseLevel,
+		pixelThreshold: defaultPixelThreshold,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// Stage implements [PostProcessor].
+func (c *chapterDetector) Stage() Stage {
+	return Stage{Name: "detect_chapters", Description: "detecting chapter markers"}
+}
+
+// PostProcess implements [PostProcessor].
+func (c *chapterDetector) PostProcess(
+	ctx context.Context,
+	job PostProcessingJob,
+	progress DownloadProgressHandler,
+) error {
+	breaks, err := c.detectBreaks(ctx, job, progress)
+	if nil != err {
+		return err
+	}
+
+	chapters := chaptersFromBreaks(breaks, job.Duration)
+	fmt.Fprintf(job.messageWriter(), "Detected %d break(s), writing %d chapter(s).\n", len(breaks), len(chapters))
+	if len(chapters) > 1 {
+		if err := c.embedChapters(ctx, job, chapters, progress); nil != err {
+			return err
+		}
+	}
+
+	if c.writeEdl {
+		edlPath := sidecarPath(job.OutputPath, ".edl")
+		if err := os.WriteFile(edlPath, formatEdl(breaks), 0o644); nil != err {
+			return fmt.Errorf("failed to write EDL file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (c *chapterDetector) detectBreaks(
+	ctx context.Context,
+	job PostProcessingJob,
+	progress DownloadProgressHandler,
+) ([]interval, error) {
+	minBreakSecs := strconv.FormatFloat(c.minBreak.Seconds(), 'f', -1, 64)
+	args := []string{
+		"-i", job.OutputPath,
+		"-map", "0:v:0?",
+		"-map", "0:a:0?",
+		"-vf", fmt.Sprintf("blackdetect=d=%s:pix_th=%.2f", minBreakSecs, c.pixelThreshold),
+		"-af", fmt.Sprintf("silencedetect=n=%s:d=%s", c.noiseLevel, minBreakSecs),
+		"-f", "null",
+		"-",
+	}
+
+	p := &breakDetectionParser{}
+	if err := runPostProcessingFfmpeg(ctx, args, job.Duration, progress, p.parseLine); nil != err {
+		return nil, err
+	}
+
+	return p.breaks(), nil
+}
+
+func (c *chapterDetector) embedChapters(
+	ctx context.Context,
+	job PostProcessingJob,
+	chapters []interval,
+	progress DownloadProgressHandler,
+) error {
+	metaPath := sidecarPath(job.OutputPath, ".chapters.txt")
+	if err := os.WriteFile(metaPath, formatFfmetadataChapters(chapters), 0o644); nil != err {
+		return fmt.Errorf("failed to write chapters metadata: %w", err)
+	}
+	defer os.Remove(metaPath)
+
+	tmpPath := sidecarPath(job.OutputPath, ".chapters"+filepath.Ext(job.OutputPath))
+	args := []string{
+		"-i", job.OutputPath,
+		"-i", metaPath,
+		"-map", "0",
+		"-map_metadata", "0",
+		"-map_chapters", "1",
+		"-c", "copy",
+		"-y", tmpPath,
+	}
+	if err := runPostProcessingFfmpeg(ctx, args, job.Duration, progress, nil); nil != err {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, job.OutputPath); nil != err {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace output with chaptered file: %w", err)
+	}
+	return nil
+}
+
+type interval struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// breakDetectionParser collects black and silent intervals from the stderr
+// output of ffmpeg's blackdetect and silencedetect filters.
+type breakDetectionParser struct {
+	black        []interval
+	silence      []interval
+	silenceStart *time.Duration
+}
+
+func (p *breakDetectionParser) parseLine(line string) {
+	if m := reBlackDetect.FindStringSubmatch(line); nil != m {
+		start, errStart := parseSeconds(m[1])
+		end, errEnd := parseSeconds(m[2])
+		if nil == errStart && nil == errEnd {
+			p.black = append(p.black, interval{start, end})
+		}
+	} else if m := reSilenceStart.FindStringSubmatch(line); nil != m {
+		if start, err := parseSeconds(m[1]); nil == err {
+			start = max(start, 0)
+			p.silenceStart = &start
+		}
+	} else if m := reSilenceEnd.FindStringSubmatch(line); nil != m {
+		if end, err := parseSeconds(m[1]); nil == err && nil != p.silenceStart {
+			p.silence = append(p.silence, interval{*p.silenceStart, end})
+			p.silenceStart = nil
+		}
+	}
+}
+
+// breaks returns the intervals during which both the picture is black and the
+// audio is silent, with breaks close to each other merged together.
+func (p *breakDetectionParser) breaks() []interval {
+	res := []interval{}
+	for _, b := range p.black {
+		for _, s := range p.silence {
+			start, end := max(b.Start, s.Start), min(b.End, s.End)
+			if end > start {
+				res = append(res, interval{start, end})
+			}
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Start < res[j].Start })
+
+	merged := []interval{}
+	for _, b := range res {
+		if n := len(merged); n > 0 && b.Start-merged[n-1].End <= breakMergeGap {
+			merged[n-1].End = max(merged[n-1].End, b.End)
+			continue
+		}
+		merged = append(merged, b)
+	}
+	return merged
+}
+
+// chaptersFromBreaks splits the recording into chapters that start at the end
+// of each break.
+func chaptersFromBreaks(breaks []interval, duration time.Duration) []interval {
+	chapters := []interval{}
+	start := time.Duration(0)
+	for _, b := range breaks {
+		if b.End-start < minChapterDuration || duration-b.End < minChapterDuration {
+			continue
+		}
+		chapters = append(chapters, interval{start, b.End})
+		start = b.End
+	}
+	return append(chapters, interval{start, duration})
+}
+
+func formatFfmetadataChapters(chapters []interval) []byte {
+	sb := strings.Builder{}
+	sb.WriteString(";FFMETADATA1\n")
+	for i, c := range chapters {
+		sb.WriteString("\n[CHAPTER]\nTIMEBASE=1/1000\n")
+		fmt.Fprintf(&sb, "START=%d\nEND=%d\n", c.Start.Milliseconds(), c.End.Milliseconds())
+		fmt.Fprintf(&sb, "title=Chapter %d\n", i+1)
+	}
+	return []byte(sb.String())
+}
+
+func formatEdl(breaks []interval) []byte {
+	sb := strings.Builder{}
+	for _, b := range breaks {
+		fmt.Fprintf(&sb, "%.2f\t%.2f\t%d\n", b.Start.Seconds(), b.End.Seconds(), edlCommercialBreak)
+	}
+	return []byte(sb.String())
+}
+
+// sidecarPath returns the path of a file next to the output with the output's
+// extension replaced by the given suffix.
+func sidecarPath(outputPath, suffix string) string {
+	return strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + suffix
+}
+
+func parseSeconds(s string) (time.Duration, error) {
+	secs, err := strconv.ParseFloat(s, 64)
+	if nil != err {
+		return 0, err
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
@@ -0,0 +1,201 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	e "github.com/rokeller/zt-dl/exec"
+	"github.com/rokeller/zt-dl/test"
+)
+
+func Test_breakDetectionParser(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []interval
+	}{
+		{
+			name:  "NoBreaks",
+			lines: []string{"frame= 100 time=00:00:04.00", "something else"},
+			want:  []interval{},
+		},
+		{
+			name: "BlackWithoutSilence",
+			lines: []string{
+				"[blackdetect @ 0x1] black_start:10 black_end:12 black_duration:2",
+			},
+			want: []interval{},
+		},
+		{
+			name: "OverlappingBlackAndSilence",
+			lines: []string{
+				"[silencedetect @ 0x2] silence_start: 9.5",
+				"[blackdetect @ 0x1] black_start:10 black_end:12.5 black_duration:2.5",
+				"[silencedetect @ 0x2] silence_end: 12 | silence_duration: 2.5",
+			},
+			want: []interval{{10 * time.Second, 12 * time.Second}},
+		},
+		{
+			name: "AdjacentBreaksMerged",
+			lines: []string{
+				"[blackdetect @ 0x1] black_start:10 black_end:11 black_duration:1",
+				"[blackdetect @ 0x1] black_start:11.5 black_end:13 black_duration:1.5",
+				"[blackdetect @ 0x1] black_start:100 black_end:101 black_duration:1",
+				"[silencedetect @ 0x2] silence_start: 10",
+				"[silencedetect @ 0x2] silence_end: 13 | silence_duration: 3",
+				"[silencedetect @ 0x2] silence_start: 100.5",
+				"[silencedetect @ 0x2] silence_end: 102 | silence_duration: 1.5",
+			},
+			want: []interval{
+				{10 * time.Second, 13 * time.Second},
+				{100*time.Second + 500*time.Millisecond, 101 * time.Second},
+			},
+		},
+		{
+			name: "NegativeSilenceStart",
+			lines: []string{
+				"[silencedetect @ 0x2] silence_start: -0.02",
+				"[blackdetect @ 0x1] black_start:0 black_end:1 black_duration:1",
+				"[silencedetect @ 0x2] silence_end: 2 | silence_duration: 2.02",
+			},
+			want: []interval{{0, time.Second}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &breakDetectionParser{}
+			for _, line := range tt.lines {
+				p.parseLine(line)
+			}
+			if got := p.breaks(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("breaks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_chaptersFromBreaks(t *testing.T) {
+	tests := []struct {
+		name     string
+		breaks   []interval
+		duration time.Duration
+		want     []interval
+	}{
+		{
+			name:     "NoBreaks",
+			duration: time.Hour,
+			want:     []interval{{0, time.Hour}},
+		},
+		{
+			name: "BreaksCloseToStartAndEndIgnored",
+			breaks: []interval{
+				{time.Second, 2 * time.Second},
+				{30 * time.Minute, 30*time.Minute + 2*time.Second},
+				{time.Hour - 5*time.Second, time.Hour - 3*time.Second},
+			},
+			duration: time.Hour,
+			want: []interval{
+				{0, 30*time.Minute + 2*time.Second},
+				{30*time.Minute + 2*time.Second, time.Hour},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chaptersFromBreaks(tt.breaks, tt.duration); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("chaptersFromBreaks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_formatFfmetadataChapters(t *testing.T) {
+	got := string(formatFfmetadataChapters([]interval{
+		{0, 90 * time.Second},
+		{90 * time.Second, 200 * time.Second},
+	}))
+	want := `;FFMETADATA1
+
+[CHAPTER]
+TIMEBASE=1/1000
+START=0
+END=90000
+title=Chapter 1
+
+[CHAPTER]
+TIMEBASE=1/1000
+START=90000
+END=200000
+title=Chapter 2
+`
+	if got != want {
+		t.Errorf("formatFfmetadataChapters() = %q, want %q", got, want)
+	}
+}
+
+func Test_formatEdl(t *testing.T) {
+	got := string(formatEdl([]interval{
+		{10 * time.Second, 12500 * time.Millisecond},
+		{100 * time.Second, 101 * time.Second},
+	}))
+	want := "10.00\t12.50\t3\n100.00\t101.00\t3\n"
+	if got != want {
+		t.Errorf("formatEdl() = %q, want %q", got, want)
+	}
+}
+
+func Test_chapterDetector_PostProcess(t *testing.T) {
+	if test.IsTestCall() {
+		args := test.GetArgs()
+		if args[len(args)-1] == "-" {
+			fmt.Fprintln(os.Stderr, "[blackdetect @ 0x1] black_start:60 black_end:62 black_duration:2")
+			fmt.Fprintln(os.Stderr, "[silencedetect @ 0x2] silence_start: 60.5")
+			fmt.Fprintln(os.Stderr, "[silencedetect @ 0x2] silence_end: 61.5 | silence_duration: 1")
+			fmt.Fprintln(os.Stderr, "frame=1 time=00:02:00.00 bitrate=N/A")
+			os.Exit(0)
+		}
+		// Remuxing with chapters: create the temporary output.
+		if err := os.WriteFile(args[len(args)-1], []byte("chaptered"), 0o644); nil != err {
+			os.Exit(3)
+		}
+		os.Exit(0)
+		return
+	}
+
+	me := test.CallerFuncName(0)
+	e.CmdFactory = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		return test.TestCommandContext(t, me, ctx, name, arg...)
+	}
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "rec.mkv")
+	if err := os.WriteFile(out, []byte("original"), 0o644); nil != err {
+		t.Fatalf("failed to create output: %v", err)
+	}
+
+	h := &testProgressHandler{progressUpdates: []DownloadProgress{}}
+	c := NewChapterDetector(WithEdlSidecar(true))
+	err := c.PostProcess(t.Context(), PostProcessingJob{OutputPath: out, Duration: 2 * time.Minute}, h)
+	if nil != err {
+		t.Fatalf("PostProcess() got error %v, want nil", err)
+	}
+
+	if data, _ := os.ReadFile(out); string(data) != "chaptered" {
+		t.Errorf("output content = %q, want %q", data, "chaptered")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "rec.edl")); string(data) != "60.50\t61.50\t3\n" {
+		t.Errorf("EDL content = %q, want %q", data, "60.50\t61.50\t3\n")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "rec.chapters.txt")); !os.IsNotExist(err) {
+		t.Errorf("chapters metadata file not removed: %v", err)
+	}
+	if len(h.progressUpdates) < 1 {
+		t.Error("PostProcess() reported no progress")
+	}
+}
@@ -2,4 +2,7 @@ package ffmpeg
 
 const (
 	protocolWhiteList = "https,tls,tcp"
+	// proxiedProtocolWhiteList also allows tunneling through the rate limiting
+	// proxy.
+	proxiedProtocolWhiteList = protocolWhiteList + ",httpproxy"
 )
@@ -0,0 +1,152 @@
+package ffmpeg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	e "github.com/rokeller/zt-dl/exec"
+)
+
+const (
+	defaultContactSheetFrames  = 16
+	defaultContactSheetColumns = 4
+	defaultContactSheetWidth   = 320
+	// contactSheetQuality is the JPEG quality scale of ffmpeg's mjpeg encoder,
+	// from 2 (best) to 31 (worst).
+	contactSheetQuality = 4
+	// contactSheetSuffix replaces the extension of the output for the path of
+	// its contact sheet.
+	contactSheetSuffix = ".contact.jpg"
+)
+
+// contactSheetFilters are the ffmpeg filters which render contact sheets.
+var contactSheetFilters = []string{"trim", "setpts", "scale", "concat", "tile"}
+
+type ContactSheetOption func(*contactSheetGenerator)
+
+// WithContactSheetFrames sets the number of frames on the contact sheet.
+func WithContactSheetFrames(frames int) ContactSheetOption {
+	return func(c *contactSheetGenerator) {
+		c.frames = frames
+	}
+}
+
+// WithContactSheetColumns sets the number of frames per row of the contact
+// sheet.
+func WithContactSheetColumns(columns int) ContactSheetOption {
+	return func(c *contactSheetGenerator) {
+		c.columns = columns
+	}
+}
+
+// WithContactSheetWidth sets the width in pixels of each frame on the contact
+// sheet.
+func WithContactSheetWidth(width int) ContactSheetOption {
+	return func(c *contactSheetGenerator) {
+		c.width = width
+	}
+}
+
+type contactSheetGenerator struct {
+	frames  int
+	columns int
+	width   int
+}
+
+var _ PostProcessor = &contactSheetGenerator{}
+
+// NewContactSheetGenerator creates a [PostProcessor] that writes a contact
+// sheet, i.e. a JPEG with frames evenly spaced across the output, next to the
+// output. ffmpeg runs at low priority to not slow down other work.
+func NewContactSheetGenerator(options ...ContactSheetOption) PostProcessor {
+	c := &contactSheetGenerator{
+		frames:  defaultContactSheetFrames,
+		columns: defaultContactSheetColumns,
+		width:   defaultContactSheetWidth,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// ContactSheetPath returns the path of the contact sheet of the output at the
+// given path.
+func ContactSheetPath(outputPath string) string {
+	return sidecarPath(outputPath, contactSheetSuffix)
+}
+
+// Stage implements [PostProcessor].
+func (c *contactSheetGenerator) Stage() Stage {
+	return Stage{Name: "contact_sheet", Description: "generating contact sheet"}
+}
+
+// PostProcess implements [PostProcessor].
+func (c *contactSheetGenerator) PostProcess(
+	ctx context.Context,
+	job PostProcessingJob,
+	progress DownloadProgressHandler,
+) error {
+	if !job.Video {
+		fmt.Fprintln(job.messageWriter(), "Output has no video, not generating contact sheet.")
+		return nil
+	}
+
+	args, err := c.args(job)
+	if nil != err {
+		return err
+	}
+
+	ffmpegCmd := e.CmdFactory(ctx, ffmpegBinary, args...)
+	if err := startAtLowPriority(ffmpegCmd, job.messageWriter()); nil != err {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	if err := ffmpegCmd.Wait(); nil != err {
+		return fmt.Errorf("ffmpeg failed: %w", err)
+	}
+	fmt.Fprintf(job.messageWriter(), "Wrote contact sheet %q.\n", ContactSheetPath(job.OutputPath))
+	return nil
+}
+
+// args returns the ffmpeg arguments to write the contact sheet of the job's
+// output. Each frame is read from a separate input which seeks to the frame,
+// such that only the frames on the contact sheet need to be decoded.
+func (c *contactSheetGenerator) args(job PostProcessingJob) ([]string, error) {
+	if c.frames <= 0 || c.columns <= 0 || c.width <= 0 {
+		return nil, errors.New("frames, columns and width of contact sheets must be positive")
+	}
+	if job.Duration <= 0 {
+		return nil, errors.New("cannot generate contact sheet for output of unknown duration")
+	}
+
+	args := []string{}
+	filters := []string{}
+	labels := ""
+	for i := range c.frames {
+		at := time.Duration(float64(job.Duration) * (float64(i) + 0.5) / float64(c.frames))
+		args = append(args,
+			"-ss", strconv.FormatFloat(at.Seconds(), 'f', 3, 64),
+			"-i", job.OutputPath,
+		)
+		filters = append(filters, fmt.Sprintf(
+			"[%d:v:0]trim=end_frame=1,setpts=PTS-STARTPTS,scale=%d:-2[f%d]", i, c.width, i))
+		labels += fmt.Sprintf("[f%d]", i)
+	}
+	columns := min(c.columns, c.frames)
+	rows := int(math.Ceil(float64(c.frames) / float64(columns)))
+	filters = append(filters, fmt.Sprintf(
+		"%sconcat=n=%d:v=1:a=0,tile=%dx%d[sheet]", labels, c.frames, columns, rows))
+
+	return append(args,
+		"-filter_complex", strings.Join(filters, ";"),
+		"-map", "[sheet]",
+		"-frames:v", "1",
+		"-q:v", strconv.Itoa(contactSheetQuality),
+		"-y", ContactSheetPath(job.OutputPath),
+	), nil
+}
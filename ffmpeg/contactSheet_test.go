@@ -0,0 +1,127 @@
+package ffmpeg
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	e "github.com/rokeller/zt-dl/exec"
+	"github.com/rokeller/zt-dl/test"
+)
+
+func Test_contactSheetGenerator_args(t *testing.T) {
+	tests := []struct {
+		name    string // description of this test case
+		options []ContactSheetOption
+		job     PostProcessingJob
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "ThreeFramesTwoColumns",
+			options: []ContactSheetOption{
+				WithContactSheetFrames(3),
+				WithContactSheetColumns(2),
+				WithContactSheetWidth(160),
+			},
+			job: PostProcessingJob{OutputPath: "/tmp/rec.mkv", Duration: time.Minute},
+			want: []string{
+				"-ss", "10.000", "-i", "/tmp/rec.mkv",
+				"-ss", "30.000", "-i", "/tmp/rec.mkv",
+				"-ss", "50.000", "-i", "/tmp/rec.mkv",
+				"-filter_complex",
+				"[0:v:0]trim=end_frame=1,setpts=PTS-STARTPTS,scale=160:-2[f0];" +
+					"[1:v:0]trim=end_frame=1,setpts=PTS-STARTPTS,scale=160:-2[f1];" +
+					"[2:v:0]trim=end_frame=1,setpts=PTS-STARTPTS,scale=160:-2[f2];" +
+					"[f0][f1][f2]concat=n=3:v=1:a=0,tile=2x2[sheet]",
+				"-map", "[sheet]",
+				"-frames:v", "1",
+				"-q:v", "4",
+				"-y", "/tmp/rec.contact.jpg",
+			},
+		},
+		{
+			name:    "MoreColumnsThanFrames",
+			options: []ContactSheetOption{WithContactSheetFrames(1)},
+			job:     PostProcessingJob{OutputPath: "rec.mp4", Duration: 10 * time.Second},
+			want: []string{
+				"-ss", "5.000", "-i", "rec.mp4",
+				"-filter_complex",
+				"[0:v:0]trim=end_frame=1,setpts=PTS-STARTPTS,scale=320:-2[f0];" +
+					"[f0]concat=n=1:v=1:a=0,tile=1x1[sheet]",
+				"-map", "[sheet]",
+				"-frames:v", "1",
+				"-q:v", "4",
+				"-y", "rec.contact.jpg",
+			},
+		},
+		{
+			name:    "UnknownDuration",
+			job:     PostProcessingJob{OutputPath: "rec.mkv"},
+			wantErr: true,
+		},
+		{
+			name:    "NoFrames",
+			options: []ContactSheetOption{WithContactSheetFrames(0)},
+			job:     PostProcessingJob{OutputPath: "rec.mkv", Duration: time.Minute},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewContactSheetGenerator(tt.options...).(*contactSheetGenerator)
+			got, err := c.args(tt.job)
+			if (nil != err) != tt.wantErr {
+				t.Fatalf("args() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("args() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_contactSheetGenerator_PostProcess(t *testing.T) {
+	if test.IsTestCall() {
+		// ffmpeg must run at low priority right from the start.
+		if !runsAtLowPriority() {
+			os.Exit(2)
+		}
+		args := test.GetArgs()
+		if err := os.WriteFile(args[len(args)-1], []byte("jpeg"), 0o644); nil != err {
+			os.Exit(3)
+		}
+		os.Exit(0)
+		return
+	}
+
+	me := test.CallerFuncName(0)
+	e.CmdFactory = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		return test.TestCommandContext(t, me, ctx, name, arg...)
+	}
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "rec.mkv")
+	c := NewContactSheetGenerator()
+	job := PostProcessingJob{OutputPath: out, Duration: time.Hour, Video: true}
+	if err := c.PostProcess(t.Context(), job, &testProgressHandler{}); nil != err {
+		t.Fatalf("PostProcess() got error %v, want nil", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "rec.contact.jpg")); string(data) != "jpeg" {
+		t.Errorf("contact sheet content = %q, want %q", data, "jpeg")
+	}
+
+	// Outputs without video have no contact sheet.
+	audio := filepath.Join(dir, "rec.mka")
+	err := c.PostProcess(t.Context(), PostProcessingJob{OutputPath: audio, Duration: time.Hour}, &testProgressHandler{})
+	if nil != err {
+		t.Fatalf("PostProcess() got error %v, want nil", err)
+	}
+	if got := listDir(t, dir); !reflect.DeepEqual(got, []string{"rec.contact.jpg"}) {
+		t.Errorf("PostProcess() wrote %v, want no contact sheet for audio", got)
+	}
+}
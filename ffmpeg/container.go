@@ -0,0 +1,209 @@
+package ffmpeg
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Container defines an output container format.
+type Container string
+
+const (
+	ContainerMatroska      = Container("mkv")
+	ContainerMatroskaAudio = Container("mka")
+	ContainerMp4           = Container("mp4")
+	ContainerMpegTs        = Container("ts")
+	ContainerMp4Audio      = Container("m4a")
+	ContainerMp3           = Container("mp3")
+	ContainerOpus          = Container("opus")
+)
+
+// Containers lists all supported output containers.
+var Containers = []Container{
+	ContainerMatroska,
+	ContainerMatroskaAudio,
+	ContainerMp4,
+	ContainerMpegTs,
+	ContainerMp4Audio,
+	ContainerMp3,
+	ContainerOpus,
+}
+
+type containerSpec struct {
+	// muxer is the name of the ffmpeg muxer for the container.
+	muxer string
+	// noVideo indicates that the container does not support video streams.
+	noVideo bool
+	// coverArt indicates that the container supports attached cover art.
+	coverArt bool
+	// videoCodecs and audioCodecs list the supported codecs; nil means any.
+	videoCodecs []string
+	audioCodecs []string
+	// subtitleCodecs lists the subtitle codecs that can be copied as-is.
+	subtitleCodecs []string
+	// subtitleConversions maps subtitle codecs to the codec they get converted
+	// to for the container.
+	subtitleConversions map[string]string
+	// audioTranscode defines how audio streams with unsupported codecs get
+	// transcoded for the container unless a profile defines it otherwise.
+	audioTranscode *CodecSettings
+}
+
+var matroskaSubtitleCodecs = []string{
+	"subrip", "srt", "ass", "ssa", "webvtt",
+	"dvb_subtitle", "dvd_subtitle", "hdmv_pgs_subtitle",
+}
+
+var containerSpecs = map[Container]containerSpec{
+	ContainerMatroska: {
+		muxer:               "matroska",
+		coverArt:            true,
+		subtitleCodecs:      matroskaSubtitleCodecs,
+		subtitleConversions: map[string]string{"mov_text": "srt", "text": "srt"},
+	},
+	ContainerMatroskaAudio: {
+		muxer:               "matroska",
+		noVideo:             true,
+		coverArt:            true,
+		subtitleCodecs:      matroskaSubtitleCodecs,
+		subtitleConversions: map[string]string{"mov_text": "srt", "text": "srt"},
+	},
+	ContainerMp4: {
+		muxer:          "mp4",
+		coverArt:       true,
+		videoCodecs:    []string{"h264", "hevc", "av1", "vp9", "mpeg4", "mpeg2video"},
+		audioCodecs:    []string{"aac", "mp3", "ac3", "eac3", "opus", "flac", "alac"},
+		subtitleCodecs: []string{"mov_text"},
+		subtitleConversions: map[string]string{
+			"webvtt": "mov_text", "subrip": "mov_text", "srt": "mov_text",
+			"ass": "mov_text", "ssa": "mov_text", "text": "mov_text",
+		},
+	},
+	ContainerMpegTs: {
+		muxer:          "mpegts",
+		videoCodecs:    []string{"h264", "hevc", "mpeg2video"},
+		audioCodecs:    []string{"aac", "mp3", "mp2", "ac3", "eac3", "opus"},
+		subtitleCodecs: []string{"dvb_subtitle", "dvb_teletext"},
+	},
+	ContainerMp4Audio: {
+		muxer:          "ipod",
+		noVideo:        true,
+		coverArt:       true,
+		audioCodecs:    []string{"aac", "alac"},
+		subtitleCodecs: []string{},
+	},
+	ContainerMp3: {
+		muxer:          "mp3",
+		noVideo:        true,
+		coverArt:       true,
+		audioCodecs:    []string{"mp3"},
+		subtitleCodecs: []string{},
+		audioTranscode: &CodecSettings{Codec: "libmp3lame", Args: []string{"-q:a", "2"}},
+	},
+	ContainerOpus: {
+		muxer:          "opus",
+		noVideo:        true,
+		audioCodecs:    []string{"opus"},
+		subtitleCodecs: []string{},
+		audioTranscode: &CodecSettings{Codec: "libopus", Bitrate: "128k"},
+	},
+}
+
+// ParseContainer parses the given name of a container.
+func ParseContainer(name string) (Container, error) {
+	c := Container(strings.ToLower(strings.TrimPrefix(name, ".")))
+	if _, found := containerSpecs[c]; !found {
+		return "", fmt.Errorf("unsupported container %q", name)
+	}
+	return c, nil
+}
+
+// ContainerFromPath returns the container implied by the extension of the
+// given path, or an empty container if the extension is not known.
+func ContainerFromPath(path string) Container {
+	c, err := ParseContainer(filepath.Ext(path))
+	if nil != err {
+		return ""
+	}
+	return c
+}
+
+// checkStreams verifies that the given streams can be stored in the container
+// and returns the codec conversions needed for subtitle streams, keyed by the
+// index of the subtitle stream among the subtitle streams in the output.
+func (c Container) checkStreams(streams []SourceStream) (map[int]string, error) {
+	spec, found := containerSpecs[c]
+	if !found {
+		return nil, fmt.Errorf("unsupported container %q", c)
+	}
+
+	conversions := map[int]string{}
+	errs := []error{}
+	subtitleIndex := 0
+	for _, s := range streams {
+		switch st := s.(type) {
+		case *VideoStream:
+			if spec.noVideo {
+				errs = append(errs, fmt.Errorf(
+					"stream #%d: container %q does not support video streams", st.Index(), c))
+			} else if !codecSupported(spec.videoCodecs, st.CodecName) {
+				errs = append(errs, fmt.Errorf(
+					"stream #%d: container %q does not support video codec %q", st.Index(), c, st.CodecName))
+			}
+
+		case *AudioStream:
+			if !codecSupported(spec.audioCodecs, st.CodecName) {
+				errs = append(errs, fmt.Errorf(
+					"stream #%d: container %q does not support audio codec %q", st.Index(), c, st.CodecName))
+			}
+
+		case *SubtitleStream:
+			if target, found := spec.subtitleConversions[st.CodecName]; found {
+				conversions[subtitleIndex] = target
+			} else if !codecSupported(spec.subtitleCodecs, st.CodecName) {
+				errs = append(errs, fmt.Errorf(
+					"stream #%d: container %q does not support subtitle codec %q and it cannot be converted",
+					st.Index(), c, st.CodecName))
+			}
+			subtitleIndex++
+		}
+	}
+
+	return conversions, errors.Join(errs...)
+}
+
+// transcodingProfile returns the profile to use for the given streams in the
+// container. Audio streams the container cannot store get transcoded with the
+// container's audio settings unless the given profile transcodes audio.
+func (c Container) transcodingProfile(profile *TranscodingProfile, streams []SourceStream) *TranscodingProfile {
+	spec := containerSpecs[c]
+	if nil == spec.audioTranscode || (nil != profile && nil != profile.Audio) {
+		return profile
+	}
+	for _, s := range FilterStreams(streams, IsAudioStream) {
+		if !codecSupported(spec.audioCodecs, s.(*AudioStream).CodecName) {
+			p := TranscodingProfile{Audio: spec.audioTranscode}
+			if nil != profile {
+				p.Video = profile.Video
+			}
+			return &p
+		}
+	}
+	return profile
+}
+
+func codecSupported(codecs []string, codec string) bool {
+	if nil == codecs || codec == "" {
+		// Any codec is supported, or we don't know the codec and let ffmpeg
+		// decide.
+		return true
+	}
+	for _, c := range codecs {
+		if c == codec {
+			return true
+		}
+	}
+	return false
+}
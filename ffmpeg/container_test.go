@@ -0,0 +1,191 @@
+package ffmpeg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseContainer(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Container
+		wantErr bool
+	}{
+		{name: "mkv", want: ContainerMatroska},
+		{name: ".MP4", want: ContainerMp4},
+		{name: "ts", want: ContainerMpegTs},
+		{name: "mka", want: ContainerMatroskaAudio},
+		{name: "m4a", want: ContainerMp4Audio},
+		{name: ".mp3", want: ContainerMp3},
+		{name: "opus", want: ContainerOpus},
+		{name: "avi", wantErr: true},
+		{name: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotErr := ParseContainer(tt.name)
+			if (nil != gotErr) != tt.wantErr {
+				t.Fatalf("ParseContainer() error = %v, wantErr %v", gotErr, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseContainer() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerFromPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want Container
+	}{
+		{path: "/tmp/foo.mkv", want: ContainerMatroska},
+		{path: "bar.Mp4", want: ContainerMp4},
+		{path: "bar.avi", want: ""},
+		{path: "no-extension", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := ContainerFromPath(tt.path); got != tt.want {
+				t.Errorf("ContainerFromPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainer_checkStreams(t *testing.T) {
+	video := &VideoStream{Stream: Stream{Index: 0, CodecName: "h264"}}
+	aac := &AudioStream{Stream: Stream{Index: 1, CodecName: "aac"}}
+	pcm := &AudioStream{Stream: Stream{Index: 2, CodecName: "pcm_s16le"}}
+	webvtt := &SubtitleStream{Stream: Stream{Index: 3, CodecName: "webvtt"}}
+	dvbsub := &SubtitleStream{Stream: Stream{Index: 4, CodecName: "dvb_subtitle"}}
+	unknown := &SubtitleStream{Stream: Stream{Index: 5}}
+
+	tests := []struct {
+		name      string
+		container Container
+		streams   []SourceStream
+		want      map[int]string
+		wantErr   bool
+	}{
+		{
+			name:      "Matroska/AnythingGoes",
+			container: ContainerMatroska,
+			streams:   []SourceStream{video, aac, pcm, webvtt, dvbsub},
+			want:      map[int]string{},
+		},
+		{
+			name:      "Mp4/ConvertWebVtt",
+			container: ContainerMp4,
+			streams:   []SourceStream{video, aac, unknown, webvtt},
+			want:      map[int]string{1: "mov_text"},
+		},
+		{
+			name:      "Mp4/UnsupportedAudio",
+			container: ContainerMp4,
+			streams:   []SourceStream{video, pcm},
+			wantErr:   true,
+		},
+		{
+			name:      "Mp4/UnsupportedSubtitle",
+			container: ContainerMp4,
+			streams:   []SourceStream{video, aac, dvbsub},
+			wantErr:   true,
+		},
+		{
+			name:      "MpegTs/WebVttCannotBeConverted",
+			container: ContainerMpegTs,
+			streams:   []SourceStream{video, aac, webvtt},
+			wantErr:   true,
+		},
+		{
+			name:      "Mka/NoVideo",
+			container: ContainerMatroskaAudio,
+			streams:   []SourceStream{video, aac},
+			wantErr:   true,
+		},
+		{
+			name:      "M4a/Aac",
+			container: ContainerMp4Audio,
+			streams:   []SourceStream{aac},
+			want:      map[int]string{},
+		},
+		{
+			name:      "Mp3/NoVideo",
+			container: ContainerMp3,
+			streams:   []SourceStream{video, aac},
+			wantErr:   true,
+		},
+		{
+			name:      "Unsupported",
+			container: Container("avi"),
+			streams:   []SourceStream{video},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotErr := tt.container.checkStreams(tt.streams)
+			if (nil != gotErr) != tt.wantErr {
+				t.Fatalf("checkStreams() error = %v, wantErr %v", gotErr, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkStreams() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainer_transcodingProfile(t *testing.T) {
+	aac := &AudioStream{Stream: Stream{Index: 1, CodecName: "aac"}}
+	mp3 := &AudioStream{Stream: Stream{Index: 2, CodecName: "mp3"}}
+	hevc := &CodecSettings{Codec: "libx265"}
+	stereo := &CodecSettings{Codec: "aac", Channels: 2}
+
+	tests := []struct {
+		name      string
+		container Container
+		profile   *TranscodingProfile
+		streams   []SourceStream
+		want      *TranscodingProfile
+	}{
+		{
+			name:      "Mkv/NoProfile",
+			container: ContainerMatroska,
+			streams:   []SourceStream{aac},
+		},
+		{
+			name:      "Mp3/CopyMp3",
+			container: ContainerMp3,
+			streams:   []SourceStream{mp3},
+		},
+		{
+			name:      "Mp3/TranscodeAac",
+			container: ContainerMp3,
+			streams:   []SourceStream{aac},
+			want:      &TranscodingProfile{Audio: containerSpecs[ContainerMp3].audioTranscode},
+		},
+		{
+			name:      "Opus/KeepVideoSettings",
+			container: ContainerOpus,
+			profile:   &TranscodingProfile{Video: hevc},
+			streams:   []SourceStream{aac},
+			want:      &TranscodingProfile{Video: hevc, Audio: containerSpecs[ContainerOpus].audioTranscode},
+		},
+		{
+			name:      "Mp3/ProfileAudioWins",
+			container: ContainerMp3,
+			profile:   &TranscodingProfile{Audio: stereo},
+			streams:   []SourceStream{aac},
+			want:      &TranscodingProfile{Audio: stereo},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.container.transcodingProfile(tt.profile, tt.streams)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("transcodingProfile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
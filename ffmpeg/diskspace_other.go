@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package ffmpeg
+
+// freeSpace is not supported on this platform.
+func freeSpace(dir string) (uint64, error) {
+	return 0, errFreeSpaceUnsupported
+}
@@ -0,0 +1,15 @@
+//go:build linux || darwin || freebsd
+
+package ffmpeg
+
+import "syscall"
+
+// freeSpace returns the number of bytes available to unprivileged users on the
+// file system of the given directory.
+func freeSpace(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); nil != err {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
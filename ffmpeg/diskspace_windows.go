@@ -0,0 +1,19 @@
+//go:build windows
+
+package ffmpeg
+
+import "golang.org/x/sys/windows"
+
+// freeSpace returns the number of bytes available to the current user on the
+// volume of the given directory.
+func freeSpace(dir string) (uint64, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if nil != err {
+		return 0, err
+	}
+	var available uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &available, nil, nil); nil != err {
+		return 0, err
+	}
+	return available, nil
+}
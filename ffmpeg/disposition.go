@@ -0,0 +1,135 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Disposition holds the disposition flags of a stream, e.g. whether it is the
+// default track or meant for the hearing or visually impaired.
+type Disposition struct {
+	Default         bool
+	Dub             bool
+	Original        bool
+	Comment         bool
+	Forced          bool
+	HearingImpaired bool
+	VisualImpaired  bool
+	Captions        bool
+	Descriptions    bool
+}
+
+// dispositionFlags maps the ffmpeg disposition names to a human readable label
+// and the flag in a Disposition.
+var dispositionFlags = []struct {
+	name  string
+	label string
+	flag  func(d *Disposition) *bool
+}{
+	{"default", "default", func(d *Disposition) *bool { return &d.Default }},
+	{"dub", "dub", func(d *Disposition) *bool { return &d.Dub }},
+	{"original", "original", func(d *Disposition) *bool { return &d.Original }},
+	{"comment", "commentary", func(d *Disposition) *bool { return &d.Comment }},
+	{"forced", "forced", func(d *Disposition) *bool { return &d.Forced }},
+	{"hearing_impaired", "hearing impaired", func(d *Disposition) *bool { return &d.HearingImpaired }},
+	{"visual_impaired", "audio description", func(d *Disposition) *bool { return &d.VisualImpaired }},
+	{"captions", "captions", func(d *Disposition) *bool { return &d.Captions }},
+	{"descriptions", "descriptions", func(d *Disposition) *bool { return &d.Descriptions }},
+}
+
+// parseDisposition parses the disposition object from ffprobe's JSON output.
+func parseDisposition(m map[string]int) Disposition {
+	var d Disposition
+	for _, f := range dispositionFlags {
+		*f.flag(&d) = m[f.name] != 0
+	}
+	return d
+}
+
+// String returns a comma separated list of the set flags' labels.
+func (d Disposition) String() string {
+	labels := []string{}
+	for _, f := range dispositionFlags {
+		if *f.flag(&d) {
+			labels = append(labels, f.label)
+		}
+	}
+	return strings.Join(labels, ", ")
+}
+
+// arg returns the value for ffmpeg's -disposition option.
+func (d Disposition) arg() string {
+	names := []string{}
+	for _, f := range dispositionFlags {
+		if *f.flag(&d) {
+			names = append(names, f.name)
+		}
+	}
+	if len(names) <= 0 {
+		return "0"
+	}
+	return strings.Join(names, "+")
+}
+
+// streamDisposition returns the disposition and title of the given stream.
+func streamDisposition(s SourceStream) (Disposition, string) {
+	switch st := s.(type) {
+	case *AudioStream:
+		return st.Disposition, st.Title
+	case *SubtitleStream:
+		return st.Disposition, st.Title
+	}
+	return Disposition{}, ""
+}
+
+// describeExtras returns the description of the title and disposition to
+// append to a stream's description.
+func describeExtras(title string, d Disposition) string {
+	s := ""
+	if title != "" {
+		s += fmt.Sprintf(", title %q", title)
+	}
+	if flags := d.String(); flags != "" {
+		s += ", " + flags
+	}
+	return s
+}
+
+// dispositionArgs returns the ffmpeg output arguments to set the dispositions of
+// the given audio and subtitle streams. Dispositions are only written if any of
+// the streams has one. The first audio stream that is not an audio description
+// becomes the default audio track.
+func dispositionArgs(streams []SourceStream) []string {
+	audio := FilterStreams(streams, IsAudioStream)
+	subtitles := FilterStreams(streams, IsSubtitleStream)
+	known := false
+	for _, s := range append(audio, subtitles...) {
+		if d, _ := streamDisposition(s); d != (Disposition{}) {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return nil
+	}
+
+	defaultAudio := 0
+	for i, s := range audio {
+		if !IsAudioDescription(s) {
+			defaultAudio = i
+			break
+		}
+	}
+
+	args := []string{}
+	for i, s := range audio {
+		d, _ := streamDisposition(s)
+		d.Default = i == defaultAudio
+		args = append(args, fmt.Sprintf("-disposition:a:%d", i), d.arg())
+	}
+	for i, s := range subtitles {
+		d, _ := streamDisposition(s)
+		args = append(args, fmt.Sprintf("-disposition:s:%d", i), d.arg())
+	}
+	return args
+}
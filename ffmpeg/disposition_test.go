@@ -0,0 +1,151 @@
+package ffmpeg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parseDisposition(t *testing.T) {
+	tests := []struct {
+		name string
+		m    map[string]int
+		want Disposition
+	}{
+		{name: "Nil"},
+		{
+			name: "Flags",
+			m:    map[string]int{"default": 1, "forced": 0, "visual_impaired": 1, "karaoke": 1},
+			want: Disposition{Default: true, VisualImpaired: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseDisposition(tt.m); got != tt.want {
+				t.Errorf("parseDisposition() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisposition_String(t *testing.T) {
+	tests := []struct {
+		name    string
+		d       Disposition
+		want    string
+		wantArg string
+	}{
+		{name: "None", want: "", wantArg: "0"},
+		{
+			name:    "AudioDescription",
+			d:       Disposition{Default: true, VisualImpaired: true},
+			want:    "default, audio description",
+			wantArg: "default+visual_impaired",
+		},
+		{
+			name:    "ForcedSdh",
+			d:       Disposition{Forced: true, HearingImpaired: true},
+			want:    "forced, hearing impaired",
+			wantArg: "forced+hearing_impaired",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.d.String(); got != tt.want {
+				t.Errorf("Disposition.String() = %q, want %q", got, tt.want)
+			}
+			if got := tt.d.arg(); got != tt.wantArg {
+				t.Errorf("Disposition.arg() = %q, want %q", got, tt.wantArg)
+			}
+		})
+	}
+}
+
+func TestSourceStream_StringWithDisposition(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream SourceStream
+		want   string
+	}{
+		{
+			name: "Audio",
+			stream: &AudioStream{
+				Stream:        Stream{Index: 1, CodecName: "aac"},
+				SampleRate:    48000,
+				Channels:      2,
+				ChannelLayout: "stereo",
+				Language:      "de",
+				Title:         "Audiodeskription",
+				Disposition:   Disposition{VisualImpaired: true},
+			},
+			want: `aac, sample rate 48000Hz, 2 channels (stereo), language "de", title "Audiodeskription", audio description (stream #1)`,
+		},
+		{
+			name: "AudioPlain",
+			stream: &AudioStream{
+				Stream:        Stream{Index: 1, CodecName: "aac"},
+				SampleRate:    48000,
+				Channels:      2,
+				ChannelLayout: "stereo",
+				Language:      "de",
+			},
+			want: `aac, sample rate 48000Hz, 2 channels (stereo), language "de" (stream #1)`,
+		},
+		{
+			name: "Subtitle",
+			stream: &SubtitleStream{
+				Stream:      Stream{Index: 4, CodecName: "webvtt"},
+				Language:    "de",
+				Disposition: Disposition{HearingImpaired: true},
+			},
+			want: `webvtt, language "de", hearing impaired (stream #4)`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.stream.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_dispositionArgs(t *testing.T) {
+	video := &VideoStream{Stream: Stream{Index: 0}}
+	main := &AudioStream{Stream: Stream{Index: 1}}
+	ad := &AudioStream{Stream: Stream{Index: 2}, Disposition: Disposition{Default: true, VisualImpaired: true}}
+	sdh := &SubtitleStream{Stream: Stream{Index: 3}, Disposition: Disposition{HearingImpaired: true}}
+	plainSub := &SubtitleStream{Stream: Stream{Index: 4}}
+
+	tests := []struct {
+		name    string
+		streams []SourceStream
+		want    []string
+	}{
+		{
+			name:    "NoDispositions",
+			streams: []SourceStream{main, video, plainSub},
+		},
+		{
+			name:    "AudioDescriptionNotDefault",
+			streams: []SourceStream{ad, main, video, sdh, plainSub},
+			want: []string{
+				"-disposition:a:0", "visual_impaired",
+				"-disposition:a:1", "default",
+				"-disposition:s:0", "hearing_impaired",
+				"-disposition:s:1", "0",
+			},
+		},
+		{
+			name:    "OnlyAudioDescription",
+			streams: []SourceStream{ad, video},
+			want:    []string{"-disposition:a:0", "default+visual_impaired"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dispositionArgs(tt.streams); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dispositionArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,33 +4,107 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"time"
 
 	e "github.com/rokeller/zt-dl/exec"
+	"github.com/rokeller/zt-dl/ratelimit"
 )
 
+// Downloadable is an input which can be downloaded to an output, i.e. a single
+// input or several joined inputs.
+type Downloadable interface {
+	DetectStreams(ctx context.Context) error
+	Duration() time.Duration
+	Streams() []SourceStream
+	StreamInfo() StreamInfo
+	Download(ctx context.Context, selector StreamsSelector, progress DownloadProgressHandler) error
+}
+
 type downloadable struct {
+	// input provides the URL of the input, and fresh URLs when it expired.
+	input UrlProvider
+	// inputUrl is the URL of the input got from its provider.
 	inputUrl   string
 	outputPath string
 
-	overwrite bool
+	overwrite      bool
+	container      Container
+	profile        *TranscodingProfile
+	subtitleMode   SubtitleMode
+	subtitleFormat SubtitleFormat
+	subtitlesOnly  bool
+	postProcessors []PostProcessor
+	metadata       *Metadata
+	coverArtUrl    string
+	stagingDir     string
+	warnOnLowSpace bool
+	postHook       *PostHook
+	hookMetadata   *Metadata
+	limiter        *ratelimit.Limiter
+	split          Split
+	// concat tells whether the input is a list of files for ffmpeg's concat
+	// demuxer.
+	concat bool
+	// pipe receives the main output if it is streamed instead of written to
+	// the output path.
+	pipe io.Writer
+	// namedPipe tells whether the output path is an existing named pipe, to
+	// which the main output is streamed.
+	namedPipe bool
+	// messages receives informational messages about the download.
+	messages io.Writer
+
+	// staged is the staging of the files written by the running download.
+	staged *staging
+	// partLength is the duration of the parts of the running download, zero
+	// if its output is not split.
+	partLength time.Duration
+	// completedParts is the number of parts of the running download which
+	// were completed before its input URL expired, and resumeAt is the
+	// position in the input after them.
+	completedParts int
+	resumeAt       time.Duration
+	// parts are the paths of the parts of the split output of the last
+	// successful download.
+	parts []string
 
-	format  format
-	streams []SourceStream
+	fullProbe bool
+	detected  bool
+	format    format
+	streams   []SourceStream
+	warnings  []string
 }
 
+// NewDownloadable creates a downloadable of the input with the URL from the
+// given provider, which is asked for a fresh URL when the URL expires during
+// the download.
 func NewDownloadable(
-	inputUrl, outputPath string,
+	input UrlProvider,
+	outputPath string,
 	options ...DownloadableOption,
 ) *downloadable {
 	d := &downloadable{
-		inputUrl:   inputUrl,
+		input:      input,
 		outputPath: outputPath,
 	}
 	for _, option := range options {
 		option(d)
 	}
+	d.namedPipe = isNamedPipe(outputPath)
+	if d.streaming() {
+		// The output has no file name to derive the container from.
+		if d.outputContainer() == "" {
+			d.container = ContainerMatroska
+		}
+	} else if d.container != "" && filepath.Ext(d.outputPath) == "" {
+		d.outputPath += "." + string(d.container)
+	}
 	return d
 }
 
@@ -39,83 +113,453 @@ func (d *downloadable) Download(
 	selector StreamsSelector,
 	progress DownloadProgressHandler,
 ) error {
+	if nil == progress {
+		progress = d.consoleProgressHandler()
+	}
+
+	streams, err := d.download(ctx, selector, progress)
+	d.runPostHook(ctx, streams, err, progress)
+	return err
+}
+
+// download downloads the selected streams and returns them.
+func (d *downloadable) download(
+	ctx context.Context,
+	selector StreamsSelector,
+	progress DownloadProgressHandler,
+) ([]SourceStream, error) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	durationMsec := d.format.Duration.Milliseconds()
 	if nil == d.streams || len(d.streams) <= 0 {
-		return errors.New("no streams available for download")
+		return nil, errors.New("no streams available for download")
 	}
 	streams, err := selector.SelectStreams(d.streams)
 	if nil != err {
-		return fmt.Errorf("failed to select streams to download: %w", err)
+		return nil, fmt.Errorf("failed to select streams to download: %w", err)
 	} else if len(streams) <= 0 {
-		return errors.New("no streams selected for download")
+		return nil, errors.New("no streams selected for download")
 	}
 
-	args := []string{
-		"-protocol_whitelist", protocolWhiteList,
-		"-i", d.inputUrl,
+	subtitleMode := d.subtitleMode
+	if sms, ok := selector.(SubtitleModeSelector); ok && sms.SelectedSubtitleMode() != "" {
+		subtitleMode = sms.SelectedSubtitleMode()
 	}
 
-	if d.overwrite {
-		args = append(args, "-y")
-	} else {
-		args = append(args, "-n")
+	d.parts = nil
+	d.completedParts, d.resumeAt = 0, 0
+	d.partLength, err = d.partDuration(streams)
+	if nil != err {
+		return streams, err
 	}
 
-	fmt.Printf("Duration: %s\n", d.format.Duration)
-	fmt.Println("Selected stream(s) for download:")
+	if err := d.checkStreamable(subtitleMode); nil != err {
+		return streams, err
+	}
+	if !d.overwrite && !d.streaming() {
+		if err := d.checkTargets(streams, subtitleMode); nil != err {
+			return streams, err
+		}
+	}
+
+	if !d.streaming() {
+		d.staged, err = d.newStaging()
+		if nil != err {
+			return streams, err
+		}
+	}
+	defer func() {
+		if nil != d.staged {
+			d.staged.discard()
+			d.staged = nil
+		}
+	}()
+
+	// Report invalid outputs before starting anything.
+	if _, err := d.outputArgs(streams, subtitleMode); nil != err {
+		return streams, err
+	}
+	if err := d.resolveInputUrl(ctx); nil != err {
+		return streams, err
+	}
+
+	var proxy *ratelimit.Proxy
+	if nil != d.limiter {
+		proxy, err = ratelimit.StartProxy(d.limiter)
+		if nil != err {
+			return streams, err
+		}
+		defer proxy.Close()
+	}
+
+	out := d.messageWriter()
+	fmt.Fprintf(out, "Duration: %s\n", d.format.Duration)
+	fmt.Fprintln(out, "Selected stream(s) for download:")
 	for i, s := range streams {
-		t := "Unknown"
-		switch s.(type) {
-		case *AudioStream:
-			t = "Audio"
-		case *SubtitleStream:
-			t = "Subtitle"
-		case *VideoStream:
-			t = "Video"
-		}
-		fmt.Printf("    [%0d] %s: %s\n", i+1, t, s.String())
-		args = append(args, "-map", fmt.Sprintf("0:%d", s.Index()))
+		fmt.Fprintf(out, "    [%0d] %s: %s\n", i+1, StreamType(s), s.String())
 	}
 
-	args = append(args, "-c", "copy", d.outputPath)
-	ffmpegCmd := e.CmdFactory(ctx, "ffmpeg", args...)
-	stderr, err := ffmpegCmd.StderrPipe()
-	if nil != err {
-		return fmt.Errorf("failed to redirect stderr to pipe: %w", err)
+	if size := d.EstimateSize(streams); size > 0 {
+		fmt.Fprintf(out, "Estimated size: %s\n", FormatSize(size))
+		// Streamed outputs don't take up space on the local disks.
+		if !d.streaming() {
+			if err := d.checkFreeSpace(size); nil != err {
+				return streams, err
+			}
+		}
+		if seh, ok := progress.(SizeEstimateHandler); ok {
+			seh.SizeEstimated(size)
+		}
 	}
 
-	if nil == progress {
-		progress = consoleProgressHandler{
-			target:     os.Stdout,
-			outputPath: d.outputPath,
+	if nil != d.limiter {
+		fmt.Fprintf(out, "Rate limit: %s\n", d.limiter.Limit())
+	}
+
+	// Now run ffmpeg, again with a fresh input URL if the URL expires.
+	start := time.Now().UTC()
+	progress.Start()
+	for refreshes := 0; ; refreshes++ {
+		args, err := d.ffmpegArgs(streams, subtitleMode, proxy)
+		if nil != err {
+			progress.Error(err)
+			return streams, err
+		}
+		err = d.runFfmpeg(ctx, args, start, progress, proxy)
+		if nil == err {
+			break
+		} else if !d.retryExpired(ctx, err, refreshes, subtitleMode) {
+			progress.Error(err)
+			return streams, err
 		}
 	}
+	if d.splitting() {
+		os.Remove(d.segmentListPath())
+	}
+
+	// Post processors only apply to the main output, and only if it was
+	// written to a file.
+	var outputs []string
+	if !d.subtitlesOnly && !d.streaming() {
+		outputs, err = d.outputPaths()
+		if nil != err {
+			progress.Error(err)
+			return streams, err
+		}
+		if d.splitting() && d.hasCoverArt() {
+			err := d.attachCoverArt(ctx, outputs, streams, inputArgs(d.coverArtUrl, proxy), progress)
+			if nil != err {
+				progress.Error(err)
+				return streams, err
+			}
+		}
+		if nil != d.profile && nil != d.profile.Loudness {
+			if err := d.normalizeLoudness(ctx, outputs, streams, progress); nil != err {
+				progress.Error(err)
+				return streams, err
+			}
+		}
+		if err := d.postProcess(ctx, outputs, streams, progress); nil != err {
+			progress.Error(err)
+			return streams, err
+		}
+		if d.splitting() {
+			d.warnOversizedParts(outputs)
+		}
+	}
+
+	if nil != d.staged {
+		if err := d.staged.commit(d.overwrite); nil != err {
+			progress.Error(err)
+			return streams, err
+		}
+		d.staged = nil
+	}
+	if d.splitting() {
+		for _, output := range outputs {
+			d.parts = append(d.parts, filepath.Join(filepath.Dir(d.outputPath), filepath.Base(output)))
+		}
+		if ph, ok := progress.(PartsHandler); ok {
+			ph.PartsWritten(d.parts)
+		}
+	}
+	if !d.streaming() && (d.subtitlesOnly || subtitleMode.sidecars()) {
+		if sh, ok := progress.(SidecarsHandler); ok {
+			sidecars, _ := d.subtitleSidecars(streams)
+			paths := make([]string, len(sidecars))
+			for i, sidecar := range sidecars {
+				paths[i] = sidecar.path
+			}
+			sh.SidecarsWritten(paths)
+		}
+	}
+
+	progress.Finished()
+	return streams, nil
+}
+
+// ffmpegArgs returns the arguments for ffmpeg to download the selected streams.
+func (d *downloadable) ffmpegArgs(
+	streams []SourceStream,
+	subtitleMode SubtitleMode,
+	proxy *ratelimit.Proxy,
+) ([]string, error) {
+	outputArgs, err := d.outputArgs(streams, subtitleMode)
+	if nil != err {
+		return nil, err
+	}
+
+	args := d.mainInputArgs(proxy)
+	if d.embedsCoverArt() {
+		args = append(args, inputArgs(d.coverArtUrl, proxy)...)
+	}
+
+	if d.overwrite || d.streaming() {
+		// A named pipe always exists, and overwriting it writes to the pipe.
+		args = append(args, "-y")
+	} else {
+		args = append(args, "-n")
+	}
+	return append(args, outputArgs...), nil
+}
+
+// runFfmpeg runs ffmpeg with the given arguments for the download which started
+// at the given time, and classifies its failure.
+func (d *downloadable) runFfmpeg(
+	ctx context.Context,
+	args []string,
+	start time.Time,
+	progress DownloadProgressHandler,
+	proxy *ratelimit.Proxy,
+) error {
+	ffmpegCmd := e.CmdFactory(ctx, ffmpegBinary, args...)
+	ffmpegCmd.Stdout = d.pipe
+	stderr, err := ffmpegCmd.StderrPipe()
+	if nil != err {
+		return fmt.Errorf("failed to redirect stderr to pipe: %w", err)
+	}
 
 	tracker := downloadProgressTracker{
 		handler: progress,
 		source:  stderr,
+		tail:    newLogTail(logTailSize),
 
-		start:        time.Now().UTC(),
-		durationMsec: durationMsec,
+		start:        start,
+		offsetMsec:   d.resumeAt.Milliseconds(),
+		durationMsec: d.format.Duration.Milliseconds(),
+	}
+	if nil != proxy {
+		tracker.transfer = func() (int64, ratelimit.Rate) {
+			return proxy.Received(), d.limiter.Limit()
+		}
 	}
-	go tracker.trackProgress()
+	tracked := make(chan struct{})
+	go func() {
+		defer close(tracked)
+		tracker.trackProgress()
+	}()
 
-	// Now start the ffmpeg process ...
-	progress.Start()
 	if err := ffmpegCmd.Start(); nil != err {
-		finalErr := fmt.Errorf("failed to start ffmpeg: %w", err)
-		progress.Error(finalErr)
-		return finalErr
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
 	}
 
+	// All output must be read before waiting, as Wait closes the pipe.
+	<-tracked
 	if err := ffmpegCmd.Wait(); nil != err {
-		finalErr := fmt.Errorf("ffmpeg failed: %w", err)
-		progress.Error(finalErr)
-		return finalErr
+		return classifyFailure(ctx, err, tracker.tail.Lines())
 	}
-	progress.Finished()
 	return nil
 }
+
+// inputArgs returns the ffmpeg arguments to read the input at the given URL,
+// through the rate limiting proxy if set.
+func inputArgs(inputUrl string, proxy *ratelimit.Proxy) []string {
+	if nil == proxy {
+		return []string{"-protocol_whitelist", protocolWhiteList, "-i", inputUrl}
+	}
+	return []string{
+		"-protocol_whitelist", proxiedProtocolWhiteList,
+		"-http_proxy", proxy.URL(),
+		"-i", inputUrl,
+	}
+}
+
+// mainInputArgs returns the ffmpeg arguments to read the main input.
+func (d *downloadable) mainInputArgs(proxy *ratelimit.Proxy) []string {
+	if d.concat {
+		return []string{"-f", "concat", "-safe", "0", "-i", d.inputUrl}
+	}
+	if d.resumeAt > 0 {
+		return append(
+			[]string{"-ss", strconv.FormatFloat(d.resumeAt.Seconds(), 'f', -1, 64)},
+			inputArgs(d.inputUrl, proxy)...)
+	}
+	return inputArgs(d.inputUrl, proxy)
+}
+
+// outputArgs returns the ffmpeg arguments for the main output and any subtitle
+// sidecar outputs of the given selected streams.
+func (d *downloadable) outputArgs(streams []SourceStream, subtitleMode SubtitleMode) ([]string, error) {
+	embedded := streams
+	if d.subtitlesOnly || !subtitleMode.embeds() {
+		embedded = FilterStreams(streams, func(s SourceStream) bool { return !IsSubtitleStream(s) })
+	}
+
+	args := []string{}
+	if !d.subtitlesOnly {
+		mainArgs, err := d.mainOutputArgs(embedded)
+		if nil != err {
+			return nil, err
+		}
+		args = append(args, mainArgs...)
+	}
+
+	if d.subtitlesOnly || subtitleMode.sidecars() {
+		sidecars, err := d.subtitleSidecars(streams)
+		if nil != err {
+			return nil, err
+		} else if d.subtitlesOnly && len(sidecars) <= 0 {
+			return nil, errors.New("no subtitle streams selected for download")
+		}
+		for _, sidecar := range sidecars {
+			args = append(args, sidecar.args()...)
+		}
+	}
+
+	return args, nil
+}
+
+// checkTargets returns an error if the main output or any of the subtitle
+// sidecar files to write for the given streams already exist.
+func (d *downloadable) checkTargets(streams []SourceStream, subtitleMode SubtitleMode) error {
+	targets := []string{}
+	if d.splitting() {
+		for part := 1; part <= d.partCount(); part++ {
+			targets = append(targets, partPath(d.outputPath, part))
+		}
+	} else if !d.subtitlesOnly {
+		targets = append(targets, d.outputPath)
+	}
+	if d.subtitlesOnly || subtitleMode.sidecars() {
+		// Invalid sidecars are reported when building the ffmpeg arguments.
+		sidecars, _ := d.subtitleSidecars(streams)
+		for _, sidecar := range sidecars {
+			targets = append(targets, sidecar.path)
+		}
+	}
+	for _, target := range targets {
+		if err := checkNotExists(target); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePath returns the path ffmpeg writes the main output to, which is in the
+// staging directory while downloading, or ffmpeg's stdout if it is piped.
+func (d *downloadable) writePath() string {
+	if nil != d.pipe {
+		return pipeOutput
+	}
+	if nil != d.staged {
+		return d.staged.path(d.outputPath)
+	}
+	return d.outputPath
+}
+
+// outputContainer returns the explicitly set container or the one implied by
+// the output path.
+func (d *downloadable) outputContainer() Container {
+	if d.container != "" {
+		return d.container
+	}
+	return ContainerFromPath(d.outputPath)
+}
+
+// hasCoverArt tells whether cover art gets attached to the main output.
+func (d *downloadable) hasCoverArt() bool {
+	return d.coverArtUrl != "" && !d.subtitlesOnly &&
+		containerSpecs[d.outputContainer()].coverArt
+}
+
+// embedsCoverArt tells whether ffmpeg attaches the cover art while downloading,
+// which it does unless the output is split into parts.
+func (d *downloadable) embedsCoverArt() bool {
+	return d.hasCoverArt() && !d.splitting()
+}
+
+func (d *downloadable) mainOutputArgs(streams []SourceStream) ([]string, error) {
+	container := d.outputContainer()
+	profile := d.profile
+	var subtitleConversions map[int]string
+	if container != "" {
+		profile = container.transcodingProfile(profile, streams)
+		outputStreams := streams
+		if nil != profile {
+			outputStreams = profile.outputStreams(streams)
+		}
+		conversions, err := container.checkStreams(outputStreams)
+		if nil != err {
+			return nil, fmt.Errorf("selected streams cannot be stored in the output container: %w", err)
+		}
+		subtitleConversions = conversions
+	}
+
+	args := []string{}
+	for _, s := range streams {
+		args = append(args, "-map", fmt.Sprintf("0:%d", s.Index()))
+	}
+
+	if d.embedsCoverArt() {
+		args = append(args, "-map", "1:0")
+	}
+
+	args = append(args, "-c", "copy")
+	videoStreams := len(FilterStreams(streams, IsVideoStream))
+	if nil != profile {
+		args = append(args, profile.args(videoStreams, d.embedsCoverArt())...)
+	}
+	for _, i := range slices.Sorted(maps.Keys(subtitleConversions)) {
+		args = append(args, fmt.Sprintf("-c:s:%d", i), subtitleConversions[i])
+	}
+	args = append(args, dispositionArgs(streams)...)
+	if d.embedsCoverArt() {
+		// The cover art follows all selected video streams and is never
+		// transcoded.
+		args = append(args,
+			fmt.Sprintf("-c:v:%d", videoStreams), "copy",
+			fmt.Sprintf("-disposition:v:%d", videoStreams), "attached_pic")
+	}
+	if nil != d.metadata {
+		args = append(args, d.metadata.args()...)
+	}
+	if d.splitting() {
+		return append(args, d.splitArgs()...), nil
+	}
+	if d.container != "" || d.streaming() {
+		args = append(args, "-f", containerSpecs[d.outputContainer()].muxer)
+	}
+	return append(args, d.writePath()), nil
+}
+
+// messageWriter returns the writer for informational messages about the
+// download, which is stderr by default if the output is streamed to stdout.
+func (d *downloadable) messageWriter() io.Writer {
+	if nil != d.messages {
+		return d.messages
+	}
+	if d.streaming() {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// consoleProgressHandler returns the handler which reports progress of the
+// download on the console, along with the informational messages.
+func (d *downloadable) consoleProgressHandler() *consoleProgressHandler {
+	return &consoleProgressHandler{
+		target:        d.messageWriter(),
+		outputPath:    d.outputPath,
+		subtitlesOnly: d.subtitlesOnly,
+	}
+}
@@ -1,5 +1,11 @@
 package ffmpeg
 
+import (
+	"io"
+
+	"github.com/rokeller/zt-dl/ratelimit"
+)
+
 type DownloadableOption func(*downloadable)
 
 func WithOverwrite(overwrite bool) DownloadableOption {
@@ -7,3 +13,151 @@ func WithOverwrite(overwrite bool) DownloadableOption {
 		d.overwrite = overwrite
 	}
 }
+
+// WithContainer explicitly sets the container format of the output instead of
+// deriving it from the output file's extension.
+func WithContainer(container Container) DownloadableOption {
+	return func(d *downloadable) {
+		d.container = container
+	}
+}
+
+// WithTranscodingProfile transcodes streams according to the given profile
+// instead of copying them.
+func WithTranscodingProfile(profile TranscodingProfile) DownloadableOption {
+	return func(d *downloadable) {
+		d.profile = &profile
+	}
+}
+
+// WithSubtitleMode sets whether subtitles get embedded in the output, written
+// to sidecar files, or both.
+func WithSubtitleMode(mode SubtitleMode) DownloadableOption {
+	return func(d *downloadable) {
+		d.subtitleMode = mode
+	}
+}
+
+// WithSubtitleFormat sets the format of subtitle sidecar files. If not set,
+// WebVTT subtitles are written as-is and all others get converted to SRT.
+func WithSubtitleFormat(format SubtitleFormat) DownloadableOption {
+	return func(d *downloadable) {
+		d.subtitleFormat = format
+	}
+}
+
+// WithSubtitlesOnly only writes the selected subtitle streams to sidecar files
+// without writing the main output.
+func WithSubtitlesOnly(subtitlesOnly bool) DownloadableOption {
+	return func(d *downloadable) {
+		d.subtitlesOnly = subtitlesOnly
+	}
+}
+
+func WithPostProcessors(postProcessors ...PostProcessor) DownloadableOption {
+	return func(d *downloadable) {
+		d.postProcessors = append(d.postProcessors, postProcessors...)
+	}
+}
+
+// WithMetadata writes the given program metadata to the tags of the output.
+func WithMetadata(metadata Metadata) DownloadableOption {
+	return func(d *downloadable) {
+		d.metadata = &metadata
+	}
+}
+
+// WithCoverArt attaches the image at the given URL as cover art to the output,
+// if the output container supports it.
+func WithCoverArt(url string) DownloadableOption {
+	return func(d *downloadable) {
+		d.coverArtUrl = url
+	}
+}
+
+// WithStagingDir sets the directory in which downloads are staged until they
+// are complete, e.g. on a fast local disk. By default, downloads are staged in
+// a hidden directory next to the output.
+func WithStagingDir(dir string) DownloadableOption {
+	return func(d *downloadable) {
+		d.stagingDir = dir
+	}
+}
+
+// WithWarnOnLowSpace only warns instead of refusing to download when the
+// estimated size of the output exceeds the free disk space.
+func WithWarnOnLowSpace(warnOnLowSpace bool) DownloadableOption {
+	return func(d *downloadable) {
+		d.warnOnLowSpace = warnOnLowSpace
+	}
+}
+
+// WithPostHook runs the given command after the download.
+func WithPostHook(hook PostHook) DownloadableOption {
+	return func(d *downloadable) {
+		d.postHook = &hook
+	}
+}
+
+// WithHookMetadata passes the given program metadata to the post-download
+// hook, without writing it to the tags of the output.
+func WithHookMetadata(metadata Metadata) DownloadableOption {
+	return func(d *downloadable) {
+		d.hookMetadata = &metadata
+	}
+}
+
+// WithFullProbe sets whether the streams of HLS inputs are always detected with
+// ffprobe, instead of from the master playlist which is much faster.
+func WithFullProbe(fullProbe bool) DownloadableOption {
+	return func(d *downloadable) {
+		d.fullProbe = fullProbe
+	}
+}
+
+// WithStreamInfo uses the given, previously detected duration and streams such
+// that DetectStreams doesn't need to detect them again.
+func WithStreamInfo(info StreamInfo) DownloadableOption {
+	return func(d *downloadable) {
+		d.format = format{Duration: info.Duration}
+		d.streams = info.Streams
+		d.warnings = info.Warnings
+		d.detected = true
+	}
+}
+
+// WithRateLimiter limits the rate at which the input is downloaded. The limiter
+// may be shared by several downloads to limit their total rate.
+func WithRateLimiter(limiter *ratelimit.Limiter) DownloadableOption {
+	return func(d *downloadable) {
+		d.limiter = limiter
+	}
+}
+
+// WithSplit splits the main output into parts by duration or size, which are
+// named like <base>.part01.mkv. Outputs which fit into a single part are not
+// split.
+func WithSplit(split Split) DownloadableOption {
+	return func(d *downloadable) {
+		d.split = split
+	}
+}
+
+// WithPipe streams the main output to the given writer, e.g. stdout, instead
+// of writing it to the output path. Only containers which can be written
+// without seeking can be streamed, and streamed outputs cannot be split or
+// post-processed.
+func WithPipe(w io.Writer) DownloadableOption {
+	return func(d *downloadable) {
+		d.pipe = w
+	}
+}
+
+// WithMessages writes informational messages about the download, e.g. the
+// selected streams, and the progress reported on the console to the given
+// writer. They go to stdout by default, or to stderr if the output is streamed.
+func WithMessages(w io.Writer) DownloadableOption {
+	return func(d *downloadable) {
+		d.messages = w
+	}
+}
@@ -2,12 +2,16 @@ package ffmpeg
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/exec"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	e "github.com/rokeller/zt-dl/exec"
+	"github.com/rokeller/zt-dl/ratelimit"
 	"github.com/rokeller/zt-dl/test"
 )
 
@@ -50,10 +54,26 @@ func TestNewDownloadable(t *testing.T) {
 				overwrite:  false,
 			},
 		},
+		{
+			name:       "Options/Container",
+			inputUrl:   "zxcv",
+			outputPath: "uiop",
+			options:    []DownloadableOption{WithContainer(ContainerMatroska)},
+			want: &downloadable{
+				inputUrl:   "zxcv",
+				outputPath: "uiop.mkv",
+				container:  ContainerMatroska,
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := NewDownloadable(tt.inputUrl, tt.outputPath, tt.options...)
+			got := NewDownloadable(StaticUrl(tt.inputUrl), tt.outputPath, tt.options...)
+			if err := got.resolveInputUrl(t.Context()); nil != err {
+				t.Fatalf("resolveInputUrl() got error %v, want nil", err)
+			}
+			// Functions cannot be compared.
+			got.input = nil
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("NewDownloadable() = %v, want %v", got, tt.want)
 			}
@@ -121,7 +141,7 @@ func Test_downloadable_Download_ffmpeg_WithOverwrite(t *testing.T) {
 			"-map", "0:0",
 			"-map", "0:2",
 			"-c", "copy",
-			"target.mp4",
+			stagedPath("target.mp4"),
 		)
 		os.Exit(0)
 		return
@@ -132,7 +152,7 @@ func Test_downloadable_Download_ffmpeg_WithOverwrite(t *testing.T) {
 		return test.TestCommandContext(t, me, ctx, name, arg...)
 	}
 
-	d := NewDownloadable("https://foo.bar.com/source", "target.mp4", WithOverwrite(true))
+	d := NewDownloadable(StaticUrl("https://foo.bar.com/source"), "target.mp4", WithOverwrite(true))
 	d.streams = []SourceStream{
 		&AudioStream{
 			Stream: Stream{
@@ -168,7 +188,7 @@ func Test_downloadable_Download_ffmpeg_WithoutOverwrite(t *testing.T) {
 			"-map", "0:0",
 			"-map", "0:2",
 			"-c", "copy",
-			"target.mp4",
+			stagedPath("target.mp4"),
 		)
 		os.Exit(0)
 		return
@@ -179,7 +199,7 @@ func Test_downloadable_Download_ffmpeg_WithoutOverwrite(t *testing.T) {
 		return test.TestCommandContext(t, me, ctx, name, arg...)
 	}
 
-	d := NewDownloadable("https://foo.bar.com/source", "target.mp4", WithOverwrite(false))
+	d := NewDownloadable(StaticUrl("https://foo.bar.com/source"), "target.mp4", WithOverwrite(false))
 	d.streams = []SourceStream{
 		&AudioStream{
 			Stream: Stream{
@@ -203,3 +223,177 @@ func Test_downloadable_Download_ffmpeg_WithoutOverwrite(t *testing.T) {
 		t.Errorf("downloadable.Download() got error %v, want nil", err)
 	}
 }
+
+func Test_downloadable_Download_ffmpeg_WithContainer(t *testing.T) {
+	if test.IsTestCall() {
+		test.AssertArgs(
+			"ffmpeg",
+			"-protocol_whitelist", "https,tls,tcp",
+			"-i", "https://foo.bar.com/source",
+			"-n",
+			"-map", "0:0",
+			"-map", "0:2",
+			"-map", "0:3",
+			"-c", "copy",
+			"-c:s:0", "mov_text",
+			"-f", "mp4",
+			stagedPath("target.mkv"),
+		)
+		os.Exit(0)
+		return
+	}
+
+	me := test.CallerFuncName(0)
+	e.CmdFactory = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		return test.TestCommandContext(t, me, ctx, name, arg...)
+	}
+
+	d := NewDownloadable(StaticUrl("https://foo.bar.com/source"), "target.mkv", WithContainer(ContainerMp4))
+	d.streams = []SourceStream{
+		&AudioStream{Stream: Stream{Index: 0, CodecName: "aac"}, SampleRate: 1234},
+		&VideoStream{Stream: Stream{Index: 2, CodecName: "h264"}, Width: 987, Height: 876},
+		&SubtitleStream{Stream: Stream{Index: 3, CodecName: "webvtt"}, Language: "de"},
+	}
+	err := d.Download(t.Context(), NewBestStreamsSelector(), nil)
+	if nil != err {
+		t.Errorf("downloadable.Download() got error %v, want nil", err)
+	}
+}
+
+func Test_downloadable_Download_IncompatibleContainer(t *testing.T) {
+	d := NewDownloadable(StaticUrl("https://foo.bar.com/source"), "target.ts")
+	d.streams = []SourceStream{
+		&AudioStream{Stream: Stream{Index: 0, CodecName: "aac"}, SampleRate: 1234},
+		&VideoStream{Stream: Stream{Index: 2, CodecName: "h264"}, Width: 987, Height: 876},
+		&SubtitleStream{Stream: Stream{Index: 3, CodecName: "webvtt"}, Language: "de"},
+	}
+	err := d.Download(t.Context(), NewBestStreamsSelector(), nil)
+	if nil == err {
+		t.Error("downloadable.Download() succeeded unexpectedly")
+	}
+}
+
+func Test_downloadable_Download_ffmpeg_WithTranscodingProfile(t *testing.T) {
+	if test.IsTestCall() {
+		test.AssertArgs(
+			"ffmpeg",
+			"-protocol_whitelist", "https,tls,tcp",
+			"-i", "https://foo.bar.com/source",
+			"-n",
+			"-map", "0:0",
+			"-map", "0:2",
+			"-c", "copy",
+			"-c:a", "aac", "-b:a", "192k", "-ac:a", "2",
+			stagedPath("target.mp4"),
+		)
+		os.Exit(0)
+		return
+	}
+
+	me := test.CallerFuncName(0)
+	e.CmdFactory = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		return test.TestCommandContext(t, me, ctx, name, arg...)
+	}
+
+	profile, _ := LookupProfile("stereo-aac", nil)
+	d := NewDownloadable(StaticUrl("https://foo.bar.com/source"), "target.mp4", WithTranscodingProfile(profile))
+	d.streams = []SourceStream{
+		&AudioStream{Stream: Stream{Index: 0, CodecName: "pcm_s16le"}, SampleRate: 1234},
+		&VideoStream{Stream: Stream{Index: 2, CodecName: "h264"}, Width: 987, Height: 876},
+	}
+	err := d.Download(t.Context(), NewBestStreamsSelector(), nil)
+	if nil != err {
+		t.Errorf("downloadable.Download() got error %v, want nil", err)
+	}
+}
+
+func Test_downloadable_Download_ffmpeg_AudioOnlyWithMetadata(t *testing.T) {
+	if test.IsTestCall() {
+		test.AssertArgs(
+			"ffmpeg",
+			"-protocol_whitelist", "https,tls,tcp",
+			"-i", "https://foo.bar.com/source",
+			"-protocol_whitelist", "https,tls,tcp",
+			"-i", "https://foo.bar.com/cover.jpg",
+			"-n",
+			"-map", "0:1",
+			"-map", "1:0",
+			"-c", "copy",
+			"-c:a", "libmp3lame", "-q:a", "2",
+			"-c:v:0", "copy",
+			"-disposition:v:0", "attached_pic",
+			"-metadata", "title=Live at the Park - Part 1",
+			"-metadata", "show=Live at the Park",
+			"-metadata", "album=Live at the Park",
+			"-metadata", "episode_id=Part 1",
+			"-metadata", "artist=Radio One",
+			"-metadata", "network=Radio One",
+			"-metadata", "date=2025",
+			stagedPath("target.mp3"),
+		)
+		os.Exit(0)
+		return
+	}
+
+	me := test.CallerFuncName(0)
+	e.CmdFactory = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		return test.TestCommandContext(t, me, ctx, name, arg...)
+	}
+
+	d := NewDownloadable(StaticUrl("https://foo.bar.com/source"), "target.mp3",
+		WithMetadata(Metadata{
+			Title:        "Live at the Park",
+			EpisodeTitle: "Part 1",
+			Channel:      "Radio One",
+			Year:         2025,
+		}),
+		WithCoverArt("https://foo.bar.com/cover.jpg"))
+	d.streams = []SourceStream{
+		&VideoStream{Stream: Stream{Index: 0, CodecName: "h264"}, Width: 987, Height: 876},
+		&AudioStream{Stream: Stream{Index: 1, CodecName: "aac"}, SampleRate: 48000},
+		&SubtitleStream{Stream: Stream{Index: 2, CodecName: "webvtt"}, Language: "de"},
+	}
+	err := d.Download(t.Context(), NewAudioOnlyStreamsSelector(NewBestStreamsSelector()), nil)
+	if nil != err {
+		t.Errorf("downloadable.Download() got error %v, want nil", err)
+	}
+}
+
+func Test_downloadable_Download_ffmpeg_WithRateLimiter(t *testing.T) {
+	if test.IsTestCall() {
+		args := test.GetArgs()
+		if len(args) < 7 ||
+			args[2] != "https,tls,tcp,httpproxy" ||
+			args[3] != "-http_proxy" ||
+			!strings.HasPrefix(args[4], "http://127.0.0.1:") ||
+			args[6] != "https://foo.bar.com/source" {
+			os.Exit(1)
+		}
+		fmt.Fprintln(os.Stderr, "size=1024kB time=00:00:30.00 bitrate=1000kbits/s speed=1x")
+		os.Exit(0)
+		return
+	}
+
+	me := test.CallerFuncName(0)
+	e.CmdFactory = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		return test.TestCommandContext(t, me, ctx, name, arg...)
+	}
+
+	limiter := ratelimit.NewLimiter(ratelimit.Schedule{Limit: 2 * 1024 * 1024})
+	d := NewDownloadable(StaticUrl("https://foo.bar.com/source"), "target.mp4",
+		WithOverwrite(true), WithRateLimiter(limiter))
+	d.format.Duration = time.Minute
+	d.streams = []SourceStream{
+		&VideoStream{Stream: Stream{Index: 0}, Width: 1280, Height: 720},
+	}
+	h := &testProgressHandler{progressUpdates: []DownloadProgress{}}
+	if err := d.Download(t.Context(), NewBestStreamsSelector(), h); nil != err {
+		t.Fatalf("downloadable.Download() got error %v, want nil", err)
+	}
+	if len(h.progressUpdates) != 1 {
+		t.Fatalf("downloadable.Download() reported %d progress updates, want 1", len(h.progressUpdates))
+	}
+	if got := h.progressUpdates[0].RateLimit; got != 2*1024*1024 {
+		t.Errorf("downloadable.Download() reported rate limit %d, want %d", got, 2*1024*1024)
+	}
+}
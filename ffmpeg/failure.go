@@ -0,0 +1,147 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// FailureClass classifies why ffmpeg failed, such that users know what to do.
+type FailureClass string
+
+const (
+	FailureUnknown        FailureClass = "unknown"
+	FailureOutputExists   FailureClass = "output_exists"
+	FailureDiskFull       FailureClass = "disk_full"
+	FailureUnauthorized   FailureClass = "http_unauthorized"
+	FailureForbidden      FailureClass = "http_forbidden"
+	FailureNotFound       FailureClass = "http_not_found"
+	FailureGone           FailureClass = "http_gone"
+	FailureNetworkTimeout FailureClass = "network_timeout"
+	FailureUnsupported    FailureClass = "unsupported_format"
+	FailureCancelled      FailureClass = "cancelled"
+)
+
+// failurePatterns maps the failure classes to the ffmpeg log messages which
+// indicate them, in the order in which they are checked.
+var failurePatterns = []struct {
+	class    FailureClass
+	patterns []string
+}{
+	{FailureOutputExists, []string{"already exists. exiting"}},
+	{FailureDiskFull, []string{"no space left on device", "disk quota exceeded"}},
+	{FailureUnauthorized, []string{"401 unauthorized", "http error 401"}},
+	{FailureForbidden, []string{"403 forbidden", "http error 403"}},
+	{FailureNotFound, []string{"404 not found", "http error 404"}},
+	{FailureGone, []string{"410 gone", "http error 410"}},
+	{FailureUnsupported, []string{
+		"could not find tag for codec",
+		"not currently supported in container",
+		"unknown encoder",
+		"encoder not found",
+		"unable to find a suitable output format",
+		"could not write header",
+	}},
+	{FailureNetworkTimeout, []string{"timed out", "connection reset by peer", "network is unreachable"}},
+}
+
+// Hint returns advice for users on how to deal with the failure.
+func (c FailureClass) Hint() string {
+	switch c {
+	case FailureOutputExists:
+		return "The output file already exists. Enable overwriting or choose another file name."
+	case FailureDiskFull:
+		return "The disk is full. Free up some space and try again."
+	case FailureUnauthorized, FailureForbidden:
+		return "The stream was denied, e.g. because its token expired. Try again."
+	case FailureNotFound:
+		return "The stream was not found. Check that the recording is still available."
+	case FailureGone:
+		return "The stream is gone, e.g. because its token expired. Try again."
+	case FailureNetworkTimeout:
+		return "The network connection timed out. Check the connection and try again."
+	case FailureUnsupported:
+		return "A selected stream is not supported by the output format. Choose another container or profile."
+	case FailureCancelled:
+		return "The download was cancelled."
+	}
+	return ""
+}
+
+// DownloadError is the error returned when ffmpeg fails, with the class of
+// the failure and the last lines that ffmpeg logged.
+type DownloadError struct {
+	Class   FailureClass
+	LogTail []string
+	Err     error
+}
+
+func (e *DownloadError) Error() string {
+	if e.Class == FailureUnknown {
+		return fmt.Sprintf("ffmpeg failed: %v", e.Err)
+	}
+	return fmt.Sprintf("ffmpeg failed (%s): %v", strings.ReplaceAll(string(e.Class), "_", " "), e.Err)
+}
+
+func (e *DownloadError) Unwrap() error {
+	return e.Err
+}
+
+// classifyFailure classifies the failure of ffmpeg from the context and the
+// lines ffmpeg logged.
+func classifyFailure(ctx context.Context, err error, logTail []string) *DownloadError {
+	res := &DownloadError{Class: FailureUnknown, LogTail: logTail, Err: err}
+	if nil != ctx.Err() {
+		res.Class = FailureCancelled
+		return res
+	}
+	for _, fp := range failurePatterns {
+		for _, line := range logTail {
+			line = strings.ToLower(line)
+			for _, pattern := range fp.patterns {
+				if strings.Contains(line, pattern) {
+					res.Class = fp.class
+					return res
+				}
+			}
+		}
+	}
+	return res
+}
+
+// logTailSize is the number of lines logged by ffmpeg which are kept to report
+// along with failures.
+const logTailSize = 30
+
+// logTail keeps the last lines logged by a process in a ring buffer.
+type logTail struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+func newLogTail(size int) *logTail {
+	return &logTail{lines: make([]string, size)}
+}
+
+func (t *logTail) Add(line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.lines[t.next] = line
+	t.next = (t.next + 1) % len(t.lines)
+	t.full = t.full || t.next == 0
+}
+
+// Lines returns the kept lines, oldest first.
+func (t *logTail) Lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.full {
+		return append([]string{}, t.lines[:t.next]...)
+	}
+	return append(append([]string{}, t.lines[t.next:]...), t.lines[:t.next]...)
+}
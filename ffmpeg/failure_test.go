@@ -0,0 +1,233 @@
+package ffmpeg
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"reflect"
+	"strconv"
+	"testing"
+
+	e "github.com/rokeller/zt-dl/exec"
+	"github.com/rokeller/zt-dl/test"
+)
+
+func Test_classifyFailure(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string // description of this test case
+		ctx     context.Context
+		logTail []string
+		want    FailureClass
+	}{
+		{
+			name:    "Unknown",
+			ctx:     context.Background(),
+			logTail: []string{"Something went wrong"},
+			want:    FailureUnknown,
+		},
+		{
+			name:    "Unknown/NoLog",
+			ctx:     context.Background(),
+			logTail: []string{},
+			want:    FailureUnknown,
+		},
+		{
+			name:    "OutputExists",
+			ctx:     context.Background(),
+			logTail: []string{"File 'target.mkv' already exists. Exiting."},
+			want:    FailureOutputExists,
+		},
+		{
+			name:    "DiskFull",
+			ctx:     context.Background(),
+			logTail: []string{"av_interleaved_write_frame(): No space left on device"},
+			want:    FailureDiskFull,
+		},
+		{
+			name: "Forbidden",
+			ctx:  context.Background(),
+			logTail: []string{
+				"[https @ 0x1234] HTTP error 403 Forbidden",
+				"Error opening input file https://foo.bar.com/master.m3u8.",
+			},
+			want: FailureForbidden,
+		},
+		{
+			name:    "Unauthorized",
+			ctx:     context.Background(),
+			logTail: []string{"[https @ 0x1234] HTTP error 401 Unauthorized"},
+			want:    FailureUnauthorized,
+		},
+		{
+			name:    "Gone",
+			ctx:     context.Background(),
+			logTail: []string{"https://foo.bar.com/master.m3u8: Server returned 410 Gone"},
+			want:    FailureGone,
+		},
+		{
+			name:    "NotFound",
+			ctx:     context.Background(),
+			logTail: []string{"https://foo.bar.com/master.m3u8: Server returned 404 Not Found"},
+			want:    FailureNotFound,
+		},
+		{
+			name:    "NetworkTimeout",
+			ctx:     context.Background(),
+			logTail: []string{"[tcp @ 0x1234] Connection to tcp://foo.bar.com:443 failed: Connection timed out"},
+			want:    FailureNetworkTimeout,
+		},
+		{
+			name: "Unsupported",
+			ctx:  context.Background(),
+			logTail: []string{
+				"[mp4 @ 0x1234] Could not find tag for codec dvb_subtitle in stream #2, codec not currently supported in container",
+				"Could not write header (incorrect codec parameters ?): Invalid argument",
+			},
+			want: FailureUnsupported,
+		},
+		{
+			name:    "DiskFullBeforeTimeout",
+			ctx:     context.Background(),
+			logTail: []string{"Connection timed out", "No space left on device"},
+			want:    FailureDiskFull,
+		},
+		{
+			name:    "Cancelled",
+			ctx:     cancelled,
+			logTail: []string{"No space left on device"},
+			want:    FailureCancelled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := errors.New("exit status 1")
+			got := classifyFailure(tt.ctx, err, tt.logTail)
+			if got.Class != tt.want {
+				t.Errorf("classifyFailure() class = %q, want %q", got.Class, tt.want)
+			}
+			if !reflect.DeepEqual(got.LogTail, tt.logTail) {
+				t.Errorf("classifyFailure() log tail = %v, want %v", got.LogTail, tt.logTail)
+			}
+			if !errors.Is(got, err) {
+				t.Errorf("classifyFailure() does not wrap %v", err)
+			}
+		})
+	}
+}
+
+func TestDownloadError_Error(t *testing.T) {
+	tests := []struct {
+		name string // description of this test case
+		err  *DownloadError
+		want string
+	}{
+		{
+			name: "Unknown",
+			err:  &DownloadError{Class: FailureUnknown, Err: errors.New("exit status 1")},
+			want: "ffmpeg failed: exit status 1",
+		},
+		{
+			name: "Known",
+			err:  &DownloadError{Class: FailureOutputExists, Err: errors.New("exit status 1")},
+			want: "ffmpeg failed (output exists): exit status 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.want {
+				t.Errorf("Error() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_logTail(t *testing.T) {
+	tests := []struct {
+		name  string // description of this test case
+		size  int
+		lines int
+		want  []string
+	}{
+		{
+			name:  "Empty",
+			size:  3,
+			lines: 0,
+			want:  []string{},
+		},
+		{
+			name:  "NotFull",
+			size:  3,
+			lines: 2,
+			want:  []string{"0", "1"},
+		},
+		{
+			name:  "Full",
+			size:  3,
+			lines: 3,
+			want:  []string{"0", "1", "2"},
+		},
+		{
+			name:  "Wrapped",
+			size:  3,
+			lines: 7,
+			want:  []string{"4", "5", "6"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tail := newLogTail(tt.size)
+			for i := range tt.lines {
+				tail.Add(strconv.Itoa(i))
+			}
+			if got := tail.Lines(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lines() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_downloadable_Download_ffmpeg_OutputExists(t *testing.T) {
+	if test.IsTestCall() {
+		os.Stderr.WriteString("Input #0, hls, from 'https://foo.bar.com/source':\n")
+		os.Stderr.WriteString("size=       0KiB time=00:00:00.00 bitrate=N/A speed=N/A\n")
+		os.Stderr.WriteString("File 'target.mp4' already exists. Exiting.\n")
+		os.Exit(1)
+		return
+	}
+
+	me := test.CallerFuncName(0)
+	e.CmdFactory = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		return test.TestCommandContext(t, me, ctx, name, arg...)
+	}
+
+	d := NewDownloadable(StaticUrl("https://foo.bar.com/source"), "target.mp4")
+	d.streams = []SourceStream{
+		&AudioStream{Stream: Stream{Index: 0}, SampleRate: 1234},
+		&VideoStream{Stream: Stream{Index: 1}, Width: 987, Height: 876},
+	}
+	h := &testProgressHandler{progressUpdates: []DownloadProgress{}}
+	err := d.Download(t.Context(), NewBestStreamsSelector(), h)
+
+	var downloadErr *DownloadError
+	if !errors.As(err, &downloadErr) {
+		t.Fatalf("downloadable.Download() got error %v, want DownloadError", err)
+	}
+	if downloadErr.Class != FailureOutputExists {
+		t.Errorf("downloadable.Download() got class %q, want %q", downloadErr.Class, FailureOutputExists)
+	}
+	// Progress reports are not kept in the log tail.
+	wantTail := []string{
+		"Input #0, hls, from 'https://foo.bar.com/source':",
+		"File 'target.mp4' already exists. Exiting.",
+	}
+	if !reflect.DeepEqual(downloadErr.LogTail, wantTail) {
+		t.Errorf("downloadable.Download() got log tail %q, want %q", downloadErr.LogTail, wantTail)
+	}
+	if h.err != err {
+		t.Errorf("downloadable.Download() reported error %v, want %v", h.err, err)
+	}
+}
@@ -0,0 +1,372 @@
+package ffmpeg
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var httpClientFactory func() *http.Client = func() *http.Client {
+	return &http.Client{Timeout: 15 * time.Second}
+}
+
+// errAmbiguousPlaylist is returned when the streams of an HLS master playlist
+// cannot be mapped to the streams of ffmpeg's HLS demuxer without probing.
+var errAmbiguousPlaylist = errors.New("ambiguous HLS master playlist")
+
+// hlsPlaylist is a playlist referenced by an HLS master playlist, i.e. either a
+// variant (EXT-X-STREAM-INF) or a rendition (EXT-X-MEDIA) with a URI.
+type hlsPlaylist struct {
+	// mediaType is "VARIANT" for variants, and the rendition's TYPE otherwise.
+	mediaType string
+	uri       string
+	attrs     hlsAttributes
+}
+
+type hlsMaster struct {
+	// playlists are kept in the order in which they appear in the master
+	// playlist, which is the order in which ffmpeg creates their streams.
+	playlists []hlsPlaylist
+	// renditions are all EXT-X-MEDIA renditions, including those without URI.
+	renditions []hlsAttributes
+}
+
+type hlsAttributes map[string]string
+
+// parseHlsAttributes parses an attribute list like
+// 'BANDWIDTH=800000,CODECS="avc1.4d401f,mp4a.40.2",RESOLUTION=1280x720'.
+func parseHlsAttributes(list string) hlsAttributes {
+	attrs := hlsAttributes{}
+	for len(list) > 0 {
+		name, rest, found := strings.Cut(list, "=")
+		if !found {
+			break
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+			rest = strings.TrimPrefix(rest, ",")
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		attrs[strings.TrimSpace(name)] = value
+		list = rest
+	}
+	return attrs
+}
+
+func parseHlsMaster(r io.Reader) (hlsMaster, error) {
+	var m hlsMaster
+	scanner := bufio.NewScanner(r)
+
+	var variant hlsAttributes
+	first := true
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if first {
+			if line != "#EXTM3U" {
+				return m, errors.New("not an HLS playlist")
+			}
+			first = false
+			continue
+		}
+
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			variant = parseHlsAttributes(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"))
+		case strings.HasPrefix(line, "#EXT-X-MEDIA:"):
+			attrs := parseHlsAttributes(strings.TrimPrefix(line, "#EXT-X-MEDIA:"))
+			m.renditions = append(m.renditions, attrs)
+			if uri := attrs["URI"]; uri != "" {
+				m.playlists = append(m.playlists, hlsPlaylist{mediaType: attrs["TYPE"], uri: uri, attrs: attrs})
+			}
+		case strings.HasPrefix(line, "#EXTINF:"):
+			return m, errors.New("not an HLS master playlist")
+		case strings.HasPrefix(line, "#"):
+		default:
+			if nil != variant {
+				m.playlists = append(m.playlists, hlsPlaylist{mediaType: "VARIANT", uri: line, attrs: variant})
+				variant = nil
+			}
+		}
+	}
+	if err := scanner.Err(); nil != err {
+		return m, err
+	}
+	if first {
+		return m, errors.New("empty HLS playlist")
+	}
+	return m, nil
+}
+
+// hlsCodec maps the RFC 6381 codec in CODECS attributes to the codec name and
+// type used by ffmpeg.
+func hlsCodec(codec string) (name string, codecType string) {
+	prefix, _, _ := strings.Cut(strings.ToLower(codec), ".")
+	switch prefix {
+	case "avc1", "avc3":
+		return "h264", "video"
+	case "hvc1", "hev1":
+		return "hevc", "video"
+	case "av01":
+		return "av1", "video"
+	case "vp09":
+		return "vp9", "video"
+	case "mp4a":
+		return "aac", "audio"
+	case "ac-3":
+		return "ac3", "audio"
+	case "ec-3":
+		return "eac3", "audio"
+	case "opus":
+		return "opus", "audio"
+	case "wvtt":
+		return "webvtt", "subtitle"
+	case "stpp":
+		return "ttml", "subtitle"
+	}
+	return prefix, ""
+}
+
+// codecs returns the names of the codecs of the given type in the variant's
+// CODECS attribute.
+func (p hlsPlaylist) codecs(codecType string) []string {
+	res := []string{}
+	for _, c := range strings.Split(p.attrs["CODECS"], ",") {
+		if name, t := hlsCodec(strings.TrimSpace(c)); t == codecType {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+func (p hlsPlaylist) disposition() Disposition {
+	chars := p.attrs["CHARACTERISTICS"]
+	return Disposition{
+		Default:         p.attrs["DEFAULT"] == "YES",
+		Forced:          p.attrs["FORCED"] == "YES",
+		VisualImpaired:  strings.Contains(chars, "public.accessibility.describes-video"),
+		HearingImpaired: strings.Contains(chars, "public.accessibility.describes-music-and-sound"),
+	}
+}
+
+// hasAudioPlaylists tells whether the audio group with the given ID has audio
+// renditions, all of which have their own playlists.
+func (m hlsMaster) hasAudioPlaylists(group string) bool {
+	found := false
+	for _, r := range m.renditions {
+		if r["TYPE"] == "AUDIO" && r["GROUP-ID"] == group {
+			if r["URI"] == "" {
+				return false
+			}
+			found = true
+		}
+	}
+	return found
+}
+
+// audioCodec returns the audio codec of the variants using the audio group.
+// Groups with renditions of different codecs are ambiguous.
+func (m hlsMaster) audioCodec(group string) (string, error) {
+	codec := ""
+	for _, p := range m.playlists {
+		if p.mediaType != "VARIANT" || p.attrs["AUDIO"] != group {
+			continue
+		}
+		for _, c := range p.codecs("audio") {
+			if codec != "" && c != codec {
+				return "", fmt.Errorf("%w: audio group %q uses more than one codec", errAmbiguousPlaylist, group)
+			}
+			codec = c
+		}
+	}
+	return codec, nil
+}
+
+// streams maps the playlists to the streams which ffmpeg's HLS demuxer creates
+// for them. This only works when each playlist holds exactly one stream, e.g.
+// video variants with separate audio renditions; otherwise errAmbiguousPlaylist
+// is returned.
+func (m hlsMaster) streams() ([]SourceStream, error) {
+	streams := make([]SourceStream, 0, len(m.playlists))
+	seen := map[string]bool{}
+	for i, p := range m.playlists {
+		if seen[p.uri] {
+			return nil, fmt.Errorf("%w: playlist %q is referenced more than once", errAmbiguousPlaylist, p.uri)
+		}
+		seen[p.uri] = true
+
+		switch p.mediaType {
+		case "VARIANT":
+			video := p.codecs("video")
+			if len(video) != 1 ||
+				(len(p.codecs("audio")) > 0 && !m.hasAudioPlaylists(p.attrs["AUDIO"])) {
+				return nil, fmt.Errorf("%w: variant %q may hold more than one stream", errAmbiguousPlaylist, p.uri)
+			}
+			vs := &VideoStream{
+				Stream:  Stream{Index: i, CodecType: "video", CodecName: video[0]},
+				BitRate: atoiOrZero(p.attrs["BANDWIDTH"]),
+			}
+			fmt.Sscanf(p.attrs["RESOLUTION"], "%dx%d", &vs.Width, &vs.Height)
+			vs.AvgFrameRate, _ = strconv.ParseFloat(p.attrs["FRAME-RATE"], 64)
+			streams = append(streams, vs)
+		case "AUDIO":
+			codec, err := m.audioCodec(p.attrs["GROUP-ID"])
+			if nil != err {
+				return nil, err
+			}
+			channels, _, _ := strings.Cut(p.attrs["CHANNELS"], "/")
+			as := &AudioStream{
+				Stream:      Stream{Index: i, CodecType: "audio", CodecName: codec},
+				Channels:    atoiOrZero(channels),
+				Language:    p.attrs["LANGUAGE"],
+				Title:       p.attrs["NAME"],
+				Disposition: p.disposition(),
+			}
+			as.ChannelLayout = channelLayout(as.Channels)
+			streams = append(streams, as)
+		case "SUBTITLES":
+			streams = append(streams, &SubtitleStream{
+				Stream:      Stream{Index: i, CodecType: "subtitle", CodecName: "webvtt"},
+				Language:    p.attrs["LANGUAGE"],
+				Title:       p.attrs["NAME"],
+				Disposition: p.disposition(),
+			})
+		default:
+			return nil, fmt.Errorf("%w: unsupported rendition type %q", errAmbiguousPlaylist, p.mediaType)
+		}
+	}
+	return streams, nil
+}
+
+func atoiOrZero(value string) int {
+	res, err := strconv.Atoi(value)
+	if nil != err || res < 0 {
+		return 0
+	}
+	return res
+}
+
+func channelLayout(channels int) string {
+	switch channels {
+	case 1:
+		return "mono"
+	case 2:
+		return "stereo"
+	case 6:
+		return "5.1"
+	case 8:
+		return "7.1"
+	}
+	return ""
+}
+
+// fetchPlaylist fetches the HLS playlist at the given URL, within the rate
+// limit if any.
+func (d *downloadable) fetchPlaylist(ctx context.Context, playlistUrl string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, playlistUrl, nil)
+	if nil != err {
+		return nil, err
+	}
+	client := httpClientFactory()
+	if nil != d.limiter {
+		client.Transport = d.limiter.Transport(client.Transport)
+	}
+	resp, err := client.Do(req)
+	if nil != err {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get playlist with status %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// mediaPlaylistDuration returns the sum of the durations of the segments of an
+// HLS media playlist.
+func mediaPlaylistDuration(r io.Reader) (time.Duration, error) {
+	var seconds float64
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if value, found := strings.CutPrefix(line, "#EXTINF:"); found {
+			value, _, _ = strings.Cut(value, ",")
+			d, err := strconv.ParseFloat(value, 64)
+			if nil != err {
+				return 0, fmt.Errorf("failed to parse segment duration %q: %w", value, err)
+			}
+			seconds += d
+		}
+	}
+	if err := scanner.Err(); nil != err {
+		return 0, err
+	}
+	if seconds <= 0 {
+		return 0, errors.New("no segments in media playlist")
+	}
+	return time.Duration(seconds * float64(time.Second)).Round(time.Millisecond), nil
+}
+
+// isHlsPlaylistUrl tells whether the URL refers to an HLS playlist.
+func isHlsPlaylistUrl(inputUrl string) bool {
+	u, err := url.Parse(inputUrl)
+	return nil == err && (u.Scheme == "https" || u.Scheme == "http") &&
+		strings.HasSuffix(strings.ToLower(u.Path), ".m3u8")
+}
+
+// detectStreamsFromPlaylist detects the streams from the HLS master playlist
+// and the duration from the first variant's media playlist, which is much
+// faster than probing every rendition with ffprobe.
+func (d *downloadable) detectStreamsFromPlaylist(ctx context.Context) error {
+	data, err := d.fetchPlaylist(ctx, d.inputUrl)
+	if nil != err {
+		return err
+	}
+	m, err := parseHlsMaster(strings.NewReader(string(data)))
+	if nil != err {
+		return err
+	}
+	streams, err := m.streams()
+	if nil != err {
+		return err
+	}
+	if len(streams) <= 0 {
+		return fmt.Errorf("%w: no playlists found", errAmbiguousPlaylist)
+	}
+
+	base, err := url.Parse(d.inputUrl)
+	if nil != err {
+		return err
+	}
+	variant, err := base.Parse(m.playlists[0].uri)
+	if nil != err {
+		return err
+	}
+	data, err = d.fetchPlaylist(ctx, variant.String())
+	if nil != err {
+		return err
+	}
+	duration, err := mediaPlaylistDuration(strings.NewReader(string(data)))
+	if nil != err {
+		return err
+	}
+
+	d.format = format{Duration: duration}
+	d.streams = streams
+	d.warnings = nil
+	return nil
+}
@@ -0,0 +1,311 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	e "github.com/rokeller/zt-dl/exec"
+	"github.com/rokeller/zt-dl/test"
+)
+
+const testMasterPlaylist = `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",LANGUAGE="de",NAME="Deutsch",DEFAULT=YES,AUTOSELECT=YES,CHANNELS="2",URI="audio_de.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",LANGUAGE="de",NAME="Audiodeskription",CHARACTERISTICS="public.accessibility.describes-video",CHANNELS="6",URI="audio_de_ad.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",LANGUAGE="de",NAME="Deutsch (SDH)",FORCED=NO,CHARACTERISTICS="public.accessibility.transcribes-spoken-dialog,public.accessibility.describes-music-and-sound",URI="subs_de.m3u8"
+
+#EXT-X-STREAM-INF:BANDWIDTH=5000000,RESOLUTION=1920x1080,FRAME-RATE=25.000,CODECS="avc1.640028,mp4a.40.2",AUDIO="aac",SUBTITLES="subs"
+video_1080.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=3000000,RESOLUTION=1280x720,FRAME-RATE=50.000,CODECS="avc1.64001f,mp4a.40.2",AUDIO="aac",SUBTITLES="subs"
+video_720.m3u8
+`
+
+const testMediaPlaylist = `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXTINF:4.000,
+seg1.mp4
+#EXTINF:4.000,
+seg2.mp4
+#EXTINF:2.5,
+seg3.mp4
+#EXT-X-ENDLIST
+`
+
+func Test_parseHlsAttributes(t *testing.T) {
+	got := parseHlsAttributes(`BANDWIDTH=800000,CODECS="avc1.4d401f,mp4a.40.2",RESOLUTION=1280x720,NAME="a=b"`)
+	want := hlsAttributes{
+		"BANDWIDTH":  "800000",
+		"CODECS":     "avc1.4d401f,mp4a.40.2",
+		"RESOLUTION": "1280x720",
+		"NAME":       "a=b",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseHlsAttributes() = %v, want %v", got, want)
+	}
+}
+
+func Test_hlsMaster_streams(t *testing.T) {
+	m, err := parseHlsMaster(strings.NewReader(testMasterPlaylist))
+	if nil != err {
+		t.Fatalf("parseHlsMaster() failed: %v", err)
+	}
+	got, err := m.streams()
+	if nil != err {
+		t.Fatalf("streams() failed: %v", err)
+	}
+	want := []SourceStream{
+		&AudioStream{
+			Stream:        Stream{Index: 0, CodecType: "audio", CodecName: "aac"},
+			Channels:      2,
+			ChannelLayout: "stereo",
+			Language:      "de",
+			Title:         "Deutsch",
+			Disposition:   Disposition{Default: true},
+		},
+		&AudioStream{
+			Stream:        Stream{Index: 1, CodecType: "audio", CodecName: "aac"},
+			Channels:      6,
+			ChannelLayout: "5.1",
+			Language:      "de",
+			Title:         "Audiodeskription",
+			Disposition:   Disposition{VisualImpaired: true},
+		},
+		&SubtitleStream{
+			Stream:      Stream{Index: 2, CodecType: "subtitle", CodecName: "webvtt"},
+			Language:    "de",
+			Title:       "Deutsch (SDH)",
+			Disposition: Disposition{HearingImpaired: true},
+		},
+		&VideoStream{
+			Stream:       Stream{Index: 3, CodecType: "video", CodecName: "h264"},
+			Width:        1920,
+			Height:       1080,
+			AvgFrameRate: 25,
+			BitRate:      5000000,
+		},
+		&VideoStream{
+			Stream:       Stream{Index: 4, CodecType: "video", CodecName: "h264"},
+			Width:        1280,
+			Height:       720,
+			AvgFrameRate: 50,
+			BitRate:      3000000,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("streams() = %v, want %v", got, want)
+	}
+}
+
+func Test_hlsMaster_streams_Ambiguous(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist string
+	}{
+		{
+			name: "MuxedAudio",
+			playlist: `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=3000000,CODECS="avc1.64001f,mp4a.40.2"
+video.m3u8
+`,
+		},
+		{
+			name: "AudioWithoutUri",
+			playlist: `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",LANGUAGE="de",NAME="Deutsch"
+#EXT-X-STREAM-INF:BANDWIDTH=3000000,CODECS="avc1.64001f,mp4a.40.2",AUDIO="aac"
+video.m3u8
+`,
+		},
+		{
+			name: "NoCodecs",
+			playlist: `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=3000000
+video.m3u8
+`,
+		},
+		{
+			name: "DuplicatePlaylist",
+			playlist: `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="lo",LANGUAGE="de",NAME="Deutsch",URI="audio.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="hi",LANGUAGE="de",NAME="Deutsch",URI="audio.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=3000000,CODECS="avc1.64001f,mp4a.40.2",AUDIO="lo"
+video.m3u8
+`,
+		},
+		{
+			name: "MixedAudioCodecs",
+			playlist: `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aud",LANGUAGE="de",NAME="Stereo",URI="aac.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aud",LANGUAGE="de",NAME="Surround",URI="ec3.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=3000000,CODECS="avc1.64001f,mp4a.40.2,ec-3",AUDIO="aud"
+video.m3u8
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := parseHlsMaster(strings.NewReader(tt.playlist))
+			if nil != err {
+				t.Fatalf("parseHlsMaster() failed: %v", err)
+			}
+			if _, err := m.streams(); !errors.Is(err, errAmbiguousPlaylist) {
+				t.Errorf("streams() error = %v, want %v", err, errAmbiguousPlaylist)
+			}
+		})
+	}
+}
+
+func Test_parseHlsMaster_NotMaster(t *testing.T) {
+	for _, playlist := range []string{"", "<html></html>", testMediaPlaylist} {
+		if _, err := parseHlsMaster(strings.NewReader(playlist)); nil == err {
+			t.Errorf("parseHlsMaster(%q) succeeded unexpectedly", playlist)
+		}
+	}
+}
+
+func Test_mediaPlaylistDuration(t *testing.T) {
+	got, err := mediaPlaylistDuration(strings.NewReader(testMediaPlaylist))
+	if nil != err {
+		t.Fatalf("mediaPlaylistDuration() failed: %v", err)
+	}
+	if want := 10500 * time.Millisecond; got != want {
+		t.Errorf("mediaPlaylistDuration() = %v, want %v", got, want)
+	}
+	if _, err := mediaPlaylistDuration(strings.NewReader("#EXTM3U\n")); nil == err {
+		t.Error("mediaPlaylistDuration() succeeded unexpectedly")
+	}
+}
+
+func Test_isHlsPlaylistUrl(t *testing.T) {
+	tests := map[string]bool{
+		"https://cdn.example.com/rec/manifest.m3u8?token=abc": true,
+		"http://localhost:1234/master.M3U8":                   true,
+		"https://cdn.example.com/rec/manifest.mpd":            false,
+		"file:///tmp/master.m3u8":                             false,
+		"https://foo.bar.com/probe-source":                    false,
+	}
+	for u, want := range tests {
+		if got := isHlsPlaylistUrl(u); got != want {
+			t.Errorf("isHlsPlaylistUrl(%q) = %v, want %v", u, got, want)
+		}
+	}
+}
+
+func newHlsTestServer(t *testing.T, master string) *httptest.Server {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rec/master.m3u8":
+			fmt.Fprint(w, master)
+		case "/rec/audio_de.m3u8", "/rec/video.m3u8":
+			fmt.Fprint(w, testMediaPlaylist)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	factory := httpClientFactory
+	httpClientFactory = ts.Client
+	t.Cleanup(func() {
+		httpClientFactory = factory
+		ts.Close()
+	})
+	return ts
+}
+
+func Test_downloadable_DetectStreams_Playlist(t *testing.T) {
+	if test.IsTestCall() {
+		os.Exit(1)
+		return
+	}
+
+	me := test.CallerFuncName(0)
+	e.CmdFactory = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		return test.TestCommandContext(t, me, ctx, name, arg...)
+	}
+
+	ts := newHlsTestServer(t, testMasterPlaylist)
+	d := NewDownloadable(StaticUrl(ts.URL+"/rec/master.m3u8"), "target.mkv")
+	if err := d.DetectStreams(t.Context()); nil != err {
+		t.Fatalf("DetectStreams() failed: %v", err)
+	}
+	if d.Duration() != 10500*time.Millisecond {
+		t.Errorf("Duration() = %v, want 10.5s", d.Duration())
+	}
+	if len(d.Streams()) != 5 {
+		t.Errorf("Streams() = %v, want 5 streams", d.Streams())
+	}
+
+	// Streams given as stream info are not detected again.
+	d = NewDownloadable(StaticUrl("https://gone/master.m3u8"), "target.mkv", WithStreamInfo(d.StreamInfo()))
+	if err := d.DetectStreams(t.Context()); nil != err {
+		t.Fatalf("DetectStreams() with stream info failed: %v", err)
+	}
+	if len(d.Streams()) != 5 || d.Duration() != 10500*time.Millisecond {
+		t.Errorf("StreamInfo() = %v, want the previously detected info", d.StreamInfo())
+	}
+
+	// ffprobe is used for full probes, which fails in this test.
+	d = NewDownloadable(StaticUrl(ts.URL+"/rec/master.m3u8"), "target.mkv", WithFullProbe(true))
+	if err := d.DetectStreams(t.Context()); nil == err || err.Error() != "failed to run ffprobe: exit status 1" {
+		t.Errorf("DetectStreams() error = %v, want ffprobe failure", err)
+	}
+}
+
+func Test_downloadable_DetectStreams_PlaylistFallback(t *testing.T) {
+	if test.IsTestCall() {
+		fmt.Println(`{
+	"format": { "duration": "10.5" },
+	"streams": [
+	{
+		"index": 0,
+		"codec_type": "video",
+		"codec_name": "h264",
+		"width": 1280,
+		"height": 720,
+		"avg_frame_rate": "25/1",
+		"bit_rate": "3000000"
+	},
+	{
+		"index": 1,
+		"codec_type": "audio",
+		"codec_name": "aac",
+		"sample_rate": "48000",
+		"channels": 2,
+		"channel_layout": "stereo",
+		"tags": { "language": "de" }
+	}
+]}`)
+		os.Exit(0)
+		return
+	}
+
+	me := test.CallerFuncName(0)
+	e.CmdFactory = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		return test.TestCommandContext(t, me, ctx, name, arg...)
+	}
+
+	ts := newHlsTestServer(t, `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=3000000,CODECS="avc1.64001f,mp4a.40.2"
+video.m3u8
+`)
+	var messages bytes.Buffer
+	d := NewDownloadable(StaticUrl(ts.URL+"/rec/master.m3u8"), "target.mkv", WithMessages(&messages))
+	if err := d.DetectStreams(t.Context()); nil != err {
+		t.Fatalf("DetectStreams() failed: %v", err)
+	}
+	if len(d.Streams()) != 2 || d.Streams()[1].(*AudioStream).SampleRate != 48000 {
+		t.Errorf("Streams() = %v, want the streams found by ffprobe", d.Streams())
+	}
+	if !strings.Contains(messages.String(), "using ffprobe instead") {
+		t.Errorf("DetectStreams() wrote messages %q, want the fallback to ffprobe", messages.String())
+	}
+}
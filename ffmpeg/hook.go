@@ -0,0 +1,182 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	e "github.com/rokeller/zt-dl/exec"
+)
+
+// DefaultHookTimeout is how long post-download hooks may run by default.
+const DefaultHookTimeout = 5 * time.Minute
+
+// hookWaitDelay is how long to wait for the output of a hook after it got
+// killed, e.g. when processes it started still hold on to its output.
+const hookWaitDelay = 5 * time.Second
+
+// hookOutputLines is the number of lines of a hook's output which are kept to
+// report along with its exit status.
+const hookOutputLines = 50
+
+// PostHook is a command which runs after a download, e.g. to move the output,
+// notify a media server or upload the output elsewhere. The command is run by
+// the shell, with details about the download in ZTDL_* environment variables.
+type PostHook struct {
+	Command string
+	// Timeout is how long the command may run before it gets killed.
+	Timeout time.Duration
+	// OnFailure runs the command also after failed downloads.
+	OnFailure bool
+	// Env holds additional environment variables in the form "KEY=value",
+	// e.g. ZTDL_RECORDING_ID.
+	Env []string
+}
+
+// HookResult describes how a post-download hook finished.
+type HookResult struct {
+	Command  string
+	ExitCode int
+	// Output holds the last lines the hook wrote to stdout and stderr.
+	Output []string
+	// Err is set if the hook could not be run, timed out or exited with a
+	// non-zero status.
+	Err error
+}
+
+// HookHandler can optionally be implemented by a [DownloadProgressHandler] to
+// get notified when a post-download hook finished.
+type HookHandler interface {
+	HookFinished(result HookResult)
+}
+
+// hookStatus returns the status of the download passed to hooks.
+func hookStatus(err error) string {
+	if nil == err {
+		return "succeeded"
+	}
+	var downloadErr *DownloadError
+	if errors.As(err, &downloadErr) && downloadErr.Class == FailureCancelled {
+		return "cancelled"
+	}
+	return "failed"
+}
+
+// hookEnv returns the environment variables describing the download.
+func (d *downloadable) hookEnv(streams []SourceStream, downloadErr error) []string {
+	descs := TransformStreams(streams, func(s SourceStream) string {
+		return fmt.Sprintf("#%d %s: %s", s.Index(), StreamType(s), s)
+	})
+	env := []string{
+		"ZTDL_STATUS=" + hookStatus(downloadErr),
+		"ZTDL_OUTPUT=" + d.outputPath,
+		"ZTDL_DURATION=" + strconv.Itoa(int(d.format.Duration.Seconds())),
+		"ZTDL_STREAMS=" + strings.Join(descs, "; "),
+	}
+	if len(d.parts) > 0 {
+		env = append(env, "ZTDL_PARTS="+strings.Join(d.parts, string(os.PathListSeparator)))
+	}
+	if nil != d.hookMetadata {
+		env = append(env,
+			"ZTDL_TITLE="+d.hookMetadata.Title,
+			"ZTDL_EPISODE="+d.hookMetadata.EpisodeTitle,
+			"ZTDL_CHANNEL="+d.hookMetadata.Channel,
+		)
+	}
+	if nil != downloadErr {
+		env = append(env, "ZTDL_ERROR="+downloadErr.Error())
+		var de *DownloadError
+		if errors.As(downloadErr, &de) {
+			env = append(env, "ZTDL_FAILURE_CLASS="+string(de.Class))
+		}
+	}
+	return append(env, d.postHook.Env...)
+}
+
+// runPostHook runs the post-download hook, if any, and reports how it finished
+// to the progress handler. Hooks never fail the download, and also run when the
+// download was cancelled, if they run on failure.
+func (d *downloadable) runPostHook(
+	ctx context.Context,
+	streams []SourceStream,
+	downloadErr error,
+	progress DownloadProgressHandler,
+) {
+	if nil == d.postHook || (nil != downloadErr && !d.postHook.OnFailure) {
+		return
+	}
+
+	timeout := d.postHook.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHookTimeout
+	}
+	// The hook is still run for cancelled downloads, so it is limited by its
+	// timeout only.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+	cmd := e.CmdFactory(ctx, shell, flag, d.postHook.Command)
+	env := cmd.Env
+	if nil == env {
+		env = os.Environ()
+	}
+	cmd.Env = append(env, d.hookEnv(streams, downloadErr)...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.WaitDelay = hookWaitDelay
+
+	out := d.messageWriter()
+	fmt.Fprintf(out, "Running post-download hook %q ...\n", d.postHook.Command)
+	err := cmd.Run()
+	result := HookResult{
+		Command:  d.postHook.Command,
+		ExitCode: cmd.ProcessState.ExitCode(),
+		Output:   lastLines(output.String(), hookOutputLines),
+	}
+	var exitErr *exec.ExitError
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		result.Err = fmt.Errorf("post-download hook timed out after %s", timeout)
+	} else if errors.As(err, &exitErr) {
+		result.Err = fmt.Errorf("post-download hook failed: %w", err)
+	} else if nil != err {
+		result.Err = fmt.Errorf("failed to run post-download hook: %w", err)
+	}
+
+	if nil != result.Err {
+		fmt.Fprintf(out, "WARN: %v.\n", result.Err)
+	} else {
+		fmt.Fprintln(out, "Post-download hook finished.")
+	}
+	for _, line := range result.Output {
+		fmt.Fprintf(out, "    %s\n", line)
+	}
+	if hh, ok := progress.(HookHandler); ok {
+		hh.HookFinished(result)
+	}
+}
+
+// lastLines returns up to n of the last non-empty lines of the given text.
+func lastLines(text string, n int) []string {
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
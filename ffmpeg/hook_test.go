@@ -0,0 +1,254 @@
+package ffmpeg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	e "github.com/rokeller/zt-dl/exec"
+	"github.com/rokeller/zt-dl/test"
+)
+
+type testHookHandler struct {
+	testProgressHandler
+	results []HookResult
+}
+
+func (h *testHookHandler) HookFinished(result HookResult) {
+	h.results = append(h.results, result)
+}
+
+func Test_downloadable_runPostHook(t *testing.T) {
+	if test.IsTestCall() {
+		args := test.GetArgs()
+		switch args[len(args)-1] {
+		case "print-env":
+			for _, name := range []string{
+				"ZTDL_STATUS", "ZTDL_OUTPUT", "ZTDL_DURATION", "ZTDL_STREAMS",
+				"ZTDL_TITLE", "ZTDL_EPISODE", "ZTDL_CHANNEL", "ZTDL_RECORDING_ID",
+				"ZTDL_ERROR", "ZTDL_FAILURE_CLASS",
+			} {
+				if value, found := os.LookupEnv(name); found {
+					fmt.Printf("%s=%s\n", name, value)
+				}
+			}
+			os.Exit(0)
+		case "fail":
+			fmt.Fprintln(os.Stderr, "upload failed")
+			os.Exit(3)
+		case "slow":
+			time.Sleep(5 * time.Second)
+			os.Exit(0)
+		}
+		os.Exit(-1)
+		return
+	}
+
+	me := test.CallerFuncName(0)
+	e.CmdFactory = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		return test.TestCommandContext(t, me, ctx, name, arg...)
+	}
+
+	streams := []SourceStream{
+		&VideoStream{Stream: Stream{Index: 0}, Width: 1280, Height: 720},
+		&AudioStream{Stream: Stream{Index: 1}, Channels: 2},
+	}
+	metadata := Metadata{Title: "Some Movie", EpisodeTitle: "Pilot", Channel: "Test TV"}
+	failure := &DownloadError{Class: FailureDiskFull, Err: errors.New("exit status 1")}
+	cancellation := &DownloadError{Class: FailureCancelled, Err: context.Canceled}
+
+	tests := []struct {
+		name        string // description of this test case
+		hook        *PostHook
+		downloadErr error
+		cancelled   bool
+		want        []HookResult
+	}{
+		{
+			name: "NoHook",
+			want: nil,
+		},
+		{
+			name: "Succeeded",
+			hook: &PostHook{Command: "print-env", Env: []string{"ZTDL_RECORDING_ID=1234"}},
+			want: []HookResult{{
+				Command: "print-env",
+				Output: []string{
+					"ZTDL_STATUS=succeeded",
+					"ZTDL_OUTPUT=target.mkv",
+					"ZTDL_DURATION=5400",
+					"ZTDL_STREAMS=#0 Video: " + streams[0].String() + "; #1 Audio: " + streams[1].String(),
+					"ZTDL_TITLE=Some Movie",
+					"ZTDL_EPISODE=Pilot",
+					"ZTDL_CHANNEL=Test TV",
+					"ZTDL_RECORDING_ID=1234",
+				},
+			}},
+		},
+		{
+			name:        "Failed/NotOnFailure",
+			hook:        &PostHook{Command: "print-env"},
+			downloadErr: failure,
+			want:        nil,
+		},
+		{
+			name:        "Failed/OnFailure",
+			hook:        &PostHook{Command: "print-env", OnFailure: true},
+			downloadErr: failure,
+			want: []HookResult{{
+				Command: "print-env",
+				Output: []string{
+					"ZTDL_STATUS=failed",
+					"ZTDL_OUTPUT=target.mkv",
+					"ZTDL_DURATION=5400",
+					"ZTDL_STREAMS=#0 Video: " + streams[0].String() + "; #1 Audio: " + streams[1].String(),
+					"ZTDL_TITLE=Some Movie",
+					"ZTDL_EPISODE=Pilot",
+					"ZTDL_CHANNEL=Test TV",
+					"ZTDL_ERROR=" + failure.Error(),
+					"ZTDL_FAILURE_CLASS=disk_full",
+				},
+			}},
+		},
+		{
+			name:        "Cancelled/OnFailure",
+			hook:        &PostHook{Command: "print-env", OnFailure: true},
+			downloadErr: cancellation,
+			cancelled:   true,
+			want: []HookResult{{
+				Command: "print-env",
+				Output: []string{
+					"ZTDL_STATUS=cancelled",
+					"ZTDL_OUTPUT=target.mkv",
+					"ZTDL_DURATION=5400",
+					"ZTDL_STREAMS=#0 Video: " + streams[0].String() + "; #1 Audio: " + streams[1].String(),
+					"ZTDL_TITLE=Some Movie",
+					"ZTDL_EPISODE=Pilot",
+					"ZTDL_CHANNEL=Test TV",
+					"ZTDL_ERROR=" + cancellation.Error(),
+					"ZTDL_FAILURE_CLASS=cancelled",
+				},
+			}},
+		},
+		{
+			name: "HookFails",
+			hook: &PostHook{Command: "fail"},
+			want: []HookResult{{
+				Command:  "fail",
+				ExitCode: 3,
+				Output:   []string{"upload failed"},
+				Err:      errors.New("post-download hook failed: exit status 3"),
+			}},
+		},
+		{
+			name: "HookTimesOut",
+			hook: &PostHook{Command: "slow", Timeout: 100 * time.Millisecond},
+			want: []HookResult{{
+				Command:  "slow",
+				ExitCode: -1,
+				Output:   []string{},
+				Err:      errors.New("post-download hook timed out after 100ms"),
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDownloadable(StaticUrl("https://foo.bar.com/source"), "target.mkv", WithHookMetadata(metadata))
+			d.format.Duration = 90 * time.Minute
+			d.postHook = tt.hook
+			h := &testHookHandler{}
+
+			ctx, cancel := context.WithCancel(t.Context())
+			defer cancel()
+			if tt.cancelled {
+				cancel()
+			}
+			d.runPostHook(ctx, streams, tt.downloadErr, h)
+
+			if len(h.results) != len(tt.want) {
+				t.Fatalf("runPostHook() reported %d results, want %d", len(h.results), len(tt.want))
+			}
+			for i, got := range h.results {
+				want := tt.want[i]
+				if (nil == got.Err) != (nil == want.Err) ||
+					(nil != got.Err && got.Err.Error() != want.Err.Error()) {
+					t.Errorf("runPostHook() got error %v, want %v", got.Err, want.Err)
+				}
+				got.Err, want.Err = nil, nil
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("runPostHook() got result %+v, want %+v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func Test_downloadable_Download_HookMetadataWithoutTags(t *testing.T) {
+	if test.IsTestCall() {
+		args := test.GetArgs()
+		if args[len(args)-1] == "print-title" {
+			fmt.Printf("ZTDL_TITLE=%s\n", os.Getenv("ZTDL_TITLE"))
+			os.Exit(0)
+		}
+		// Videos are not tagged with the metadata passed to the hook.
+		test.AssertArgs(
+			"ffmpeg",
+			"-protocol_whitelist", "https,tls,tcp",
+			"-i", "https://foo.bar.com/source",
+			"-n",
+			"-map", "0:0",
+			"-map", "0:2",
+			"-c", "copy",
+			stagedPath("target.mkv"),
+		)
+		os.Exit(0)
+		return
+	}
+
+	me := test.CallerFuncName(0)
+	e.CmdFactory = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		return test.TestCommandContext(t, me, ctx, name, arg...)
+	}
+
+	d := NewDownloadable(StaticUrl("https://foo.bar.com/source"), "target.mkv",
+		WithHookMetadata(Metadata{Title: "Some Movie"}),
+		WithPostHook(PostHook{Command: "print-title"}))
+	d.streams = []SourceStream{
+		&AudioStream{Stream: Stream{Index: 0, CodecName: "aac"}, SampleRate: 1234},
+		&VideoStream{Stream: Stream{Index: 2, CodecName: "h264"}, Width: 987, Height: 876},
+	}
+	h := &testHookHandler{}
+	if err := d.Download(t.Context(), NewBestStreamsSelector(), h); nil != err {
+		t.Fatalf("downloadable.Download() got error %v, want nil", err)
+	}
+	want := []HookResult{{Command: "print-title", Output: []string{"ZTDL_TITLE=Some Movie"}}}
+	if !reflect.DeepEqual(h.results, want) {
+		t.Errorf("downloadable.Download() ran hooks %+v, want %+v", h.results, want)
+	}
+}
+
+func Test_lastLines(t *testing.T) {
+	tests := []struct {
+		name string // description of this test case
+		text string
+		n    int
+		want []string
+	}{
+		{name: "Empty", text: "", n: 3, want: []string{}},
+		{name: "SkipsEmptyLines", text: "a\r\n\nb\n", n: 3, want: []string{"a", "b"}},
+		{name: "KeepsLast", text: strings.Repeat("x\n", 5) + "y\nz", n: 2, want: []string{"y", "z"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lastLines(tt.text, tt.n); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lastLines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
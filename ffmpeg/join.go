@@ -0,0 +1,431 @@
+package ffmpeg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StageJoin concatenates the downloaded inputs of a joined download.
+var StageJoin = Stage{Name: "join", Description: "Joining recordings"}
+
+// JoinInput is one of the inputs of a joined download.
+type JoinInput struct {
+	// Url provides the URL of the input, and fresh URLs when it expired.
+	Url UrlProvider
+	// Trim is the duration cut from the start of the input, e.g. because it
+	// overlaps with the end of the previous input.
+	Trim time.Duration
+}
+
+// joinedDownloadable downloads several inputs, e.g. adjacent recordings of the
+// same program, with the same streams selection and concatenates them without
+// transcoding into one output.
+type joinedDownloadable struct {
+	inputs []*downloadable
+	trims  []time.Duration
+	// final writes the output from the concatenated inputs, applying all the
+	// options like the container, transcoding profile, metadata or hooks.
+	final *downloadable
+}
+
+func NewJoinedDownloadable(
+	inputs []JoinInput,
+	outputPath string,
+	options ...DownloadableOption,
+) *joinedDownloadable {
+	final := NewDownloadable(nil, outputPath, options...)
+	j := &joinedDownloadable{final: final}
+	for _, input := range inputs {
+		j.inputs = append(j.inputs, &downloadable{
+			input:        input.Url,
+			overwrite:    true,
+			subtitleMode: SubtitlesEmbed,
+			fullProbe:    final.fullProbe,
+			limiter:      final.limiter,
+			messages:     final.messageWriter(),
+		})
+		j.trims = append(j.trims, input.Trim)
+	}
+	// The inputs are downloaded within the rate limit, but the concatenation
+	// only reads local files.
+	final.limiter = nil
+	final.concat = true
+	return j
+}
+
+// DetectStreams detects the duration and the streams of every input.
+func (j *joinedDownloadable) DetectStreams(ctx context.Context) error {
+	for i, input := range j.inputs {
+		if err := input.DetectStreams(ctx); nil != err {
+			return fmt.Errorf("failed to detect streams of input %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Streams returns the source streams of the first input, which are used to
+// select the streams of all inputs.
+func (j *joinedDownloadable) Streams() []SourceStream {
+	if len(j.inputs) <= 0 {
+		return nil
+	}
+	return j.inputs[0].Streams()
+}
+
+// StreamInfo returns the detected duration and streams of the first input.
+func (j *joinedDownloadable) StreamInfo() StreamInfo {
+	if len(j.inputs) <= 0 {
+		return StreamInfo{}
+	}
+	return j.inputs[0].StreamInfo()
+}
+
+// Duration returns the duration of the joined output.
+func (j *joinedDownloadable) Duration() time.Duration {
+	var duration time.Duration
+	for i, input := range j.inputs {
+		duration += max(0, input.Duration()-j.trims[i])
+	}
+	return duration
+}
+
+func (j *joinedDownloadable) Download(
+	ctx context.Context,
+	selector StreamsSelector,
+	progress DownloadProgressHandler,
+) error {
+	if nil == progress {
+		progress = j.final.consoleProgressHandler()
+	}
+
+	defer j.removeWorkDir()
+	selected, err := j.download(ctx, selector, progress)
+	if nil != err {
+		j.final.runPostHook(ctx, selected, err, progress)
+		return err
+	}
+
+	// Subtitles were embedded in the inputs such that the final output applies
+	// the selected subtitle mode.
+	if sms, ok := selector.(SubtitleModeSelector); ok && sms.SelectedSubtitleMode() != "" {
+		j.final.subtitleMode = sms.SelectedSubtitleMode()
+	}
+	indices := []int{}
+	j.final.streams = nil
+	for i, s := range selected {
+		j.final.streams = append(j.final.streams, withIndex(s, i))
+		indices = append(indices, i)
+	}
+	j.final.format.Duration = j.Duration()
+	j.final.detected = true
+	return j.final.Download(ctx, NewIndexStreamsSelector(indices...), joinedProgressHandler{progress})
+}
+
+// download downloads the selected streams of every input to the work directory
+// and writes the list of files for the concat demuxer. It returns the selected
+// streams of the first input, in the order in which they were downloaded.
+func (j *joinedDownloadable) download(
+	ctx context.Context,
+	selector StreamsSelector,
+	progress DownloadProgressHandler,
+) ([]SourceStream, error) {
+	if len(j.inputs) <= 0 {
+		return nil, errors.New("no inputs to join")
+	}
+	selected, err := selector.SelectStreams(j.inputs[0].Streams())
+	if nil != err {
+		return nil, fmt.Errorf("failed to select streams to download: %w", err)
+	} else if len(selected) <= 0 {
+		return nil, errors.New("no streams selected for download")
+	}
+	// The inputs are downloaded with their streams in the order of the source.
+	selected = slices.SortedFunc(slices.Values(selected), func(a, b SourceStream) int {
+		return a.Index() - b.Index()
+	})
+
+	// Fail before downloading any input if the output cannot be written.
+	subtitleMode := j.final.subtitleMode
+	if sms, ok := selector.(SubtitleModeSelector); ok && sms.SelectedSubtitleMode() != "" {
+		subtitleMode = sms.SelectedSubtitleMode()
+	}
+	if err := j.final.checkStreamable(subtitleMode); nil != err {
+		return selected, err
+	}
+	if !j.final.overwrite && !j.final.streaming() {
+		if err := j.final.checkTargets(selected, subtitleMode); nil != err {
+			return selected, err
+		}
+	}
+
+	matched := [][]int{}
+	for i, input := range j.inputs {
+		indices, err := matchStreams(selected, input.Streams())
+		if nil != err {
+			return selected, fmt.Errorf("cannot join input %d: %w", i+1, err)
+		}
+		matched = append(matched, indices)
+	}
+
+	if !j.final.streaming() {
+		if err := j.checkFreeSpace(selected, matched); nil != err {
+			return selected, err
+		}
+	}
+
+	workDir, err := j.workDir()
+	if nil != err {
+		return selected, err
+	}
+
+	progress.Start()
+	total := j.Duration()
+	var offset time.Duration
+	files := []string{}
+	for i, input := range j.inputs {
+		fmt.Fprintf(j.final.messageWriter(), "Downloading input %d of %d ...\n", i+1, len(j.inputs))
+		input.outputPath = filepath.Join(workDir, fmt.Sprintf("input%02d.mkv", i+1))
+		// The trimmed start of inputs is downloaded too, but not part of the
+		// total duration.
+		duration := max(0, input.Duration()-j.trims[i])
+		partProgress := &inputProgressHandler{
+			DownloadProgressHandler: progress,
+			offset:                  float32(offset.Seconds() / total.Seconds()),
+			scale:                   float32(duration.Seconds() / total.Seconds()),
+		}
+		if err := input.Download(ctx, matchedStreamsSelector(matched[i]), partProgress); nil != err {
+			return selected, fmt.Errorf("failed to download input %d: %w", i+1, err)
+		}
+		files = append(files, input.outputPath)
+		offset += duration
+	}
+
+	listPath := filepath.Join(workDir, "inputs.ffconcat")
+	if err := os.WriteFile(listPath, []byte(concatList(files, j.trims)), 0o644); nil != err {
+		return selected, fmt.Errorf("failed to write list of inputs to join: %w", err)
+	}
+	j.final.inputUrl = listPath
+	return selected, nil
+}
+
+// checkFreeSpace verifies that there is room for the inputs with the matched
+// streams in the work directory, along with the output which is written next to
+// them before it is moved to the output directory.
+func (j *joinedDownloadable) checkFreeSpace(selected []SourceStream, matched [][]int) error {
+	j.final.format.Duration = j.Duration()
+	outputSize := j.final.EstimateSize(selected)
+	if outputSize <= 0 {
+		return nil
+	}
+	size := outputSize
+	for i, input := range j.inputs {
+		streams, err := matchedStreamsSelector(matched[i]).SelectStreams(input.Streams())
+		if nil != err {
+			return err
+		}
+		inputSize := input.EstimateSize(streams)
+		if inputSize <= 0 {
+			return nil
+		}
+		size += inputSize
+	}
+
+	fmt.Fprintf(j.final.messageWriter(), "Estimated size of the inputs and the output: %s\n", FormatSize(size))
+	root, outDir := filepath.Dir(j.workDirPath()), filepath.Dir(j.final.outputPath)
+	if err := j.final.checkFreeSpaceIn(size, root); nil != err {
+		return err
+	}
+	if root != outDir {
+		return j.final.checkFreeSpaceIn(outputSize, outDir)
+	}
+	return nil
+}
+
+// workDirPath returns the path of the directory to which the inputs are
+// downloaded before they are joined.
+func (j *joinedDownloadable) workDirPath() string {
+	root := j.final.stagingDir
+	if root == "" {
+		root = filepath.Dir(j.final.outputPath)
+	}
+	return filepath.Join(root, stagingDirName(j.final.outputPath+".join"))
+}
+
+// workDir creates the directory to which the inputs are downloaded before they
+// are joined. Like staging directories, it is removed when left behind.
+func (j *joinedDownloadable) workDir() (string, error) {
+	dir := j.workDirPath()
+	if err := os.RemoveAll(dir); nil != err {
+		return "", fmt.Errorf("failed to remove join directory %q: %w", dir, err)
+	}
+	if err := os.MkdirAll(dir, 0o755); nil != err {
+		return "", fmt.Errorf("failed to create join directory %q: %w", dir, err)
+	}
+	return dir, nil
+}
+
+// removeWorkDir removes the inputs downloaded for joining.
+func (j *joinedDownloadable) removeWorkDir() {
+	dir := j.workDirPath()
+	if err := os.RemoveAll(dir); nil != err {
+		fmt.Fprintf(j.final.messageWriter(), "WARN: Failed to remove join directory %q: %v\n", dir, err)
+	}
+}
+
+// concatList returns the list of the given files for ffmpeg's concat demuxer,
+// skipping the given durations at the start of each file.
+func concatList(files []string, trims []time.Duration) string {
+	var b strings.Builder
+	b.WriteString("ffconcat version 1.0\n")
+	for i, file := range files {
+		fmt.Fprintf(&b, "file '%s'\n", strings.ReplaceAll(file, "'", `'\''`))
+		if i < len(trims) && trims[i] > 0 {
+			fmt.Fprintf(&b, "inpoint %s\n", strconv.FormatFloat(trims[i].Seconds(), 'f', -1, 64))
+		}
+	}
+	return b.String()
+}
+
+// matchStreams returns the indices of the streams among candidates which match
+// the given selected streams of another input. Streams at the same index are
+// preferred.
+func matchStreams(selected, candidates []SourceStream) ([]int, error) {
+	indices := []int{}
+	for _, s := range selected {
+		i := slices.IndexFunc(candidates, func(c SourceStream) bool {
+			return c.Index() == s.Index() && similarStreams(s, c)
+		})
+		if i < 0 {
+			i = slices.IndexFunc(candidates, func(c SourceStream) bool {
+				return !slices.Contains(indices, c.Index()) && similarStreams(s, c)
+			})
+		}
+		if i < 0 {
+			return nil, fmt.Errorf("no stream matches %s stream %s", StreamType(s), s)
+		}
+		indices = append(indices, candidates[i].Index())
+	}
+	return indices, nil
+}
+
+// matchedStreamsSelector selects the streams with the given indices in the
+// order of the indices, such that the streams of all inputs of a joined
+// download are written in the same order.
+type matchedStreamsSelector []int
+
+// SelectStreams implements [StreamsSelector].
+func (m matchedStreamsSelector) SelectStreams(streams []SourceStream) ([]SourceStream, error) {
+	selected := []SourceStream{}
+	for _, index := range m {
+		i := slices.IndexFunc(streams, func(s SourceStream) bool { return s.Index() == index })
+		if i < 0 {
+			return nil, fmt.Errorf("stream #%d is not available", index)
+		}
+		selected = append(selected, streams[i])
+	}
+	return selected, nil
+}
+
+// similarStreams tells whether the streams can be concatenated.
+func similarStreams(a, b SourceStream) bool {
+	switch sa := a.(type) {
+	case *VideoStream:
+		sb, ok := b.(*VideoStream)
+		return ok && sa.CodecName == sb.CodecName && sa.Width == sb.Width && sa.Height == sb.Height
+	case *AudioStream:
+		sb, ok := b.(*AudioStream)
+		return ok && sa.CodecName == sb.CodecName && sa.Language == sb.Language &&
+			sa.Channels == sb.Channels
+	case *SubtitleStream:
+		sb, ok := b.(*SubtitleStream)
+		return ok && sa.CodecName == sb.CodecName && sa.Language == sb.Language
+	}
+	return false
+}
+
+// withIndex returns a copy of the stream with the given index.
+func withIndex(s SourceStream, index int) SourceStream {
+	switch st := s.(type) {
+	case *VideoStream:
+		c := *st
+		c.Stream.Index = index
+		return &c
+	case *AudioStream:
+		c := *st
+		c.Stream.Index = index
+		return &c
+	case *SubtitleStream:
+		c := *st
+		c.Stream.Index = index
+		return &c
+	}
+	return s
+}
+
+// inputProgressHandler reports the progress of downloading one input of a
+// joined download as part of the progress of downloading all inputs.
+type inputProgressHandler struct {
+	DownloadProgressHandler
+	offset float32
+	scale  float32
+}
+
+func (h *inputProgressHandler) Start() {}
+
+func (h *inputProgressHandler) Finished() {}
+
+func (h *inputProgressHandler) UpdateProgress(p DownloadProgress) {
+	p.RelCompleted = h.offset + p.RelCompleted*h.scale
+	h.DownloadProgressHandler.UpdateProgress(p)
+}
+
+// joinedProgressHandler reports writing the output of a joined download as a
+// stage after downloading the inputs.
+type joinedProgressHandler struct {
+	DownloadProgressHandler
+}
+
+func (h joinedProgressHandler) Start() {
+	h.StageStarted(StageJoin)
+}
+
+// StageStarted implements [StageHandler].
+func (h joinedProgressHandler) StageStarted(stage Stage) {
+	if sh, ok := h.DownloadProgressHandler.(StageHandler); ok {
+		sh.StageStarted(stage)
+	}
+}
+
+// SizeEstimated implements [SizeEstimateHandler].
+func (h joinedProgressHandler) SizeEstimated(bytes int64) {
+	if seh, ok := h.DownloadProgressHandler.(SizeEstimateHandler); ok {
+		seh.SizeEstimated(bytes)
+	}
+}
+
+// HookFinished implements [HookHandler].
+func (h joinedProgressHandler) HookFinished(result HookResult) {
+	if hh, ok := h.DownloadProgressHandler.(HookHandler); ok {
+		hh.HookFinished(result)
+	}
+}
+
+// PartsWritten implements [PartsHandler].
+func (h joinedProgressHandler) PartsWritten(paths []string) {
+	if ph, ok := h.DownloadProgressHandler.(PartsHandler); ok {
+		ph.PartsWritten(paths)
+	}
+}
+
+// SidecarsWritten implements [SidecarsHandler].
+func (h joinedProgressHandler) SidecarsWritten(paths []string) {
+	if sh, ok := h.DownloadProgressHandler.(SidecarsHandler); ok {
+		sh.SidecarsWritten(paths)
+	}
+}
@@ -0,0 +1,244 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	e "github.com/rokeller/zt-dl/exec"
+	"github.com/rokeller/zt-dl/test"
+)
+
+func Test_concatList(t *testing.T) {
+	got := concatList(
+		[]string{"/tmp/input01.mkv", "/tmp/it's/input02.mkv"},
+		[]time.Duration{0, 90500 * time.Millisecond},
+	)
+	want := `ffconcat version 1.0
+file '/tmp/input01.mkv'
+file '/tmp/it'\''s/input02.mkv'
+inpoint 90.5
+`
+	if got != want {
+		t.Errorf("concatList() = %q, want %q", got, want)
+	}
+}
+
+func Test_matchStreams(t *testing.T) {
+	video := &VideoStream{Stream: Stream{Index: 0, CodecName: "h264"}, Width: 1280, Height: 720}
+	german := &AudioStream{Stream: Stream{Index: 1, CodecName: "aac"}, Language: "deu", Channels: 2}
+	english := &AudioStream{Stream: Stream{Index: 2, CodecName: "aac"}, Language: "eng", Channels: 2}
+
+	tests := []struct {
+		name       string // description of this test case
+		candidates []SourceStream
+		want       []int
+		wantErr    bool
+	}{
+		{
+			name:       "SameIndices",
+			candidates: []SourceStream{video, german, english},
+			want:       []int{0, 2},
+		},
+		{
+			name: "Reordered",
+			candidates: []SourceStream{
+				&AudioStream{Stream: Stream{Index: 0, CodecName: "aac"}, Language: "eng", Channels: 2},
+				&VideoStream{Stream: Stream{Index: 1, CodecName: "h264"}, Width: 1280, Height: 720},
+			},
+			want: []int{1, 0},
+		},
+		{
+			name: "DifferentResolution",
+			candidates: []SourceStream{
+				&VideoStream{Stream: Stream{Index: 0, CodecName: "h264"}, Width: 1920, Height: 1080},
+				english,
+			},
+			wantErr: true,
+		},
+		{
+			name:       "MissingLanguage",
+			candidates: []SourceStream{video, german},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := matchStreams([]SourceStream{video, english}, tt.candidates)
+			if (nil != err) != tt.wantErr {
+				t.Fatalf("matchStreams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matchStreams() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_joinedDownloadable_Download_ffmpeg(t *testing.T) {
+	if test.IsTestCall() {
+		args := test.GetArgs()
+		output := args[len(args)-1]
+		if slices.Contains(args, "concat") {
+			list := args[6]
+			test.AssertArgs(
+				"ffmpeg",
+				"-f", "concat",
+				"-safe", "0",
+				"-i", list,
+				"-n",
+				"-map", "0:0",
+				"-map", "0:1",
+				"-c", "copy",
+				"-metadata", "title=Some Movie",
+				"-metadata", "show=Some Movie",
+				"-metadata", "album=Some Movie",
+				output,
+			)
+			// The output gets the list of inputs such that the test can verify it.
+			data, _ := os.ReadFile(list)
+			os.WriteFile(output, data, 0o644)
+			os.Exit(0)
+		}
+
+		input := args[4]
+		// The streams of the second input are in another order, but must be
+		// written in the order of the first input's streams.
+		maps := map[string][]string{
+			"https://foo.bar.com/first":  {"-map", "0:0", "-map", "0:1"},
+			"https://foo.bar.com/second": {"-map", "0:2", "-map", "0:1"},
+		}[input]
+		test.AssertArgs(slices.Concat(
+			[]string{"ffmpeg", "-protocol_whitelist", "https,tls,tcp", "-i", input, "-y"},
+			maps,
+			[]string{"-c", "copy", output},
+		)...)
+		// Both inputs report being half way through.
+		fmt.Fprintln(os.Stderr, map[string]string{
+			"https://foo.bar.com/first":  "frame=1 time=00:30:00.00 bitrate=1.0kbits/s",
+			"https://foo.bar.com/second": "frame=1 time=00:15:00.00 bitrate=1.0kbits/s",
+		}[input])
+		os.WriteFile(output, []byte(input), 0o644)
+		os.Exit(0)
+	}
+
+	me := test.CallerFuncName(0)
+	e.CmdFactory = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		return test.TestCommandContext(t, me, ctx, name, arg...)
+	}
+
+	dir := t.TempDir()
+	j := NewJoinedDownloadable(
+		[]JoinInput{
+			{Url: StaticUrl("https://foo.bar.com/first")},
+			{Url: StaticUrl("https://foo.bar.com/second"), Trim: 2 * time.Minute},
+		},
+		filepath.Join(dir, "target.mkv"),
+		WithMetadata(Metadata{Title: "Some Movie"}))
+	video := &VideoStream{Stream: Stream{Index: 0, CodecName: "h264"}, Width: 1280, Height: 720}
+	j.inputs[0].format.Duration = time.Hour
+	j.inputs[0].streams = []SourceStream{
+		video,
+		&AudioStream{Stream: Stream{Index: 1, CodecName: "aac"}, Language: "deu", Channels: 2},
+	}
+	// The second recording has an additional audio stream, and the video
+	// stream last.
+	j.inputs[1].format.Duration = 30 * time.Minute
+	j.inputs[1].streams = []SourceStream{
+		&AudioStream{Stream: Stream{Index: 0, CodecName: "aac"}, Language: "eng", Channels: 2},
+		&AudioStream{Stream: Stream{Index: 1, CodecName: "aac"}, Language: "deu", Channels: 2},
+		&VideoStream{Stream: Stream{Index: 2, CodecName: "h264"}, Width: 1280, Height: 720},
+	}
+	for _, input := range j.inputs {
+		input.detected = true
+	}
+
+	progress := &testProgressHandler{}
+	if err := j.Download(t.Context(), NewBestStreamsSelector(), progress); nil != err {
+		t.Fatalf("joinedDownloadable.Download() got error %v, want nil", err)
+	}
+	if !progress.started || !progress.finished {
+		t.Errorf("progress started = %v, finished = %v, want both", progress.started, progress.finished)
+	}
+	// The progress of the second input only covers its 28 minutes left after
+	// trimming.
+	gotProgress := []float64{}
+	for _, p := range progress.progressUpdates {
+		gotProgress = append(gotProgress, math.Round(float64(p.RelCompleted)*88*10)/10)
+	}
+	if want := []float64{30, 60 + 14}; !reflect.DeepEqual(gotProgress, want) {
+		t.Errorf("joinedDownloadable.Download() reported progress %v of 88, want %v", gotProgress, want)
+	}
+	if got := j.Duration(); got != 88*time.Minute {
+		t.Errorf("joinedDownloadable.Duration() = %s, want %s", got, 88*time.Minute)
+	}
+
+	if got := listDir(t, dir); !reflect.DeepEqual(got, []string{"target.mkv"}) {
+		t.Errorf("joinedDownloadable.Download() left %v, want only the output", got)
+	}
+	workDir := filepath.Join(dir, stagingDirName(filepath.Join(dir, "target.mkv")+".join"))
+	wantList := "ffconcat version 1.0\n" +
+		"file '" + filepath.Join(workDir, "input01.mkv") + "'\n" +
+		"file '" + filepath.Join(workDir, "input02.mkv") + "'\n" +
+		"inpoint 120\n"
+	if data, _ := os.ReadFile(filepath.Join(dir, "target.mkv")); string(data) != wantList {
+		t.Errorf("joined inputs %q, want %q", data, wantList)
+	}
+}
+
+func Test_matchedStreamsSelector_SelectStreams(t *testing.T) {
+	audio := &AudioStream{Stream: Stream{Index: 0, CodecName: "aac"}}
+	video := &VideoStream{Stream: Stream{Index: 1, CodecName: "h264"}}
+
+	got, err := matchedStreamsSelector{1, 0}.SelectStreams([]SourceStream{audio, video})
+	if nil != err {
+		t.Fatalf("SelectStreams() failed: %v", err)
+	}
+	if want := []SourceStream{video, audio}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SelectStreams() = %v, want %v", got, want)
+	}
+
+	if _, err := (matchedStreamsSelector{2}).SelectStreams([]SourceStream{audio, video}); nil == err {
+		t.Error("SelectStreams() got no error for an unavailable stream")
+	}
+}
+
+func Test_joinedDownloadable_checkFreeSpace(t *testing.T) {
+	dir := t.TempDir()
+	free, err := freeSpace(dir)
+	if errors.Is(err, errFreeSpaceUnsupported) {
+		t.Skip("free space cannot be determined on this platform")
+	} else if nil != err {
+		t.Fatalf("freeSpace() failed: %v", err)
+	}
+
+	// Each input takes up 30% of the free space, and the output takes up as
+	// much as both inputs, so the output alone fits, but not along with them.
+	inputSize := float64(free) * 0.3
+	bitRate := int(inputSize * 8 / time.Hour.Seconds() / containerOverhead)
+	video := &VideoStream{Stream: Stream{Index: 0, CodecName: "h264"}, BitRate: bitRate}
+	var messages bytes.Buffer
+	j := NewJoinedDownloadable(
+		[]JoinInput{{Url: StaticUrl("https://foo.bar.com/first")}, {Url: StaticUrl("https://foo.bar.com/second")}},
+		filepath.Join(dir, "target.mkv"),
+		WithMessages(&messages))
+	for _, input := range j.inputs {
+		input.format.Duration = time.Hour
+		input.streams = []SourceStream{video}
+	}
+
+	var downloadErr *DownloadError
+	err = j.checkFreeSpace([]SourceStream{video}, [][]int{{0}, {0}})
+	if !errors.As(err, &downloadErr) || downloadErr.Class != FailureDiskFull {
+		t.Errorf("checkFreeSpace() got error %v, want class %q", err, FailureDiskFull)
+	}
+}
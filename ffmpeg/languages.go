@@ -0,0 +1,44 @@
+package ffmpeg
+
+import "strings"
+
+// iso639_1 maps ISO 639-1 language codes to the ISO 639-2/T codes.
+var iso639_1 = map[string]string{
+	"ar": "ara", "bg": "bul", "bs": "bos", "ca": "cat", "cs": "ces",
+	"cy": "cym", "da": "dan", "de": "deu", "el": "ell", "en": "eng",
+	"es": "spa", "et": "est", "eu": "eus", "fa": "fas", "fi": "fin",
+	"fr": "fra", "ga": "gle", "he": "heb", "hi": "hin", "hr": "hrv",
+	"hu": "hun", "hy": "hye", "is": "isl", "it": "ita", "ja": "jpn",
+	"ka": "kat", "ko": "kor", "lb": "ltz", "lt": "lit", "lv": "lav",
+	"mk": "mkd", "nb": "nob", "nl": "nld", "nn": "nno", "no": "nor",
+	"pl": "pol", "pt": "por", "rm": "roh", "ro": "ron", "ru": "rus",
+	"sk": "slk", "sl": "slv", "sq": "sqi", "sr": "srp", "sv": "swe",
+	"th": "tha", "tr": "tur", "uk": "ukr", "vi": "vie", "zh": "zho",
+}
+
+// iso639_2b maps ISO 639-2/B (bibliographic) language codes to the ISO 639-2/T
+// (terminology) codes.
+var iso639_2b = map[string]string{
+	"alb": "sqi", "arm": "hye", "baq": "eus", "chi": "zho", "cze": "ces",
+	"dut": "nld", "fre": "fra", "geo": "kat", "ger": "deu", "gre": "ell",
+	"ice": "isl", "mac": "mkd", "per": "fas", "rum": "ron", "slo": "slk",
+	"wel": "cym",
+}
+
+// NormalizeLanguage returns the ISO 639-2/T code for the given ISO 639-1 or
+// ISO 639-2 language code, such that e.g. "de", "ger" and "deu" all compare
+// equal. Unknown codes are returned in lower case.
+func NormalizeLanguage(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if t, found := iso639_1[code]; found {
+		return t
+	} else if t, found := iso639_2b[code]; found {
+		return t
+	}
+	return code
+}
+
+// SameLanguage tells whether the given language codes denote the same language.
+func SameLanguage(a, b string) bool {
+	return NormalizeLanguage(a) == NormalizeLanguage(b)
+}
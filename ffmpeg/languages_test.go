@@ -0,0 +1,35 @@
+package ffmpeg
+
+import "testing"
+
+func TestNormalizeLanguage(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{code: "de", want: "deu"},
+		{code: "DE", want: "deu"},
+		{code: "ger", want: "deu"},
+		{code: "deu", want: "deu"},
+		{code: "fre", want: "fra"},
+		{code: " en ", want: "eng"},
+		{code: "qaa", want: "qaa"},
+		{code: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			if got := NormalizeLanguage(tt.code); got != tt.want {
+				t.Errorf("NormalizeLanguage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSameLanguage(t *testing.T) {
+	if !SameLanguage("de", "ger") {
+		t.Error(`SameLanguage("de", "ger") = false, want true`)
+	}
+	if SameLanguage("de", "en") {
+		t.Error(`SameLanguage("de", "en") = true, want false`)
+	}
+}
@@ -0,0 +1,285 @@
+package ffmpeg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultLoudnessTarget   = -23.0
+	defaultLoudnessTruePeak = -1.0
+	defaultLoudnessRange    = 7.0
+	// defaultNormalizedSampleRate is the sample rate of normalized audio if the
+	// sample rate of the source is unknown, as loudnorm upsamples to 192 kHz.
+	defaultNormalizedSampleRate = 48000
+)
+
+// StageLoudness normalizes the loudness of the audio streams of the output.
+var StageLoudness = Stage{Name: "normalize_loudness", Description: "Normalizing loudness"}
+
+// LoudnessSettings defines the EBU R128 loudness normalization of all audio
+// streams, which ffmpeg's loudnorm filter measures in a first pass and
+// normalizes in a second pass.
+type LoudnessSettings struct {
+	// Target is the integrated loudness target in LUFS, -23 if not set.
+	Target float64 `json:"target,omitempty"`
+	// TruePeak is the maximum true peak in dBTP, -1 if not set.
+	TruePeak float64 `json:"truePeak,omitempty"`
+	// Range is the loudness range target in LU, 7 if not set.
+	Range float64 `json:"range,omitempty"`
+}
+
+// audioEncoders maps audio codecs to their ffmpeg encoder, where it is not
+// named like the codec.
+var audioEncoders = map[string]string{
+	"mp3":    "libmp3lame",
+	"opus":   "libopus",
+	"vorbis": "libvorbis",
+}
+
+// loudnessMeasurement holds the values measured by the first pass of ffmpeg's
+// loudnorm filter.
+type loudnessMeasurement struct {
+	InputI       string `json:"input_i"`
+	InputTp      string `json:"input_tp"`
+	InputLra     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	TargetOffset string `json:"target_offset"`
+}
+
+// filter returns the loudnorm filter which targets the given settings.
+func (s LoudnessSettings) filter() string {
+	target, truePeak, lra := s.Target, s.TruePeak, s.Range
+	if target == 0 {
+		target = defaultLoudnessTarget
+	}
+	if truePeak == 0 {
+		truePeak = defaultLoudnessTruePeak
+	}
+	if lra == 0 {
+		lra = defaultLoudnessRange
+	}
+	return fmt.Sprintf("loudnorm=I=%s:TP=%s:LRA=%s",
+		formatFloat(target), formatFloat(truePeak), formatFloat(lra))
+}
+
+// normalizeLoudness normalizes the loudness of the audio streams of each of the
+// given outputs, copying all other streams.
+func (d *downloadable) normalizeLoudness(
+	ctx context.Context,
+	outputs []string,
+	streams []SourceStream,
+	progress DownloadProgressHandler,
+) error {
+	audio := FilterStreams(streams, IsAudioStream)
+	if len(audio) <= 0 {
+		return nil
+	}
+	if sh, ok := progress.(StageHandler); ok {
+		sh.StageStarted(StageLoudness)
+	}
+
+	settings := *d.profile.Loudness
+	for i, output := range outputs {
+		measurements, err := d.measureLoudness(ctx, output, len(audio), settings, i, progress)
+		if nil != err {
+			return fmt.Errorf("failed to measure loudness of %q: %w", output, err)
+		}
+		for a, m := range measurements {
+			fmt.Fprintf(d.messageWriter(), "Audio stream %d: %s LUFS, true peak %s dBTP, range %s LU\n",
+				a, m.InputI, m.InputTp, m.InputLra)
+		}
+
+		normalized := filepath.Join(filepath.Dir(output), ".loudness."+filepath.Base(output))
+		args := d.normalizeArgs(output, normalized, audio, streams, settings, measurements)
+		if err := runPostProcessingFfmpeg(ctx, args, d.partDurationOf(i), progress, nil); nil != err {
+			os.Remove(normalized)
+			return fmt.Errorf("failed to normalize loudness of %q: %w", output, err)
+		}
+		if err := os.Rename(normalized, output); nil != err {
+			return fmt.Errorf("failed to replace %q: %w", output, err)
+		}
+	}
+	return nil
+}
+
+// measureLoudness runs the first loudnorm pass on the given number of audio
+// streams of the output at once, with one loudnorm filter per stream, and
+// returns the measured values of each stream.
+func (d *downloadable) measureLoudness(
+	ctx context.Context,
+	output string,
+	audioCount int,
+	settings LoudnessSettings,
+	part int,
+	progress DownloadProgressHandler,
+) ([]loudnessMeasurement, error) {
+	p := &loudnormParser{}
+	args := measureArgs(output, audioCount, settings)
+	if err := runPostProcessingFfmpeg(ctx, args, d.partDurationOf(part), progress, p.parseLine); nil != err {
+		return nil, err
+	}
+	return p.measurements(audioCount)
+}
+
+// measureArgs returns the ffmpeg arguments for the first loudnorm pass on the
+// given number of audio streams of the output.
+func measureArgs(output string, audioCount int, settings LoudnessSettings) []string {
+	filters := []string{}
+	maps := []string{}
+	for a := range audioCount {
+		filters = append(filters, fmt.Sprintf("[0:a:%d]%s:print_format=json[a%d]", a, settings.filter(), a))
+		maps = append(maps, "-map", fmt.Sprintf("[a%d]", a))
+	}
+	args := []string{"-i", output, "-filter_complex", strings.Join(filters, ";")}
+	return append(append(args, maps...), "-f", "null", "-")
+}
+
+// normalizeArgs returns the ffmpeg arguments for the second loudnorm pass,
+// which encodes the given audio streams like the first pass wrote them and
+// writes the measured values to their metadata.
+func (d *downloadable) normalizeArgs(
+	output, normalized string,
+	audio []SourceStream,
+	streams []SourceStream,
+	settings LoudnessSettings,
+	measurements []loudnessMeasurement,
+) []string {
+	var audioSettings *CodecSettings
+	profile := d.profile
+	if container := d.outputContainer(); container != "" {
+		profile = container.transcodingProfile(profile, streams)
+	}
+	if nil != profile {
+		audioSettings = profile.Audio
+	}
+
+	muxer := containerSpecs[d.outputContainer()].muxer
+	args := []string{"-i", output, "-map", "0", "-c", "copy"}
+	for a, s := range audio {
+		as := s.(*AudioStream)
+		m := measurements[a]
+		encoder, bitrate := as.CodecName, ""
+		if nil != audioSettings {
+			encoder, bitrate = audioSettings.Codec, audioSettings.Bitrate
+		} else if as.BitRate > 0 {
+			bitrate = strconv.Itoa(as.BitRate)
+		}
+		if e, found := audioEncoders[encoder]; found {
+			encoder = e
+		}
+		sampleRate := as.SampleRate
+		if sampleRate <= 0 {
+			sampleRate = defaultNormalizedSampleRate
+		}
+
+		args = append(args, fmt.Sprintf("-c:a:%d", a), encoder)
+		if bitrate != "" {
+			args = append(args, fmt.Sprintf("-b:a:%d", a), bitrate)
+		}
+		args = append(args,
+			fmt.Sprintf("-ar:a:%d", a), strconv.Itoa(sampleRate),
+			fmt.Sprintf("-filter:a:%d", a), fmt.Sprintf(
+				"%s:measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true",
+				settings.filter(), m.InputI, m.InputTp, m.InputLra, m.InputThresh, m.TargetOffset),
+		)
+		if nil != audioSettings {
+			args = append(args, streamArgs(audioSettings.Args, fmt.Sprintf("a:%d", a))...)
+		}
+
+		// The mp3 muxer only writes the tags of the file, and mp3 files have
+		// a single audio stream.
+		metadata := fmt.Sprintf("-metadata:s:a:%d", a)
+		if muxer == "mp3" {
+			metadata = "-metadata"
+		}
+		args = append(args,
+			metadata, "LOUDNESS_INTEGRATED="+m.InputI,
+			metadata, "LOUDNESS_TRUE_PEAK="+m.InputTp,
+			metadata, "LOUDNESS_RANGE="+m.InputLra,
+			metadata, "LOUDNESS_THRESHOLD="+m.InputThresh,
+		)
+	}
+
+	if muxer == "mp4" || muxer == "ipod" {
+		// The mp4 muxers drop custom metadata tags unless asked to keep them.
+		args = append(args, "-movflags", "+use_metadata_tags")
+	}
+	if d.container != "" {
+		args = append(args, "-f", muxer)
+	}
+	return append(args, "-y", normalized)
+}
+
+// reLoudnormFilter matches the log prefix of the loudnorm filters, which are
+// numbered in the order of the audio streams they measure.
+var reLoudnormFilter = regexp.MustCompile(`\[Parsed_loudnorm_(\d+) @`)
+
+// loudnormParser collects the JSON objects printed by ffmpeg's loudnorm
+// filters, by the number of the filter which printed them.
+type loudnormParser struct {
+	filter int
+	inJson bool
+	json   strings.Builder
+	values map[int]string
+}
+
+func (p *loudnormParser) parseLine(line string) {
+	if m := reLoudnormFilter.FindStringSubmatch(line); nil != m {
+		p.filter, _ = strconv.Atoi(m[1])
+	}
+	line = strings.TrimSpace(line)
+	if line == "{" {
+		p.inJson = true
+		p.json.Reset()
+	}
+	if p.inJson {
+		p.json.WriteString(line)
+	}
+	if line == "}" && p.inJson {
+		p.inJson = false
+		if nil == p.values {
+			p.values = map[int]string{}
+		}
+		p.values[p.filter] = p.json.String()
+	}
+}
+
+// measurements returns the values measured by the given number of loudnorm
+// filters.
+func (p *loudnormParser) measurements(count int) ([]loudnessMeasurement, error) {
+	res := []loudnessMeasurement{}
+	for i := range count {
+		m, err := parseLoudnessMeasurement(p.values[i])
+		if nil != err {
+			return nil, fmt.Errorf("audio stream %d: %w", i, err)
+		}
+		res = append(res, m)
+	}
+	return res, nil
+}
+
+func parseLoudnessMeasurement(values string) (loudnessMeasurement, error) {
+	if values == "" {
+		return loudnessMeasurement{}, errors.New("loudnorm did not print measured values")
+	}
+	var m loudnessMeasurement
+	if err := json.Unmarshal([]byte(values), &m); nil != err {
+		return loudnessMeasurement{}, fmt.Errorf("failed to parse measured values: %w", err)
+	}
+	if m.InputI == "" || m.InputTp == "" || m.InputLra == "" || m.InputThresh == "" || m.TargetOffset == "" {
+		return loudnessMeasurement{}, errors.New("loudnorm did not print all measured values")
+	}
+	return m, nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,258 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	e "github.com/rokeller/zt-dl/exec"
+	"github.com/rokeller/zt-dl/test"
+)
+
+const loudnormOutput = `[Parsed_loudnorm_0 @ 0x5581]
+{
+	"input_i" : "-18.42",
+	"input_tp" : "-0.35",
+	"input_lra" : "9.10",
+	"input_thresh" : "-28.73",
+	"output_i" : "-23.05",
+	"output_tp" : "-2.01",
+	"output_lra" : "7.40",
+	"output_thresh" : "-33.31",
+	"normalization_type" : "dynamic",
+	"target_offset" : "0.05"
+}`
+
+func TestLoudnessSettings_filter(t *testing.T) {
+	tests := []struct {
+		settings LoudnessSettings
+		want     string
+	}{
+		{settings: LoudnessSettings{}, want: "loudnorm=I=-23:TP=-1:LRA=7"},
+		{settings: LoudnessSettings{Target: -16, TruePeak: -1.5, Range: 11}, want: "loudnorm=I=-16:TP=-1.5:LRA=11"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.settings.filter(); got != tt.want {
+				t.Errorf("LoudnessSettings.filter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_loudnormParser(t *testing.T) {
+	measured := loudnessMeasurement{
+		InputI:       "-18.42",
+		InputTp:      "-0.35",
+		InputLra:     "9.10",
+		InputThresh:  "-28.73",
+		TargetOffset: "0.05",
+	}
+	secondOutput := strings.NewReplacer("loudnorm_0", "loudnorm_1", "-18.42", "-20.00").Replace(loudnormOutput)
+	second := measured
+	second.InputI = "-20.00"
+
+	tests := []struct {
+		name    string // description of this test case
+		lines   []string
+		count   int
+		want    []loudnessMeasurement
+		wantErr bool
+	}{
+		{
+			name:  "Measured",
+			lines: append([]string{"size=N/A time=01:00:00.00 bitrate=N/A"}, strings.Split(loudnormOutput, "\n")...),
+			count: 1,
+			want:  []loudnessMeasurement{measured},
+		},
+		{
+			name:  "MeasuredSeveral/OutOfOrder",
+			lines: strings.Split(secondOutput+"\n"+loudnormOutput, "\n"),
+			count: 2,
+			want:  []loudnessMeasurement{measured, second},
+		},
+		{
+			name:    "MissingStream",
+			lines:   strings.Split(loudnormOutput, "\n"),
+			count:   2,
+			wantErr: true,
+		},
+		{
+			name:    "NothingPrinted",
+			lines:   []string{"size=N/A time=01:00:00.00 bitrate=N/A"},
+			count:   1,
+			wantErr: true,
+		},
+		{
+			name:    "Incomplete",
+			lines:   []string{"{", `"input_i" : "-18.42"`, "}"},
+			count:   1,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &loudnormParser{}
+			for _, line := range tt.lines {
+				p.parseLine(line)
+			}
+			got, err := p.measurements(tt.count)
+			if (nil != err) != tt.wantErr {
+				t.Fatalf("measurements() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("measurements() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_measureArgs(t *testing.T) {
+	got := measureArgs("in.mkv", 2, LoudnessSettings{})
+	want := []string{
+		"-i", "in.mkv",
+		"-filter_complex", "[0:a:0]loudnorm=I=-23:TP=-1:LRA=7:print_format=json[a0];" +
+			"[0:a:1]loudnorm=I=-23:TP=-1:LRA=7:print_format=json[a1]",
+		"-map", "[a0]",
+		"-map", "[a1]",
+		"-f", "null", "-",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("measureArgs() = %q, want %q", got, want)
+	}
+}
+
+func Test_downloadable_normalizeArgs(t *testing.T) {
+	m := loudnessMeasurement{InputI: "-18.42", InputTp: "-0.35", InputLra: "9.10", InputThresh: "-28.73", TargetOffset: "0.05"}
+	filter := "loudnorm=I=-23:TP=-1:LRA=7:measured_I=-18.42:measured_TP=-0.35:measured_LRA=9.10:measured_thresh=-28.73:offset=0.05:linear=true"
+	metadata := []string{
+		"-metadata:s:a:0", "LOUDNESS_INTEGRATED=-18.42",
+		"-metadata:s:a:0", "LOUDNESS_TRUE_PEAK=-0.35",
+		"-metadata:s:a:0", "LOUDNESS_RANGE=9.10",
+		"-metadata:s:a:0", "LOUDNESS_THRESHOLD=-28.73",
+	}
+	video := &VideoStream{Stream: Stream{Index: 0, CodecName: "h264"}}
+	audio := &AudioStream{Stream: Stream{Index: 1, CodecName: "aac"}, SampleRate: 44100, BitRate: 128000}
+
+	tests := []struct {
+		name       string // description of this test case
+		outputPath string
+		options    []DownloadableOption
+		streams    []SourceStream
+		want       []string
+	}{
+		{
+			name:       "CopiedAudio",
+			outputPath: "rec.mkv",
+			streams:    []SourceStream{video, audio},
+			want: slices.Concat(
+				[]string{"-i", "in.mkv", "-map", "0", "-c", "copy",
+					"-c:a:0", "aac", "-b:a:0", "128000", "-ar:a:0", "44100", "-filter:a:0", filter},
+				metadata,
+				[]string{"-y", "out.mkv"},
+			),
+		},
+		{
+			name:       "TranscodedAudio/Mp4",
+			outputPath: "rec.mp4",
+			options: []DownloadableOption{
+				WithContainer(ContainerMp4),
+				WithTranscodingProfile(TranscodingProfile{
+					Audio:    &CodecSettings{Codec: "libopus", Bitrate: "96k", Args: []string{"-vbr", "on"}},
+					Loudness: &LoudnessSettings{},
+				}),
+			},
+			streams: []SourceStream{video, &AudioStream{Stream: Stream{Index: 1, CodecName: "mp2"}}},
+			want: slices.Concat(
+				[]string{"-i", "in.mkv", "-map", "0", "-c", "copy",
+					"-c:a:0", "libopus", "-b:a:0", "96k", "-ar:a:0", "48000", "-filter:a:0", filter,
+					"-vbr:a:0", "on"},
+				metadata,
+				[]string{"-movflags", "+use_metadata_tags", "-f", "mp4", "-y", "out.mkv"},
+			),
+		},
+		{
+			name:       "ContainerTranscodedAudio",
+			outputPath: "rec.mp3",
+			streams:    []SourceStream{&AudioStream{Stream: Stream{Index: 0, CodecName: "aac"}, SampleRate: 48000}},
+			want: slices.Concat(
+				[]string{"-i", "in.mkv", "-map", "0", "-c", "copy",
+					"-c:a:0", "libmp3lame", "-ar:a:0", "48000", "-filter:a:0", filter, "-q:a", "2"},
+				// The mp3 muxer only writes the tags of the file.
+				[]string{
+					"-metadata", "LOUDNESS_INTEGRATED=-18.42",
+					"-metadata", "LOUDNESS_TRUE_PEAK=-0.35",
+					"-metadata", "LOUDNESS_RANGE=9.10",
+					"-metadata", "LOUDNESS_THRESHOLD=-28.73",
+				},
+				[]string{"-y", "out.mkv"},
+			),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDownloadable(nil, tt.outputPath, tt.options...)
+			got := d.normalizeArgs("in.mkv", "out.mkv", FilterStreams(tt.streams, IsAudioStream),
+				tt.streams, LoudnessSettings{}, []loudnessMeasurement{m})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_downloadable_Download_ffmpeg_Loudness(t *testing.T) {
+	if test.IsTestCall() {
+		args := test.GetArgs()
+		output := args[len(args)-1]
+		switch {
+		case output == "-":
+			// First pass: measure both audio streams at once.
+			if !slices.Contains(args, "[a1]") {
+				os.Exit(2)
+			}
+			fmt.Fprintln(os.Stderr, "size=N/A time=00:30:00.00 bitrate=N/A")
+			fmt.Fprintln(os.Stderr, loudnormOutput)
+			fmt.Fprintln(os.Stderr, strings.ReplaceAll(loudnormOutput, "loudnorm_0", "loudnorm_1"))
+		case filepath.Base(output) == ".loudness.target.mkv":
+			// Second pass: normalize.
+			os.WriteFile(output, []byte("normalized"), 0o644)
+		default:
+			os.WriteFile(output, []byte("downloaded"), 0o644)
+		}
+		os.Exit(0)
+		return
+	}
+
+	me := test.CallerFuncName(0)
+	e.CmdFactory = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		return test.TestCommandContext(t, me, ctx, name, arg...)
+	}
+
+	dir := t.TempDir()
+	d := NewDownloadable(StaticUrl("https://foo.bar.com/source"), filepath.Join(dir, "target.mkv"),
+		WithTranscodingProfile(TranscodingProfile{Loudness: &LoudnessSettings{Target: -24}}))
+	d.format.Duration = 30 * time.Minute
+	d.streams = []SourceStream{
+		&VideoStream{Stream: Stream{Index: 0}, Width: 1280, Height: 720},
+		&AudioStream{Stream: Stream{Index: 1, CodecName: "aac"}, Channels: 2, Language: "deu"},
+		&AudioStream{Stream: Stream{Index: 2, CodecName: "aac"}, Channels: 2, Language: "eng"},
+	}
+	if err := d.Download(t.Context(), NewIndexStreamsSelector(0, 1, 2), &testProgressHandler{}); nil != err {
+		t.Fatalf("downloadable.Download() got error %v, want nil", err)
+	}
+
+	if got := listDir(t, dir); !reflect.DeepEqual(got, []string{"target.mkv"}) {
+		t.Errorf("downloadable.Download() wrote %v, want only the output", got)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "target.mkv")); string(data) != "normalized" {
+		t.Errorf("output has content %q, want normalized output", data)
+	}
+}
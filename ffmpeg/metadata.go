@@ -0,0 +1,45 @@
+package ffmpeg
+
+import "strconv"
+
+// Metadata describes the program of a recording. It gets written to the tags
+// of the output.
+type Metadata struct {
+	Title        string
+	EpisodeTitle string
+	Channel      string
+	Description  string
+	Year         int
+}
+
+// args returns the ffmpeg output arguments to write the metadata tags.
+func (m Metadata) args() []string {
+	title := m.Title
+	if m.EpisodeTitle != "" {
+		title += " - " + m.EpisodeTitle
+	}
+	year := ""
+	if m.Year > 0 {
+		year = strconv.Itoa(m.Year)
+	}
+
+	tags := []struct{ key, value string }{
+		{"title", title},
+		{"show", m.Title},
+		{"album", m.Title},
+		{"episode_id", m.EpisodeTitle},
+		{"artist", m.Channel},
+		{"network", m.Channel},
+		{"date", year},
+		{"description", m.Description},
+		{"comment", m.Description},
+	}
+
+	args := []string{}
+	for _, tag := range tags {
+		if tag.value != "" {
+			args = append(args, "-metadata", tag.key+"="+tag.value)
+		}
+	}
+	return args
+}
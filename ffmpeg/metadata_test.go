@@ -0,0 +1,56 @@
+package ffmpeg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMetadata_args(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata Metadata
+		want     []string
+	}{
+		{
+			name: "Empty",
+			want: []string{},
+		},
+		{
+			name:     "Title only",
+			metadata: Metadata{Title: "News"},
+			want: []string{
+				"-metadata", "title=News",
+				"-metadata", "show=News",
+				"-metadata", "album=News",
+			},
+		},
+		{
+			name: "All",
+			metadata: Metadata{
+				Title:        "Concert",
+				EpisodeTitle: "Encore",
+				Channel:      "Arte",
+				Description:  "Live from Berlin.",
+				Year:         2024,
+			},
+			want: []string{
+				"-metadata", "title=Concert - Encore",
+				"-metadata", "show=Concert",
+				"-metadata", "album=Concert",
+				"-metadata", "episode_id=Encore",
+				"-metadata", "artist=Arte",
+				"-metadata", "network=Arte",
+				"-metadata", "date=2024",
+				"-metadata", "description=Live from Berlin.",
+				"-metadata", "comment=Live from Berlin.",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.metadata.args(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Metadata.args() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
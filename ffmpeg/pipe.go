@@ -0,0 +1,59 @@
+package ffmpeg
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+)
+
+// StdoutPath is the output path which streams the output to stdout.
+const StdoutPath = "-"
+
+// pipeOutput is the ffmpeg output which writes to the stdout of ffmpeg.
+const pipeOutput = "pipe:1"
+
+// streamableContainers lists the containers whose muxers write the output
+// without seeking, such that it can be streamed to a pipe.
+var streamableContainers = []Container{
+	ContainerMatroska,
+	ContainerMatroskaAudio,
+	ContainerMpegTs,
+}
+
+// streaming tells whether the main output is streamed to a pipe, i.e. to the
+// writer set with [WithPipe] or to an existing named pipe, instead of being
+// written to a file.
+func (d *downloadable) streaming() bool {
+	return nil != d.pipe || d.namedPipe
+}
+
+// checkStreamable returns an error if the main output is streamed but the
+// download needs an output file, e.g. to post-process it.
+func (d *downloadable) checkStreamable(subtitleMode SubtitleMode) error {
+	if !d.streaming() {
+		return nil
+	}
+
+	if container := d.outputContainer(); !slices.Contains(streamableContainers, container) {
+		return fmt.Errorf("cannot stream the %q container, use one of %v", container, streamableContainers)
+	}
+	switch {
+	case d.subtitlesOnly:
+		return errors.New("cannot stream subtitles only")
+	case subtitleMode.sidecars():
+		return errors.New("cannot write subtitle sidecar files when streaming the output")
+	case d.split.Duration > 0 || d.split.Size > 0:
+		return errors.New("cannot split a streamed output into parts")
+	case len(d.postProcessors) > 0 || (nil != d.profile && nil != d.profile.Loudness):
+		return errors.New("cannot post-process a streamed output")
+	}
+	return nil
+}
+
+// isNamedPipe tells whether a named pipe exists at the given path.
+func isNamedPipe(path string) bool {
+	info, err := os.Stat(path)
+	return nil == err && info.Mode()&fs.ModeNamedPipe != 0
+}
@@ -0,0 +1,144 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	e "github.com/rokeller/zt-dl/exec"
+	"github.com/rokeller/zt-dl/test"
+)
+
+func Test_downloadable_checkStreamable(t *testing.T) {
+	tests := []struct {
+		name         string // description of this test case
+		outputPath   string
+		options      []DownloadableOption
+		subtitleMode SubtitleMode
+		wantErr      bool
+	}{
+		{
+			name:       "NotStreaming",
+			outputPath: "target.mp4",
+		},
+		{
+			name:       "DefaultContainer",
+			outputPath: StdoutPath,
+			options:    []DownloadableOption{WithPipe(&bytes.Buffer{})},
+		},
+		{
+			name:       "MpegTs",
+			outputPath: StdoutPath,
+			options:    []DownloadableOption{WithPipe(&bytes.Buffer{}), WithContainer(ContainerMpegTs)},
+		},
+		{
+			name:       "Mp4",
+			outputPath: StdoutPath,
+			options:    []DownloadableOption{WithPipe(&bytes.Buffer{}), WithContainer(ContainerMp4)},
+			wantErr:    true,
+		},
+		{
+			name:         "SubtitleSidecars",
+			outputPath:   StdoutPath,
+			options:      []DownloadableOption{WithPipe(&bytes.Buffer{})},
+			subtitleMode: SubtitlesBoth,
+			wantErr:      true,
+		},
+		{
+			name:       "SubtitlesOnly",
+			outputPath: StdoutPath,
+			options:    []DownloadableOption{WithPipe(&bytes.Buffer{}), WithSubtitlesOnly(true)},
+			wantErr:    true,
+		},
+		{
+			name:       "Split",
+			outputPath: StdoutPath,
+			options:    []DownloadableOption{WithPipe(&bytes.Buffer{}), WithSplit(Split{Size: 1 << 30})},
+			wantErr:    true,
+		},
+		{
+			name:       "PostProcessors",
+			outputPath: StdoutPath,
+			options:    []DownloadableOption{WithPipe(&bytes.Buffer{}), WithPostProcessors(NewChapterDetector())},
+			wantErr:    true,
+		},
+		{
+			name:       "Loudness",
+			outputPath: StdoutPath,
+			options: []DownloadableOption{
+				WithPipe(&bytes.Buffer{}),
+				WithTranscodingProfile(TranscodingProfile{Loudness: &LoudnessSettings{}}),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDownloadable(StaticUrl("https://foo.bar.com/source"), tt.outputPath, tt.options...)
+			err := d.checkStreamable(tt.subtitleMode)
+			if (nil != err) != tt.wantErr {
+				t.Errorf("checkStreamable() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_downloadable_Download_ffmpeg_WithPipe(t *testing.T) {
+	if test.IsTestCall() {
+		test.AssertArgs(
+			"ffmpeg",
+			"-protocol_whitelist", "https,tls,tcp",
+			"-i", "https://foo.bar.com/source",
+			"-y",
+			"-map", "0:0",
+			"-map", "0:2",
+			"-c", "copy",
+			"-f", "matroska",
+			"pipe:1",
+		)
+		fmt.Print("streamed output")
+		os.Exit(0)
+		return
+	}
+
+	me := test.CallerFuncName(0)
+	e.CmdFactory = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		return test.TestCommandContext(t, me, ctx, name, arg...)
+	}
+
+	// The output is neither checked nor staged, so it is fine if a file with
+	// the name of the output exists.
+	dir := t.TempDir()
+	t.Chdir(dir)
+	if err := os.WriteFile(StdoutPath, []byte("existing"), 0o644); nil != err {
+		t.Fatalf("failed to write existing file: %v", err)
+	}
+
+	var out, messages bytes.Buffer
+	d := NewDownloadable(StaticUrl("https://foo.bar.com/source"), StdoutPath, WithPipe(&out), WithMessages(&messages))
+	d.streams = []SourceStream{
+		&AudioStream{Stream: Stream{Index: 0, CodecName: "aac"}, SampleRate: 48000},
+		&VideoStream{Stream: Stream{Index: 2, CodecName: "h264"}, Width: 1280, Height: 720},
+	}
+	progress := &testProgressHandler{}
+	if err := d.Download(t.Context(), NewBestStreamsSelector(), progress); nil != err {
+		t.Fatalf("downloadable.Download() got error %v, want nil", err)
+	}
+
+	if got := out.String(); got != "streamed output" {
+		t.Errorf("downloadable.Download() streamed %q, want %q", got, "streamed output")
+	}
+	if got := messages.String(); !strings.Contains(got, "Selected stream(s) for download:") {
+		t.Errorf("downloadable.Download() wrote messages %q, want the selected streams", got)
+	}
+	if !progress.finished {
+		t.Error("downloadable.Download() did not report the download as finished")
+	}
+	if got := listDir(t, dir); len(got) != 1 || got[0] != StdoutPath {
+		t.Errorf("downloadable.Download() wrote %v, want no files", got)
+	}
+}
@@ -0,0 +1,131 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	e "github.com/rokeller/zt-dl/exec"
+)
+
+// Stage describes a stage of the download pipeline.
+type Stage struct {
+	Name        string
+	Description string
+}
+
+// PostProcessor defines the interface for optional pipeline stages that run on
+// the output file after the streams were downloaded successfully.
+type PostProcessor interface {
+	// Stage returns the pipeline stage implemented by the post processor.
+	Stage() Stage
+	// PostProcess runs the post processor on the given job.
+	PostProcess(
+		ctx context.Context,
+		job PostProcessingJob,
+		progress DownloadProgressHandler,
+	) error
+}
+
+// PostProcessingJob holds the details about a finished download that are
+// needed by post processors.
+type PostProcessingJob struct {
+	// OutputPath is the path of the output, which is still staged while post
+	// processors run.
+	OutputPath string
+	Duration   time.Duration
+	// Video tells whether the output has a video stream.
+	Video bool
+	// Messages receives informational messages of the post processor, which
+	// go to stdout if not set.
+	Messages io.Writer
+}
+
+// messageWriter returns the writer for informational messages of the job.
+func (j PostProcessingJob) messageWriter() io.Writer {
+	if nil != j.Messages {
+		return j.Messages
+	}
+	return os.Stdout
+}
+
+// StageHandler can optionally be implemented by a [DownloadProgressHandler] to
+// get notified when the download pipeline enters a new stage.
+type StageHandler interface {
+	StageStarted(stage Stage)
+}
+
+// postProcess runs the post processors on each of the given outputs, which
+// are the parts of the main output if it is split, of the given streams.
+func (d *downloadable) postProcess(
+	ctx context.Context,
+	outputs []string,
+	streams []SourceStream,
+	progress DownloadProgressHandler,
+) error {
+	video := len(FilterStreams(streams, IsVideoStream)) > 0
+	for _, pp := range d.postProcessors {
+		stage := pp.Stage()
+		if sh, ok := progress.(StageHandler); ok {
+			sh.StageStarted(stage)
+		}
+		for i, output := range outputs {
+			job := PostProcessingJob{
+				OutputPath: output,
+				Duration:   d.partDurationOf(i),
+				Video:      video,
+				Messages:   d.messageWriter(),
+			}
+			if err := pp.PostProcess(ctx, job, progress); nil != err {
+				return fmt.Errorf("post-processing stage %q failed: %w", stage.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// runPostProcessingFfmpeg runs ffmpeg with the given arguments, e.g. on the
+// output of a download, and reports progress parsed from its stderr output to
+// the given handler, and classifies its failure. If observe is not nil, it gets
+// called for every line ffmpeg writes to stderr.
+func runPostProcessingFfmpeg(
+	ctx context.Context,
+	args []string,
+	duration time.Duration,
+	progress DownloadProgressHandler,
+	observe func(line string),
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ffmpegCmd := e.CmdFactory(ctx, ffmpegBinary, args...)
+	stderr, err := ffmpegCmd.StderrPipe()
+	if nil != err {
+		return fmt.Errorf("failed to redirect stderr to pipe: %w", err)
+	}
+
+	tracker := downloadProgressTracker{
+		handler:  progress,
+		source:   stderr,
+		observer: observe,
+		tail:     newLogTail(logTailSize),
+
+		start:        time.Now().UTC(),
+		durationMsec: duration.Milliseconds(),
+	}
+
+	if err := ffmpegCmd.Start(); nil != err {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	// Consume all of stderr before waiting for the process to exit.
+	tracker.trackProgress()
+
+	if err := ffmpegCmd.Wait(); nil != err {
+		return classifyFailure(ctx, err, tracker.tail.Lines())
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build linux
+
+package ffmpeg
+
+import "syscall"
+
+// runsAtLowPriority tells whether the current process runs at low priority.
+func runsAtLowPriority() bool {
+	// The getpriority system call returns 20 minus the niceness on Linux.
+	prio, err := syscall.Getpriority(syscall.PRIO_PROCESS, 0)
+	return nil == err && 20-prio == lowPriorityNiceness
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package ffmpeg
+
+import (
+	"io"
+	"os/exec"
+)
+
+// startAtLowPriority is not supported on this platform, so commands are
+// started at normal priority.
+func startAtLowPriority(cmd *exec.Cmd, messages io.Writer) error {
+	return cmd.Start()
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package ffmpeg
+
+// runsAtLowPriority is only verified on Linux.
+func runsAtLowPriority() bool {
+	return true
+}
@@ -0,0 +1,40 @@
+//go:build linux || darwin || freebsd
+
+package ffmpeg
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// lowPriorityNiceness is the niceness of processes running at low priority.
+const lowPriorityNiceness = 19
+
+// startAtLowPriority starts the command at low priority. The command is run
+// through nice such that it never runs at normal priority, or gets its priority
+// lowered right after it started if nice is not available.
+func startAtLowPriority(cmd *exec.Cmd, messages io.Writer) error {
+	nice, err := exec.LookPath("nice")
+	if nil != err || nil != cmd.Err {
+		if err := cmd.Start(); nil != err {
+			return err
+		}
+		if err := lowerPriority(cmd.Process.Pid); nil != err {
+			fmt.Fprintf(messages, "WARN: Failed to lower the priority of %s: %v\n", cmd.Path, err)
+		}
+		return nil
+	}
+
+	cmd.Args = append([]string{"nice", "-n", strconv.Itoa(lowPriorityNiceness), cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = nice
+	return cmd.Start()
+}
+
+// lowerPriority lowers the scheduling priority of the process with the given
+// ID.
+func lowerPriority(pid int) error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, pid, lowPriorityNiceness)
+}
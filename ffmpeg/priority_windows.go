@@ -0,0 +1,20 @@
+//go:build windows
+
+package ffmpeg
+
+import (
+	"io"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// startAtLowPriority starts the command in the below normal priority class.
+func startAtLowPriority(cmd *exec.Cmd, messages io.Writer) error {
+	if nil == cmd.SysProcAttr {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= windows.BELOW_NORMAL_PRIORITY_CLASS
+	return cmd.Start()
+}
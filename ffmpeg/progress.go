@@ -9,12 +9,19 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/rokeller/zt-dl/ratelimit"
 )
 
 type DownloadProgress struct {
 	RelCompleted float32       `json:"completed"`
 	Elapsed      time.Duration `json:"elapsed"`
 	Remaining    time.Duration `json:"remaining"`
+	// Rate is the average rate at which the input was downloaded so far, if
+	// the download is rate limited.
+	Rate ratelimit.Rate `json:"rate,omitempty"`
+	// RateLimit is the limit which currently applies, zero if unlimited.
+	RateLimit ratelimit.Rate `json:"rateLimit,omitempty"`
 }
 
 type DownloadProgressHandler interface {
@@ -27,32 +34,90 @@ type DownloadProgressHandler interface {
 type consoleProgressHandler struct {
 	target     io.Writer
 	outputPath string
+	parts      []string
+	sidecars   []string
+	// subtitlesOnly is set if only the subtitle sidecars are written, and not
+	// the output itself.
+	subtitlesOnly bool
 }
 
-func (h consoleProgressHandler) Start() {
-	fmt.Println("Starting download ...")
+var (
+	_ DownloadProgressHandler = &consoleProgressHandler{}
+	_ SidecarsHandler         = &consoleProgressHandler{}
+	_ PartsHandler            = &consoleProgressHandler{}
+)
+
+func (h *consoleProgressHandler) Start() {
+	fmt.Fprintln(h.target, "Starting download ...")
 }
 
-func (h consoleProgressHandler) UpdateProgress(p DownloadProgress) {
+func (h *consoleProgressHandler) UpdateProgress(p DownloadProgress) {
+	rate := ""
+	if p.Rate > 0 {
+		rate = fmt.Sprintf(" | Rate: %12s (limit: %s)", p.Rate, p.RateLimit)
+	}
 	fmt.Fprintf(h.target,
-		"Download progress: %5.1f%% | Elapsed: %10s | Remaining: %10s\r",
-		p.RelCompleted*100, p.Elapsed.Truncate(time.Second), p.Remaining)
+		"Download progress: %5.1f%% | Elapsed: %10s | Remaining: %10s%s\r",
+		p.RelCompleted*100, p.Elapsed.Truncate(time.Second), p.Remaining, rate)
 }
 
-func (h consoleProgressHandler) Error(err error) {
+func (h *consoleProgressHandler) Error(err error) {
 }
 
-func (h consoleProgressHandler) Finished() {
-	fmt.Println("Finished download.")
-	fmt.Printf("Recording written to %q.\n", h.outputPath)
-	fmt.Println()
+// StageStarted implements [StageHandler].
+func (h *consoleProgressHandler) StageStarted(stage Stage) {
+	fmt.Fprintln(h.target)
+	fmt.Fprintf(h.target, "Post-processing: %s ...\n", stage.Description)
 }
 
-type downloadProgressTracker struct {
-	handler DownloadProgressHandler
-	source  io.Reader
+func (h *consoleProgressHandler) Finished() {
+	fmt.Fprintln(h.target, "Finished download.")
+	switch {
+	case h.subtitlesOnly:
+		// Only the sidecars were written, which are listed below.
+	case len(h.parts) > 0:
+		fmt.Fprintf(h.target, "Recording written to %d parts:\n", len(h.parts))
+		for _, part := range h.parts {
+			fmt.Fprintf(h.target, "    %q\n", part)
+		}
+	case h.outputPath == StdoutPath:
+		fmt.Fprintln(h.target, "Recording written to stdout.")
+	default:
+		fmt.Fprintf(h.target, "Recording written to %q.\n", h.outputPath)
+	}
+	if len(h.sidecars) > 0 {
+		fmt.Fprintf(h.target, "Subtitles written to %d sidecar file(s):\n", len(h.sidecars))
+		for _, sidecar := range h.sidecars {
+			fmt.Fprintf(h.target, "    %q\n", sidecar)
+		}
+	}
+	fmt.Fprintln(h.target)
+}
+
+// SidecarsWritten implements [SidecarsHandler].
+func (h *consoleProgressHandler) SidecarsWritten(paths []string) {
+	h.sidecars = paths
+}
 
-	start        time.Time
+// PartsWritten implements [PartsHandler].
+func (h *consoleProgressHandler) PartsWritten(paths []string) {
+	h.parts = paths
+}
+
+type downloadProgressTracker struct {
+	handler  DownloadProgressHandler
+	source   io.Reader
+	observer func(line string)
+	// tail keeps the last lines which do not report progress, if set.
+	tail *logTail
+	// transfer returns the number of bytes downloaded and the rate limit, if
+	// the download is rate limited.
+	transfer func() (int64, ratelimit.Rate)
+
+	start time.Time
+	// offsetMsec is the position in the input at which ffmpeg started, e.g.
+	// when continuing a download.
+	offsetMsec   int64
 	durationMsec int64
 }
 
@@ -66,8 +131,16 @@ func (t *downloadProgressTracker) trackProgress() {
 
 	for scanner.Scan() {
 		line := scanner.Text()
+		if nil != t.observer {
+			t.observer(line)
+		}
 		if strings.Contains(line, "time=") {
 			t.tryReportProgress(line)
+			continue
+		}
+		// Errors end up in the log tail attached to the failure, if kept.
+		if nil != t.tail {
+			t.tail.Add(line)
 		} else if reErrorProgress.MatchString(line) {
 			t.reportError(line)
 		}
@@ -89,7 +162,7 @@ func (t *downloadProgressTracker) tryReportProgress(line string) {
 	if nil != err {
 		return
 	}
-	relPos := float32(posMsec) / float32(t.durationMsec)
+	relPos := float32(t.offsetMsec+posMsec) / float32(t.durationMsec)
 	elapsed := time.Now().UTC().Sub(t.start)
 	remaining := time.Hour * 24 * 999
 
@@ -100,11 +173,19 @@ func (t *downloadProgressTracker) tryReportProgress(line string) {
 				Truncate(time.Second)
 	}
 
-	t.handler.UpdateProgress(DownloadProgress{
+	p := DownloadProgress{
 		RelCompleted: relPos,
 		Elapsed:      elapsed,
 		Remaining:    remaining,
-	})
+	}
+	if nil != t.transfer {
+		received, limit := t.transfer()
+		if elapsed > 0 {
+			p.Rate = ratelimit.Rate(float64(received) / elapsed.Seconds())
+		}
+		p.RateLimit = limit
+	}
+	t.handler.UpdateProgress(p)
 }
 
 func (t *downloadProgressTracker) reportError(line string) {
@@ -13,8 +13,10 @@ func Test_downloadProgressTracker_trackProgress(t *testing.T) {
 	tests := []struct {
 		name         string // description of this test case
 		pipeIn       string
+		keepTail     bool
 		wantProgress []DownloadProgress
 		wantError    error
+		wantTail     []string
 	}{
 		{
 			name:         "Progress/NoValidProgressUpdates",
@@ -61,6 +63,15 @@ func Test_downloadProgressTracker_trackProgress(t *testing.T) {
 			wantProgress: []DownloadProgress{},
 			wantError:    errors.New("this is an ERROR"),
 		},
+		{
+			name:     "Errors/KeptInTail",
+			pipeIn:   "blah\nthis is an error\ntime=00:01:40.00\n",
+			keepTail: true,
+			wantProgress: []DownloadProgress{
+				{RelCompleted: .1, Elapsed: time.Second * 10, Remaining: time.Minute + time.Second*30},
+			},
+			wantTail: []string{"blah", "this is an error"},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -72,6 +83,9 @@ func Test_downloadProgressTracker_trackProgress(t *testing.T) {
 				start:        time.Now().Add(-10 * time.Second),
 				durationMsec: (1000 * time.Second).Milliseconds(),
 			}
+			if tt.keepTail {
+				d.tail = newLogTail(logTailSize)
+			}
 
 			d.trackProgress()
 			actualProgress := h.progressUpdates
@@ -84,6 +98,9 @@ func Test_downloadProgressTracker_trackProgress(t *testing.T) {
 			} else if (nil == h.err) != (nil == tt.wantError) {
 				t.Errorf("trackProgress() produced error %v, want %v", h.err, tt.wantError)
 			}
+			if tt.keepTail && !reflect.DeepEqual(d.tail.Lines(), tt.wantTail) {
+				t.Errorf("trackProgress() kept tail %q, want %q", d.tail.Lines(), tt.wantTail)
+			}
 		})
 	}
 }
@@ -253,7 +270,7 @@ func Test_consoleProgressHandler_UpdateProgress(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			buf := bytes.NewBuffer(nil)
-			h := consoleProgressHandler{
+			h := &consoleProgressHandler{
 				target: buf,
 			}
 			h.UpdateProgress(tt.p)
@@ -266,6 +283,54 @@ func Test_consoleProgressHandler_UpdateProgress(t *testing.T) {
 	}
 }
 
+func Test_consoleProgressHandler_Finished(t *testing.T) {
+	tests := []struct {
+		name string // description of this test case
+		h    *consoleProgressHandler
+		want string
+	}{
+		{
+			name: "Output",
+			h:    &consoleProgressHandler{outputPath: "/out/rec.mkv"},
+			want: "Finished download.\nRecording written to \"/out/rec.mkv\".\n\n",
+		},
+		{
+			name: "Stdout",
+			h:    &consoleProgressHandler{outputPath: StdoutPath},
+			want: "Finished download.\nRecording written to stdout.\n\n",
+		},
+		{
+			name: "Parts",
+			h:    &consoleProgressHandler{outputPath: "/out/rec.mkv", parts: []string{"/out/rec.part1.mkv"}},
+			want: "Finished download.\nRecording written to 1 parts:\n    \"/out/rec.part1.mkv\"\n\n",
+		},
+		{
+			name: "Sidecars",
+			h:    &consoleProgressHandler{outputPath: "/out/rec.mkv", sidecars: []string{"/out/rec.de.srt"}},
+			want: "Finished download.\nRecording written to \"/out/rec.mkv\".\n" +
+				"Subtitles written to 1 sidecar file(s):\n    \"/out/rec.de.srt\"\n\n",
+		},
+		{
+			name: "SubtitlesOnly",
+			h: &consoleProgressHandler{outputPath: "/out/rec.mkv", subtitlesOnly: true,
+				sidecars: []string{"/out/rec.de.srt"}},
+			want: "Finished download.\n" +
+				"Subtitles written to 1 sidecar file(s):\n    \"/out/rec.de.srt\"\n\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			tt.h.target = buf
+			tt.h.Finished()
+
+			if got := buf.String(); got != tt.want {
+				t.Errorf("Finished() output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_downloadProgressTracker_reportError(t *testing.T) {
 	tests := []struct {
 		name string // description of this test case
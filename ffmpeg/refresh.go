@@ -0,0 +1,185 @@
+package ffmpeg
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// maxUrlRefreshes is how often a download asks for a fresh input URL before it
+// gives up.
+const maxUrlRefreshes = 3
+
+// segmentListName is the name of the file in the staging directory to which
+// ffmpeg's segment muxer lists the completed parts of a split output.
+const segmentListName = ".parts.csv"
+
+// UrlProvider provides the URL of an input, e.g. a stream URL with a
+// time-limited token. It is called again for a fresh URL when the input was
+// denied because its URL expired.
+type UrlProvider func(ctx context.Context) (string, error)
+
+// StaticUrl returns the provider of the given URL, which cannot be refreshed.
+func StaticUrl(url string) UrlProvider {
+	return func(ctx context.Context) (string, error) {
+		return url, nil
+	}
+}
+
+// RefreshableUrl returns the provider which provides the given URL first, and
+// gets a fresh URL from refresh on every further call.
+func RefreshableUrl(url string, refresh UrlProvider) UrlProvider {
+	var used atomic.Bool
+	return func(ctx context.Context) (string, error) {
+		if used.CompareAndSwap(false, true) {
+			return url, nil
+		}
+		return refresh(ctx)
+	}
+}
+
+// resolveInputUrl gets the URL of the input from its provider, unless it is
+// known already.
+func (d *downloadable) resolveInputUrl(ctx context.Context) error {
+	if d.inputUrl != "" || nil == d.input {
+		return nil
+	}
+	url, err := d.input(ctx)
+	if nil != err {
+		return fmt.Errorf("failed to get input URL: %w", err)
+	}
+	d.inputUrl = url
+	return nil
+}
+
+// isExpired tells whether the download failed because the input URL expired.
+// CDNs answer expired tokens with 401, 403 or 410.
+func isExpired(err error) bool {
+	var downloadErr *DownloadError
+	if !errors.As(err, &downloadErr) {
+		return false
+	}
+	switch downloadErr.Class {
+	case FailureUnauthorized, FailureForbidden, FailureGone:
+		return true
+	}
+	return false
+}
+
+// retryExpired prepares to retry the download after it failed with the given
+// error, and tells whether to retry. Downloads are only retried if the input
+// URL expired and its provider gives a fresh one. Split outputs continue after
+// the last completed part, while other outputs restart from the beginning.
+// Streamed outputs are never retried, as their start was consumed already.
+func (d *downloadable) retryExpired(
+	ctx context.Context,
+	failure error,
+	refreshes int,
+	subtitleMode SubtitleMode,
+) bool {
+	if refreshes >= maxUrlRefreshes || nil == d.input || d.streaming() || !isExpired(failure) {
+		return false
+	}
+	url, err := d.input(ctx)
+	if nil != err {
+		fmt.Fprintf(d.messageWriter(), "WARN: failed to refresh the expired input URL: %v\n", err)
+		return false
+	} else if url == d.inputUrl {
+		return false
+	}
+	d.inputUrl = url
+
+	if d.splitting() && !subtitleMode.sidecars() {
+		err := d.resumeSplit()
+		if nil == err {
+			fmt.Fprintf(d.messageWriter(), "\nThe input URL expired, continuing after part %d with a fresh URL ...\n", d.completedParts)
+			return true
+		}
+		fmt.Fprintf(d.messageWriter(), "WARN: cannot continue after the completed parts: %v\n", err)
+	}
+
+	d.completedParts, d.resumeAt = 0, 0
+	staged, err := d.newStaging()
+	if nil != err {
+		fmt.Fprintf(d.messageWriter(), "WARN: cannot restart the download: %v\n", err)
+		return false
+	}
+	d.staged = staged
+	fmt.Fprintln(d.messageWriter(), "\nThe input URL expired, restarting the download with a fresh URL ...")
+	return true
+}
+
+// segmentListPath returns the path of the list of completed parts of a split
+// output.
+func (d *downloadable) segmentListPath() string {
+	return filepath.Join(d.staged.dir, segmentListName)
+}
+
+// resumeSplit prepares to continue a split download after the parts which
+// ffmpeg completed before it failed. The incomplete part is removed.
+func (d *downloadable) resumeSplit() error {
+	completed, end, err := readSegmentList(d.segmentListPath())
+	if nil != err {
+		return err
+	}
+	d.completedParts += completed
+	d.resumeAt += end
+
+	for part := d.completedParts + 1; ; part++ {
+		path := partPath(d.writePath(), part)
+		if err := os.Remove(path); errors.Is(err, os.ErrNotExist) {
+			break
+		} else if nil != err {
+			return fmt.Errorf("failed to remove incomplete part %q: %w", path, err)
+		}
+	}
+	if err := os.Remove(d.segmentListPath()); nil != err && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove list of parts: %w", err)
+	}
+	return nil
+}
+
+// readSegmentList reads the CSV list of completed parts which ffmpeg's segment
+// muxer writes, and returns the number of parts and the end of the last part.
+// A missing list means that no part was completed.
+func readSegmentList(path string) (int, time.Duration, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	} else if nil != err {
+		return 0, 0, fmt.Errorf("failed to open list of parts: %w", err)
+	}
+	defer f.Close()
+
+	count := 0
+	var end time.Duration
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		// Lines are <file name>,<start time>,<end time>, with times in
+		// seconds.
+		fields := strings.Split(line, ",")
+		seconds, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+		if nil != err || len(fields) < 3 {
+			return 0, 0, fmt.Errorf("invalid entry %q in list of parts", line)
+		}
+		count++
+		// ffmpeg lists times with microsecond precision.
+		end = time.Duration(math.Round(seconds*1e6)) * time.Microsecond
+	}
+	if err := s.Err(); nil != err {
+		return 0, 0, fmt.Errorf("failed to read list of parts: %w", err)
+	}
+	return count, end, nil
+}
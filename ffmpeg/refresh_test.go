@@ -0,0 +1,252 @@
+package ffmpeg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	e "github.com/rokeller/zt-dl/exec"
+	"github.com/rokeller/zt-dl/test"
+)
+
+func TestRefreshableUrl(t *testing.T) {
+	refreshes := 0
+	provider := RefreshableUrl("https://foo.bar.com/source?token=1", func(ctx context.Context) (string, error) {
+		refreshes++
+		return fmt.Sprintf("https://foo.bar.com/source?token=%d", refreshes+1), nil
+	})
+
+	for i, want := range []string{
+		"https://foo.bar.com/source?token=1",
+		"https://foo.bar.com/source?token=2",
+		"https://foo.bar.com/source?token=3",
+	} {
+		got, err := provider(t.Context())
+		if nil != err {
+			t.Fatalf("call %d got error %v, want nil", i+1, err)
+		}
+		if got != want {
+			t.Errorf("call %d = %q, want %q", i+1, got, want)
+		}
+	}
+}
+
+func Test_isExpired(t *testing.T) {
+	tests := []struct {
+		name string // description of this test case
+		err  error
+		want bool
+	}{
+		{name: "Unauthorized", err: &DownloadError{Class: FailureUnauthorized}, want: true},
+		{name: "Forbidden", err: &DownloadError{Class: FailureForbidden}, want: true},
+		{name: "Gone", err: fmt.Errorf("wrapped: %w", &DownloadError{Class: FailureGone}), want: true},
+		{name: "NotFound", err: &DownloadError{Class: FailureNotFound}, want: false},
+		{name: "Other", err: errors.New("exit status 1"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isExpired(tt.err); got != tt.want {
+				t.Errorf("isExpired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_readSegmentList(t *testing.T) {
+	tests := []struct {
+		name      string // description of this test case
+		content   string // the list is missing if empty
+		wantCount int
+		wantEnd   time.Duration
+		wantErr   bool
+	}{
+		{
+			name: "Missing",
+		},
+		{
+			name:      "Parts",
+			content:   "target.part01.mkv,0.000000,1200.040000\ntarget.part02.mkv,1200.040000,2400.080000\n",
+			wantCount: 2,
+			wantEnd:   2400080 * time.Millisecond,
+		},
+		{
+			name:    "Invalid",
+			content: "target.part01.mkv,0.000000,soon\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), segmentListName)
+			if tt.content != "" {
+				os.WriteFile(path, []byte(tt.content), 0o644)
+			}
+			count, end, err := readSegmentList(path)
+			if (nil != err) != tt.wantErr {
+				t.Fatalf("readSegmentList() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if count != tt.wantCount || end != tt.wantEnd {
+				t.Errorf("readSegmentList() = %d, %s, want %d, %s", count, end, tt.wantCount, tt.wantEnd)
+			}
+		})
+	}
+}
+
+// expiringSource fails with 403 for the first token of the source's URL.
+const expiringSource = "https://foo.bar.com/source?token=1"
+
+func Test_downloadable_Download_ffmpeg_RefreshUrl(t *testing.T) {
+	if test.IsTestCall() {
+		args := test.GetArgs()
+		if slices.Contains(args, expiringSource) {
+			fmt.Fprintln(os.Stderr, "[https @ 0x1234] HTTP error 403 Forbidden")
+			os.Exit(1)
+		}
+		test.AssertArgs(
+			"ffmpeg",
+			"-protocol_whitelist", "https,tls,tcp",
+			"-i", "https://foo.bar.com/source?token=2",
+			"-n",
+			"-map", "0:0",
+			"-c", "copy",
+			args[len(args)-1],
+		)
+		os.WriteFile(args[len(args)-1], []byte("output"), 0o644)
+		os.Exit(0)
+		return
+	}
+
+	me := test.CallerFuncName(0)
+	defer func(factory func(context.Context, string, ...string) *exec.Cmd) {
+		e.CmdFactory = factory
+	}(e.CmdFactory)
+	e.CmdFactory = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		return test.TestCommandContext(t, me, ctx, name, arg...)
+	}
+
+	tests := []struct {
+		name      string // description of this test case
+		input     UrlProvider
+		wantClass FailureClass
+		wantFiles []string
+	}{
+		{
+			name: "Refreshed",
+			input: RefreshableUrl(expiringSource, func(ctx context.Context) (string, error) {
+				return "https://foo.bar.com/source?token=2", nil
+			}),
+			wantFiles: []string{"target.mkv"},
+		},
+		{
+			name:      "Static",
+			input:     StaticUrl(expiringSource),
+			wantClass: FailureForbidden,
+			wantFiles: []string{},
+		},
+		{
+			name: "RefreshFailed",
+			input: RefreshableUrl(expiringSource, func(ctx context.Context) (string, error) {
+				return "", errors.New("not logged in")
+			}),
+			wantClass: FailureForbidden,
+			wantFiles: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			d := NewDownloadable(tt.input, filepath.Join(dir, "target.mkv"))
+			d.format.Duration = time.Hour
+			d.streams = []SourceStream{&VideoStream{Stream: Stream{Index: 0}, Width: 1280, Height: 720}}
+
+			err := d.Download(t.Context(), NewBestStreamsSelector(), &testProgressHandler{})
+			var downloadErr *DownloadError
+			if tt.wantClass == "" && nil != err {
+				t.Fatalf("downloadable.Download() got error %v, want nil", err)
+			} else if tt.wantClass != "" && (!errors.As(err, &downloadErr) || downloadErr.Class != tt.wantClass) {
+				t.Fatalf("downloadable.Download() got error %v, want class %s", err, tt.wantClass)
+			}
+			if got := listDir(t, dir); !reflect.DeepEqual(got, tt.wantFiles) {
+				t.Errorf("downloadable.Download() wrote %v, want %v", got, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func Test_downloadable_Download_ffmpeg_RefreshUrl_Split(t *testing.T) {
+	if test.IsTestCall() {
+		args := test.GetArgs()
+		output := args[len(args)-1]
+		list := filepath.Join(filepath.Dir(output), segmentListName)
+		if slices.Contains(args, expiringSource) {
+			// The first part completes before the URL expires.
+			os.WriteFile(fmt.Sprintf(output, 1), []byte("part"), 0o644)
+			os.WriteFile(fmt.Sprintf(output, 2), []byte("incomplete"), 0o644)
+			os.WriteFile(list, []byte("target.part01.mkv,0.000000,1200.040000\n"), 0o644)
+			fmt.Fprintln(os.Stderr, "[https @ 0x1234] HTTP error 403 Forbidden")
+			os.Exit(1)
+		}
+		test.AssertArgs(
+			"ffmpeg",
+			"-ss", "1200.04",
+			"-protocol_whitelist", "https,tls,tcp",
+			"-i", "https://foo.bar.com/source?token=2",
+			"-n",
+			"-map", "0:0",
+			"-c", "copy",
+			"-f", "segment",
+			"-segment_time", "1200",
+			"-segment_start_number", "2",
+			"-reset_timestamps", "1",
+			"-segment_list", list,
+			"-segment_list_type", "csv",
+			output,
+		)
+		if _, err := os.Stat(fmt.Sprintf(output, 2)); nil == err {
+			// The incomplete part must have been removed.
+			os.Exit(100)
+		}
+		for part := 2; part <= 3; part++ {
+			os.WriteFile(fmt.Sprintf(output, part), []byte("part"), 0o644)
+		}
+		os.WriteFile(list, []byte("target.part02.mkv,0.000000,1200.000000\n"), 0o644)
+		os.Exit(0)
+		return
+	}
+
+	me := test.CallerFuncName(0)
+	defer func(factory func(context.Context, string, ...string) *exec.Cmd) {
+		e.CmdFactory = factory
+	}(e.CmdFactory)
+	e.CmdFactory = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		return test.TestCommandContext(t, me, ctx, name, arg...)
+	}
+
+	dir := t.TempDir()
+	input := RefreshableUrl(expiringSource, func(ctx context.Context) (string, error) {
+		return "https://foo.bar.com/source?token=2", nil
+	})
+	d := NewDownloadable(input, filepath.Join(dir, "target.mkv"), WithSplit(Split{Duration: 20 * time.Minute}))
+	d.format.Duration = time.Hour
+	d.streams = []SourceStream{&VideoStream{Stream: Stream{Index: 0}, Width: 1280, Height: 720}}
+	if err := d.Download(t.Context(), NewBestStreamsSelector(), &testProgressHandler{}); nil != err {
+		t.Fatalf("downloadable.Download() got error %v, want nil", err)
+	}
+
+	wantParts := []string{"target.part01.mkv", "target.part02.mkv", "target.part03.mkv"}
+	if got := listDir(t, dir); !reflect.DeepEqual(got, wantParts) {
+		t.Errorf("downloadable.Download() wrote %v, want %v", got, wantParts)
+	}
+	for _, part := range wantParts {
+		if data, _ := os.ReadFile(filepath.Join(dir, part)); string(data) != "part" {
+			t.Errorf("%s has content %q, want %q", part, data, "part")
+		}
+	}
+}
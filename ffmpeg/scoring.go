@@ -0,0 +1,218 @@
+package ffmpeg
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/rokeller/zt-dl/units"
+)
+
+// Score is the score of a stream, along with the components it is made of.
+// Higher scores are better.
+type Score struct {
+	Total      float64
+	Components []ScoreComponent
+}
+
+// ScoreComponent is the part of a score contributed by a stream property.
+type ScoreComponent struct {
+	Name  string
+	Value float64
+}
+
+func (s *Score) add(name string, value float64) {
+	if value == 0 {
+		return
+	}
+	s.Total += value
+	s.Components = append(s.Components, ScoreComponent{Name: name, Value: value})
+}
+
+// String implements [fmt.Stringer].
+func (s Score) String() string {
+	parts := make([]string, 0, len(s.Components))
+	for _, c := range s.Components {
+		parts = append(parts, fmt.Sprintf("%s %.2f", c.Name, c.Value))
+	}
+	return fmt.Sprintf("%.2f (%s)", s.Total, strings.Join(parts, ", "))
+}
+
+// StreamScorer scores video and audio streams to rank them.
+type StreamScorer interface {
+	ScoreVideo(s *VideoStream) Score
+	ScoreAudio(s *AudioStream) Score
+}
+
+// WeightedScorer scores streams by the weighted sum of their properties.
+type WeightedScorer struct {
+	// Resolution is the weight per megapixel of video streams.
+	Resolution float64
+	// FrameRate is the weight per frame per second of video streams.
+	FrameRate float64
+	// VideoBitRate is the weight per Mbps of video streams.
+	VideoBitRate float64
+	// Channels is the weight per audio channel.
+	Channels float64
+	// SampleRate is the weight per kHz of audio streams.
+	SampleRate float64
+	// AudioBitRate is the weight per 100 kbps of audio streams.
+	AudioBitRate float64
+	// Codec is the weight of the codec preference. The first of n preferred
+	// codecs scores n times the weight, the last one scores the weight once.
+	Codec float64
+	// VideoCodecs and AudioCodecs list the preferred codecs in order.
+	VideoCodecs []string
+	AudioCodecs []string
+}
+
+var _ StreamScorer = WeightedScorer{}
+
+// DefaultScorer returns the scorer used unless another one is configured. A
+// stream with a higher resolution wins over one with a higher frame rate, e.g.
+// 1080p25 scores higher than 720p50.
+func DefaultScorer() WeightedScorer {
+	return WeightedScorer{
+		Resolution:   10,
+		FrameRate:    0.1,
+		VideoBitRate: 1,
+		Channels:     1,
+		SampleRate:   0.1,
+		AudioBitRate: 0.1,
+		Codec:        1,
+	}
+}
+
+// ScoreVideo implements [StreamScorer].
+func (w WeightedScorer) ScoreVideo(s *VideoStream) Score {
+	var score Score
+	score.add("resolution", w.Resolution*float64(s.Width*s.Height)/1e6)
+	score.add("frame rate", w.FrameRate*s.AvgFrameRate)
+	score.add("bit rate", w.VideoBitRate*float64(s.BitRate)/1e6)
+	score.add("codec", w.Codec*codecPreference(w.VideoCodecs, s.CodecName))
+	return score
+}
+
+// ScoreAudio implements [StreamScorer].
+func (w WeightedScorer) ScoreAudio(s *AudioStream) Score {
+	var score Score
+	score.add("channels", w.Channels*float64(s.Channels))
+	score.add("sample rate", w.SampleRate*float64(s.SampleRate)/1e3)
+	score.add("bit rate", w.AudioBitRate*float64(s.BitRate)/1e5)
+	score.add("codec", w.Codec*codecPreference(w.AudioCodecs, s.CodecName))
+	return score
+}
+
+func codecPreference(codecs []string, codec string) float64 {
+	for i, c := range codecs {
+		if strings.EqualFold(c, codec) {
+			return float64(len(codecs) - i)
+		}
+	}
+	return 0
+}
+
+// ranking picks the best video and audio streams by their scores, limited to
+// video streams within the configured ceilings. The picks are explained to log,
+// if set.
+type ranking struct {
+	scorer     StreamScorer
+	maxHeight  int
+	maxBitRate int
+	log        io.Writer
+}
+
+func defaultRanking() ranking {
+	return ranking{scorer: DefaultScorer()}
+}
+
+func (r ranking) logf(format string, args ...any) {
+	if nil != r.log {
+		fmt.Fprintf(r.log, format, args...)
+	}
+}
+
+func (r ranking) withinCeilings(s *VideoStream) bool {
+	return (r.maxHeight <= 0 || s.Height <= r.maxHeight) &&
+		(r.maxBitRate <= 0 || s.BitRate <= r.maxBitRate)
+}
+
+func (r ranking) bestVideo(streams []SourceStream) SourceStream {
+	if len(streams) < 1 {
+		return nil
+	}
+
+	candidates := FilterStreams(streams, func(s SourceStream) bool {
+		return r.withinCeilings(s.(*VideoStream))
+	})
+	if len(candidates) <= 0 {
+		r.logf("WARN: no video stream within height %d and bit rate %d; ignoring the limits.\n",
+			r.maxHeight, r.maxBitRate)
+		candidates = streams
+	}
+
+	scored := TransformStreams(candidates, func(s SourceStream) scoredVideo {
+		vs := s.(*VideoStream)
+		return scoredVideo{vs, r.scorer.ScoreVideo(vs)}
+	})
+	best := slices.MinFunc(scored, func(a, b scoredVideo) int {
+		return cmp.Or(
+			cmp.Compare(b.score.Total, a.score.Total),
+			cmp.Compare(b.stream.Height, a.stream.Height),
+			cmp.Compare(b.stream.Width, a.stream.Width),
+			cmp.Compare(b.stream.AvgFrameRate, a.stream.AvgFrameRate),
+			cmp.Compare(b.stream.BitRate, a.stream.BitRate),
+			cmp.Compare(a.stream.Index(), b.stream.Index()),
+		)
+	})
+	if len(scored) > 1 {
+		r.logf("Best video stream #%d scored %s\n", best.stream.Index(), best.score)
+	}
+	return best.stream
+}
+
+func (r ranking) bestAudio(streams []SourceStream) SourceStream {
+	if len(streams) < 1 {
+		return nil
+	}
+
+	scored := TransformStreams(streams, func(s SourceStream) scoredAudio {
+		as := s.(*AudioStream)
+		return scoredAudio{as, r.scorer.ScoreAudio(as)}
+	})
+	best := slices.MinFunc(scored, func(a, b scoredAudio) int {
+		return cmp.Or(
+			cmp.Compare(b.score.Total, a.score.Total),
+			cmp.Compare(b.stream.Channels, a.stream.Channels),
+			cmp.Compare(b.stream.SampleRate, a.stream.SampleRate),
+			cmp.Compare(b.stream.BitRate, a.stream.BitRate),
+			cmp.Compare(a.stream.Index(), b.stream.Index()),
+		)
+	})
+	if len(scored) > 1 {
+		r.logf("Best audio stream #%d scored %s\n", best.stream.Index(), best.score)
+	}
+	return best.stream
+}
+
+type scoredVideo struct {
+	stream *VideoStream
+	score  Score
+}
+
+type scoredAudio struct {
+	stream *AudioStream
+	score  Score
+}
+
+// ParseBitRate parses a bit rate in bits per second with an optional decimal
+// k, M or G suffix in either case, e.g. 5M or 800k.
+func ParseBitRate(value string) (int, error) {
+	n, err := units.Decimal.Parse(value)
+	if nil != err {
+		return 0, fmt.Errorf("invalid bit rate %q", value)
+	}
+	return int(n), nil
+}
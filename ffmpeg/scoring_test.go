@@ -0,0 +1,149 @@
+package ffmpeg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWeightedScorer_ScoreVideo(t *testing.T) {
+	s := DefaultScorer()
+	s.VideoCodecs = []string{"hevc", "h264"}
+	got := s.ScoreVideo(&VideoStream{
+		Stream:       Stream{CodecName: "h264"},
+		Width:        1000,
+		Height:       500,
+		AvgFrameRate: 50,
+		BitRate:      2_000_000,
+	})
+	want := Score{
+		Total: 13,
+		Components: []ScoreComponent{
+			{Name: "resolution", Value: 5},
+			{Name: "frame rate", Value: 5},
+			{Name: "bit rate", Value: 2},
+			{Name: "codec", Value: 1},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ScoreVideo() = %v, want %v", got, want)
+	}
+	if got.String() != "13.00 (resolution 5.00, frame rate 5.00, bit rate 2.00, codec 1.00)" {
+		t.Errorf("Score.String() = %q", got.String())
+	}
+}
+
+func TestWeightedScorer_ScoreAudio(t *testing.T) {
+	s := DefaultScorer()
+	s.AudioCodecs = []string{"aac", "ac3"}
+	got := s.ScoreAudio(&AudioStream{
+		Stream:     Stream{CodecName: "AAC"},
+		Channels:   2,
+		SampleRate: 48000,
+		BitRate:    128000,
+	})
+	if got.Total < 8.92 || got.Total > 8.93 {
+		t.Errorf("ScoreAudio() total = %v, want 2 + 4.8 + 0.128 + 2", got.Total)
+	}
+}
+
+func Test_ranking_bestVideo(t *testing.T) {
+	v1080p25 := &VideoStream{Stream: Stream{Index: 0}, Width: 1920, Height: 1080, AvgFrameRate: 25, BitRate: 5_000_000}
+	v720p50 := &VideoStream{Stream: Stream{Index: 1}, Width: 1280, Height: 720, AvgFrameRate: 50, BitRate: 3_500_000}
+	v720p50low := &VideoStream{Stream: Stream{Index: 2}, Width: 1280, Height: 720, AvgFrameRate: 50, BitRate: 2_000_000}
+	v720p50dup := &VideoStream{Stream: Stream{Index: 3}, Width: 1280, Height: 720, AvgFrameRate: 50, BitRate: 3_500_000}
+
+	tests := []struct {
+		name    string
+		ranking ranking
+		streams []SourceStream
+		want    SourceStream
+	}{
+		{
+			name:    "ResolutionBeatsFrameRate",
+			ranking: defaultRanking(),
+			streams: []SourceStream{v720p50, v1080p25},
+			want:    v1080p25,
+		},
+		{
+			name:    "BitRate",
+			ranking: defaultRanking(),
+			streams: []SourceStream{v720p50low, v720p50},
+			want:    v720p50,
+		},
+		{
+			name:    "TieBrokenByIndex",
+			ranking: defaultRanking(),
+			streams: []SourceStream{v720p50dup, v720p50},
+			want:    v720p50,
+		},
+		{
+			name:    "MaxHeight",
+			ranking: ranking{scorer: DefaultScorer(), maxHeight: 720},
+			streams: []SourceStream{v1080p25, v720p50low, v720p50},
+			want:    v720p50,
+		},
+		{
+			name:    "MaxBitRate",
+			ranking: ranking{scorer: DefaultScorer(), maxBitRate: 3_000_000},
+			streams: []SourceStream{v1080p25, v720p50low, v720p50},
+			want:    v720p50low,
+		},
+		{
+			name:    "NoneWithinCeilings",
+			ranking: ranking{scorer: DefaultScorer(), maxHeight: 480},
+			streams: []SourceStream{v720p50, v1080p25},
+			want:    v1080p25,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.ranking.bestVideo(tt.streams); got != tt.want {
+				t.Errorf("bestVideo() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ranking_bestAudio(t *testing.T) {
+	stereo := &AudioStream{Stream: Stream{Index: 0}, Channels: 2, SampleRate: 48000}
+	surround := &AudioStream{Stream: Stream{Index: 1}, Channels: 6, SampleRate: 48000}
+	stereoLow := &AudioStream{Stream: Stream{Index: 2}, Channels: 2, SampleRate: 44100}
+
+	if got := defaultRanking().bestAudio([]SourceStream{stereo, surround, stereoLow}); got != surround {
+		t.Errorf("bestAudio() = %v, want %v", got, surround)
+	}
+	if got := defaultRanking().bestAudio([]SourceStream{stereoLow, stereo}); got != stereo {
+		t.Errorf("bestAudio() = %v, want %v", got, stereo)
+	}
+	if got := defaultRanking().bestAudio(nil); nil != got {
+		t.Errorf("bestAudio() = %v, want nil", got)
+	}
+}
+
+func TestParseBitRate(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "5M", want: 5_000_000},
+		{value: "2.5M", want: 2_500_000},
+		{value: "5m", want: 5_000_000},
+		{value: "800k", want: 800_000},
+		{value: "800K", want: 800_000},
+		{value: "1200", want: 1200},
+		{value: "fast", wantErr: true},
+		{value: "-1k", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseBitRate(tt.value)
+			if (nil != err) != tt.wantErr {
+				t.Fatalf("ParseBitRate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseBitRate() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package ffmpeg
+
+import (
+	"io"
+	"slices"
+	"strings"
+)
+
+// SelectionRules declares preferences for the automatic selection of streams.
+// The zero value selects the same streams as the best streams selector.
+type SelectionRules struct {
+	// AudioLanguages lists the preferred audio languages in order. The audio
+	// stream of the first language available is selected.
+	AudioLanguages []string `json:"audioLanguages,omitempty"`
+	// KeepOriginal also selects the original language audio stream, if any.
+	KeepOriginal bool `json:"keepOriginal,omitempty"`
+	// SubtitleLanguages lists the languages of subtitles to select. All
+	// subtitles are selected if empty, none if set to "none".
+	SubtitleLanguages []string `json:"subtitleLanguages,omitempty"`
+	// AudioCodecs lists the preferred audio codecs in order, e.g. aac, ac3.
+	AudioCodecs []string `json:"audioCodecs,omitempty"`
+	// VideoCodecs lists the preferred video codecs in order, e.g. hevc, h264.
+	VideoCodecs []string `json:"videoCodecs,omitempty"`
+	// Exclude lists the kinds of streams to never select, e.g.
+	// audio-description or sdh.
+	Exclude []string `json:"exclude,omitempty"`
+	// MaxHeight limits the height of the selected video stream, e.g. 720.
+	MaxHeight int `json:"maxHeight,omitempty"`
+	// MaxBitRate limits the bit rate of the selected video stream, e.g. 5M.
+	MaxBitRate string `json:"maxBitrate,omitempty"`
+}
+
+// originalLanguages lists language codes used by broadcasters to mark the
+// original language audio.
+var originalLanguages = []string{"qaa", "mul", "orig"}
+
+// IsOriginalLanguage tells whether the stream is an original language audio
+// stream, going by its disposition, language code or title.
+func IsOriginalLanguage(s SourceStream) bool {
+	as, ok := s.(*AudioStream)
+	if !ok {
+		return false
+	}
+	return as.Disposition.Original ||
+		slices.Contains(originalLanguages, strings.ToLower(as.Language)) ||
+		strings.Contains(strings.ToLower(as.Title), "original")
+}
+
+type ruleBasedStreamsSelector struct {
+	rules    SelectionRules
+	excluded []SourceStreamPredicate
+	ranking  ranking
+}
+
+// NewRuleBasedStreamsSelector returns a StreamsSelector that selects streams
+// according to the given rules. The scores of the best video and audio streams
+// are explained to scoreLog, if not nil.
+func NewRuleBasedStreamsSelector(rules SelectionRules, scoreLog io.Writer) (StreamsSelector, error) {
+	scorer := DefaultScorer()
+	scorer.VideoCodecs = rules.VideoCodecs
+	scorer.AudioCodecs = rules.AudioCodecs
+	r := ruleBasedStreamsSelector{
+		rules:   rules,
+		ranking: ranking{scorer: scorer, maxHeight: rules.MaxHeight, log: scoreLog},
+	}
+	if rules.MaxBitRate != "" {
+		maxBitRate, err := ParseBitRate(rules.MaxBitRate)
+		if nil != err {
+			return nil, err
+		}
+		r.ranking.maxBitRate = maxBitRate
+	}
+	for _, name := range rules.Exclude {
+		p, err := ParseStreamPredicate(name)
+		if nil != err {
+			return nil, err
+		}
+		r.excluded = append(r.excluded, p)
+	}
+	return r, nil
+}
+
+// SelectStreams implements [StreamsSelector].
+func (r ruleBasedStreamsSelector) SelectStreams(streams []SourceStream) ([]SourceStream, error) {
+	streams = selectableStreams(streams, r.excluded)
+	res := r.selectAudio(FilterStreams(streams, IsAudioStream))
+	if vs := r.ranking.bestVideo(FilterStreams(streams, IsVideoStream)); nil != vs {
+		res = append(res, vs)
+	}
+	return append(res, r.selectSubtitles(FilterStreams(streams, IsSubtitleStream))...), nil
+}
+
+func (r ruleBasedStreamsSelector) selectAudio(streams []SourceStream) []SourceStream {
+	var selected SourceStream
+	for _, lang := range r.rules.AudioLanguages {
+		candidates := FilterStreams(streams, func(s SourceStream) bool {
+			return SameLanguage(s.(*AudioStream).Language, lang)
+		})
+		if len(candidates) > 0 {
+			selected = r.bestAudioStream(candidates)
+			break
+		}
+	}
+	if nil == selected {
+		selected = r.bestAudioStream(streams)
+	}
+	if nil == selected {
+		return []SourceStream{}
+	}
+
+	res := []SourceStream{selected}
+	if r.rules.KeepOriginal && !IsOriginalLanguage(selected) {
+		if original := r.bestAudioStream(FilterStreams(streams, IsOriginalLanguage)); nil != original {
+			res = append(res, original)
+		}
+	}
+	return res
+}
+
+// bestAudioStream returns the best of the given audio streams, preferring the
+// codecs in the order of the rules.
+func (r ruleBasedStreamsSelector) bestAudioStream(streams []SourceStream) SourceStream {
+	for _, codec := range r.rules.AudioCodecs {
+		candidates := FilterStreams(streams, func(s SourceStream) bool {
+			return strings.EqualFold(s.(*AudioStream).CodecName, codec)
+		})
+		if len(candidates) > 0 {
+			return r.ranking.bestAudio(candidates)
+		}
+	}
+	return r.ranking.bestAudio(streams)
+}
+
+func (r ruleBasedStreamsSelector) selectSubtitles(streams []SourceStream) []SourceStream {
+	langs := r.rules.SubtitleLanguages
+	if len(langs) <= 0 {
+		return streams
+	}
+
+	res := []SourceStream{}
+	for _, lang := range langs {
+		if strings.EqualFold(lang, "none") {
+			continue
+		}
+		res = append(res, FilterStreams(streams, func(s SourceStream) bool {
+			return SameLanguage(s.(*SubtitleStream).Language, lang)
+		})...)
+	}
+	return res
+}
@@ -0,0 +1,165 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewRuleBasedStreamsSelector(t *testing.T) {
+	if _, err := NewRuleBasedStreamsSelector(SelectionRules{Exclude: []string{"sdh"}}, nil); nil != err {
+		t.Errorf("NewRuleBasedStreamsSelector() error = %v, want nil", err)
+	}
+	if _, err := NewRuleBasedStreamsSelector(SelectionRules{Exclude: []string{"karaoke"}}, nil); nil == err {
+		t.Error("NewRuleBasedStreamsSelector() succeeded unexpectedly")
+	}
+	if _, err := NewRuleBasedStreamsSelector(SelectionRules{MaxBitRate: "fast"}, nil); nil == err {
+		t.Error("NewRuleBasedStreamsSelector() succeeded unexpectedly")
+	}
+}
+
+func Test_ruleBasedStreamsSelector_SelectStreams(t *testing.T) {
+	video := &VideoStream{Stream: Stream{Index: 0}, Width: 1280, Height: 720}
+	hd := &VideoStream{Stream: Stream{Index: 10}, Width: 1280, Height: 720, BitRate: 3_500_000}
+	fullHd := &VideoStream{Stream: Stream{Index: 11}, Width: 1920, Height: 1080, BitRate: 6_000_000}
+	hevc := &VideoStream{Stream: Stream{Index: 12, CodecName: "hevc"}, Width: 1280, Height: 720}
+	deuAc3 := &AudioStream{Stream: Stream{Index: 1, CodecName: "ac3"}, SampleRate: 48000, Language: "deu"}
+	deuAac := &AudioStream{Stream: Stream{Index: 2, CodecName: "aac"}, SampleRate: 44100, Language: "ger"}
+	deuAd := &AudioStream{Stream: Stream{Index: 3, CodecName: "aac"}, SampleRate: 48000, Language: "deu",
+		Disposition: Disposition{VisualImpaired: true}}
+	original := &AudioStream{Stream: Stream{Index: 4, CodecName: "aac"}, SampleRate: 48000, Language: "qaa"}
+	eng := &AudioStream{Stream: Stream{Index: 5, CodecName: "aac"}, SampleRate: 48000, Language: "en"}
+	subDe := &SubtitleStream{Stream: Stream{Index: 6}, Language: "de"}
+	subEn := &SubtitleStream{Stream: Stream{Index: 7}, Language: "eng"}
+	subDeSdh := &SubtitleStream{Stream: Stream{Index: 8}, Language: "deu",
+		Disposition: Disposition{HearingImpaired: true}}
+	all := []SourceStream{video, deuAc3, deuAac, deuAd, original, eng, subDe, subEn, subDeSdh}
+
+	tests := []struct {
+		name    string
+		rules   SelectionRules
+		streams []SourceStream
+		want    []SourceStream
+	}{
+		{
+			name:    "NoRules",
+			streams: all,
+			want:    []SourceStream{deuAc3, video, subDe, subEn, subDeSdh},
+		},
+		{
+			name:    "LanguageOrder",
+			rules:   SelectionRules{AudioLanguages: []string{"en", "de"}},
+			streams: all,
+			want:    []SourceStream{eng, video, subDe, subEn, subDeSdh},
+		},
+		{
+			name:    "LanguageFallback",
+			rules:   SelectionRules{AudioLanguages: []string{"fr", "de"}},
+			streams: all,
+			want:    []SourceStream{deuAc3, video, subDe, subEn, subDeSdh},
+		},
+		{
+			name:    "NoLanguageMatch/TieBrokenByIndex",
+			rules:   SelectionRules{AudioLanguages: []string{"fr"}},
+			streams: []SourceStream{eng, deuAc3},
+			want:    []SourceStream{deuAc3},
+		},
+		{
+			name: "PreferAacKeepOriginal",
+			rules: SelectionRules{
+				AudioLanguages: []string{"de"},
+				AudioCodecs:    []string{"aac", "ac3"},
+				KeepOriginal:   true,
+			},
+			streams: all,
+			want:    []SourceStream{deuAac, original, video, subDe, subEn, subDeSdh},
+		},
+		{
+			name: "SubtitleLanguagesAndExclusions",
+			rules: SelectionRules{
+				SubtitleLanguages: []string{"de"},
+				Exclude:           []string{"sdh"},
+			},
+			streams: all,
+			want:    []SourceStream{deuAc3, video, subDe},
+		},
+		{
+			name:    "VideoCeilings",
+			rules:   SelectionRules{MaxHeight: 720, MaxBitRate: "4M"},
+			streams: []SourceStream{hd, video, fullHd, deuAc3},
+			want:    []SourceStream{deuAc3, hd},
+		},
+		{
+			name:    "PreferVideoCodec",
+			rules:   SelectionRules{VideoCodecs: []string{"hevc", "h264"}},
+			streams: []SourceStream{video, hevc, deuAc3},
+			want:    []SourceStream{deuAc3, hevc},
+		},
+		{
+			name:    "NoSubtitles",
+			rules:   SelectionRules{SubtitleLanguages: []string{"none"}},
+			streams: all,
+			want:    []SourceStream{deuAc3, video},
+		},
+		{
+			name:    "OnlyAudioDescription",
+			rules:   SelectionRules{AudioLanguages: []string{"de"}},
+			streams: []SourceStream{video, deuAd},
+			want:    []SourceStream{deuAd, video},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewRuleBasedStreamsSelector(tt.rules, nil)
+			if nil != err {
+				t.Fatalf("NewRuleBasedStreamsSelector() error = %v", err)
+			}
+			got, err := s.SelectStreams(tt.streams)
+			if nil != err {
+				t.Fatalf("SelectStreams() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SelectStreams() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsOriginalLanguage(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream SourceStream
+		want   bool
+	}{
+		{name: "Disposition", stream: &AudioStream{Disposition: Disposition{Original: true}}, want: true},
+		{name: "Qaa", stream: &AudioStream{Language: "QAA"}, want: true},
+		{name: "Title", stream: &AudioStream{Language: "eng", Title: "Original version"}, want: true},
+		{name: "Regular", stream: &AudioStream{Language: "deu"}},
+		{name: "Subtitle", stream: &SubtitleStream{Language: "qaa"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsOriginalLanguage(tt.stream); got != tt.want {
+				t.Errorf("IsOriginalLanguage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ruleBasedStreamsSelector_SelectStreams_ScoreLog(t *testing.T) {
+	sd := &VideoStream{Stream: Stream{Index: 0}, Width: 720, Height: 576}
+	hd := &VideoStream{Stream: Stream{Index: 1}, Width: 1280, Height: 720}
+
+	var log bytes.Buffer
+	s, err := NewRuleBasedStreamsSelector(SelectionRules{}, &log)
+	if nil != err {
+		t.Fatalf("NewRuleBasedStreamsSelector() error = %v", err)
+	}
+	if _, err := s.SelectStreams([]SourceStream{sd, hd}); nil != err {
+		t.Fatalf("ruleBasedStreamsSelector.SelectStreams() error = %v", err)
+	}
+	if !strings.HasPrefix(log.String(), "Best video stream #1 scored ") {
+		t.Errorf("ruleBasedStreamsSelector.SelectStreams() logged %q, want the score of stream #1", log.String())
+	}
+}
@@ -0,0 +1,127 @@
+package ffmpeg
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// fallbackAudioBitRate is assumed for audio streams of unknown bit rate, e.g.
+// HLS audio renditions. It is on the high side such that the estimate does not
+// fall short.
+const fallbackAudioBitRate = 256_000
+
+// containerOverhead accounts for the container's headers, indices and packet
+// framing on top of the streams' payload.
+const containerOverhead = 1.02
+
+// errFreeSpaceUnsupported is returned where the free space of file systems
+// cannot be determined.
+var errFreeSpaceUnsupported = errors.New("free space cannot be determined on this platform")
+
+// SizeEstimateHandler can optionally be implemented by a
+// [DownloadProgressHandler] to get the estimated size of the output before the
+// download starts.
+type SizeEstimateHandler interface {
+	SizeEstimated(bytes int64)
+}
+
+// EstimateSize estimates the size in bytes of the main output for the given
+// selected streams from their bit rates, or the bit rates of the transcoding
+// profile, and the duration. It returns zero if the size cannot be estimated,
+// e.g. because the bit rate of a video stream is unknown.
+func (d *downloadable) EstimateSize(streams []SourceStream) int64 {
+	if d.subtitlesOnly || d.format.Duration <= 0 {
+		return 0
+	}
+	profile := d.profile
+	if container := d.outputContainer(); container != "" {
+		profile = container.transcodingProfile(profile, streams)
+	}
+
+	bitRate := 0
+	for _, s := range streams {
+		switch st := s.(type) {
+		case *VideoStream:
+			rate := st.BitRate
+			if nil != profile && nil != profile.Video {
+				rate = profile.Video.estimatedBitRate(rate)
+			}
+			if rate <= 0 {
+				return 0
+			}
+			bitRate += rate
+		case *AudioStream:
+			rate := st.BitRate
+			if nil != profile && nil != profile.Audio {
+				rate = profile.Audio.estimatedBitRate(rate)
+			}
+			if rate <= 0 {
+				rate = fallbackAudioBitRate
+			}
+			bitRate += rate
+		}
+	}
+
+	return int64(float64(bitRate) / 8 * d.format.Duration.Seconds() * containerOverhead)
+}
+
+// estimatedBitRate returns the target bit rate of the settings, if set, and the
+// bit rate of the source stream otherwise.
+func (s CodecSettings) estimatedBitRate(sourceBitRate int) int {
+	if rate, err := ParseBitRate(s.Bitrate); nil == err && rate > 0 {
+		return rate
+	}
+	return sourceBitRate
+}
+
+// checkFreeSpace verifies that the staging and the output directory have room
+// for an output of the given size. Unless warnOnLowSpace is set, downloads are
+// refused when they would not fit.
+func (d *downloadable) checkFreeSpace(size int64) error {
+	dirs := []string{filepath.Dir(d.outputPath)}
+	if nil != d.staged {
+		dirs = append(dirs, d.staged.dir)
+	}
+	return d.checkFreeSpaceIn(size, dirs...)
+}
+
+// checkFreeSpaceIn verifies that each of the given directories has room for the
+// given size, like checkFreeSpace does.
+func (d *downloadable) checkFreeSpaceIn(size int64, dirs ...string) error {
+	for _, dir := range dirs {
+		free, err := freeSpace(dir)
+		if errors.Is(err, errFreeSpaceUnsupported) {
+			return nil
+		} else if nil != err {
+			fmt.Fprintf(d.messageWriter(), "WARN: Failed to determine free space in %q: %v\n", dir, err)
+			continue
+		}
+		if free >= uint64(size) {
+			continue
+		}
+
+		err = fmt.Errorf("the estimated size of %s exceeds the %s free in %q",
+			FormatSize(size), FormatSize(int64(free)), dir)
+		if d.warnOnLowSpace {
+			fmt.Fprintf(d.messageWriter(), "WARN: %v.\n", err)
+			continue
+		}
+		return &DownloadError{Class: FailureDiskFull, Err: err}
+	}
+	return nil
+}
+
+// FormatSize formats the given number of bytes using binary units, e.g. 1.5 GiB.
+func FormatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit && exp < 4; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTP"[exp])
+}
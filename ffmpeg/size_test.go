@@ -0,0 +1,126 @@
+package ffmpeg
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func Test_downloadable_EstimateSize(t *testing.T) {
+	video := &VideoStream{Stream: Stream{Index: 0, CodecName: "h264"}, BitRate: 4_000_000}
+	audio := &AudioStream{Stream: Stream{Index: 1, CodecName: "aac"}, BitRate: 128_000}
+	unknownAudio := &AudioStream{Stream: Stream{Index: 2, CodecName: "ac3"}}
+	subtitle := &SubtitleStream{Stream: Stream{Index: 3, CodecName: "webvtt"}}
+	hour := time.Hour.Seconds()
+
+	tests := []struct {
+		name    string // description of this test case
+		d       *downloadable
+		streams []SourceStream
+		want    float64
+	}{
+		{
+			name:    "Copy",
+			d:       NewDownloadable(nil, "target.mkv"),
+			streams: []SourceStream{video, audio, subtitle},
+			want:    (4_000_000 + 128_000) / 8 * hour * containerOverhead,
+		},
+		{
+			name:    "UnknownAudioBitRate",
+			d:       NewDownloadable(nil, "target.mkv"),
+			streams: []SourceStream{video, unknownAudio},
+			want:    (4_000_000 + fallbackAudioBitRate) / 8 * hour * containerOverhead,
+		},
+		{
+			name:    "UnknownVideoBitRate",
+			d:       NewDownloadable(nil, "target.mkv"),
+			streams: []SourceStream{&VideoStream{Stream: Stream{Index: 0}}, audio},
+			want:    0,
+		},
+		{
+			name: "ProfileBitRate",
+			d: NewDownloadable(nil, "target.mkv", WithTranscodingProfile(TranscodingProfile{
+				Audio: &CodecSettings{Codec: "aac", Bitrate: "192k"},
+			})),
+			streams: []SourceStream{video, unknownAudio},
+			want:    (4_000_000 + 192_000) / 8 * hour * containerOverhead,
+		},
+		{
+			name: "ProfileWithoutBitRate",
+			d: NewDownloadable(nil, "target.mkv", WithTranscodingProfile(TranscodingProfile{
+				Video: &CodecSettings{Codec: "libx265", Args: []string{"-crf", "24"}},
+			})),
+			streams: []SourceStream{video, audio},
+			want:    (4_000_000 + 128_000) / 8 * hour * containerOverhead,
+		},
+		{
+			name:    "ContainerTranscodesAudio",
+			d:       NewDownloadable(nil, "target.opus"),
+			streams: []SourceStream{unknownAudio},
+			want:    128_000 / 8 * hour * containerOverhead,
+		},
+		{
+			name:    "SubtitlesOnly",
+			d:       NewDownloadable(nil, "target.mkv", WithSubtitlesOnly(true)),
+			streams: []SourceStream{subtitle},
+			want:    0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.d.format.Duration = time.Hour
+			got := tt.d.EstimateSize(tt.streams)
+			if got != int64(tt.want) {
+				t.Errorf("EstimateSize() = %d, want %d", got, int64(tt.want))
+			}
+		})
+	}
+}
+
+func Test_downloadable_checkFreeSpace(t *testing.T) {
+	dir := t.TempDir()
+	free, err := freeSpace(dir)
+	if errors.Is(err, errFreeSpaceUnsupported) {
+		t.Skip("free space cannot be determined on this platform")
+	} else if nil != err {
+		t.Fatalf("freeSpace() failed: %v", err)
+	}
+
+	d := NewDownloadable(nil, dir+"/target.mkv")
+	if err := d.checkFreeSpace(1); nil != err {
+		t.Errorf("checkFreeSpace() failed: %v", err)
+	}
+
+	var downloadErr *DownloadError
+	err = d.checkFreeSpace(int64(min(free+1, math.MaxInt64)))
+	if !errors.As(err, &downloadErr) || downloadErr.Class != FailureDiskFull {
+		t.Errorf("checkFreeSpace() got error %v, want class %q", err, FailureDiskFull)
+	}
+
+	d = NewDownloadable(nil, dir+"/target.mkv", WithWarnOnLowSpace(true))
+	if err := d.checkFreeSpace(int64(min(free+1, math.MaxInt64))); nil != err {
+		t.Errorf("checkFreeSpace() failed despite warning only: %v", err)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		bytes int64
+		want  string
+	}{
+		{bytes: 0, want: "0 B"},
+		{bytes: 1023, want: "1023 B"},
+		{bytes: 1536, want: "1.5 KiB"},
+		{bytes: 5 * 1024 * 1024, want: "5.0 MiB"},
+		{bytes: 3_865_470_566, want: "3.6 GiB"},
+		{bytes: 2 * 1024 * 1024 * 1024 * 1024, want: "2.0 TiB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := FormatSize(tt.bytes); got != tt.want {
+				t.Errorf("FormatSize(%d) = %q, want %q", tt.bytes, got, tt.want)
+			}
+		})
+	}
+}
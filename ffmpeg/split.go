@@ -0,0 +1,210 @@
+package ffmpeg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rokeller/zt-dl/units"
+)
+
+// splitSizeMargin is the share of the maximum size of parts which is planned
+// for when splitting by size, as the bit rate of the streams varies over time.
+const splitSizeMargin = 0.9
+
+// Split sets how the main output gets split into parts, e.g. to stay below the
+// maximum file size of FAT32. Parts are cut at keyframes without transcoding.
+type Split struct {
+	// Duration is the maximum duration of each part.
+	Duration time.Duration
+	// Size is the maximum size of each part in bytes. The duration of the
+	// parts is derived from the estimated size of the output, so parts may
+	// still exceed it.
+	Size int64
+}
+
+// PartsHandler can optionally be implemented by a [DownloadProgressHandler] to
+// get the paths of the parts of a split output before the download finishes.
+type PartsHandler interface {
+	PartsWritten(paths []string)
+}
+
+// StageCoverArt attaches the cover art to every part of a split output.
+var StageCoverArt = Stage{Name: "cover_art", Description: "Attaching cover art to parts"}
+
+// partDuration returns the duration of the parts of the main output for the
+// given selected streams, or zero if the output does not need to be split.
+func (d *downloadable) partDuration(streams []SourceStream) (time.Duration, error) {
+	if d.subtitlesOnly || (d.split.Duration <= 0 && d.split.Size <= 0) {
+		return 0, nil
+	}
+
+	duration := d.split.Duration
+	if d.split.Size > 0 {
+		size := d.EstimateSize(streams)
+		if size <= 0 {
+			return 0, errors.New("cannot split by size because the size of the output cannot be estimated")
+		}
+		bySize := time.Duration(float64(d.format.Duration) *
+			float64(d.split.Size) / float64(size) * splitSizeMargin).Truncate(time.Second)
+		if bySize < time.Second {
+			return 0, fmt.Errorf("parts of %s would be shorter than a second", FormatSize(d.split.Size))
+		}
+		if duration <= 0 || bySize < duration {
+			duration = bySize
+		}
+	}
+
+	if duration >= d.format.Duration {
+		return 0, nil
+	}
+	return duration, nil
+}
+
+// splitting tells whether the running download splits the main output.
+func (d *downloadable) splitting() bool {
+	return d.partLength > 0
+}
+
+// partCount returns the number of parts the main output gets split into.
+func (d *downloadable) partCount() int {
+	if !d.splitting() {
+		return 1
+	}
+	return int(math.Ceil(float64(d.format.Duration) / float64(d.partLength)))
+}
+
+// partPath returns the path of the given part, counting from 1, of the output
+// at the given path, e.g. movie.part01.mkv for movie.mkv.
+func partPath(outputPath string, part int) string {
+	ext := filepath.Ext(outputPath)
+	return fmt.Sprintf("%s.part%02d%s", strings.TrimSuffix(outputPath, ext), part, ext)
+}
+
+// partPattern returns the pattern of the paths of the parts of the output at
+// the given path for ffmpeg's segment muxer.
+func partPattern(outputPath string) string {
+	ext := filepath.Ext(outputPath)
+	base := strings.ReplaceAll(strings.TrimSuffix(outputPath, ext), "%", "%%")
+	return base + ".part%02d" + strings.ReplaceAll(ext, "%", "%%")
+}
+
+// splitArgs returns the ffmpeg arguments to write the main output in parts.
+func (d *downloadable) splitArgs() []string {
+	args := []string{
+		"-f", "segment",
+		"-segment_time", strconv.FormatFloat(d.partLength.Seconds(), 'f', -1, 64),
+		"-segment_start_number", strconv.Itoa(d.completedParts + 1),
+		"-reset_timestamps", "1",
+	}
+	if nil != d.staged {
+		// The list of completed parts tells where to continue if the input
+		// URL expires.
+		args = append(args, "-segment_list", d.segmentListPath(), "-segment_list_type", "csv")
+	}
+	if d.container != "" {
+		args = append(args, "-segment_format", containerSpecs[d.container].muxer)
+	}
+	return append(args, partPattern(d.writePath()))
+}
+
+// outputPaths returns the paths ffmpeg wrote the main output to, which are the
+// parts of the output if it is split.
+func (d *downloadable) outputPaths() ([]string, error) {
+	if !d.splitting() {
+		return []string{d.writePath()}, nil
+	}
+
+	paths := []string{}
+	for part := 1; ; part++ {
+		path := partPath(d.writePath(), part)
+		if _, err := os.Stat(path); nil != err {
+			break
+		}
+		paths = append(paths, path)
+	}
+	if len(paths) <= 0 {
+		return nil, errors.New("ffmpeg did not write any parts")
+	}
+	return paths, nil
+}
+
+// warnOversizedParts warns about the given parts which exceed the maximum size
+// of parts, as splitting by size relies on the estimated size of the output.
+func (d *downloadable) warnOversizedParts(parts []string) {
+	if d.split.Size <= 0 {
+		return
+	}
+	for _, part := range parts {
+		info, err := os.Stat(part)
+		if nil == err && info.Size() > d.split.Size {
+			fmt.Fprintf(d.messageWriter(), "WARN: Part %q is %s, exceeding the maximum of %s.\n",
+				filepath.Base(part), FormatSize(info.Size()), FormatSize(d.split.Size))
+		}
+	}
+}
+
+// attachCoverArt attaches the cover art to each of the given parts, as ffmpeg's
+// segment muxer only writes it to the first part.
+func (d *downloadable) attachCoverArt(
+	ctx context.Context,
+	parts []string,
+	streams []SourceStream,
+	coverArgs []string,
+	progress DownloadProgressHandler,
+) error {
+	if sh, ok := progress.(StageHandler); ok {
+		sh.StageStarted(StageCoverArt)
+	}
+
+	// The cover art follows all video streams and is never transcoded.
+	coverIndex := len(FilterStreams(streams, IsVideoStream))
+	for i, part := range parts {
+		withCover := filepath.Join(filepath.Dir(part), ".cover."+filepath.Base(part))
+		args := []string{"-i", part}
+		args = append(args, coverArgs...)
+		args = append(args,
+			"-map", "0",
+			"-map", "1:0",
+			"-c", "copy",
+			fmt.Sprintf("-disposition:v:%d", coverIndex), "attached_pic",
+		)
+		if d.container != "" {
+			args = append(args, "-f", containerSpecs[d.container].muxer)
+		}
+		args = append(args, "-y", withCover)
+
+		if err := runPostProcessingFfmpeg(ctx, args, d.partDurationOf(i), progress, nil); nil != err {
+			os.Remove(withCover)
+			return fmt.Errorf("failed to attach cover art to %q: %w", part, err)
+		}
+		if err := os.Rename(withCover, part); nil != err {
+			return fmt.Errorf("failed to replace %q: %w", part, err)
+		}
+	}
+	return nil
+}
+
+// partDurationOf returns the duration of the given part, counting from 0.
+func (d *downloadable) partDurationOf(part int) time.Duration {
+	if !d.splitting() {
+		return d.format.Duration
+	}
+	return min(d.partLength, d.format.Duration-time.Duration(part)*d.partLength)
+}
+
+// ParseSize parses a size in bytes with an optional binary suffix, e.g. 700M or
+// 4G.
+func ParseSize(value string) (int64, error) {
+	n, err := units.Binary.Parse(value)
+	if nil != err {
+		return 0, fmt.Errorf("invalid size %q, use e.g. 700M or 4G", value)
+	}
+	return int64(n), nil
+}
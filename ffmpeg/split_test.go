@@ -0,0 +1,258 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	e "github.com/rokeller/zt-dl/exec"
+	"github.com/rokeller/zt-dl/test"
+)
+
+func Test_partPath(t *testing.T) {
+	tests := []struct {
+		outputPath  string
+		part        int
+		want        string
+		wantPattern string
+	}{
+		{outputPath: "movie.mkv", part: 1, want: "movie.part01.mkv", wantPattern: "movie.part%02d.mkv"},
+		{outputPath: "/foo/show.s01.mp4", part: 12, want: "/foo/show.s01.part12.mp4", wantPattern: "/foo/show.s01.part%02d.mp4"},
+		{outputPath: "100% movie.mkv", part: 3, want: "100% movie.part03.mkv", wantPattern: "100%% movie.part%02d.mkv"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := partPath(tt.outputPath, tt.part); got != tt.want {
+				t.Errorf("partPath() = %q, want %q", got, tt.want)
+			}
+			if got := partPattern(tt.outputPath); got != tt.wantPattern {
+				t.Errorf("partPattern() = %q, want %q", got, tt.wantPattern)
+			}
+		})
+	}
+}
+
+func Test_downloadable_partDuration(t *testing.T) {
+	video := &VideoStream{Stream: Stream{Index: 0}, BitRate: 8_000_000}
+	unknownVideo := &VideoStream{Stream: Stream{Index: 0}}
+	// One hour of video at 8 Mbit/s is about 3.4 GiB.
+	hourSize := float64(8_000_000) / 8 * 3600 * containerOverhead
+
+	tests := []struct {
+		name    string // description of this test case
+		split   Split
+		streams []SourceStream
+		want    time.Duration
+		wantErr bool
+	}{
+		{
+			name:    "NoSplit",
+			streams: []SourceStream{video},
+			want:    0,
+		},
+		{
+			name:    "ByDuration",
+			split:   Split{Duration: 30 * time.Minute},
+			streams: []SourceStream{video},
+			want:    30 * time.Minute,
+		},
+		{
+			name:    "ByDuration/Longer",
+			split:   Split{Duration: 2 * time.Hour},
+			streams: []SourceStream{video},
+			want:    0,
+		},
+		{
+			name:    "BySize",
+			split:   Split{Size: 1 << 30},
+			streams: []SourceStream{video},
+			want: time.Duration(float64(time.Hour) * (1 << 30) / hourSize * splitSizeMargin).
+				Truncate(time.Second),
+		},
+		{
+			name:    "BySize/Larger",
+			split:   Split{Size: 4 << 30},
+			streams: []SourceStream{video},
+			want:    0,
+		},
+		{
+			name:    "BySize/Unknown",
+			split:   Split{Size: 1 << 30},
+			streams: []SourceStream{unknownVideo},
+			wantErr: true,
+		},
+		{
+			name:    "ByDurationAndSize",
+			split:   Split{Duration: 10 * time.Minute, Size: 1 << 30},
+			streams: []SourceStream{video},
+			want:    10 * time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDownloadable(nil, "target.mkv", WithSplit(tt.split))
+			d.format.Duration = time.Hour
+			got, err := d.partDuration(tt.streams)
+			if (nil != err) != tt.wantErr {
+				t.Fatalf("partDuration() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("partDuration() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_downloadable_Download_ffmpeg_Split(t *testing.T) {
+	if test.IsTestCall() {
+		args := test.GetArgs()
+		output := args[len(args)-1]
+		if slices.Contains(args, "segment") {
+			test.AssertArgs(
+				"ffmpeg",
+				"-protocol_whitelist", "https,tls,tcp",
+				"-i", "https://foo.bar.com/source",
+				"-n",
+				"-map", "0:1",
+				"-map", "0:0",
+				"-c", "copy",
+				"-metadata", "title=Some Movie",
+				"-metadata", "show=Some Movie",
+				"-metadata", "album=Some Movie",
+				"-f", "segment",
+				"-segment_time", "1200",
+				"-segment_start_number", "1",
+				"-reset_timestamps", "1",
+				"-segment_list", filepath.Join(filepath.Dir(output), ".parts.csv"),
+				"-segment_list_type", "csv",
+				output,
+			)
+			for part := 1; part <= 3; part++ {
+				os.WriteFile(fmt.Sprintf(output, part), []byte("part"), 0o644)
+			}
+			os.Exit(0)
+		}
+		if slices.Contains(args, "attached_pic") {
+			test.AssertArgs(
+				"ffmpeg",
+				"-i", args[2],
+				"-protocol_whitelist", "https,tls,tcp",
+				"-i", "https://foo.bar.com/cover.jpg",
+				"-map", "0",
+				"-map", "1:0",
+				"-c", "copy",
+				"-disposition:v:1", "attached_pic",
+				"-y", output,
+			)
+			os.WriteFile(output, []byte("part with cover"), 0o644)
+			os.Exit(0)
+		}
+		os.Exit(-1)
+		return
+	}
+
+	me := test.CallerFuncName(0)
+	e.CmdFactory = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		return test.TestCommandContext(t, me, ctx, name, arg...)
+	}
+
+	dir := t.TempDir()
+	d := NewDownloadable(StaticUrl("https://foo.bar.com/source"), filepath.Join(dir, "target.mkv"),
+		WithSplit(Split{Duration: 20 * time.Minute}),
+		WithMetadata(Metadata{Title: "Some Movie"}),
+		WithCoverArt("https://foo.bar.com/cover.jpg"))
+	d.format.Duration = time.Hour
+	d.streams = []SourceStream{
+		&VideoStream{Stream: Stream{Index: 0}, Width: 1280, Height: 720},
+		&AudioStream{Stream: Stream{Index: 1}, Channels: 2},
+	}
+	if err := d.Download(t.Context(), NewBestStreamsSelector(), &testProgressHandler{}); nil != err {
+		t.Fatalf("downloadable.Download() got error %v, want nil", err)
+	}
+
+	wantParts := []string{"target.part01.mkv", "target.part02.mkv", "target.part03.mkv"}
+	if got := listDir(t, dir); !reflect.DeepEqual(got, wantParts) {
+		t.Errorf("downloadable.Download() wrote %v, want %v", got, wantParts)
+	}
+	for i, part := range wantParts {
+		if data, _ := os.ReadFile(filepath.Join(dir, part)); string(data) != "part with cover" {
+			t.Errorf("part %d has content %q, want cover art attached", i+1, data)
+		}
+		if d.parts[i] != filepath.Join(dir, part) {
+			t.Errorf("downloadable.parts[%d] = %q, want %q", i, d.parts[i], filepath.Join(dir, part))
+		}
+	}
+}
+
+func Test_downloadable_warnOversizedParts(t *testing.T) {
+	dir := t.TempDir()
+	small, large := filepath.Join(dir, "rec.part01.mkv"), filepath.Join(dir, "rec.part02.mkv")
+	if err := os.WriteFile(small, make([]byte, 1000), 0o644); nil != err {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(large, make([]byte, 2000), 0o644); nil != err {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string // description of this test case
+		split Split
+		want  string
+	}{
+		{
+			name:  "SplitBySize",
+			split: Split{Size: 1500},
+			want:  "WARN: Part \"rec.part02.mkv\" is 2.0 KiB, exceeding the maximum of 1.5 KiB.\n",
+		},
+		{
+			name:  "SplitByDuration",
+			split: Split{Duration: time.Hour},
+			want:  "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var messages bytes.Buffer
+			d := NewDownloadable(StaticUrl("http://input"), filepath.Join(dir, "rec.mkv"),
+				WithSplit(tt.split), WithMessages(&messages))
+			d.warnOversizedParts([]string{small, large})
+
+			if got := messages.String(); got != tt.want {
+				t.Errorf("warnOversizedParts() wrote %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "1000", want: 1000},
+		{value: "700M", want: 700 << 20},
+		{value: "4G", want: 4 << 30},
+		{value: "1.5t", want: 3 << 39},
+		{value: "", wantErr: true},
+		{value: "big", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseSize(tt.value)
+			if (nil != err) != tt.wantErr {
+				t.Fatalf("ParseSize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package ffmpeg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// stagingPrefix prefixes the names of the directories in which downloads are
+// staged until they are complete, and of temporary files written when moving
+// staged files across file systems.
+const stagingPrefix = ".zt-dl-"
+
+// orphanAge is how long staging directories must not have changed before they
+// are considered orphaned.
+const orphanAge = time.Hour
+
+// staging is the directory to which ffmpeg writes the output and sidecar files
+// of a download. The files are moved to the target directory only after the
+// download succeeded, such that cancelled or failed downloads never leave
+// half-written files under their final names.
+type staging struct {
+	dir       string
+	targetDir string
+	// messages receives warnings about staged files which cannot be removed.
+	messages io.Writer
+}
+
+// stagingDirName returns the name of the staging directory for the given output
+// path. The name is derived from the absolute output path, such that downloads
+// to different directories can share a staging directory, and such that files
+// left behind by an earlier attempt get replaced.
+func stagingDirName(outputPath string) string {
+	if abs, err := filepath.Abs(outputPath); nil == err {
+		outputPath = abs
+	}
+	sum := sha256.Sum256([]byte(outputPath))
+	return stagingPrefix + hex.EncodeToString(sum[:6])
+}
+
+// newStaging creates the staging directory for the download in the staging
+// directory, or next to the output if no staging directory is set.
+func (d *downloadable) newStaging() (*staging, error) {
+	root := d.stagingDir
+	if root == "" {
+		root = filepath.Dir(d.outputPath)
+	}
+	dir := filepath.Join(root, stagingDirName(d.outputPath))
+	if err := os.RemoveAll(dir); nil != err {
+		return nil, fmt.Errorf("failed to remove staging directory %q: %w", dir, err)
+	}
+	if err := os.MkdirAll(dir, 0o755); nil != err {
+		return nil, fmt.Errorf("failed to create staging directory %q: %w", dir, err)
+	}
+	return &staging{dir: dir, targetDir: filepath.Dir(d.outputPath), messages: d.messageWriter()}, nil
+}
+
+// path returns the staged path of the given target path.
+func (s *staging) path(target string) string {
+	return filepath.Join(s.dir, filepath.Base(target))
+}
+
+// commit moves all staged files to the target directory and removes the
+// staging directory. Unless overwrite is set, it fails if any target exists.
+func (s *staging) commit(overwrite bool) error {
+	entries, err := os.ReadDir(s.dir)
+	if nil != err {
+		return fmt.Errorf("failed to list staged files: %w", err)
+	}
+	if !overwrite {
+		for _, entry := range entries {
+			if err := checkNotExists(filepath.Join(s.targetDir, entry.Name())); nil != err {
+				return err
+			}
+		}
+	}
+	for _, entry := range entries {
+		target := filepath.Join(s.targetDir, entry.Name())
+		if err := moveFile(filepath.Join(s.dir, entry.Name()), target); nil != err {
+			return fmt.Errorf("failed to move staged file to %q: %w", target, err)
+		}
+	}
+	return os.RemoveAll(s.dir)
+}
+
+// discard removes the staging directory with all staged files.
+func (s *staging) discard() {
+	if err := os.RemoveAll(s.dir); nil != err {
+		fmt.Fprintf(s.messages, "WARN: Failed to remove staging directory %q: %v\n", s.dir, err)
+	}
+}
+
+// checkNotExists returns an error classified as FailureOutputExists if a file
+// exists at the given path.
+func checkNotExists(path string) error {
+	if _, err := os.Stat(path); nil == err {
+		return &DownloadError{
+			Class: FailureOutputExists,
+			Err:   fmt.Errorf("file %q already exists", path),
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to check file %q: %w", path, err)
+	}
+	return nil
+}
+
+// moveFile moves the file from src to dst. Renaming fails across file systems,
+// e.g. when staging on a separate disk, in which case the file is copied to a
+// temporary file next to dst first, which is then renamed.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); nil == err {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if nil != err {
+		return err
+	}
+	defer in.Close()
+	out, err := os.CreateTemp(filepath.Dir(dst), stagingPrefix+"*")
+	if nil != err {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); nil == err {
+		err = closeErr
+	}
+	if nil == err {
+		err = os.Rename(out.Name(), dst)
+	}
+	if nil != err {
+		os.Remove(out.Name())
+		return err
+	}
+	in.Close()
+	return os.Remove(src)
+}
+
+// SweepStaging removes the staging directories and temporary files in dir which
+// were left behind by downloads that did not finish, e.g. because the process
+// got killed. Only entries which did not change for a while are removed, such
+// that downloads of other, still running processes are not affected. What was
+// removed is reported to out.
+func SweepStaging(dir string, out io.Writer) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if nil != err {
+		return fmt.Errorf("failed to list directory %q: %w", dir, err)
+	}
+
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), stagingPrefix) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if time.Since(lastModified(path)) < orphanAge {
+			continue
+		}
+		if err := os.RemoveAll(path); nil != err {
+			fmt.Fprintf(out, "WARN: Failed to remove orphaned staging files %q: %v\n", path, err)
+			continue
+		}
+		fmt.Fprintf(out, "Removed orphaned staging files %q.\n", path)
+	}
+	return nil
+}
+
+// lastModified returns the latest modification time of the file at path, or
+// of the directory at path and the files in it.
+func lastModified(path string) time.Time {
+	var latest time.Time
+	filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if nil != err {
+			return nil
+		}
+		if info, err := entry.Info(); nil == err && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return latest
+}
@@ -0,0 +1,246 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	e "github.com/rokeller/zt-dl/exec"
+	"github.com/rokeller/zt-dl/test"
+)
+
+// stagedPath returns the path ffmpeg writes the output at the given path to
+// when staging next to the output.
+func stagedPath(outputPath string) string {
+	return filepath.Join(filepath.Dir(outputPath), stagingDirName(outputPath), filepath.Base(outputPath))
+}
+
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if nil != err {
+		t.Fatalf("failed to list directory %q: %v", dir, err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	slices.Sort(names)
+	return names
+}
+
+func Test_stagingDirName(t *testing.T) {
+	a := stagingDirName("/foo/target.mkv")
+	if a != stagingDirName("/foo/target.mkv") {
+		t.Errorf("stagingDirName() is not stable")
+	}
+	if a == stagingDirName("/bar/target.mkv") {
+		t.Errorf("stagingDirName() = %q for outputs in different directories", a)
+	}
+	if len(a) != len(stagingPrefix)+12 || a[:len(stagingPrefix)] != stagingPrefix {
+		t.Errorf("stagingDirName() = %q, want prefix %q and 12 hex digits", a, stagingPrefix)
+	}
+}
+
+func Test_staging_commit(t *testing.T) {
+	tests := []struct {
+		name       string // description of this test case
+		overwrite  bool
+		existing   []string
+		stagingDir bool
+		wantErr    bool
+		wantFiles  []string
+	}{
+		{
+			name:      "NextToOutput",
+			wantFiles: []string{"target.de.srt", "target.mkv"},
+		},
+		{
+			name:       "StagingDir",
+			stagingDir: true,
+			wantFiles:  []string{"target.de.srt", "target.mkv"},
+		},
+		{
+			name:     "Exists",
+			existing: []string{"target.de.srt"},
+			wantErr:  true,
+		},
+		{
+			name:      "Exists/Overwrite",
+			overwrite: true,
+			existing:  []string{"target.mkv"},
+			wantFiles: []string{"target.de.srt", "target.mkv"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outdir := t.TempDir()
+			opts := []DownloadableOption{}
+			stagingDir := outdir
+			if tt.stagingDir {
+				stagingDir = t.TempDir()
+				opts = append(opts, WithStagingDir(stagingDir))
+			}
+			for _, name := range tt.existing {
+				os.WriteFile(filepath.Join(outdir, name), []byte("old"), 0o644)
+			}
+
+			d := NewDownloadable(StaticUrl("https://foo.bar.com/source"), filepath.Join(outdir, "target.mkv"), opts...)
+			s, err := d.newStaging()
+			if nil != err {
+				t.Fatalf("newStaging() failed: %v", err)
+			}
+			if filepath.Dir(s.dir) != stagingDir {
+				t.Errorf("newStaging() created %q, want it in %q", s.dir, stagingDir)
+			}
+			os.WriteFile(s.path(d.outputPath), []byte("new"), 0o644)
+			os.WriteFile(filepath.Join(s.dir, "target.de.srt"), []byte("new"), 0o644)
+
+			err = s.commit(tt.overwrite)
+			if nil != err {
+				if !tt.wantErr {
+					t.Errorf("commit() failed: %v", err)
+				}
+				var downloadErr *DownloadError
+				if !errors.As(err, &downloadErr) || downloadErr.Class != FailureOutputExists {
+					t.Errorf("commit() got error %v, want class %q", err, FailureOutputExists)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("commit() succeeded unexpectedly")
+			}
+			if got := listDir(t, outdir); !reflect.DeepEqual(got, tt.wantFiles) {
+				t.Errorf("commit() left files %v, want %v", got, tt.wantFiles)
+			}
+			if got, _ := os.ReadFile(d.outputPath); string(got) != "new" {
+				t.Errorf("commit() wrote %q, want %q", got, "new")
+			}
+			if _, err := os.Stat(s.dir); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("commit() did not remove staging directory %q", s.dir)
+			}
+		})
+	}
+}
+
+func TestSweepStaging(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-2 * orphanAge)
+
+	orphan := filepath.Join(dir, stagingPrefix+"orphan")
+	os.Mkdir(orphan, 0o755)
+	os.WriteFile(filepath.Join(orphan, "target.mkv"), nil, 0o644)
+	os.Chtimes(filepath.Join(orphan, "target.mkv"), old, old)
+	os.Chtimes(orphan, old, old)
+
+	orphanFile := filepath.Join(dir, stagingPrefix+"123456")
+	os.WriteFile(orphanFile, nil, 0o644)
+	os.Chtimes(orphanFile, old, old)
+
+	// Staging directories with recent changes belong to running downloads.
+	running := filepath.Join(dir, stagingPrefix+"running")
+	os.Mkdir(running, 0o755)
+	os.WriteFile(filepath.Join(running, "target.mkv"), nil, 0o644)
+	os.Chtimes(running, old, old)
+
+	other := filepath.Join(dir, "other.mkv")
+	os.WriteFile(other, nil, 0o644)
+	os.Chtimes(other, old, old)
+
+	var out bytes.Buffer
+	if err := SweepStaging(dir, &out); nil != err {
+		t.Fatalf("SweepStaging() failed: %v", err)
+	}
+	want := []string{stagingPrefix + "running", "other.mkv"}
+	slices.Sort(want)
+	if got := listDir(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("SweepStaging() left %v, want %v", got, want)
+	}
+	if got := strings.Count(out.String(), "Removed orphaned staging files"); got != 2 {
+		t.Errorf("SweepStaging() reported %d removals, want 2: %q", got, out.String())
+	}
+
+	if err := SweepStaging(filepath.Join(dir, "missing"), io.Discard); nil != err {
+		t.Errorf("SweepStaging() failed for missing directory: %v", err)
+	}
+}
+
+func Test_downloadable_Download_ffmpeg_Staged(t *testing.T) {
+	if test.IsTestCall() {
+		args := test.GetArgs()
+		path := args[len(args)-1]
+		os.WriteFile(path, []byte("downloaded"), 0o644)
+		if filepath.Base(path) == "fail.mkv" {
+			os.Exit(1)
+		}
+		os.Exit(0)
+		return
+	}
+
+	me := test.CallerFuncName(0)
+	e.CmdFactory = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		return test.TestCommandContext(t, me, ctx, name, arg...)
+	}
+
+	tests := []struct {
+		name      string // description of this test case
+		output    string
+		existing  bool
+		wantErr   bool
+		wantFiles []string
+	}{
+		{
+			name:      "Succeeds",
+			output:    "target.mkv",
+			wantFiles: []string{"target.mkv"},
+		},
+		{
+			name:      "Fails",
+			output:    "fail.mkv",
+			wantErr:   true,
+			wantFiles: []string{},
+		},
+		{
+			name:      "Exists",
+			output:    "target.mkv",
+			existing:  true,
+			wantErr:   true,
+			wantFiles: []string{"target.mkv"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outdir, stagingDir := t.TempDir(), t.TempDir()
+			outputPath := filepath.Join(outdir, tt.output)
+			if tt.existing {
+				os.WriteFile(outputPath, []byte("old"), 0o644)
+			}
+
+			d := NewDownloadable(StaticUrl("https://foo.bar.com/source"), outputPath, WithStagingDir(stagingDir))
+			d.streams = []SourceStream{
+				&AudioStream{Stream: Stream{Index: 0}, SampleRate: 1234},
+				&VideoStream{Stream: Stream{Index: 1}, Width: 987, Height: 876},
+			}
+			h := &testProgressHandler{progressUpdates: []DownloadProgress{}}
+			err := d.Download(t.Context(), NewBestStreamsSelector(), h)
+			if (nil != err) != tt.wantErr {
+				t.Errorf("downloadable.Download() got error %v, want error %v", err, tt.wantErr)
+			}
+			if got := listDir(t, outdir); !reflect.DeepEqual(got, tt.wantFiles) {
+				t.Errorf("downloadable.Download() left files %v, want %v", got, tt.wantFiles)
+			}
+			if got := listDir(t, stagingDir); len(got) > 0 {
+				t.Errorf("downloadable.Download() left staged files %v", got)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -28,10 +29,11 @@ type streamJson struct {
 	Channels      int            `json:"channels"`       // audio streams only
 	ChannelLayout string         `json:"channel_layout"` // audio streams only
 	Tags          map[string]any `json:"tags"`           // audio and subtitle streams
+	Disposition   map[string]int `json:"disposition"`    // audio and subtitle streams
 	Width         int            `json:"width"`          // video streams only
 	Height        int            `json:"height"`         // video streams only
 	AvgFrameRate  string         `json:"avg_frame_rate"` // video streams only
-	BitRate       string         `json:"bit_rate"`       // video streams only
+	BitRate       string         `json:"bit_rate"`       // video and audio streams
 }
 
 type format struct {
@@ -49,12 +51,17 @@ type Stream struct {
 	CodecName string
 }
 
+// AudioStream describes an audio stream. Sample and bit rates are zero when
+// they are unknown.
 type AudioStream struct {
 	Stream
 	SampleRate    int
 	Channels      int
 	ChannelLayout string
+	BitRate       int
 	Language      string
+	Title         string
+	Disposition   Disposition
 }
 
 var _ SourceStream = &AudioStream{}
@@ -62,8 +69,9 @@ var _ SourceStream = &AudioStream{}
 // String implements [SourceStream]
 func (s *AudioStream) String() string {
 	return fmt.Sprintf(
-		"%s, sample rate %dHz, %d channels (%s), language %q (stream #%d)",
-		s.CodecName, s.SampleRate, s.Channels, s.ChannelLayout, s.Language, s.Stream.Index)
+		"%s, sample rate %s, %d channels (%s), language %q%s (stream #%d)",
+		s.CodecName, formatKnown(float64(s.SampleRate), "Hz"), s.Channels, s.ChannelLayout, s.Language,
+		describeExtras(s.Title, s.Disposition), s.Stream.Index)
 }
 
 // Index implements [SourceStream]
@@ -73,15 +81,17 @@ func (s *AudioStream) Index() int {
 
 type SubtitleStream struct {
 	Stream
-	Language string
+	Language    string
+	Title       string
+	Disposition Disposition
 }
 
 var _ SourceStream = &SubtitleStream{}
 
 // String implements [SourceStream]
 func (s *SubtitleStream) String() string {
-	return fmt.Sprintf("%s, language %q (stream #%d)",
-		s.CodecName, s.Language, s.Stream.Index)
+	return fmt.Sprintf("%s, language %q%s (stream #%d)",
+		s.CodecName, s.Language, describeExtras(s.Title, s.Disposition), s.Stream.Index)
 }
 
 // Index implements [SourceStream]
@@ -89,11 +99,13 @@ func (s *SubtitleStream) Index() int {
 	return s.Stream.Index
 }
 
+// VideoStream describes a video stream. Frame and bit rates are zero when
+// they are unknown.
 type VideoStream struct {
 	Stream
 	Width        int
 	Height       int
-	AvgFrameRate int
+	AvgFrameRate float64
 	BitRate      int
 }
 
@@ -101,8 +113,10 @@ var _ SourceStream = &VideoStream{}
 
 // String implements [SourceStream]
 func (s *VideoStream) String() string {
-	return fmt.Sprintf("%s, dimensions %dx%d, bit rate %dbps, avg frame rate %dfps (stream #%d)",
-		s.CodecName, s.Width, s.Height, s.BitRate, s.AvgFrameRate, s.Stream.Index)
+	return fmt.Sprintf("%s, dimensions %dx%d, bit rate %s, avg frame rate %s (stream #%d)",
+		s.CodecName, s.Width, s.Height,
+		formatKnown(float64(s.BitRate), "bps"), formatKnown(s.AvgFrameRate, "fps"),
+		s.Stream.Index)
 }
 
 // Index implements [SourceStream]
@@ -110,11 +124,95 @@ func (s *VideoStream) Index() int {
 	return s.Stream.Index
 }
 
+// formatKnown formats the value with at most two decimals and its unit, or as
+// "unknown" when the value is zero.
+func formatKnown(value float64, unit string) string {
+	if value <= 0 {
+		return "unknown"
+	}
+	return strconv.FormatFloat(math.Round(value*100)/100, 'f', -1, 64) + unit
+}
+
+// StreamType returns the type of the stream, i.e. "Audio", "Subtitle", "Video"
+// or "Unknown".
+func StreamType(s SourceStream) string {
+	switch s.(type) {
+	case *AudioStream:
+		return "Audio"
+	case *SubtitleStream:
+		return "Subtitle"
+	case *VideoStream:
+		return "Video"
+	default:
+		return "Unknown"
+	}
+}
+
+// Duration returns the duration of the input found by DetectStreams.
+func (d *downloadable) Duration() time.Duration {
+	return d.format.Duration
+}
+
+// Streams returns the source streams found by DetectStreams.
+func (d *downloadable) Streams() []SourceStream {
+	return d.streams
+}
+
+// Warnings returns the problems found by DetectStreams which did not prevent
+// detecting the streams, e.g. unknown frame or bit rates.
+func (d *downloadable) Warnings() []string {
+	return d.warnings
+}
+
+// DetectStreams detects the duration and the streams of the input. For HLS
+// inputs, the streams are taken from the master playlist, unless WithFullProbe
+// is set or the playlist is ambiguous, in which case ffprobe is used. Nothing
+// is detected when the streams were given with WithStreamInfo.
 func (d *downloadable) DetectStreams(ctx context.Context) error {
+	if d.detected {
+		return nil
+	}
+	if err := d.resolveInputUrl(ctx); nil != err {
+		return err
+	}
+	if !d.fullProbe && isHlsPlaylistUrl(d.inputUrl) {
+		err := d.detectStreamsFromPlaylist(ctx)
+		if nil == err {
+			d.detected = true
+			return nil
+		}
+		fmt.Fprintf(d.messageWriter(), "Detecting streams from the HLS playlist failed, using ffprobe instead: %v\n", err)
+	}
+	if err := d.probeStreams(ctx); nil != err {
+		return err
+	}
+	d.detected = true
+	return nil
+}
+
+// StreamInfo holds the detected duration and streams of an input, e.g. to
+// reuse them for another download of the same recording.
+type StreamInfo struct {
+	Duration time.Duration
+	Streams  []SourceStream
+	Warnings []string
+}
+
+// StreamInfo returns the duration and streams found by DetectStreams.
+func (d *downloadable) StreamInfo() StreamInfo {
+	return StreamInfo{
+		Duration: d.format.Duration,
+		Streams:  d.streams,
+		Warnings: d.warnings,
+	}
+}
+
+// probeStreams detects the streams with ffprobe.
+func (d *downloadable) probeStreams(ctx context.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	ffprobeCmd := e.CmdFactory(ctx, "ffprobe",
+	ffprobeCmd := e.CmdFactory(ctx, ffprobeBinary,
 		"-protocol_whitelist", protocolWhiteList,
 		"-print_format", "json",
 		"-show_format",
@@ -132,48 +230,87 @@ func (d *downloadable) DetectStreams(ctx context.Context) error {
 		return fmt.Errorf("failed to JSON decode ffprobe output: %w", err)
 	}
 
-	duration, err := strconv.ParseFloat(res.Format.Duration, 32)
+	duration, err := strconv.ParseFloat(res.Format.Duration, 64)
 	if nil != err {
 		return fmt.Errorf("failed to parse duration %q from ffprobe output: %w", res.Format.Duration, err)
 	}
 	f := format{
-		Duration: time.Second * time.Duration(duration),
+		Duration: time.Duration(duration * float64(time.Second)).Round(time.Millisecond),
 	}
 
+	var warnings probeWarnings
 	streams := make([]SourceStream, 0)
 
 	for _, s := range res.Streams {
 		switch s.CodecType {
 		case "audio":
-			if audio, err := s.audioStream(); nil != err {
-				return err
-			} else if nil != audio {
-				streams = append(streams, audio)
-			}
+			streams = append(streams, s.audioStream(&warnings))
 		case "subtitle":
-			if subtitle, err := s.subtitleStream(); nil != err {
-				return err
-			} else if nil != subtitle {
+			if subtitle := s.subtitleStream(&warnings); nil != subtitle {
 				streams = append(streams, subtitle)
 			}
 		case "video":
-			if video, err := s.videoStream(); nil != err {
-				return err
-			} else if nil != video {
-				streams = append(streams, video)
-			}
+			streams = append(streams, s.videoStream(&warnings))
 		}
 	}
 
+	for _, warning := range warnings {
+		fmt.Fprintf(d.messageWriter(), "WARN: %s.\n", warning)
+	}
 	d.format = f
 	d.streams = streams
+	d.warnings = warnings
 	return nil
 }
 
-func (s streamJson) audioStream() (*AudioStream, error) {
-	sampleRate, err := strconv.ParseInt(s.SampleRate, 10, 0)
+// probeWarnings collects problems found while probing which don't prevent a
+// download, e.g. streams with an unknown bit rate.
+type probeWarnings []string
+
+func (w *probeWarnings) add(format string, args ...any) {
+	*w = append(*w, fmt.Sprintf(format, args...))
+}
+
+// parseRational parses rationals like ffprobe's frame rates, e.g. "30000/1001"
+// or "25/1". Values like "0/0" are not valid and reported as such.
+func parseRational(value string) (float64, bool) {
+	num, den, found := strings.Cut(value, "/")
+	n, err := strconv.ParseFloat(num, 64)
 	if nil != err {
-		return nil, fmt.Errorf("failed to parse sample rate from %q: %w", s.SampleRate, err)
+		return 0, false
+	}
+	d := 1.0
+	if found {
+		if d, err = strconv.ParseFloat(den, 64); nil != err {
+			return 0, false
+		}
+	}
+	if n <= 0 || d <= 0 {
+		return 0, false
+	}
+	return n / d, true
+}
+
+// bitRate returns the bit rate of the stream. HLS variants often lack a bit
+// rate, but have the BANDWIDTH of the variant from the master playlist in the
+// 'variant_bitrate' tag, which is used instead.
+func (s streamJson) bitRate() (int, bool) {
+	if bitRate, err := strconv.Atoi(s.BitRate); nil == err && bitRate > 0 {
+		return bitRate, true
+	}
+	if variant, ok := s.Tags["variant_bitrate"].(string); ok {
+		if bitRate, err := strconv.Atoi(variant); nil == err && bitRate > 0 {
+			return bitRate, true
+		}
+	}
+	return 0, false
+}
+
+func (s streamJson) audioStream(warnings *probeWarnings) *AudioStream {
+	sampleRate, err := strconv.Atoi(s.SampleRate)
+	if nil != err || sampleRate < 0 {
+		warnings.add("unknown sample rate %q of audio stream %d", s.SampleRate, s.Index)
+		sampleRate = 0
 	}
 	lang := "<not-specified>"
 	if nil != s.Tags {
@@ -181,29 +318,35 @@ func (s streamJson) audioStream() (*AudioStream, error) {
 			lang = l.(string)
 		}
 	}
+	// The bit rate of audio streams is often unknown and only used to rank
+	// them, so it is not worth a warning.
+	bitRate, _ := s.bitRate()
 	audio := AudioStream{
 		Stream: Stream{
 			Index:     s.Index,
 			CodecType: s.CodecType,
 			CodecName: s.CodecName,
 		},
-		SampleRate:    int(sampleRate),
+		SampleRate:    sampleRate,
 		Channels:      s.Channels,
 		ChannelLayout: s.ChannelLayout,
+		BitRate:       bitRate,
 		Language:      lang,
+		Title:         s.title(),
+		Disposition:   parseDisposition(s.Disposition),
 	}
-	return &audio, nil
+	return &audio
 }
 
-func (s streamJson) subtitleStream() (*SubtitleStream, error) {
+func (s streamJson) subtitleStream(warnings *probeWarnings) *SubtitleStream {
 	if nil == s.Tags {
-		fmt.Printf("WARN: failed to find tags for subtitle stream %d.\n", s.Index)
-		return nil, nil
+		warnings.add("failed to find tags for subtitle stream %d", s.Index)
+		return nil
 	}
 	lang, found := s.Tags["language"]
 	if !found {
-		fmt.Printf("WARN: failed to find language tag for subtitle stream %d.\n", s.Index)
-		return nil, nil
+		warnings.add("failed to find language tag for subtitle stream %d", s.Index)
+		return nil
 	}
 	subtitle := SubtitleStream{
 		Stream: Stream{
@@ -211,24 +354,29 @@ func (s streamJson) subtitleStream() (*SubtitleStream, error) {
 			CodecType: s.CodecType,
 			CodecName: s.CodecName,
 		},
-		Language: lang.(string),
+		Language:    lang.(string),
+		Title:       s.title(),
+		Disposition: parseDisposition(s.Disposition),
 	}
-	return &subtitle, nil
+	return &subtitle
 }
 
-func (s streamJson) videoStream() (*VideoStream, error) {
-	avgFrameRateStr := s.AvgFrameRate
-	slashPos := strings.Index(avgFrameRateStr, "/")
-	if slashPos >= 0 {
-		avgFrameRateStr = avgFrameRateStr[0:slashPos]
+// title returns the title tag of the stream, if any.
+func (s streamJson) title() string {
+	if title, ok := s.Tags["title"].(string); ok {
+		return title
 	}
-	avgFrameRate, err := strconv.ParseInt(avgFrameRateStr, 10, 0)
-	if nil != err {
-		return nil, fmt.Errorf("failed to parse average frame rate from %q: %w", s.AvgFrameRate, err)
+	return ""
+}
+
+func (s streamJson) videoStream(warnings *probeWarnings) *VideoStream {
+	avgFrameRate, ok := parseRational(s.AvgFrameRate)
+	if !ok {
+		warnings.add("unknown average frame rate %q of video stream %d", s.AvgFrameRate, s.Index)
 	}
-	bitRate, err := strconv.ParseInt(s.BitRate, 10, 0)
-	if nil != err {
-		return nil, fmt.Errorf("failed to parse bit rate from %q: %w", s.BitRate, err)
+	bitRate, ok := s.bitRate()
+	if !ok {
+		warnings.add("unknown bit rate %q of video stream %d", s.BitRate, s.Index)
 	}
 	video := VideoStream{
 		Stream: Stream{
@@ -238,8 +386,8 @@ func (s streamJson) videoStream() (*VideoStream, error) {
 		},
 		Width:        s.Width,
 		Height:       s.Height,
-		AvgFrameRate: int(avgFrameRate),
-		BitRate:      int(bitRate),
+		AvgFrameRate: avgFrameRate,
+		BitRate:      bitRate,
 	}
-	return &video, nil
+	return &video
 }
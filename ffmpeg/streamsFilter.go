@@ -1,5 +1,12 @@
 package ffmpeg
 
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
 type SourceStreamPredicate func(SourceStream) bool
 
 func FilterStreams(streams []SourceStream, predicate SourceStreamPredicate) []SourceStream {
@@ -27,6 +34,64 @@ func IsVideoStream(s SourceStream) bool {
 	return ok
 }
 
+// IsAudioDescription tells whether the stream is an audio description track
+// for the visually impaired.
+func IsAudioDescription(s SourceStream) bool {
+	as, ok := s.(*AudioStream)
+	return ok && as.Disposition.VisualImpaired
+}
+
+// IsHearingImpaired tells whether the stream is meant for the hearing impaired,
+// e.g. an SDH subtitle.
+func IsHearingImpaired(s SourceStream) bool {
+	d, _ := streamDisposition(s)
+	return d.HearingImpaired
+}
+
+// IsForced tells whether the stream is a forced subtitle.
+func IsForced(s SourceStream) bool {
+	d, _ := streamDisposition(s)
+	return d.Forced
+}
+
+// IsCommentary tells whether the stream is a commentary track.
+func IsCommentary(s SourceStream) bool {
+	d, _ := streamDisposition(s)
+	return d.Comment
+}
+
+// IsDefault tells whether the stream is marked as the default track.
+func IsDefault(s SourceStream) bool {
+	d, _ := streamDisposition(s)
+	return d.Default
+}
+
+// Not negates the given predicate.
+func Not(predicate SourceStreamPredicate) SourceStreamPredicate {
+	return func(s SourceStream) bool {
+		return !predicate(s)
+	}
+}
+
+// namedPredicates maps the names of stream kinds to their predicates.
+var namedPredicates = map[string]SourceStreamPredicate{
+	"audio-description": IsAudioDescription,
+	"hearing-impaired":  IsHearingImpaired,
+	"sdh":               IsHearingImpaired,
+	"forced":            IsForced,
+	"commentary":        IsCommentary,
+}
+
+// ParseStreamPredicate returns the predicate for the named kind of stream,
+// e.g. "audio-description" or "sdh".
+func ParseStreamPredicate(name string) (SourceStreamPredicate, error) {
+	if p, found := namedPredicates[strings.ToLower(name)]; found {
+		return p, nil
+	}
+	return nil, fmt.Errorf("unknown kind of stream %q (available: %v)",
+		name, slices.Sorted(maps.Keys(namedPredicates)))
+}
+
 type SourceStreamTransformer[T any] func(SourceStream) T
 
 func TransformStreams[T any](streams []SourceStream, transformer SourceStreamTransformer[T]) []T {
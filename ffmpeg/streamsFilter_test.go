@@ -71,6 +71,51 @@ func TestFilterStreams(t *testing.T) {
 	}
 }
 
+func TestParseStreamPredicate(t *testing.T) {
+	ad := &AudioStream{Disposition: Disposition{VisualImpaired: true}}
+	sdh := &SubtitleStream{Disposition: Disposition{HearingImpaired: true}}
+	forced := &SubtitleStream{Disposition: Disposition{Forced: true, Default: true}}
+	commentary := &AudioStream{Disposition: Disposition{Comment: true}}
+	plain := &SubtitleStream{}
+	all := []SourceStream{ad, sdh, forced, commentary, plain}
+
+	tests := []struct {
+		name    string
+		want    []SourceStream
+		wantErr bool
+	}{
+		{name: "audio-description", want: []SourceStream{ad}},
+		{name: "SDH", want: []SourceStream{sdh}},
+		{name: "hearing-impaired", want: []SourceStream{sdh}},
+		{name: "forced", want: []SourceStream{forced}},
+		{name: "commentary", want: []SourceStream{commentary}},
+		{name: "karaoke", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParseStreamPredicate(tt.name)
+			if (nil != err) != tt.wantErr {
+				t.Fatalf("ParseStreamPredicate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := FilterStreams(all, p); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FilterStreams() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsDefault(t *testing.T) {
+	if !IsDefault(&AudioStream{Disposition: Disposition{Default: true}}) {
+		t.Error("IsDefault() = false, want true")
+	}
+	if IsDefault(&VideoStream{}) {
+		t.Error("IsDefault() = true, want false")
+	}
+}
+
 func TestTransformStreams(t *testing.T) {
 	sourceStreams := []SourceStream{
 		&AudioStream{
@@ -1,23 +1,63 @@
 package ffmpeg
 
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
 type StreamsSelector interface {
 	SelectStreams(streams []SourceStream) ([]SourceStream, error)
 }
 
-type bestStreamsSelector struct{}
+type bestStreamsSelector struct {
+	ranking ranking
+}
+
+type BestStreamsSelectorOption func(*bestStreamsSelector)
+
+// WithScoreLog explains the scores of the best video and audio streams to the
+// given writer.
+func WithScoreLog(w io.Writer) BestStreamsSelectorOption {
+	return func(b *bestStreamsSelector) {
+		b.ranking.log = w
+	}
+}
+
+// WithMaxHeight only considers video streams up to the given height, unless
+// there are none.
+func WithMaxHeight(height int) BestStreamsSelectorOption {
+	return func(b *bestStreamsSelector) {
+		b.ranking.maxHeight = height
+	}
+}
 
-func NewBestStreamsSelector() StreamsSelector {
-	return bestStreamsSelector{}
+// WithMaxBitRate only considers video streams up to the given bit rate in bits
+// per second, unless there are none.
+func WithMaxBitRate(bitRate int) BestStreamsSelectorOption {
+	return func(b *bestStreamsSelector) {
+		b.ranking.maxBitRate = bitRate
+	}
+}
+
+func NewBestStreamsSelector(opts ...BestStreamsSelectorOption) StreamsSelector {
+	b := bestStreamsSelector{ranking: defaultRanking()}
+	for _, opt := range opts {
+		opt(&b)
+	}
+	return b
 }
 
 // SelectStreams implements [StreamsSelector].
 func (b bestStreamsSelector) SelectStreams(streams []SourceStream) ([]SourceStream, error) {
 	res := []SourceStream{}
 
-	if as := bestAudioStream(FilterStreams(streams, IsAudioStream)); nil != as {
+	streams = selectableStreams(streams, nil)
+	if as := b.ranking.bestAudio(FilterStreams(streams, IsAudioStream)); nil != as {
 		res = append(res, as)
 	}
-	if vs := bestVideoStream(FilterStreams(streams, IsVideoStream)); nil != vs {
+	if vs := b.ranking.bestVideo(FilterStreams(streams, IsVideoStream)); nil != vs {
 		res = append(res, vs)
 	}
 	for _, s := range FilterStreams(streams, IsSubtitleStream) {
@@ -26,37 +66,66 @@ func (b bestStreamsSelector) SelectStreams(streams []SourceStream) ([]SourceStre
 	return res, nil
 }
 
-func bestAudioStream(streams []SourceStream) SourceStream {
-	if len(streams) < 1 {
-		return nil
-	} else if len(streams) == 1 {
-		return streams[0]
+// selectableStreams returns the streams which automatic selectors may pick,
+// i.e. the ones not matching any of the excluded predicates. Audio
+// descriptions are only kept when there is no other audio stream.
+func selectableStreams(streams []SourceStream, excluded []SourceStreamPredicate) []SourceStream {
+	for _, predicate := range excluded {
+		streams = FilterStreams(streams, Not(predicate))
 	}
-
-	var best *AudioStream
-	for _, s := range streams {
-		as := s.(*AudioStream)
-		if nil == best || as.SampleRate > best.SampleRate {
-			best = as
-		}
+	if slices.ContainsFunc(streams, func(s SourceStream) bool {
+		return IsAudioStream(s) && !IsAudioDescription(s)
+	}) {
+		streams = FilterStreams(streams, Not(IsAudioDescription))
 	}
-	return best
+	return streams
+}
+
+type audioOnlyStreamsSelector struct {
+	selector StreamsSelector
 }
 
-func bestVideoStream(streams []SourceStream) SourceStream {
-	if len(streams) < 1 {
-		return nil
-	} else if len(streams) == 1 {
-		return streams[0]
+// NewAudioOnlyStreamsSelector returns a StreamsSelector which only offers the
+// audio streams to the given selector, such that no video or subtitles get
+// downloaded.
+func NewAudioOnlyStreamsSelector(selector StreamsSelector) StreamsSelector {
+	return audioOnlyStreamsSelector{selector: selector}
+}
+
+// SelectStreams implements [StreamsSelector].
+func (a audioOnlyStreamsSelector) SelectStreams(streams []SourceStream) ([]SourceStream, error) {
+	audio := FilterStreams(streams, IsAudioStream)
+	if len(audio) <= 0 {
+		return nil, errors.New("no audio streams available")
+	}
+	selected, err := a.selector.SelectStreams(audio)
+	if nil != err {
+		return nil, err
 	}
+	return FilterStreams(selected, IsAudioStream), nil
+}
+
+type indexStreamsSelector struct {
+	indices []int
+}
 
-	var best *VideoStream
-	for _, s := range streams {
-		vs := s.(*VideoStream)
-		if nil == best ||
-			(vs.Width > best.Width && vs.Height > best.Height && vs.AvgFrameRate > best.AvgFrameRate) {
-			best = vs
+// NewIndexStreamsSelector returns a StreamsSelector which selects the streams
+// with the given indices, e.g. from a '--streams 0,2,5' flag. Selection fails
+// if any of the indices does not refer to an available stream.
+func NewIndexStreamsSelector(indices ...int) StreamsSelector {
+	return indexStreamsSelector{indices: indices}
+}
+
+// SelectStreams implements [StreamsSelector].
+func (s indexStreamsSelector) SelectStreams(streams []SourceStream) ([]SourceStream, error) {
+	for _, index := range s.indices {
+		if !slices.ContainsFunc(streams, func(stream SourceStream) bool {
+			return stream.Index() == index
+		}) {
+			return nil, fmt.Errorf("stream #%d is not available", index)
 		}
 	}
-	return best
+	return FilterStreams(streams, func(stream SourceStream) bool {
+		return slices.Contains(s.indices, stream.Index())
+	}), nil
 }
@@ -0,0 +1,202 @@
+package ffmpeg
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type fixedStreamsSelector struct {
+	streams []SourceStream
+	err     error
+}
+
+func (f fixedStreamsSelector) SelectStreams(streams []SourceStream) ([]SourceStream, error) {
+	return f.streams, f.err
+}
+
+func Test_audioOnlyStreamsSelector_SelectStreams(t *testing.T) {
+	video := &VideoStream{Stream: Stream{Index: 0}, Width: 1280, Height: 720}
+	audio1 := &AudioStream{Stream: Stream{Index: 1}, SampleRate: 44100}
+	audio2 := &AudioStream{Stream: Stream{Index: 2}, SampleRate: 48000}
+	subtitle := &SubtitleStream{Stream: Stream{Index: 3}, Language: "de"}
+	all := []SourceStream{video, audio1, audio2, subtitle}
+
+	tests := []struct {
+		name     string
+		selector StreamsSelector
+		streams  []SourceStream
+		want     []SourceStream
+		wantErr  bool
+	}{
+		{
+			name:     "Best",
+			selector: NewBestStreamsSelector(),
+			streams:  all,
+			want:     []SourceStream{audio2},
+		},
+		{
+			name:     "Non-audio selections dropped",
+			selector: fixedStreamsSelector{streams: []SourceStream{video, audio1, audio2, subtitle}},
+			streams:  all,
+			want:     []SourceStream{audio1, audio2},
+		},
+		{
+			name:     "No audio",
+			selector: NewBestStreamsSelector(),
+			streams:  []SourceStream{video, subtitle},
+			wantErr:  true,
+		},
+		{
+			name:     "Selector fails",
+			selector: fixedStreamsSelector{err: errors.New("nope")},
+			streams:  all,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewAudioOnlyStreamsSelector(tt.selector).SelectStreams(tt.streams)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("audioOnlyStreamsSelector.SelectStreams() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("audioOnlyStreamsSelector.SelectStreams() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_bestStreamsSelector_SelectStreams(t *testing.T) {
+	video := &VideoStream{Stream: Stream{Index: 0}, Width: 1280, Height: 720, AvgFrameRate: 25, BitRate: 3_000_000}
+	sd := &VideoStream{Stream: Stream{Index: 5}, Width: 720, Height: 480, AvgFrameRate: 50, BitRate: 800_000}
+	main := &AudioStream{Stream: Stream{Index: 1}, SampleRate: 44100}
+	ad := &AudioStream{Stream: Stream{Index: 2}, SampleRate: 48000, Disposition: Disposition{VisualImpaired: true}}
+	sub := &SubtitleStream{Stream: Stream{Index: 3}, Language: "de"}
+	sdh := &SubtitleStream{Stream: Stream{Index: 4}, Language: "de", Disposition: Disposition{HearingImpaired: true}}
+
+	tests := []struct {
+		name    string
+		opts    []BestStreamsSelectorOption
+		streams []SourceStream
+		want    []SourceStream
+	}{
+		{
+			name:    "AudioDescriptionAvoided",
+			streams: []SourceStream{video, main, ad, sub, sdh},
+			want:    []SourceStream{main, video, sub, sdh},
+		},
+		{
+			name:    "OnlyAudioDescription",
+			streams: []SourceStream{video, ad},
+			want:    []SourceStream{ad, video},
+		},
+		{
+			name:    "MaxHeight",
+			opts:    []BestStreamsSelectorOption{WithMaxHeight(480)},
+			streams: []SourceStream{video, sd, main},
+			want:    []SourceStream{main, sd},
+		},
+		{
+			name:    "MaxBitRate",
+			opts:    []BestStreamsSelectorOption{WithMaxBitRate(1_000_000)},
+			streams: []SourceStream{video, sd, main},
+			want:    []SourceStream{main, sd},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewBestStreamsSelector(tt.opts...).SelectStreams(tt.streams)
+			if nil != err {
+				t.Fatalf("bestStreamsSelector.SelectStreams() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("bestStreamsSelector.SelectStreams() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_selectableStreams(t *testing.T) {
+	video := &VideoStream{Stream: Stream{Index: 0}, Width: 1280, Height: 720}
+	main := &AudioStream{Stream: Stream{Index: 1}, SampleRate: 48000}
+	ad := &AudioStream{Stream: Stream{Index: 2}, SampleRate: 48000, Disposition: Disposition{VisualImpaired: true}}
+	sdh := &SubtitleStream{Stream: Stream{Index: 3}, Language: "de", Disposition: Disposition{HearingImpaired: true}}
+
+	tests := []struct {
+		name     string
+		streams  []SourceStream
+		excluded []SourceStreamPredicate
+		want     []SourceStream
+	}{
+		{
+			name:    "AudioDescriptionDropped",
+			streams: []SourceStream{video, main, ad, sdh},
+			want:    []SourceStream{video, main, sdh},
+		},
+		{
+			name:    "OnlyAudioDescription",
+			streams: []SourceStream{video, ad},
+			want:    []SourceStream{video, ad},
+		},
+		{
+			name:     "Excluded",
+			streams:  []SourceStream{video, ad, sdh},
+			excluded: []SourceStreamPredicate{IsHearingImpaired, IsAudioDescription},
+			want:     []SourceStream{video},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := selectableStreams(tt.streams, tt.excluded); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectableStreams() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_indexStreamsSelector_SelectStreams(t *testing.T) {
+	video := &VideoStream{Stream: Stream{Index: 0}, Width: 1280, Height: 720}
+	audio := &AudioStream{Stream: Stream{Index: 1}, SampleRate: 48000}
+	subtitle := &SubtitleStream{Stream: Stream{Index: 2}, Language: "de"}
+	all := []SourceStream{video, audio, subtitle}
+
+	tests := []struct {
+		name    string
+		indices []int
+		want    []SourceStream
+		wantErr bool
+	}{
+		{
+			name:    "InStreamOrder",
+			indices: []int{2, 0},
+			want:    []SourceStream{video, subtitle},
+		},
+		{
+			name:    "Duplicates",
+			indices: []int{1, 1},
+			want:    []SourceStream{audio},
+		},
+		{
+			name: "None",
+			want: []SourceStream{},
+		},
+		{
+			name:    "Unknown",
+			indices: []int{0, 5},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewIndexStreamsSelector(tt.indices...).SelectStreams(all)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SelectStreams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SelectStreams() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
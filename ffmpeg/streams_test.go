@@ -7,6 +7,7 @@ import (
 	"os/exec"
 	"reflect"
 	"testing"
+	"time"
 
 	e "github.com/rokeller/zt-dl/exec"
 	"github.com/rokeller/zt-dl/test"
@@ -43,8 +44,13 @@ func Test_downloadable_DetectStreams_ffprobe_Complete(t *testing.T) {
 		"sample_rate": "88000",
 		"channels": 5,
 		"channel_layout": "test",
+		"disposition": {
+			"default": 0,
+			"visual_impaired": 1
+		},
 		"tags": {
-			"language": "test"
+			"language": "test",
+			"title": "Audio description"
 		}
 	},
 	{
@@ -80,6 +86,11 @@ func Test_downloadable_DetectStreams_ffprobe_Complete(t *testing.T) {
 		"index": 8,
 		"codec_type": "subtitle",
 		"codec_name": "srt",
+		"disposition": {
+			"default": 0,
+			"forced": 0,
+			"hearing_impaired": 1
+		},
 		"tags": {
 			"language": "en"
 		}
@@ -94,7 +105,7 @@ func Test_downloadable_DetectStreams_ffprobe_Complete(t *testing.T) {
 		return test.TestCommandContext(t, me, ctx, name, arg...)
 	}
 
-	d := NewDownloadable("https://foo.bar.com/probe-source", "target.mp4")
+	d := NewDownloadable(StaticUrl("https://foo.bar.com/probe-source"), "target.mp4")
 	err := d.DetectStreams(t.Context())
 	if nil != err {
 		t.Errorf("downloadable.DetectStreams() got error %v, want nil", err)
@@ -122,6 +133,8 @@ func Test_downloadable_DetectStreams_ffprobe_Complete(t *testing.T) {
 			Channels:      5,
 			ChannelLayout: "test",
 			Language:      "test",
+			Title:         "Audio description",
+			Disposition:   Disposition{VisualImpaired: true},
 		},
 		&VideoStream{
 			Stream: Stream{
@@ -151,7 +164,8 @@ func Test_downloadable_DetectStreams_ffprobe_Complete(t *testing.T) {
 				CodecType: "subtitle",
 				CodecName: "srt",
 			},
-			Language: "en",
+			Language:    "en",
+			Disposition: Disposition{HearingImpaired: true},
 		},
 	}
 	if len(d.streams) != len(expectedStreams) ||
@@ -160,6 +174,101 @@ func Test_downloadable_DetectStreams_ffprobe_Complete(t *testing.T) {
 	}
 }
 
+func Test_downloadable_DetectStreams_ffprobe_Tolerant(t *testing.T) {
+	if test.IsTestCall() {
+		fmt.Println(`{
+	"format": { "duration": "3600.25" },
+	"streams": [
+	{
+		"index": 0,
+		"codec_type": "video",
+		"codec_name": "h264",
+		"width": 1280,
+		"height": 720,
+		"avg_frame_rate": "30000/1001",
+		"bit_rate": "",
+		"tags": { "variant_bitrate": "3500000" }
+	},
+	{
+		"index": 1,
+		"codec_type": "video",
+		"codec_name": "h264",
+		"width": 640,
+		"height": 360,
+		"avg_frame_rate": "0/0"
+	},
+	{
+		"index": 2,
+		"codec_type": "audio",
+		"codec_name": "aac",
+		"sample_rate": "",
+		"channels": 2,
+		"channel_layout": "stereo",
+		"tags": { "language": "de", "variant_bitrate": "128000" }
+	}
+]}`)
+		os.Exit(0)
+		return
+	}
+
+	me := test.CallerFuncName(0)
+	e.CmdFactory = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		return test.TestCommandContext(t, me, ctx, name, arg...)
+	}
+
+	d := NewDownloadable(StaticUrl("https://foo.bar.com/probe-source"), "target.mp4")
+	if err := d.DetectStreams(t.Context()); nil != err {
+		t.Fatalf("downloadable.DetectStreams() got error %v, want nil", err)
+	}
+
+	if want := 3600250 * time.Millisecond; d.Duration() != want {
+		t.Errorf("Duration() = %v, want %v", d.Duration(), want)
+	}
+	wantDescs := []string{
+		"h264, dimensions 1280x720, bit rate 3500000bps, avg frame rate 29.97fps (stream #0)",
+		"h264, dimensions 640x360, bit rate unknown, avg frame rate unknown (stream #1)",
+		`aac, sample rate unknown, 2 channels (stereo), language "de" (stream #2)`,
+	}
+	if descs := TransformStreams(d.Streams(), SourceStream.String); !reflect.DeepEqual(descs, wantDescs) {
+		t.Errorf("streams = %q, want %q", descs, wantDescs)
+	}
+	if bitRate := d.Streams()[2].(*AudioStream).BitRate; bitRate != 128000 {
+		t.Errorf("audio bit rate = %d, want 128000", bitRate)
+	}
+	wantWarnings := []string{
+		`unknown average frame rate "0/0" of video stream 1`,
+		`unknown bit rate "" of video stream 1`,
+		`unknown sample rate "" of audio stream 2`,
+	}
+	if !reflect.DeepEqual(d.Warnings(), wantWarnings) {
+		t.Errorf("Warnings() = %q, want %q", d.Warnings(), wantWarnings)
+	}
+}
+
+func Test_parseRational(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   float64
+		wantOk bool
+	}{
+		{value: "50/1", want: 50, wantOk: true},
+		{value: "30000/1001", want: 30000.0 / 1001, wantOk: true},
+		{value: "25", want: 25, wantOk: true},
+		{value: "0/0"},
+		{value: "25/0"},
+		{value: ""},
+		{value: "abc/1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := parseRational(tt.value)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("parseRational() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
 func Test_downloadable_getBestAudioStream(t *testing.T) {
 	tests := []struct {
 		name    string // description of this test case
@@ -199,9 +308,9 @@ func Test_downloadable_getBestAudioStream(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			d := NewDownloadable("http://input", "./output")
+			d := NewDownloadable(StaticUrl("http://input"), "./output")
 			d.streams = tt.streams
-			got := bestAudioStream(d.streams)
+			got := defaultRanking().bestAudio(d.streams)
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("getBestAudioStream() = %v, want %v", got, tt.want)
 			}
@@ -263,9 +372,9 @@ func Test_downloadable_getBestVideoStream(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			d := NewDownloadable("http://input", "./output")
+			d := NewDownloadable(StaticUrl("http://input"), "./output")
 			d.streams = tt.streams
-			got := bestVideoStream(d.streams)
+			got := defaultRanking().bestVideo(d.streams)
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("getBestVideoStream() = %v, want %v", got, tt.want)
 			}
@@ -0,0 +1,146 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SubtitleMode defines how subtitle streams are written.
+type SubtitleMode string
+
+const (
+	// SubtitlesEmbed embeds subtitle streams in the output file.
+	SubtitlesEmbed = SubtitleMode("embed")
+	// SubtitlesSidecar writes subtitle streams to sidecar files only.
+	SubtitlesSidecar = SubtitleMode("sidecar")
+	// SubtitlesBoth embeds subtitle streams and writes them to sidecar files.
+	SubtitlesBoth = SubtitleMode("both")
+)
+
+// SubtitleFormat defines the format of subtitle sidecar files.
+type SubtitleFormat string
+
+const (
+	SubtitleFormatSrt    = SubtitleFormat("srt")
+	SubtitleFormatWebVtt = SubtitleFormat("vtt")
+)
+
+// SubtitleModeSelector can optionally be implemented by a [StreamsSelector]
+// that also lets the user choose how subtitles are written.
+type SubtitleModeSelector interface {
+	// SelectedSubtitleMode returns the subtitle mode chosen with the last
+	// stream selection, or an empty mode if none was chosen.
+	SelectedSubtitleMode() SubtitleMode
+}
+
+// SidecarsHandler can optionally be implemented by a [DownloadProgressHandler]
+// to get the paths of the subtitle sidecar files before the download finishes.
+type SidecarsHandler interface {
+	SidecarsWritten(paths []string)
+}
+
+// ParseSubtitleMode parses the given name of a subtitle mode.
+func ParseSubtitleMode(name string) (SubtitleMode, error) {
+	switch m := SubtitleMode(strings.ToLower(name)); m {
+	case SubtitlesEmbed, SubtitlesSidecar, SubtitlesBoth:
+		return m, nil
+	}
+	return "", fmt.Errorf("unsupported subtitle mode %q", name)
+}
+
+// ParseSubtitleFormat parses the given name of a subtitle sidecar format.
+func ParseSubtitleFormat(name string) (SubtitleFormat, error) {
+	switch f := SubtitleFormat(strings.ToLower(strings.TrimPrefix(name, "."))); f {
+	case SubtitleFormatSrt, SubtitleFormatWebVtt:
+		return f, nil
+	}
+	return "", fmt.Errorf("unsupported subtitle format %q", name)
+}
+
+func (m SubtitleMode) embeds() bool {
+	return m == "" || m == SubtitlesEmbed || m == SubtitlesBoth
+}
+
+func (m SubtitleMode) sidecars() bool {
+	return m == SubtitlesSidecar || m == SubtitlesBoth
+}
+
+// textSubtitleCodecs lists the text-based subtitle codecs that can be written
+// to SRT and WebVTT sidecar files.
+var textSubtitleCodecs = []string{"webvtt", "subrip", "srt", "mov_text", "ass", "ssa", "text"}
+
+type subtitleSidecar struct {
+	stream *SubtitleStream
+	path   string
+	codec  string
+	muxer  string
+}
+
+func (s subtitleSidecar) args() []string {
+	return []string{
+		"-map", fmt.Sprintf("0:%d", s.stream.Index()),
+		"-c:s", s.codec,
+		"-f", s.muxer,
+		s.path,
+	}
+}
+
+// subtitleSidecars determines the sidecar files to write for the given
+// subtitle streams, named after the output path and the stream's language, or
+// its index if the language is unknown, followed by ".forced" and ".sdh" for forced and hearing impaired subtitles.
+func (d *downloadable) subtitleSidecars(streams []SourceStream) ([]subtitleSidecar, error) {
+	sidecars := []subtitleSidecar{}
+	used := map[string]int{}
+
+	for _, s := range FilterStreams(streams, IsSubtitleStream) {
+		ss := s.(*SubtitleStream)
+		if !codecSupported(textSubtitleCodecs, ss.CodecName) {
+			return nil, fmt.Errorf(
+				"stream #%d: subtitle codec %q cannot be written to a sidecar file",
+				ss.Index(), ss.CodecName)
+		}
+
+		format := d.subtitleFormat
+		if format == "" {
+			format = SubtitleFormatSrt
+			if ss.CodecName == "webvtt" {
+				format = SubtitleFormatWebVtt
+			}
+		}
+
+		sidecar := subtitleSidecar{stream: ss}
+		switch format {
+		case SubtitleFormatWebVtt:
+			sidecar.codec, sidecar.muxer = "webvtt", "webvtt"
+			if ss.CodecName == "webvtt" {
+				sidecar.codec = "copy"
+			}
+		default:
+			sidecar.codec, sidecar.muxer = "subrip", "srt"
+			if ss.CodecName == "subrip" || ss.CodecName == "srt" {
+				sidecar.codec = "copy"
+			}
+		}
+
+		name := ss.Language
+		if name == "" {
+			name = strconv.Itoa(ss.Index())
+		}
+		if ss.Disposition.Forced {
+			name += ".forced"
+		}
+		if ss.Disposition.HearingImpaired {
+			name += ".sdh"
+		}
+		used[name]++
+		if n := used[name]; n > 1 {
+			name = fmt.Sprintf("%s.%d", name, n)
+		}
+		sidecar.path = sidecarPath(d.writePath(), "."+name+"."+string(format))
+
+		sidecars = append(sidecars, sidecar)
+	}
+
+	return sidecars, nil
+}
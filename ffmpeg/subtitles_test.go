@@ -0,0 +1,199 @@
+package ffmpeg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSubtitleMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    SubtitleMode
+		wantErr bool
+	}{
+		{name: "embed", want: SubtitlesEmbed},
+		{name: "Sidecar", want: SubtitlesSidecar},
+		{name: "both", want: SubtitlesBoth},
+		{name: "none", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotErr := ParseSubtitleMode(tt.name)
+			if (nil != gotErr) != tt.wantErr {
+				t.Fatalf("ParseSubtitleMode() error = %v, wantErr %v", gotErr, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSubtitleMode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSubtitleFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    SubtitleFormat
+		wantErr bool
+	}{
+		{name: "srt", want: SubtitleFormatSrt},
+		{name: ".VTT", want: SubtitleFormatWebVtt},
+		{name: "ass", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotErr := ParseSubtitleFormat(tt.name)
+			if (nil != gotErr) != tt.wantErr {
+				t.Fatalf("ParseSubtitleFormat() error = %v, wantErr %v", gotErr, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSubtitleFormat() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_downloadable_subtitleSidecars(t *testing.T) {
+	webvttDe := &SubtitleStream{Stream: Stream{Index: 3, CodecName: "webvtt"}, Language: "de"}
+	webvttDe2 := &SubtitleStream{Stream: Stream{Index: 4, CodecName: "webvtt"}, Language: "de"}
+	srtEn := &SubtitleStream{Stream: Stream{Index: 5, CodecName: "subrip"}, Language: "en"}
+	dvb := &SubtitleStream{Stream: Stream{Index: 6, CodecName: "dvb_subtitle"}, Language: "fr"}
+	sdhDe := &SubtitleStream{Stream: Stream{Index: 7, CodecName: "webvtt"}, Language: "de",
+		Disposition: Disposition{HearingImpaired: true}}
+	forcedEn := &SubtitleStream{Stream: Stream{Index: 8, CodecName: "subrip"}, Language: "en",
+		Disposition: Disposition{Forced: true}}
+	noLanguage := &SubtitleStream{Stream: Stream{Index: 9, CodecName: "subrip"}}
+	audio := &AudioStream{Stream: Stream{Index: 1}}
+
+	tests := []struct {
+		name    string
+		format  SubtitleFormat
+		streams []SourceStream
+		want    []subtitleSidecar
+		wantErr bool
+	}{
+		{
+			name:    "KeepFormat",
+			streams: []SourceStream{audio, webvttDe, srtEn},
+			want: []subtitleSidecar{
+				{stream: webvttDe, path: "/out/rec.de.vtt", codec: "copy", muxer: "webvtt"},
+				{stream: srtEn, path: "/out/rec.en.srt", codec: "copy", muxer: "srt"},
+			},
+		},
+		{
+			name:    "ConvertToSrt/DuplicateLanguage",
+			format:  SubtitleFormatSrt,
+			streams: []SourceStream{webvttDe, webvttDe2},
+			want: []subtitleSidecar{
+				{stream: webvttDe, path: "/out/rec.de.srt", codec: "subrip", muxer: "srt"},
+				{stream: webvttDe2, path: "/out/rec.de.2.srt", codec: "subrip", muxer: "srt"},
+			},
+		},
+		{
+			name:    "ConvertToWebVtt",
+			format:  SubtitleFormatWebVtt,
+			streams: []SourceStream{srtEn},
+			want: []subtitleSidecar{
+				{stream: srtEn, path: "/out/rec.en.vtt", codec: "webvtt", muxer: "webvtt"},
+			},
+		},
+		{
+			name:    "Dispositions",
+			streams: []SourceStream{webvttDe, sdhDe, forcedEn},
+			want: []subtitleSidecar{
+				{stream: webvttDe, path: "/out/rec.de.vtt", codec: "copy", muxer: "webvtt"},
+				{stream: sdhDe, path: "/out/rec.de.sdh.vtt", codec: "copy", muxer: "webvtt"},
+				{stream: forcedEn, path: "/out/rec.en.forced.srt", codec: "copy", muxer: "srt"},
+			},
+		},
+		{
+			name:    "NoLanguage",
+			streams: []SourceStream{noLanguage},
+			want: []subtitleSidecar{
+				{stream: noLanguage, path: "/out/rec.9.srt", codec: "copy", muxer: "srt"},
+			},
+		},
+		{
+			name:    "BitmapSubtitles",
+			streams: []SourceStream{dvb},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDownloadable(StaticUrl("http://input"), "/out/rec.mkv", WithSubtitleFormat(tt.format))
+			got, gotErr := d.subtitleSidecars(tt.streams)
+			if (nil != gotErr) != tt.wantErr {
+				t.Fatalf("subtitleSidecars() error = %v, wantErr %v", gotErr, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("subtitleSidecars() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_downloadable_outputArgs(t *testing.T) {
+	video := &VideoStream{Stream: Stream{Index: 0, CodecName: "h264"}}
+	audio := &AudioStream{Stream: Stream{Index: 1, CodecName: "aac"}}
+	subtitle := &SubtitleStream{Stream: Stream{Index: 2, CodecName: "webvtt"}, Language: "de"}
+	streams := []SourceStream{video, audio, subtitle}
+
+	tests := []struct {
+		name    string
+		options []DownloadableOption
+		mode    SubtitleMode
+		streams []SourceStream
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "Embed",
+			mode:    SubtitlesEmbed,
+			streams: streams,
+			want:    []string{"-map", "0:0", "-map", "0:1", "-map", "0:2", "-c", "copy", "/out/rec.mkv"},
+		},
+		{
+			name:    "Sidecar",
+			mode:    SubtitlesSidecar,
+			streams: streams,
+			want: []string{
+				"-map", "0:0", "-map", "0:1", "-c", "copy", "/out/rec.mkv",
+				"-map", "0:2", "-c:s", "copy", "-f", "webvtt", "/out/rec.de.vtt",
+			},
+		},
+		{
+			name:    "Both",
+			options: []DownloadableOption{WithSubtitleFormat(SubtitleFormatSrt)},
+			mode:    SubtitlesBoth,
+			streams: streams,
+			want: []string{
+				"-map", "0:0", "-map", "0:1", "-map", "0:2", "-c", "copy", "/out/rec.mkv",
+				"-map", "0:2", "-c:s", "subrip", "-f", "srt", "/out/rec.de.srt",
+			},
+		},
+		{
+			name:    "SubtitlesOnly",
+			options: []DownloadableOption{WithSubtitlesOnly(true)},
+			streams: streams,
+			want:    []string{"-map", "0:2", "-c:s", "copy", "-f", "webvtt", "/out/rec.de.vtt"},
+		},
+		{
+			name:    "SubtitlesOnly/NoSubtitles",
+			options: []DownloadableOption{WithSubtitlesOnly(true)},
+			streams: []SourceStream{video, audio},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDownloadable(StaticUrl("http://input"), "/out/rec.mkv", tt.options...)
+			got, gotErr := d.outputArgs(tt.streams, tt.mode)
+			if (nil != gotErr) != tt.wantErr {
+				t.Fatalf("outputArgs() error = %v, wantErr %v", gotErr, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("outputArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// TranscodingProfile defines how video and audio streams get transcoded.
+// Streams of a type without codec settings are copied as-is.
+type TranscodingProfile struct {
+	Video *CodecSettings `json:"video,omitempty"`
+	Audio *CodecSettings `json:"audio,omitempty"`
+	// Loudness normalizes the loudness of audio streams after downloading,
+	// which transcodes them once more.
+	Loudness *LoudnessSettings `json:"loudness,omitempty"`
+}
+
+// CodecSettings defines the encoder and its settings for a stream type.
+type CodecSettings struct {
+	// Codec is the name of the ffmpeg encoder, e.g. libx265.
+	Codec string `json:"codec"`
+	// Bitrate is the target bit rate, e.g. 128k.
+	Bitrate string `json:"bitrate,omitempty"`
+	// Channels is the number of audio channels to downmix to.
+	Channels int `json:"channels,omitempty"`
+	// Filter is an ffmpeg filter graph applied to the streams.
+	Filter string `json:"filter,omitempty"`
+	// Args holds additional encoder arguments, e.g. ["-crf", "24"].
+	Args []string `json:"args,omitempty"`
+}
+
+var builtinProfiles = map[string]TranscodingProfile{
+	"hevc-archive": {
+		Video: &CodecSettings{
+			Codec: "libx265",
+			Args:  []string{"-crf", "24", "-preset", "medium"},
+		},
+	},
+	"stereo-aac": {
+		Audio: &CodecSettings{
+			Codec:    "aac",
+			Bitrate:  "192k",
+			Channels: 2,
+		},
+	},
+	"mobile-720p": {
+		Video: &CodecSettings{
+			Codec:  "libx264",
+			Filter: "scale=-2:'min(720,ih)'",
+			Args:   []string{"-crf", "23", "-preset", "fast"},
+		},
+		Audio: &CodecSettings{
+			Codec:    "aac",
+			Bitrate:  "128k",
+			Channels: 2,
+		},
+	},
+}
+
+// BuiltinProfiles returns the transcoding profiles that are always available.
+func BuiltinProfiles() map[string]TranscodingProfile {
+	return maps.Clone(builtinProfiles)
+}
+
+// LookupProfile finds the transcoding profile with the given name in the custom
+// profiles, falling back to the built-in profiles.
+func LookupProfile(name string, custom map[string]TranscodingProfile) (TranscodingProfile, error) {
+	if p, found := custom[name]; found {
+		return p, nil
+	} else if p, found := builtinProfiles[name]; found {
+		return p, nil
+	}
+
+	available := maps.Clone(builtinProfiles)
+	maps.Copy(available, custom)
+	names := slices.Sorted(maps.Keys(available))
+	return TranscodingProfile{}, fmt.Errorf("unknown transcoding profile %q (available: %v)", name, names)
+}
+
+// encoderCodecs maps well-known encoder names to the codec they produce.
+var encoderCodecs = map[string]string{
+	"libx264":    "h264",
+	"libx265":    "hevc",
+	"libvpx-vp9": "vp9",
+	"libaom-av1": "av1",
+	"libsvtav1":  "av1",
+	"libfdk_aac": "aac",
+	"libmp3lame": "mp3",
+	"libopus":    "opus",
+	"libvorbis":  "vorbis",
+}
+
+func (c *CodecSettings) args(streamType string) []string {
+	args := []string{"-c:" + streamType, c.Codec}
+	if c.Bitrate != "" {
+		args = append(args, "-b:"+streamType, c.Bitrate)
+	}
+	if c.Channels > 0 {
+		args = append(args, "-ac:"+streamType, strconv.Itoa(c.Channels))
+	}
+	if c.Filter != "" {
+		args = append(args, "-filter:"+streamType, c.Filter)
+	}
+	return append(args, streamArgs(c.Args, streamType)...)
+}
+
+// streamArgs returns the given encoder arguments with the stream specifier
+// added to the option names, e.g. -crf becomes -crf:v, such that they don't
+// apply to the encoders of other streams. Options which already have a stream
+// specifier are kept as they are.
+func streamArgs(args []string, streamType string) []string {
+	res := make([]string, len(args))
+	for i, arg := range args {
+		if isOptionName(arg) && !strings.Contains(arg, ":") {
+			arg += ":" + streamType
+		}
+		res[i] = arg
+	}
+	return res
+}
+
+// isOptionName tells whether the argument is the name of an ffmpeg option
+// rather than a value, which may be a negative number.
+func isOptionName(arg string) bool {
+	if len(arg) < 2 || arg[0] != '-' {
+		return false
+	}
+	_, err := strconv.ParseFloat(arg, 64)
+	return nil != err
+}
+
+func (c *CodecSettings) outputCodec() string {
+	if codec, found := encoderCodecs[c.Codec]; found {
+		return codec
+	}
+	return c.Codec
+}
+
+// args returns the ffmpeg output arguments to transcode streams according to
+// the profile. With cover art, which follows the given number of video streams,
+// the video settings are scoped to these streams, such that the cover art is
+// copied rather than transcoded or filtered.
+func (p TranscodingProfile) args(videoStreams int, coverArt bool) []string {
+	args := []string{}
+	if nil != p.Video && !coverArt {
+		args = append(args, p.Video.args("v")...)
+	} else if nil != p.Video {
+		for i := range videoStreams {
+			args = append(args, p.Video.args(fmt.Sprintf("v:%d", i))...)
+		}
+	}
+	if nil != p.Audio {
+		args = append(args, p.Audio.args("a")...)
+	}
+	return args
+}
+
+// outputStreams returns copies of the given streams with the codecs replaced
+// by the ones the profile transcodes them to.
+func (p TranscodingProfile) outputStreams(streams []SourceStream) []SourceStream {
+	return TransformStreams(streams, func(s SourceStream) SourceStream {
+		switch st := s.(type) {
+		case *VideoStream:
+			if nil != p.Video {
+				vs := *st
+				vs.CodecName = p.Video.outputCodec()
+				return &vs
+			}
+		case *AudioStream:
+			if nil != p.Audio {
+				as := *st
+				as.CodecName = p.Audio.outputCodec()
+				return &as
+			}
+		}
+		return s
+	})
+}
@@ -0,0 +1,135 @@
+package ffmpeg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLookupProfile(t *testing.T) {
+	custom := map[string]TranscodingProfile{
+		"custom": {Audio: &CodecSettings{Codec: "libopus"}},
+	}
+	tests := []struct {
+		name    string
+		want    TranscodingProfile
+		wantErr bool
+	}{
+		{name: "custom", want: custom["custom"]},
+		{name: "hevc-archive", want: builtinProfiles["hevc-archive"]},
+		{name: "unknown", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotErr := LookupProfile(tt.name, custom)
+			if (nil != gotErr) != tt.wantErr {
+				t.Fatalf("LookupProfile() error = %v, wantErr %v", gotErr, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LookupProfile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookupProfile_UnknownListsSortedNames(t *testing.T) {
+	custom := map[string]TranscodingProfile{
+		"zz-custom": {Audio: &CodecSettings{Codec: "libopus"}},
+		"aa-custom": {Audio: &CodecSettings{Codec: "aac"}},
+	}
+	want := `unknown transcoding profile "unknown" (available: [aa-custom hevc-archive mobile-720p stereo-aac zz-custom])`
+	for range 10 {
+		_, err := LookupProfile("unknown", custom)
+		if nil == err || err.Error() != want {
+			t.Fatalf("LookupProfile() error = %v, want %s", err, want)
+		}
+	}
+}
+
+func TestTranscodingProfile_args(t *testing.T) {
+	tests := []struct {
+		name         string
+		profile      TranscodingProfile
+		videoStreams int
+		coverArt     bool
+		want         []string
+	}{
+		{
+			name:    "CopyAll",
+			profile: TranscodingProfile{},
+			want:    []string{},
+		},
+		{
+			name:    "HevcArchive",
+			profile: builtinProfiles["hevc-archive"],
+			want:    []string{"-c:v", "libx265", "-crf:v", "24", "-preset:v", "medium"},
+		},
+		{
+			name:    "StereoAac",
+			profile: builtinProfiles["stereo-aac"],
+			want:    []string{"-c:a", "aac", "-b:a", "192k", "-ac:a", "2"},
+		},
+		{
+			name: "ScopedArgs",
+			profile: TranscodingProfile{
+				Audio: &CodecSettings{Codec: "libopus", Args: []string{"-vbr", "on", "-compression_level:a", "10"}},
+				Video: &CodecSettings{Codec: "libx264", Args: []string{"-x264-params", "keyint=50", "-bf", "-1"}},
+			},
+			want: []string{
+				"-c:v", "libx264", "-x264-params:v", "keyint=50", "-bf:v", "-1",
+				"-c:a", "libopus", "-vbr:a", "on", "-compression_level:a", "10",
+			},
+		},
+		{
+			name:     "CoverArtOnly",
+			profile:  builtinProfiles["mobile-720p"],
+			coverArt: true,
+			want:     []string{"-c:a", "aac", "-b:a", "128k", "-ac:a", "2"},
+		},
+		{
+			name:         "VideoAndCoverArt",
+			profile:      builtinProfiles["mobile-720p"],
+			videoStreams: 2,
+			coverArt:     true,
+			want: []string{
+				"-c:v:0", "libx264", "-filter:v:0", "scale=-2:'min(720,ih)'", "-crf:v:0", "23", "-preset:v:0", "fast",
+				"-c:v:1", "libx264", "-filter:v:1", "scale=-2:'min(720,ih)'", "-crf:v:1", "23", "-preset:v:1", "fast",
+				"-c:a", "aac", "-b:a", "128k", "-ac:a", "2",
+			},
+		},
+		{
+			name:    "Mobile720p",
+			profile: builtinProfiles["mobile-720p"],
+			want: []string{
+				"-c:v", "libx264", "-filter:v", "scale=-2:'min(720,ih)'", "-crf:v", "23", "-preset:v", "fast",
+				"-c:a", "aac", "-b:a", "128k", "-ac:a", "2",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.profile.args(tt.videoStreams, tt.coverArt); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("args() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTranscodingProfile_outputStreams(t *testing.T) {
+	streams := []SourceStream{
+		&VideoStream{Stream: Stream{Index: 0, CodecName: "h264"}},
+		&AudioStream{Stream: Stream{Index: 1, CodecName: "ac3"}},
+		&SubtitleStream{Stream: Stream{Index: 2, CodecName: "webvtt"}},
+	}
+	got := builtinProfiles["hevc-archive"].outputStreams(streams)
+	want := []SourceStream{
+		&VideoStream{Stream: Stream{Index: 0, CodecName: "hevc"}},
+		&AudioStream{Stream: Stream{Index: 1, CodecName: "ac3"}},
+		&SubtitleStream{Stream: Stream{Index: 2, CodecName: "webvtt"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("outputStreams() = %v, want %v", got, want)
+	}
+	if streams[0].(*VideoStream).CodecName != "h264" {
+		t.Error("outputStreams() modified the source streams")
+	}
+}
@@ -0,0 +1,184 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxChunk is the most bytes a throttled reader reads at once, such that waits
+// stay short and changes of the limit take effect quickly.
+const maxChunk = 32 * 1024
+
+// Limiter limits the rate of all transfers sharing it, following a schedule
+// which can be overridden at runtime. It is safe for concurrent use.
+type Limiter struct {
+	mu       sync.Mutex
+	schedule Schedule
+	override *Rate
+	now      func() time.Time
+
+	// debt is the number of bytes transferred ahead of the limit.
+	debt float64
+	last time.Time
+}
+
+func NewLimiter(schedule Schedule) *Limiter {
+	return &Limiter{
+		schedule: schedule,
+		now:      time.Now,
+	}
+}
+
+// Limit returns the limit which currently applies.
+func (l *Limiter) Limit() Rate {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit()
+}
+
+func (l *Limiter) limit() Rate {
+	if nil != l.override {
+		return *l.override
+	}
+	return l.schedule.LimitAt(l.now())
+}
+
+// Schedule returns the schedule of the limiter.
+func (l *Limiter) Schedule() Schedule {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.schedule
+}
+
+// SetSchedule replaces the schedule of the limiter.
+func (l *Limiter) SetSchedule(schedule Schedule) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.schedule = schedule
+}
+
+// Override returns the limit overriding the schedule, or nil.
+func (l *Limiter) Override() *Rate {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if nil == l.override {
+		return nil
+	}
+	rate := *l.override
+	return &rate
+}
+
+// SetOverride sets a limit which applies instead of the schedule until it is
+// cleared by passing nil.
+func (l *Limiter) SetOverride(rate *Rate) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if nil == rate {
+		l.override = nil
+		return
+	}
+	override := *rate
+	l.override = &override
+}
+
+// WaitN accounts for n transferred bytes and waits until they are within the
+// limit, or the context is done.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := l.now()
+	limit := l.limit()
+	if limit <= 0 {
+		l.last = time.Time{}
+		l.mu.Unlock()
+		return nil
+	}
+
+	// Up to a second worth of bytes may be transferred in a burst, e.g. at the
+	// start or after idle periods.
+	if l.last.IsZero() {
+		l.debt = -float64(limit)
+	} else {
+		l.debt -= now.Sub(l.last).Seconds() * float64(limit)
+		l.debt = max(l.debt, -float64(limit))
+	}
+	l.last = now
+	l.debt += float64(n)
+	wait := time.Duration(l.debt / float64(limit) * float64(time.Second))
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Reader returns a reader which reads from r within the limit. If counter is
+// set, the number of bytes read gets added to it.
+func (l *Limiter) Reader(ctx context.Context, r io.Reader, counter *atomic.Int64) io.Reader {
+	return &reader{ctx: ctx, r: r, l: l, counter: counter}
+}
+
+type reader struct {
+	ctx     context.Context
+	r       io.Reader
+	l       *Limiter
+	counter *atomic.Int64
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > maxChunk {
+		p = p[:maxChunk]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if nil != r.counter {
+			r.counter.Add(int64(n))
+		}
+		if waitErr := r.l.WaitN(r.ctx, n); nil != waitErr && nil == err {
+			err = waitErr
+		}
+	}
+	return n, err
+}
+
+// Transport returns a round tripper which reads the bodies of the responses of
+// base, or http.DefaultTransport if nil, within the limit.
+func (l *Limiter) Transport(base http.RoundTripper) http.RoundTripper {
+	if nil == base {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base, l: l}
+}
+
+type transport struct {
+	base http.RoundTripper
+	l    *Limiter
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if nil != err {
+		return nil, err
+	}
+	resp.Body = &readCloser{
+		Reader: t.l.Reader(req.Context(), resp.Body, nil),
+		Closer: resp.Body,
+	}
+	return resp, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
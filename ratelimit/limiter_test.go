@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiter_Limit(t *testing.T) {
+	l := NewLimiter(Schedule{
+		Limit: 10,
+		Rules: []Rule{{From: 18 * 60, To: 23 * 60, Limit: 2}},
+	})
+	l.now = func() time.Time { return time.Date(2026, 1, 1, 19, 0, 0, 0, time.Local) }
+
+	if got := l.Limit(); got != 2 {
+		t.Errorf("Limit() = %d, want scheduled 2", got)
+	}
+
+	override := Rate(5)
+	l.SetOverride(&override)
+	if got := l.Limit(); got != 5 {
+		t.Errorf("Limit() = %d, want overridden 5", got)
+	}
+	if got := l.Override(); nil == got || *got != 5 {
+		t.Errorf("Override() = %v, want 5", got)
+	}
+
+	l.SetOverride(nil)
+	l.SetSchedule(Schedule{Limit: 7})
+	if got := l.Limit(); got != 7 {
+		t.Errorf("Limit() = %d, want 7 from new schedule", got)
+	}
+	if got := l.Override(); nil != got {
+		t.Errorf("Override() = %v, want nil", *got)
+	}
+}
+
+func TestLimiter_WaitN(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local)
+	l := NewLimiter(Schedule{Limit: 1000})
+	l.now = func() time.Time { return now }
+
+	// The first second worth of bytes may pass without waiting.
+	if err := l.WaitN(t.Context(), 1000); nil != err {
+		t.Fatalf("WaitN() failed: %v", err)
+	}
+
+	// Exceeding it must wait, until the context is done.
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	if err := l.WaitN(ctx, 1000); nil == err {
+		t.Errorf("WaitN() did not wait for 1000 bytes above the limit")
+	}
+
+	// Once the time passed, the debt is paid off.
+	now = now.Add(3 * time.Second)
+	if err := l.WaitN(t.Context(), 500); nil != err {
+		t.Errorf("WaitN() failed after the debt was paid off: %v", err)
+	}
+
+	// Unlimited transfers never wait.
+	l.SetOverride(new(Rate))
+	if err := l.WaitN(ctx, 1_000_000); nil != err {
+		t.Errorf("WaitN() failed when unlimited: %v", err)
+	}
+}
+
+func TestLimiter_Reader(t *testing.T) {
+	l := NewLimiter(Schedule{Limit: 64 * 1024})
+	data := bytes.Repeat([]byte{'x'}, 96*1024)
+	var counter atomic.Int64
+
+	start := time.Now()
+	got, err := io.ReadAll(l.Reader(t.Context(), bytes.NewReader(data), &counter))
+	elapsed := time.Since(start)
+
+	if nil != err {
+		t.Fatalf("ReadAll() failed: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("ReadAll() read %d bytes, want %d", len(got), len(data))
+	}
+	if counter.Load() != int64(len(data)) {
+		t.Errorf("counter = %d, want %d", counter.Load(), len(data))
+	}
+	// 64 KiB pass right away, the remaining 32 KiB take half a second.
+	if elapsed < 400*time.Millisecond {
+		t.Errorf("ReadAll() took %s, want at least 400ms", elapsed)
+	}
+}
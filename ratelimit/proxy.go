@@ -0,0 +1,149 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// dialTimeout is how long the proxy waits for connections to upstream servers.
+const dialTimeout = 15 * time.Second
+
+// hopHeaders are the hop-by-hop headers which proxies must not forward.
+var hopHeaders = []string{
+	"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate",
+	"Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// Proxy is a local HTTP proxy which limits the rate of the data received from
+// upstream servers, e.g. for ffmpeg to download through. HTTPS is tunneled with
+// CONNECT, so the proxy never sees the decrypted traffic.
+type Proxy struct {
+	limiter  *Limiter
+	listener net.Listener
+	server   *http.Server
+	ctx      context.Context
+	cancel   context.CancelFunc
+	received atomic.Int64
+}
+
+// StartProxy starts a proxy on a random port of the loopback interface.
+func StartProxy(limiter *Limiter) (*Proxy, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		return nil, fmt.Errorf("failed to start rate limiting proxy: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Proxy{
+		limiter:  limiter,
+		listener: listener,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	p.server = &http.Server{
+		Handler:     p,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go p.server.Serve(listener)
+	return p, nil
+}
+
+// URL returns the URL to use the proxy with.
+func (p *Proxy) URL() string {
+	return "http://" + p.listener.Addr().String()
+}
+
+// Received returns the number of bytes received from upstream servers.
+func (p *Proxy) Received() int64 {
+	return p.received.Load()
+}
+
+// Close stops the proxy and closes all connections through it.
+func (p *Proxy) Close() error {
+	p.cancel()
+	return p.server.Close()
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "only proxy requests are supported", http.StatusBadRequest)
+		return
+	}
+
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	for _, h := range hopHeaders {
+		out.Header.Del(h)
+	}
+	resp, err := http.DefaultTransport.RoundTrip(out)
+	if nil != err {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, h := range hopHeaders {
+		resp.Header.Del(h)
+	}
+	for name, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, p.limiter.Reader(r.Context(), resp.Body, &p.received))
+}
+
+// tunnel connects the client to the requested host and relays the data in both
+// directions, limiting the rate of the data received from the host.
+func (p *Proxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	dialer := net.Dialer{Timeout: dialTimeout}
+	upstream, err := dialer.DialContext(r.Context(), "tcp", r.Host)
+	if nil != err {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "tunneling is not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if nil != err {
+		return
+	}
+	defer client.Close()
+	if _, err := io.WriteString(client, "HTTP/1.1 200 Connection established\r\n\r\n"); nil != err {
+		return
+	}
+
+	// Unblock the copies below when the proxy gets closed.
+	stop := context.AfterFunc(p.ctx, func() {
+		client.Close()
+		upstream.Close()
+	})
+	defer stop()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		io.Copy(upstream, buffered)
+		if tcp, ok := upstream.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		}
+	}()
+	io.Copy(client, p.limiter.Reader(p.ctx, upstream, &p.received))
+	client.Close()
+	<-done
+}
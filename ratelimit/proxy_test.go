@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestProxy(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Path", r.URL.Path)
+		io.WriteString(w, "segment data")
+	})
+
+	tests := []struct {
+		name   string // description of this test case
+		server *httptest.Server
+	}{
+		{name: "HTTP", server: httptest.NewServer(handler)},
+		{name: "HTTPS", server: httptest.NewTLSServer(handler)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.server.Close()
+			p, err := StartProxy(NewLimiter(Schedule{Limit: 1024 * 1024}))
+			if nil != err {
+				t.Fatalf("StartProxy() failed: %v", err)
+			}
+			defer p.Close()
+
+			proxyUrl, _ := url.Parse(p.URL())
+			client := tt.server.Client()
+			client.Transport.(*http.Transport).Proxy = http.ProxyURL(proxyUrl)
+
+			resp, err := client.Get(tt.server.URL + "/seg-1.ts")
+			if nil != err {
+				t.Fatalf("Get() through proxy failed: %v", err)
+			}
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if nil != err {
+				t.Fatalf("ReadAll() failed: %v", err)
+			}
+
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("Get() status = %d, want %d", resp.StatusCode, http.StatusOK)
+			}
+			if got := resp.Header.Get("X-Path"); got != "/seg-1.ts" {
+				t.Errorf("Get() path = %q, want %q", got, "/seg-1.ts")
+			}
+			if string(body) != "segment data" {
+				t.Errorf("Get() body = %q, want %q", body, "segment data")
+			}
+			if p.Received() <= 0 {
+				t.Errorf("Received() = %d, want > 0", p.Received())
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/rokeller/zt-dl/units"
+)
+
+// Rate is a transfer rate in bytes per second. Zero means unlimited.
+type Rate int64
+
+// ParseRate parses a rate in bytes per second with an optional binary suffix,
+// e.g. 500k, 2M or 1.5G. Zero, an empty string and "unlimited" mean unlimited.
+func ParseRate(s string) (Rate, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.EqualFold(s, "unlimited") {
+		return 0, nil
+	}
+
+	value, err := units.Binary.Parse(s)
+	if nil != err {
+		return 0, fmt.Errorf("invalid rate %q, use e.g. 500k or 2M", s)
+	}
+	return Rate(value), nil
+}
+
+// String formats the rate using binary units, e.g. 2.0 MiB/s.
+func (r Rate) String() string {
+	if r <= 0 {
+		return "unlimited"
+	}
+	const unit = 1024
+	if r < unit {
+		return fmt.Sprintf("%d B/s", r)
+	}
+	div, exp := int64(unit), 0
+	for n := int64(r) / unit; n >= unit && exp < 2; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB/s", float64(r)/float64(div), "KMG"[exp])
+}
+
+// UnmarshalJSON accepts rates both as numbers of bytes per second and as
+// strings like "2M".
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); nil == err {
+		rate, err := ParseRate(s)
+		if nil != err {
+			return err
+		}
+		*r = rate
+		return nil
+	}
+
+	var n int64
+	if err := json.Unmarshal(data, &n); nil != err {
+		return fmt.Errorf("invalid rate %s, use e.g. 2097152 or \"2M\"", data)
+	} else if n < 0 {
+		return fmt.Errorf("invalid rate %d, must not be negative", n)
+	}
+	*r = Rate(n)
+	return nil
+}
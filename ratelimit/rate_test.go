@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    Rate
+		wantErr bool
+	}{
+		{s: "", want: 0},
+		{s: "unlimited", want: 0},
+		{s: "0", want: 0},
+		{s: "1000", want: 1000},
+		{s: "500k", want: 500 * 1024},
+		{s: "2M", want: 2 * 1024 * 1024},
+		{s: "1.5G", want: 1536 * 1024 * 1024},
+		{s: "fast", wantErr: true},
+		{s: "-1M", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseRate(tt.s)
+			if (nil != err) != tt.wantErr {
+				t.Fatalf("ParseRate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRate() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRate_String(t *testing.T) {
+	tests := []struct {
+		r    Rate
+		want string
+	}{
+		{r: 0, want: "unlimited"},
+		{r: 512, want: "512 B/s"},
+		{r: 1536, want: "1.5 KiB/s"},
+		{r: 2 * 1024 * 1024, want: "2.0 MiB/s"},
+		{r: 3 * 1024 * 1024 * 1024, want: "3.0 GiB/s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.r.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRate_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    Rate
+		wantErr bool
+	}{
+		{name: "Number", json: `2097152`, want: 2 * 1024 * 1024},
+		{name: "String", json: `"2M"`, want: 2 * 1024 * 1024},
+		{name: "InvalidString", json: `"2 per second"`, wantErr: true},
+		{name: "Negative", json: `-1`, wantErr: true},
+		{name: "Bool", json: `true`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Rate
+			err := json.Unmarshal([]byte(tt.json), &got)
+			if (nil != err) != tt.wantErr {
+				t.Fatalf("UnmarshalJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("UnmarshalJSON() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
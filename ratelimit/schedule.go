@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ClockTime is a time of day in minutes after midnight.
+type ClockTime int
+
+// ParseClockTime parses a time of day like 18:00 or 6:30.
+func ParseClockTime(s string) (ClockTime, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if nil != err {
+		return 0, fmt.Errorf("invalid time of day %q, use e.g. 18:00", s)
+	}
+	return ClockTime(t.Hour()*60 + t.Minute()), nil
+}
+
+func (c ClockTime) String() string {
+	return fmt.Sprintf("%02d:%02d", c/60, c%60)
+}
+
+func (c ClockTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.String())
+}
+
+func (c *ClockTime) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); nil != err {
+		return fmt.Errorf("invalid time of day %s, use e.g. \"18:00\"", data)
+	}
+	t, err := ParseClockTime(s)
+	if nil != err {
+		return err
+	}
+	*c = t
+	return nil
+}
+
+// Rule limits the rate from a time of day until another. Rules whose end is not
+// after their start span midnight, e.g. from 22:00 to 06:00.
+type Rule struct {
+	From  ClockTime `json:"from"`
+	To    ClockTime `json:"to"`
+	Limit Rate      `json:"limit"`
+}
+
+// ParseRule parses a rule like 18:00-23:00=2M.
+func ParseRule(s string) (Rule, error) {
+	var r Rule
+	span, limit, found := strings.Cut(s, "=")
+	if !found {
+		return r, fmt.Errorf("invalid rate limit rule %q, use e.g. 18:00-23:00=2M", s)
+	}
+	from, to, found := strings.Cut(span, "-")
+	if !found {
+		return r, fmt.Errorf("invalid rate limit rule %q, use e.g. 18:00-23:00=2M", s)
+	}
+
+	fromTime, err := ParseClockTime(from)
+	if nil != err {
+		return r, err
+	}
+	toTime, err := ParseClockTime(to)
+	if nil != err {
+		return r, err
+	}
+	rate, err := ParseRate(limit)
+	if nil != err {
+		return r, err
+	}
+	return Rule{From: fromTime, To: toTime, Limit: rate}, nil
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("%s-%s=%s", r.From, r.To, r.Limit)
+}
+
+// applies tells whether the rule applies at the given time of day.
+func (r Rule) applies(c ClockTime) bool {
+	if r.From < r.To {
+		return c >= r.From && c < r.To
+	}
+	return c >= r.From || c < r.To
+}
+
+// Schedule holds the rate limits by time of day.
+type Schedule struct {
+	// Limit applies whenever none of the rules does.
+	Limit Rate `json:"limit"`
+	// Rules are checked in order, and the first one which applies wins.
+	Rules []Rule `json:"rules,omitempty"`
+}
+
+// LimitAt returns the limit which applies at the given local time.
+func (s Schedule) LimitAt(t time.Time) Rate {
+	c := ClockTime(t.Hour()*60 + t.Minute())
+	for _, r := range s.Rules {
+		if r.applies(c) {
+			return r.Limit
+		}
+	}
+	return s.Limit
+}
+
+// IsZero tells whether the schedule never limits the rate.
+func (s Schedule) IsZero() bool {
+	return s.Limit <= 0 && len(s.Rules) <= 0
+}
@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    Rule
+		wantErr bool
+	}{
+		{s: "18:00-23:00=2M", want: Rule{From: 18 * 60, To: 23 * 60, Limit: 2 * 1024 * 1024}},
+		{s: "22:30-6:00=unlimited", want: Rule{From: 22*60 + 30, To: 6 * 60}},
+		{s: "18:00-23:00", wantErr: true},
+		{s: "18:00=2M", wantErr: true},
+		{s: "25:00-23:00=2M", wantErr: true},
+		{s: "18:00-23:00=fast", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseRule(tt.s)
+			if (nil != err) != tt.wantErr {
+				t.Fatalf("ParseRule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRule() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchedule_LimitAt(t *testing.T) {
+	s := Schedule{
+		Limit: 10,
+		Rules: []Rule{
+			{From: 18 * 60, To: 23 * 60, Limit: 2},
+			{From: 22 * 60, To: 6 * 60, Limit: 3},
+			{From: 12 * 60, To: 13 * 60, Limit: 0},
+		},
+	}
+	tests := []struct {
+		at   string
+		want Rate
+	}{
+		{at: "08:00", want: 10},
+		{at: "12:30", want: 0},
+		{at: "17:59", want: 10},
+		{at: "18:00", want: 2},
+		{at: "22:30", want: 2},
+		{at: "23:00", want: 3},
+		{at: "02:00", want: 3},
+		{at: "06:00", want: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.at, func(t *testing.T) {
+			at, _ := time.ParseInLocation("15:04", tt.at, time.Local)
+			if got := s.LimitAt(at); got != tt.want {
+				t.Errorf("LimitAt() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchedule_JSON(t *testing.T) {
+	var got Schedule
+	err := json.Unmarshal([]byte(`{
+		"limit": "10M",
+		"rules": [ { "from": "18:00", "to": "23:00", "limit": "2M" } ]
+	}`), &got)
+	if nil != err {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+	want := Schedule{
+		Limit: 10 * 1024 * 1024,
+		Rules: []Rule{{From: 18 * 60, To: 23 * 60, Limit: 2 * 1024 * 1024}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unmarshal() = %+v, want %+v", got, want)
+	}
+
+	data, err := json.Marshal(want)
+	if nil != err {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+	wantJson := `{"limit":10485760,"rules":[{"from":"18:00","to":"23:00","limit":2097152}]}`
+	if string(data) != wantJson {
+		t.Errorf("Marshal() = %s, want %s", data, wantJson)
+	}
+}
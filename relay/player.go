@@ -0,0 +1,35 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+
+	e "github.com/rokeller/zt-dl/exec"
+)
+
+// Player is an external media player, e.g. mpv or VLC, to play relayed
+// streams with.
+type Player struct {
+	// Command is the path or name of the player's executable.
+	Command string `json:"command"`
+	// Args holds additional arguments passed to the player before the URL of
+	// the stream, e.g. ["--fs"].
+	Args []string `json:"args,omitempty"`
+}
+
+// IsZero tells whether no player is configured.
+func (p Player) IsZero() bool {
+	return p.Command == ""
+}
+
+// Start starts the player to play the stream at the given URL. The caller
+// must wait for the returned command.
+func (p Player) Start(ctx context.Context, streamUrl string) (*exec.Cmd, error) {
+	args := append(append([]string{}, p.Args...), streamUrl)
+	cmd := e.CmdFactory(ctx, p.Command, args...)
+	if err := cmd.Start(); nil != err {
+		return nil, fmt.Errorf("failed to start player %q: %w", p.Command, err)
+	}
+	return cmd, nil
+}
@@ -0,0 +1,186 @@
+package relay
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// playlistContentType is the content type of relayed HLS playlists.
+const playlistContentType = "application/vnd.apple.mpegurl"
+
+// forwardedHeaders are the headers of upstream responses which are passed on
+// to the player.
+var forwardedHeaders = []string{
+	"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges",
+	"Cache-Control", "Last-Modified", "ETag",
+}
+
+// reUriAttribute matches the URI attributes of HLS tags, e.g. of EXT-X-MEDIA,
+// EXT-X-KEY or EXT-X-MAP.
+var reUriAttribute = regexp.MustCompile(`URI="([^"]*)"`)
+
+// Relay re-serves an HLS stream, i.e. its playlists and segments, fetching them
+// with the given HTTP client, e.g. to play a recording in a player which does
+// not have the client's session. Playlists are rewritten such that all URIs in
+// them point to the relay. Only hosts from which the relay served a playlist
+// are relayed, such that the relay cannot be used as an open proxy.
+type Relay struct {
+	client      *http.Client
+	prefix      string
+	playlistUrl *url.URL
+
+	mu    sync.Mutex
+	hosts map[string]bool
+}
+
+// New creates a relay of the HLS stream with the given playlist URL, served
+// under the given URL path prefix.
+func New(client *http.Client, prefix, playlistUrl string) (*Relay, error) {
+	u, err := url.Parse(playlistUrl)
+	if nil != err {
+		return nil, fmt.Errorf("failed to parse playlist URL: %w", err)
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("cannot relay %q URLs", u.Scheme)
+	}
+	return &Relay{
+		client:      client,
+		prefix:      strings.TrimSuffix(prefix, "/"),
+		playlistUrl: u,
+		hosts:       map[string]bool{u.Host: true},
+	}, nil
+}
+
+// PlaylistPath returns the URL path and query of the relayed playlist.
+func (r *Relay) PlaylistPath() string {
+	return r.path(r.playlistUrl)
+}
+
+// path returns the URL path and query under which the relay serves the given
+// upstream URL. The path ends with the name of the upstream file, such that
+// players can tell playlists and segments apart by their extension.
+func (r *Relay) path(upstream *url.URL) string {
+	name := path.Base(upstream.Path)
+	if name == "/" || name == "." {
+		name = "index"
+	}
+	return r.prefix + "/" + url.PathEscape(name) + "?u=" + url.QueryEscape(upstream.String())
+}
+
+func (r *Relay) allowed(u *url.URL) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.hosts[u.Host]
+}
+
+func (r *Relay) allow(u *url.URL) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hosts[u.Host] = true
+}
+
+// ServeHTTP relays the upstream URL in the "u" query parameter.
+func (r *Relay) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	upstream, err := url.Parse(req.URL.Query().Get("u"))
+	if nil != err || (upstream.Scheme != "http" && upstream.Scheme != "https") {
+		http.Error(w, "invalid upstream URL", http.StatusBadRequest)
+		return
+	} else if !r.allowed(upstream) {
+		http.Error(w, "upstream host not allowed", http.StatusForbidden)
+		return
+	}
+
+	upstreamReq, err := http.NewRequestWithContext(req.Context(), http.MethodGet, upstream.String(), nil)
+	if nil != err {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if rng := req.Header.Get("Range"); rng != "" {
+		upstreamReq.Header.Set("Range", rng)
+	}
+	resp, err := r.client.Do(upstreamReq)
+	if nil != err {
+		http.Error(w, fmt.Sprintf("failed to fetch upstream: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK && isPlaylist(upstream, resp) {
+		r.servePlaylist(w, upstream, resp.Body)
+		return
+	}
+
+	for _, header := range forwardedHeaders {
+		if value := resp.Header.Get(header); value != "" {
+			w.Header().Set(header, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// servePlaylist serves the given playlist with all URIs pointing to the relay.
+func (r *Relay) servePlaylist(w http.ResponseWriter, upstream *url.URL, body io.Reader) {
+	data, err := io.ReadAll(body)
+	if nil != err {
+		http.Error(w, fmt.Sprintf("failed to read playlist: %v", err), http.StatusBadGateway)
+		return
+	}
+	rewritten := r.rewritePlaylist(upstream, data)
+	w.Header().Set("Content-Type", playlistContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	w.Write(rewritten)
+}
+
+// rewritePlaylist rewrites the URIs of the playlist at the given upstream URL
+// to point to the relay.
+func (r *Relay) rewritePlaylist(upstream *url.URL, playlist []byte) []byte {
+	var out bytes.Buffer
+	s := bufio.NewScanner(bytes.NewReader(playlist))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#"):
+			line = reUriAttribute.ReplaceAllStringFunc(line, func(attr string) string {
+				uri := reUriAttribute.FindStringSubmatch(attr)[1]
+				return `URI="` + r.rewriteUri(upstream, uri) + `"`
+			})
+		default:
+			line = r.rewriteUri(upstream, line)
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
+
+// rewriteUri returns the relay path of the given URI, resolved relative to the
+// URL of the playlist it appears in. Non-HTTP URIs, e.g. of keys, are kept.
+func (r *Relay) rewriteUri(playlist *url.URL, uri string) string {
+	ref, err := url.Parse(uri)
+	if nil != err {
+		return uri
+	}
+	resolved := playlist.ResolveReference(ref)
+	if resolved.Scheme != "http" && resolved.Scheme != "https" {
+		return uri
+	}
+	r.allow(resolved)
+	return r.path(resolved)
+}
+
+// isPlaylist tells whether the response to the request for the given URL is
+// an HLS playlist.
+func isPlaylist(u *url.URL, resp *http.Response) bool {
+	contentType := strings.ToLower(resp.Header.Get("Content-Type"))
+	return strings.Contains(contentType, "mpegurl") || strings.HasSuffix(u.Path, ".m3u8")
+}
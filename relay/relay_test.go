@@ -0,0 +1,141 @@
+package relay
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestRelay_rewritePlaylist(t *testing.T) {
+	r, err := New(http.DefaultClient, "/play/", "https://cdn.example.com/rec/master.m3u8?token=abc")
+	if nil != err {
+		t.Fatalf("New() failed: %v", err)
+	}
+	upstream, _ := url.Parse("https://cdn.example.com/rec/master.m3u8?token=abc")
+	playlist := `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aud",NAME="de",URI="audio/de.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=5000000,AUDIO="aud"
+
+video/720.m3u8?token=abc
+#EXT-X-KEY:METHOD=SAMPLE-AES,URI="skd://key"
+https://other.example.com/seg-1.ts
+`
+
+	want := `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aud",NAME="de",URI="/play/de.m3u8?u=https%3A%2F%2Fcdn.example.com%2Frec%2Faudio%2Fde.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=5000000,AUDIO="aud"
+
+/play/720.m3u8?u=https%3A%2F%2Fcdn.example.com%2Frec%2Fvideo%2F720.m3u8%3Ftoken%3Dabc
+#EXT-X-KEY:METHOD=SAMPLE-AES,URI="skd://key"
+/play/seg-1.ts?u=https%3A%2F%2Fother.example.com%2Fseg-1.ts
+`
+	if got := string(r.rewritePlaylist(upstream, []byte(playlist))); got != want {
+		t.Errorf("rewritePlaylist() = %s, want %s", got, want)
+	}
+	if !r.hosts["other.example.com"] {
+		t.Error("rewritePlaylist() did not allow the host of a segment")
+	}
+	if got, want := r.PlaylistPath(), "/play/master.m3u8?u=https%3A%2F%2Fcdn.example.com%2Frec%2Fmaster.m3u8%3Ftoken%3Dabc"; got != want {
+		t.Errorf("PlaylistPath() = %q, want %q", got, want)
+	}
+}
+
+func TestRelay_ServeHTTP(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rec/master.m3u8":
+			w.Header().Set("Content-Type", "application/x-mpegURL")
+			io.WriteString(w, "#EXTM3U\n#EXTINF:4.0,\nseg-1.ts\n")
+		case "/rec/seg-1.ts":
+			w.Header().Set("Content-Type", "video/mp2t")
+			io.WriteString(w, "segment data "+r.Header.Get("Range"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+
+	r, err := New(upstream.Client(), "/play", upstream.URL+"/rec/master.m3u8")
+	if nil != err {
+		t.Fatalf("New() failed: %v", err)
+	}
+	relay := httptest.NewServer(r)
+	defer relay.Close()
+
+	tests := []struct {
+		name            string // description of this test case
+		path            string
+		header          http.Header
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "Playlist",
+			path:            r.PlaylistPath(),
+			wantStatus:      http.StatusOK,
+			wantContentType: playlistContentType,
+			wantBody:        "#EXTM3U\n#EXTINF:4.0,\n/play/seg-1.ts?u=" + url.QueryEscape(upstream.URL+"/rec/seg-1.ts") + "\n",
+		},
+		{
+			name:            "Segment",
+			path:            "/play/seg-1.ts?u=" + url.QueryEscape(upstream.URL+"/rec/seg-1.ts"),
+			header:          http.Header{"Range": {"bytes=0-3"}},
+			wantStatus:      http.StatusOK,
+			wantContentType: "video/mp2t",
+			wantBody:        "segment data bytes=0-3",
+		},
+		{
+			name:       "UpstreamNotFound",
+			path:       "/play/missing.ts?u=" + url.QueryEscape(upstream.URL+"/rec/missing.ts"),
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "HostNotAllowed",
+			path:       "/play/seg.ts?u=" + url.QueryEscape("https://elsewhere.example.com/seg.ts"),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "InvalidUrl",
+			path:       "/play/seg.ts?u=file%3A%2F%2F%2Fetc%2Fpasswd",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, relay.URL+tt.path, nil)
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+			resp, err := relay.Client().Do(req)
+			if nil != err {
+				t.Fatalf("Get() failed: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("Get() status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got := resp.Header.Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Get() content type = %q, want %q", got, tt.wantContentType)
+			}
+			if string(body) != tt.wantBody {
+				t.Errorf("Get() body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestNew_InvalidUrl(t *testing.T) {
+	for _, u := range []string{"file:///etc/passwd", "://"} {
+		if _, err := New(http.DefaultClient, "/play", u); nil == err {
+			t.Errorf("New(%q) succeeded unexpectedly", u)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/rokeller/zt-dl/ffmpeg"
+)
+
+type libraryApiController struct {
+	*server
+}
+
+func AddLibraryApi(s *server, api *mux.Router) {
+	r := api.PathPrefix("/library").Subrouter()
+	c := libraryApiController{s}
+	r.HandleFunc("", c.listAll).Methods(http.MethodGet)
+	r.HandleFunc("/{recordingId}/thumbnail", c.thumbnail).Methods(http.MethodGet)
+}
+
+func (c libraryApiController) listAll(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(c.library.List())
+}
+
+// thumbnail serves the contact sheet of the downloaded recording, which is the
+// contact sheet of the first part of split outputs.
+func (c libraryApiController) thumbnail(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	recordingIdStr := vars["recordingId"]
+
+	// Errors are reported as JSON, the contact sheet is served as JPEG.
+	w.Header().Set("content-type", "application/json")
+	j := json.NewEncoder(w)
+
+	recordingId, err := strconv.ParseInt(recordingIdStr, 10, 64)
+	if nil != err {
+		w.WriteHeader(400)
+		j.Encode(map[string]any{
+			"code": "error_parsing_recordingId",
+			"err":  err.Error(),
+		})
+		return
+	}
+
+	entry, found := c.library.Get(recordingId)
+	if !found {
+		w.WriteHeader(404)
+		j.Encode(map[string]any{
+			"code": "recording_not_downloaded",
+		})
+		return
+	}
+
+	outputPath := entry.OutputPath
+	if len(entry.Parts) > 0 {
+		outputPath = entry.Parts[0]
+	}
+	f, err := os.Open(ffmpeg.ContactSheetPath(outputPath))
+	if errors.Is(err, fs.ErrNotExist) {
+		w.WriteHeader(404)
+		j.Encode(map[string]any{
+			"code": "thumbnail_not_found",
+		})
+		return
+	} else if nil != err {
+		w.WriteHeader(500)
+		j.Encode(map[string]any{
+			"code": "error_reading_thumbnail",
+			"err":  err.Error(),
+		})
+		return
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if nil != err {
+		w.WriteHeader(500)
+		j.Encode(map[string]any{
+			"code": "error_reading_thumbnail",
+			"err":  err.Error(),
+		})
+		return
+	}
+	w.Header().Set("content-type", "image/jpeg")
+	http.ServeContent(w, r, stat.Name(), stat.ModTime(), f)
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func Test_libraryApiController_thumbnail(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "movie.contact.jpg"), []byte("jpeg"), 0o644)
+	os.WriteFile(filepath.Join(dir, "show.part01.contact.jpg"), []byte("part jpeg"), 0o644)
+
+	s := &server{library: newLibrary()}
+	s.library.Add(libraryEntry{RecordingId: 1, OutputPath: filepath.Join(dir, "movie.mkv")})
+	s.library.Add(libraryEntry{
+		RecordingId: 2,
+		OutputPath:  filepath.Join(dir, "show.mkv"),
+		Parts:       []string{filepath.Join(dir, "show.part01.mkv"), filepath.Join(dir, "show.part02.mkv")},
+	})
+	s.library.Add(libraryEntry{RecordingId: 3, OutputPath: filepath.Join(dir, "radio.mka")})
+
+	tests := []struct {
+		name            string
+		recordingId     string
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "Status400/MalformedRecordingId",
+			recordingId:     "not-an-int",
+			wantStatus:      400,
+			wantContentType: "application/json",
+			wantBody: `{"code":"error_parsing_recordingId","err":"strconv.ParseInt: parsing \"not-an-int\": invalid syntax"}
+`,
+		},
+		{
+			name:            "Status404/NotDownloaded",
+			recordingId:     "4",
+			wantStatus:      404,
+			wantContentType: "application/json",
+			wantBody: `{"code":"recording_not_downloaded"}
+`,
+		},
+		{
+			name:            "Status404/NoContactSheet",
+			recordingId:     "3",
+			wantStatus:      404,
+			wantContentType: "application/json",
+			wantBody: `{"code":"thumbnail_not_found"}
+`,
+		},
+		{
+			name:            "Status200",
+			recordingId:     "1",
+			wantStatus:      200,
+			wantContentType: "image/jpeg",
+			wantBody:        "jpeg",
+		},
+		{
+			name:            "Status200/FirstPart",
+			recordingId:     "2",
+			wantStatus:      200,
+			wantContentType: "image/jpeg",
+			wantBody:        "part jpeg",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := libraryApiController{s}
+			r, _ := http.NewRequest(http.MethodGet, "blah", nil)
+			r = mux.SetURLVars(r, map[string]string{
+				"recordingId": tt.recordingId,
+			})
+			w := httptest.NewRecorder()
+			c.thumbnail(w, r)
+
+			if w.Result().StatusCode != tt.wantStatus {
+				t.Errorf("response status got %d, want %d", w.Result().StatusCode, tt.wantStatus)
+			}
+			if got := w.Result().Header.Get("content-type"); got != tt.wantContentType {
+				t.Errorf("response content type got %q, want %q", got, tt.wantContentType)
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("response body got %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
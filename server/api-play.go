@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rokeller/zt-dl/relay"
+)
+
+type playApiController struct {
+	*server
+}
+
+// relayIdleTimeout is how long a relay is kept after it was last used.
+const relayIdleTimeout = 30 * time.Minute
+
+// relays keeps the HLS relay of each recording which is being played. Relays
+// which were not used for a while are evicted.
+type relays struct {
+	mu      sync.Mutex
+	entries map[int64]*relayEntry
+}
+
+type relayEntry struct {
+	relay    *relay.Relay
+	lastUsed time.Time
+}
+
+func newRelays() *relays {
+	return &relays{entries: map[int64]*relayEntry{}}
+}
+
+// Put sets the relay of the recording, replacing an earlier one, e.g. with an
+// expired stream URL.
+func (r *relays) Put(recordingId int64, rl *relay.Relay) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.evictIdle(now)
+	r.entries[recordingId] = &relayEntry{relay: rl, lastUsed: now}
+}
+
+// Get returns the relay of the recording, if any.
+func (r *relays) Get(recordingId int64) (*relay.Relay, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.evictIdle(now)
+	entry, found := r.entries[recordingId]
+	if !found {
+		return nil, false
+	}
+	entry.lastUsed = now
+	return entry.relay, true
+}
+
+// evictIdle removes the relays which were not used within relayIdleTimeout.
+func (r *relays) evictIdle(now time.Time) {
+	for recordingId, entry := range r.entries {
+		if now.Sub(entry.lastUsed) > relayIdleTimeout {
+			delete(r.entries, recordingId)
+		}
+	}
+}
+
+// playResult holds the URL of the relayed stream of a recording.
+type playResult struct {
+	Url string `json:"url"`
+	// Launched tells whether the configured player was started.
+	Launched bool `json:"launched"`
+}
+
+func AddPlayApi(s *server, api *mux.Router) {
+	c := playApiController{s}
+	api.HandleFunc("/recordings/{recordingId}/play", c.play).Methods(http.MethodPost)
+	api.HandleFunc("/play/{recordingId}/{name}", c.relay).Methods(http.MethodGet)
+}
+
+// play relays the stream of the recording and optionally starts the player.
+func (c playApiController) play(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	recordingIdStr := vars["recordingId"]
+
+	w.Header().Add("content-type", "application/json")
+	j := json.NewEncoder(w)
+
+	recordingId, err := strconv.ParseInt(recordingIdStr, 10, 64)
+	if nil != err {
+		w.WriteHeader(400)
+		j.Encode(map[string]any{
+			"code": "error_parsing_recordingId",
+			"err":  err.Error(),
+		})
+		return
+	}
+
+	if err := r.ParseForm(); nil != err {
+		w.WriteHeader(400)
+		j.Encode(map[string]any{
+			"code": "error_parsing_body",
+			"err":  err.Error(),
+		})
+		return
+	}
+
+	launch := false
+	if value := r.FormValue("launch"); value != "" {
+		launch, err = strconv.ParseBool(value)
+		if nil != err {
+			w.WriteHeader(400)
+			j.Encode(map[string]any{
+				"code": "error_parsing_launch",
+				"err":  err.Error(),
+			})
+			return
+		}
+	}
+	if launch && c.player.IsZero() {
+		w.WriteHeader(400)
+		j.Encode(map[string]any{
+			"code": "no_player_configured",
+		})
+		return
+	}
+
+	streamUrl, err := c.a.GetRecordingStreamUrl(recordingId)
+	if nil != err {
+		w.WriteHeader(500)
+		j.Encode(map[string]any{
+			"code": "error_getting_stream_url",
+			"err":  err.Error(),
+		})
+		return
+	}
+
+	rl, err := relay.New(c.a.HttpClient(), fmt.Sprintf("/api/play/%d", recordingId), streamUrl)
+	if nil != err {
+		w.WriteHeader(500)
+		j.Encode(map[string]any{
+			"code": "error_relaying_stream",
+			"err":  err.Error(),
+		})
+		return
+	}
+	c.relays.Put(recordingId, rl)
+
+	res := playResult{Url: "http://" + r.Host + rl.PlaylistPath()}
+	if launch {
+		// The player outlives the request.
+		cmd, err := c.player.Start(context.WithoutCancel(r.Context()), res.Url)
+		if nil != err {
+			w.WriteHeader(500)
+			j.Encode(map[string]any{
+				"code": "error_starting_player",
+				"err":  err.Error(),
+			})
+			return
+		}
+		go func() {
+			if err := cmd.Wait(); nil != err {
+				fmt.Fprintf(os.Stderr, "Player exited with error: %v\n", err)
+			}
+		}()
+		res.Launched = true
+	}
+
+	w.WriteHeader(200)
+	j.Encode(res)
+}
+
+// relay serves the playlists and segments of a relayed stream.
+func (c playApiController) relay(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	recordingId, err := strconv.ParseInt(vars["recordingId"], 10, 64)
+	if nil != err {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rl, found := c.relays.Get(recordingId)
+	if !found {
+		http.Error(w, "recording is not being played", http.StatusNotFound)
+		return
+	}
+	rl.ServeHTTP(w, r)
+}
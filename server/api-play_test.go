@@ -0,0 +1,230 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	e "github.com/rokeller/zt-dl/exec"
+	"github.com/rokeller/zt-dl/relay"
+	"github.com/rokeller/zt-dl/test"
+	"github.com/rokeller/zt-dl/zattoo"
+)
+
+func Test_playApiController_play(t *testing.T) {
+	if test.IsTestCall() {
+		os.Exit(0)
+		return
+	}
+
+	me := test.CallerFuncName(0)
+	defer func(factory func(context.Context, string, ...string) *exec.Cmd) {
+		e.CmdFactory = factory
+	}(e.CmdFactory)
+	e.CmdFactory = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		return test.TestCommandContext(t, me, ctx, name, arg...)
+	}
+
+	playlistPath := "/api/play/1234/master.m3u8?u=" + url.QueryEscape("https://cdn/rec/master.m3u8")
+
+	tests := []struct {
+		name        string
+		recordingId string
+		form        url.Values
+		player      relay.Player
+		streamUrl   string
+		wantStatus  int
+		wantBody    string
+		wantRelay   bool
+	}{
+		{
+			name:        "Status400/InvalidRecordingId",
+			recordingId: "abc",
+			wantStatus:  400,
+			wantBody: `{"code":"error_parsing_recordingId","err":"strconv.ParseInt: parsing \"abc\": invalid syntax"}
+`,
+		},
+		{
+			name:        "Status400/InvalidLaunch",
+			recordingId: "1234",
+			form:        url.Values{"launch": {"maybe"}},
+			wantStatus:  400,
+			wantBody: `{"code":"error_parsing_launch","err":"strconv.ParseBool: parsing \"maybe\": invalid syntax"}
+`,
+		},
+		{
+			name:        "Status400/NoPlayerConfigured",
+			recordingId: "1234",
+			form:        url.Values{"launch": {"true"}},
+			streamUrl:   "https://cdn/rec/master.m3u8",
+			wantStatus:  400,
+			wantBody: `{"code":"no_player_configured"}
+`,
+		},
+		{
+			name:        "Status500/NoStreamUrl",
+			recordingId: "1234",
+			wantStatus:  500,
+			wantBody: `{"code":"error_getting_stream_url","err":"failed to get recording with status 404"}
+`,
+		},
+		{
+			name:        "Status500/UnsupportedStreamUrl",
+			recordingId: "1234",
+			streamUrl:   "rtmp://cdn/rec",
+			wantStatus:  500,
+			wantBody: `{"code":"error_relaying_stream","err":"cannot relay \"rtmp\" URLs"}
+`,
+		},
+		{
+			name:        "Status200",
+			recordingId: "1234",
+			streamUrl:   "https://cdn/rec/master.m3u8",
+			wantStatus:  200,
+			wantBody: `{"url":"http://localhost:8080` + playlistPath + `","launched":false}
+`,
+			wantRelay: true,
+		},
+		{
+			name:        "Status200/Launched",
+			recordingId: "1234",
+			form:        url.Values{"launch": {"true"}},
+			player:      relay.Player{Command: "mpv", Args: []string{"--fs"}},
+			streamUrl:   "https://cdn/rec/master.m3u8",
+			wantStatus:  200,
+			wantBody: `{"url":"http://localhost:8080` + playlistPath + `","launched":true}
+`,
+			wantRelay: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, client, host := test.NewHttpTestSetup(func(w http.ResponseWriter, r *http.Request) {
+				if r.RequestURI == "/zapi/watch/recording/1234" && tt.streamUrl != "" {
+					test.HttpResponse{
+						StatusCode: 200,
+						Body:       []byte(`{"success":true,"stream":{"url":"` + tt.streamUrl + `"}}`),
+					}.Respond(w)
+					return
+				}
+				w.Header().Add("x-reason", "unsupported-uri")
+				w.WriteHeader(404)
+			})
+			defer ts.Close()
+			s := &server{
+				a:      zattoo.NewAccountWithSession(t, host, client),
+				relays: newRelays(),
+			}
+			WithPlayer(tt.player)(s)
+			c := playApiController{s}
+
+			r, _ := http.NewRequest(http.MethodPost, "http://localhost:8080/api/recordings/"+tt.recordingId+"/play",
+				strings.NewReader(tt.form.Encode()))
+			r.Header.Set("content-type", "application/x-www-form-urlencoded")
+			r = mux.SetURLVars(r, map[string]string{
+				"recordingId": tt.recordingId,
+			})
+			w := httptest.NewRecorder()
+			c.play(w, r)
+			if w.Result().StatusCode != tt.wantStatus {
+				t.Errorf("response status got %d, want %d", w.Result().StatusCode, tt.wantStatus)
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("response body got %q, want %q", w.Body.String(), tt.wantBody)
+			}
+			if _, found := s.relays.Get(1234); found != tt.wantRelay {
+				t.Errorf("relay found got %v, want %v", found, tt.wantRelay)
+			}
+		})
+	}
+}
+
+func Test_relays_evictIdle(t *testing.T) {
+	rl, err := relay.New(http.DefaultClient, "/api/play/1234", "https://cdn/rec/master.m3u8")
+	if nil != err {
+		t.Fatalf("relay.New() failed: %v", err)
+	}
+	r := newRelays()
+	r.Put(1234, rl)
+	r.Put(5678, rl)
+	r.entries[1234].lastUsed = time.Now().Add(-relayIdleTimeout - time.Minute)
+
+	if _, found := r.Get(1234); found {
+		t.Errorf("relays.Get(1234) found idle relay, want evicted")
+	}
+	if _, found := r.Get(5678); !found {
+		t.Errorf("relays.Get(5678) did not find relay in use")
+	}
+	if len(r.entries) != 1 {
+		t.Errorf("relays kept %d entries, want 1", len(r.entries))
+	}
+}
+
+func Test_playApiController_relay(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp2t")
+		w.Write([]byte("segment"))
+	}))
+	defer upstream.Close()
+
+	s := &server{relays: newRelays()}
+	rl, err := relay.New(upstream.Client(), "/api/play/1234", upstream.URL+"/rec/seg-1.ts")
+	if nil != err {
+		t.Fatalf("relay.New() failed: %v", err)
+	}
+	s.relays.Put(1234, rl)
+	c := playApiController{s}
+
+	tests := []struct {
+		name        string
+		recordingId string
+		path        string
+		wantStatus  int
+		wantBody    string
+	}{
+		{
+			name:        "Status400",
+			recordingId: "abc",
+			path:        "/api/play/abc/seg-1.ts",
+			wantStatus:  400,
+			wantBody:    "strconv.ParseInt: parsing \"abc\": invalid syntax\n",
+		},
+		{
+			name:        "Status404",
+			recordingId: "5678",
+			path:        "/api/play/5678/seg-1.ts",
+			wantStatus:  404,
+			wantBody:    "recording is not being played\n",
+		},
+		{
+			name:        "Status200",
+			recordingId: "1234",
+			path:        rl.PlaylistPath(),
+			wantStatus:  200,
+			wantBody:    "segment",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest(http.MethodGet, "http://localhost:8080"+tt.path, nil)
+			r = mux.SetURLVars(r, map[string]string{
+				"recordingId": tt.recordingId,
+			})
+			w := httptest.NewRecorder()
+			c.relay(w, r)
+			if w.Result().StatusCode != tt.wantStatus {
+				t.Errorf("response status got %d, want %d", w.Result().StatusCode, tt.wantStatus)
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("response body got %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
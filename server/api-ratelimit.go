@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rokeller/zt-dl/ffmpeg"
+	"github.com/rokeller/zt-dl/ratelimit"
+)
+
+type rateLimitApiController struct {
+	*server
+}
+
+// rateLimitUpdate changes the rate limit of downloads. A missing or null
+// override clears the override, and a missing schedule keeps the schedule.
+type rateLimitUpdate struct {
+	Override *ratelimit.Rate     `json:"override"`
+	Schedule *ratelimit.Schedule `json:"schedule,omitempty"`
+}
+
+func AddRateLimitApi(s *server, api *mux.Router) {
+	c := rateLimitApiController{s}
+	api.HandleFunc("/ratelimit", c.get).Methods(http.MethodGet)
+	api.HandleFunc("/ratelimit", c.update).Methods(http.MethodPut)
+}
+
+func (c rateLimitApiController) state() *rateLimitState {
+	return &rateLimitState{
+		Limit:    c.limiter.Limit(),
+		Override: c.limiter.Override(),
+		Schedule: c.limiter.Schedule(),
+	}
+}
+
+func (c rateLimitApiController) get(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(c.state())
+}
+
+func (c rateLimitApiController) update(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("content-type", "application/json")
+	j := json.NewEncoder(w)
+
+	var update rateLimitUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); nil != err {
+		w.WriteHeader(400)
+		j.Encode(map[string]any{
+			"code": "error_parsing_body",
+			"err":  err.Error(),
+		})
+		return
+	}
+
+	// Limits need ffmpeg to download through the proxy of the limiter.
+	schedule := c.limiter.Schedule()
+	if nil != update.Schedule {
+		schedule = *update.Schedule
+	}
+	if nil != update.Override || !schedule.IsZero() {
+		if err := c.capabilities.Check([]ffmpeg.Feature{ffmpeg.RateLimitFeature}); nil != err {
+			w.WriteHeader(400)
+			j.Encode(map[string]any{
+				"code": "unsupported_by_ffmpeg",
+				"err":  err.Error(),
+			})
+			return
+		}
+	}
+
+	c.limiter.SetOverride(update.Override)
+	if nil != update.Schedule {
+		c.limiter.SetSchedule(*update.Schedule)
+	}
+
+	state := c.state()
+	c.hub.outbox <- serverEvent{RateLimitUpdated: state}
+	w.WriteHeader(200)
+	j.Encode(state)
+}
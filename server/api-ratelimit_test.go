@@ -0,0 +1,102 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rokeller/zt-dl/ffmpeg"
+	"github.com/rokeller/zt-dl/ratelimit"
+)
+
+func Test_rateLimitApiController_update(t *testing.T) {
+	tests := []struct {
+		name          string
+		capabilities  *ffmpeg.Capabilities
+		body          string
+		wantStatus    int
+		wantBody      string
+		wantBroadcast bool
+	}{
+		{
+			name:       "MalformedBody",
+			body:       `{ not json`,
+			wantStatus: 400,
+			wantBody: `{"code":"error_parsing_body","err":"invalid character 'n' looking for beginning of object key string"}
+`,
+		},
+		{
+			name:       "InvalidRate",
+			body:       `{"override":"fast"}`,
+			wantStatus: 400,
+			wantBody: `{"code":"error_parsing_body","err":"invalid rate \"fast\", use e.g. 500k or 2M"}
+`,
+		},
+		{
+			name:       "Override",
+			body:       `{"override":"1M"}`,
+			wantStatus: 200,
+			wantBody: `{"limit":1048576,"override":1048576,"schedule":{"limit":2097152}}
+`,
+			wantBroadcast: true,
+		},
+		{
+			name:       "ClearOverride",
+			body:       `{"override":null}`,
+			wantStatus: 200,
+			wantBody: `{"limit":2097152,"override":null,"schedule":{"limit":2097152}}
+`,
+			wantBroadcast: true,
+		},
+		{
+			name:       "Schedule",
+			body:       `{"schedule":{"limit":0,"rules":[{"from":"18:00","to":"18:00","limit":"500k"}]}}`,
+			wantStatus: 200,
+			wantBody: `{"limit":512000,"override":null,"schedule":{"limit":0,"rules":[{"from":"18:00","to":"18:00","limit":512000}]}}
+`,
+			wantBroadcast: true,
+		},
+		{
+			name:         "UnsupportedByFfmpeg",
+			capabilities: &ffmpeg.Capabilities{FfmpegPath: "ffmpeg", FfmpegVersion: "7.0"},
+			body:         `{"override":"1M"}`,
+			wantStatus:   400,
+			wantBody: `{"code":"unsupported_by_ffmpeg","err":"ffmpeg 7.0 does not support the protocol \"httpproxy\" needed for rate limiting downloads"}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &server{
+				hub:          newHub(),
+				limiter:      ratelimit.NewLimiter(ratelimit.Schedule{Limit: 2 * 1024 * 1024}),
+				capabilities: tt.capabilities,
+			}
+			c := rateLimitApiController{s}
+
+			r, _ := http.NewRequest(http.MethodPut, "blah", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			c.update(w, r)
+
+			if w.Result().StatusCode != tt.wantStatus {
+				t.Errorf("update() status = %d, want %d", w.Result().StatusCode, tt.wantStatus)
+			}
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("update() body = %s, want %s", got, tt.wantBody)
+			}
+			select {
+			case evt := <-s.hub.outbox:
+				if !tt.wantBroadcast {
+					t.Errorf("update() broadcast unexpected event %+v", evt)
+				} else if nil == evt.RateLimitUpdated {
+					t.Errorf("update() broadcast %+v, want rateLimitUpdated", evt)
+				}
+			default:
+				if tt.wantBroadcast {
+					t.Errorf("update() did not broadcast rateLimitUpdated")
+				}
+			}
+		})
+	}
+}
@@ -1,12 +1,18 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"path"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/rokeller/zt-dl/ffmpeg"
 )
 
 type recordingsApiController struct {
@@ -18,6 +24,7 @@ func AddRecordingsApi(s *server, api *mux.Router) {
 
 	c := recordingsApiController{s}
 	r.HandleFunc("/", c.listAll).Methods(http.MethodGet)
+	r.HandleFunc("/{recordingId}/streams", c.listStreams).Methods(http.MethodGet)
 	r.HandleFunc("/{recordingId}/enqueue", c.enqueueDownload).Methods(http.MethodPost)
 	r.HandleFunc("/{recordingId}/dequeue", c.dequeueDownload).Methods(http.MethodPost)
 }
@@ -39,6 +46,69 @@ func (c recordingsApiController) listAll(w http.ResponseWriter, r *http.Request)
 	j.Encode(recordings)
 }
 
+// streamDetectionTimeout is how long detecting the streams of a recording may
+// take.
+const streamDetectionTimeout = 30 * time.Second
+
+func (c recordingsApiController) listStreams(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	recordingIdStr := vars["recordingId"]
+
+	w.Header().Add("content-type", "application/json")
+	j := json.NewEncoder(w)
+
+	recordingId, err := strconv.ParseInt(recordingIdStr, 10, 64)
+	if nil != err {
+		w.WriteHeader(400)
+		j.Encode(map[string]any{
+			"code": "error_parsing_recordingId",
+			"err":  err.Error(),
+		})
+		return
+	}
+
+	info, found := c.probes.Get(recordingId)
+	if !found {
+		url, err := c.a.GetRecordingStreamUrl(recordingId)
+		if nil != err {
+			w.WriteHeader(500)
+			j.Encode(map[string]any{
+				"code": "error_getting_stream_url",
+				"err":  err.Error(),
+			})
+			return
+		}
+
+		// Detecting the streams may take longer than the server's write
+		// timeout allows.
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(streamDetectionTimeout + 15*time.Second))
+		ctx, cancel := context.WithTimeout(r.Context(), streamDetectionTimeout)
+		defer cancel()
+		d := ffmpeg.NewDownloadable(ffmpeg.StaticUrl(url), "", c.downloadableOptions...)
+		if err := d.DetectStreams(ctx); nil != err {
+			w.WriteHeader(500)
+			j.Encode(map[string]any{
+				"code": "error_detecting_streams",
+				"err":  err.Error(),
+			})
+			return
+		}
+		info = d.StreamInfo()
+		c.probes.Put(recordingId, info)
+	}
+
+	var selector ffmpeg.StreamsSelector
+	if nil != c.automaticSelectorFactory {
+		selector = c.automaticSelectorFactory()
+	}
+	w.WriteHeader(200)
+	j.Encode(recordingStreams{
+		Duration: info.Duration.String(),
+		Streams:  describeStreams(info.Streams, selector),
+		Warnings: info.Warnings,
+	})
+}
+
 func (c recordingsApiController) enqueueDownload(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	recordingIdStr := vars["recordingId"]
@@ -82,8 +152,121 @@ func (c recordingsApiController) enqueueDownload(w http.ResponseWriter, r *http.
 		return
 	}
 
+	var container ffmpeg.Container
+	if name := r.FormValue("container"); name != "" {
+		container, err = ffmpeg.ParseContainer(name)
+		if nil != err {
+			w.WriteHeader(400)
+			j.Encode(map[string]any{
+				"code": "unsupported_container",
+				"err":  err.Error(),
+			})
+			return
+		}
+	}
+
+	profile := r.FormValue("profile")
+	if profile != "" {
+		if _, err := ffmpeg.LookupProfile(profile, c.profiles); nil != err {
+			w.WriteHeader(400)
+			j.Encode(map[string]any{
+				"code": "unknown_profile",
+				"err":  err.Error(),
+			})
+			return
+		}
+	}
+
+	var subtitles ffmpeg.SubtitleMode
+	if name := r.FormValue("subtitles"); name != "" {
+		subtitles, err = ffmpeg.ParseSubtitleMode(name)
+		if nil != err {
+			w.WriteHeader(400)
+			j.Encode(map[string]any{
+				"code": "unsupported_subtitle_mode",
+				"err":  err.Error(),
+			})
+			return
+		}
+	}
+
+	audioOnly := false
+	if value := r.FormValue("audioOnly"); value != "" {
+		audioOnly, err = strconv.ParseBool(value)
+		if nil != err {
+			w.WriteHeader(400)
+			j.Encode(map[string]any{
+				"code": "error_parsing_audioOnly",
+				"err":  err.Error(),
+			})
+			return
+		}
+	}
+
+	var join []int64
+	if value := r.FormValue("join"); value != "" {
+		for _, idStr := range strings.Split(value, ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(idStr), 10, 64)
+			if nil != err {
+				w.WriteHeader(400)
+				j.Encode(map[string]any{
+					"code": "error_parsing_join",
+					"err":  err.Error(),
+				})
+				return
+			}
+			if id == recordingId || slices.Contains(join, id) {
+				w.WriteHeader(400)
+				j.Encode(map[string]any{
+					"code": "duplicate_join",
+					"err":  fmt.Sprintf("recording %d is joined more than once", id),
+				})
+				return
+			}
+			if c.dlq.InQueue(id) {
+				w.WriteHeader(409)
+				j.Encode(map[string]any{
+					"code": "recording_already_queued",
+				})
+				return
+			}
+			join = append(join, id)
+		}
+	}
+
+	trimOverlap := false
+	if value := r.FormValue("trimOverlap"); value != "" {
+		trimOverlap, err = strconv.ParseBool(value)
+		if nil != err {
+			w.WriteHeader(400)
+			j.Encode(map[string]any{
+				"code": "error_parsing_trimOverlap",
+				"err":  err.Error(),
+			})
+			return
+		}
+	}
+
+	if err := c.checkCapabilities(filename, container, profile, audioOnly, len(join) > 0); nil != err {
+		w.WriteHeader(400)
+		j.Encode(map[string]any{
+			"code": "unsupported_by_ffmpeg",
+			"err":  err.Error(),
+		})
+		return
+	}
+
 	outputPath := path.Join(c.outdir, filename)
-	c.dlq.Enqueue(recordingId, outputPath)
+	c.dlq.Enqueue(toDownload{
+		RecordingId: recordingId,
+		OutputPath:  outputPath,
+		Container:   container,
+		Profile:     profile,
+		Subtitles:   subtitles,
+		AudioOnly:   audioOnly,
+		Join:        join,
+		TrimOverlap: trimOverlap,
+	})
 
 	w.WriteHeader(200)
 	j.Encode(map[string]any{
@@ -115,3 +298,37 @@ func (c recordingsApiController) dequeueDownload(w http.ResponseWriter, r *http.
 		"result": true,
 	})
 }
+
+// checkCapabilities verifies that ffmpeg supports the features needed for a
+// download to the given file with the given container and profile, falling
+// back to the server's defaults like the download queue does.
+func (c recordingsApiController) checkCapabilities(
+	filename string,
+	container ffmpeg.Container,
+	profileName string,
+	audioOnly bool,
+	joined bool,
+) error {
+	if container == "" {
+		container = c.container
+	}
+	if container == "" {
+		container = ffmpeg.ContainerFromPath(filename)
+	}
+	if container == "" && audioOnly {
+		container = ffmpeg.ContainerMatroskaAudio
+	}
+	if profileName == "" {
+		profileName = c.profile
+	}
+	var profile *ffmpeg.TranscodingProfile
+	if profileName != "" {
+		p, err := ffmpeg.LookupProfile(profileName, c.profiles)
+		if nil != err {
+			return err
+		}
+		profile = &p
+	}
+	return c.capabilities.Check(ffmpeg.RequiredFeatures(container, profile,
+		ffmpeg.FeatureUsage{Join: joined, RateLimit: c.rateLimited()}))
+}
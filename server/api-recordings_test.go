@@ -2,13 +2,20 @@ package server
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"os/exec"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
+	e "github.com/rokeller/zt-dl/exec"
+	"github.com/rokeller/zt-dl/ffmpeg"
 	"github.com/rokeller/zt-dl/test"
 	"github.com/rokeller/zt-dl/zattoo"
 )
@@ -80,10 +87,153 @@ func Test_recordingsApiController_listAll(t *testing.T) {
 	}
 }
 
+func Test_recordingsApiController_listStreams(t *testing.T) {
+	if test.IsTestCall() {
+		args := test.GetArgs()
+		if args[len(args)-1] == "https://fails" {
+			os.Exit(1)
+		}
+		fmt.Println(`{
+	"format": { "duration": "5400.5" },
+	"streams": [
+	{
+		"index": 0,
+		"codec_type": "video",
+		"codec_name": "h264",
+		"width": 1280,
+		"height": 720,
+		"avg_frame_rate": "30000/1001",
+		"tags": { "variant_bitrate": "3000000" }
+	},
+	{
+		"index": 1,
+		"codec_type": "audio",
+		"codec_name": "aac",
+		"sample_rate": "",
+		"channels": 2,
+		"channel_layout": "stereo",
+		"tags": { "language": "deu" }
+	}
+]}`)
+		os.Exit(0)
+		return
+	}
+
+	me := test.CallerFuncName(0)
+	defer func(factory func(context.Context, string, ...string) *exec.Cmd) {
+		e.CmdFactory = factory
+	}(e.CmdFactory)
+	e.CmdFactory = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		return test.TestCommandContext(t, me, ctx, name, arg...)
+	}
+
+	tests := []struct {
+		name        string
+		recordingId string
+		streamUrl   string
+		selector    ffmpeg.StreamsSelector
+		cached      *ffmpeg.StreamInfo
+		wantStatus  int
+		wantBody    []byte
+	}{
+		{
+			name:        "Status400/MalformedRecordingId",
+			recordingId: "not-an-int",
+			wantStatus:  400,
+			wantBody: []byte(`{"code":"error_parsing_recordingId","err":"strconv.ParseInt: parsing \"not-an-int\": invalid syntax"}
+`),
+		},
+		{
+			name:        "Status500/StreamUrl",
+			recordingId: "1234",
+			wantStatus:  500,
+			wantBody: []byte(`{"code":"error_getting_stream_url","err":"failed to get recording with status 404"}
+`),
+		},
+		{
+			name:        "Status500/DetectStreams",
+			recordingId: "1234",
+			streamUrl:   "https://fails",
+			wantStatus:  500,
+			wantBody: []byte(`{"code":"error_detecting_streams","err":"failed to run ffprobe: exit status 1"}
+`),
+		},
+		{
+			name:        "Status200",
+			recordingId: "1234",
+			streamUrl:   "https://works",
+			wantStatus:  200,
+			wantBody: []byte(`{"duration":"1h30m0.5s","streams":[{"index":0,"type":"Video","desc":"h264, dimensions 1280x720, bit rate 3000000bps, avg frame rate 29.97fps (stream #0)"},{"index":1,"type":"Audio","desc":"aac, sample rate unknown, 2 channels (stereo), language \"deu\" (stream #1)"}],"warnings":["unknown sample rate \"\" of audio stream 1"]}
+`),
+		},
+		{
+			name:        "Status200/Preselected",
+			recordingId: "1234",
+			streamUrl:   "https://works",
+			selector:    ffmpeg.NewIndexStreamsSelector(1),
+			wantStatus:  200,
+			wantBody: []byte(`{"duration":"1h30m0.5s","streams":[{"index":0,"type":"Video","desc":"h264, dimensions 1280x720, bit rate 3000000bps, avg frame rate 29.97fps (stream #0)"},{"index":1,"type":"Audio","desc":"aac, sample rate unknown, 2 channels (stereo), language \"deu\" (stream #1)","selected":true}],"warnings":["unknown sample rate \"\" of audio stream 1"]}
+`),
+		},
+		{
+			name:        "Status200/Cached",
+			recordingId: "1234",
+			cached: &ffmpeg.StreamInfo{
+				Duration: time.Minute,
+				Streams:  []ffmpeg.SourceStream{&ffmpeg.SubtitleStream{Stream: ffmpeg.Stream{Index: 3, CodecName: "webvtt"}, Language: "de"}},
+			},
+			wantStatus: 200,
+			wantBody: []byte(`{"duration":"1m0s","streams":[{"index":3,"type":"Subtitle","desc":"webvtt, language \"de\" (stream #3)"}]}
+`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, client, host := test.NewHttpTestSetup(func(w http.ResponseWriter, r *http.Request) {
+				if r.RequestURI == "/zapi/watch/recording/1234" && tt.streamUrl != "" {
+					test.HttpResponse{
+						StatusCode: 200,
+						Body:       []byte(`{"success":true,"stream":{"url":"` + tt.streamUrl + `"}}`),
+					}.Respond(w)
+					return
+				}
+				w.Header().Add("x-reason", "unsupported-uri")
+				w.WriteHeader(404)
+			})
+			defer ts.Close()
+			s := &server{
+				a:      zattoo.NewAccountWithSession(t, host, client),
+				probes: newProbeCache(time.Hour),
+			}
+			if nil != tt.cached {
+				s.probes.Put(1234, *tt.cached)
+			}
+			if nil != tt.selector {
+				WithStreamsSelector(tt.selector)(s)
+			}
+			c := recordingsApiController{s}
+
+			r, _ := http.NewRequest(http.MethodGet, "blah", nil)
+			r = mux.SetURLVars(r, map[string]string{
+				"recordingId": tt.recordingId,
+			})
+			w := httptest.NewRecorder()
+			c.listStreams(w, r)
+			if w.Result().StatusCode != tt.wantStatus {
+				t.Errorf("response status got %d, want %d", w.Result().StatusCode, tt.wantStatus)
+			}
+			if w.Body.String() != string(tt.wantBody) {
+				t.Errorf("response body got %q, want %q", w.Body.String(), string(tt.wantBody))
+			}
+		})
+	}
+}
+
 func Test_recordingsApiController_enqueueDownload(t *testing.T) {
 	tests := []struct {
 		name               string
 		startQueue         []toDownload
+		capabilities       *ffmpeg.Capabilities
 		recordingId        string
 		requestContentType string
 		requestBody        []byte
@@ -120,7 +270,7 @@ func Test_recordingsApiController_enqueueDownload(t *testing.T) {
 		{
 			name: "Status409/AlreadyInQueue",
 			startQueue: []toDownload{
-				{111, "blah"},
+				{RecordingId: 111, OutputPath: "blah"},
 			},
 			recordingId:        "111",
 			requestContentType: "application/x-www-form-urlencoded",
@@ -129,7 +279,186 @@ func Test_recordingsApiController_enqueueDownload(t *testing.T) {
 			wantBody: []byte(`{"code":"recording_already_queued"}
 `),
 			wantQueue: []toDownload{
-				{111, "blah"},
+				{RecordingId: 111, OutputPath: "blah"},
+			},
+		},
+		{
+			name:               "Status400/UnsupportedContainer",
+			recordingId:        "4567",
+			requestContentType: "application/x-www-form-urlencoded",
+			requestBody:        []byte("filename=my-file&container=avi"),
+			wantStatus:         400,
+			wantBody: []byte(`{"code":"unsupported_container","err":"unsupported container \"avi\""}
+`),
+		},
+		{
+			name:               "Status400/UnknownProfile",
+			recordingId:        "4567",
+			requestContentType: "application/x-www-form-urlencoded",
+			requestBody:        []byte("filename=my-file.mkv&profile=unknown"),
+			wantStatus:         400,
+			wantBody: []byte(`{"code":"unknown_profile","err":"unknown transcoding profile \"unknown\" (available: [hevc-archive mobile-720p stereo-aac])"}
+`),
+		},
+		{
+			name: "Status400/UnsupportedByFfmpeg",
+			capabilities: &ffmpeg.Capabilities{
+				FfmpegPath:    "ffmpeg",
+				FfmpegVersion: "7.0",
+				Protocols:     []string{"https", "tls", "tcp", "httpproxy"},
+				Demuxers:      []string{"hls"},
+				Muxers:        []string{"matroska"},
+			},
+			recordingId:        "4567",
+			requestContentType: "application/x-www-form-urlencoded",
+			requestBody:        []byte("filename=my-file.mkv&profile=hevc-archive"),
+			wantStatus:         400,
+			wantBody: []byte(`{"code":"unsupported_by_ffmpeg","err":"ffmpeg 7.0 does not support the encoder \"libx265\" needed for the video of the transcoding profile"}
+`),
+		},
+		{
+			name:               "Status200/WithProfile",
+			recordingId:        "6789",
+			requestContentType: "application/x-www-form-urlencoded",
+			requestBody:        []byte("filename=my-file.mkv&profile=hevc-archive"),
+			wantStatus:         200,
+			wantBody: []byte(`{"result":true}
+`),
+			wantQueue: []toDownload{
+				{RecordingId: 6789, OutputPath: "/tmp/test/my-file.mkv", Profile: "hevc-archive"},
+			},
+			wantEvents: []serverEvent{
+				{QueueUpdated: &eventQueueUpdated{Queue: []toDownload{
+					{RecordingId: 6789, OutputPath: "/tmp/test/my-file.mkv", Profile: "hevc-archive"},
+				}}},
+			},
+		},
+		{
+			name:               "Status400/UnsupportedSubtitleMode",
+			recordingId:        "4567",
+			requestContentType: "application/x-www-form-urlencoded",
+			requestBody:        []byte("filename=my-file.mkv&subtitles=burn"),
+			wantStatus:         400,
+			wantBody: []byte(`{"code":"unsupported_subtitle_mode","err":"unsupported subtitle mode \"burn\""}
+`),
+		},
+		{
+			name:               "Status200/WithSubtitleMode",
+			recordingId:        "7890",
+			requestContentType: "application/x-www-form-urlencoded",
+			requestBody:        []byte("filename=my-file.mkv&subtitles=sidecar"),
+			wantStatus:         200,
+			wantBody: []byte(`{"result":true}
+`),
+			wantQueue: []toDownload{
+				{RecordingId: 7890, OutputPath: "/tmp/test/my-file.mkv", Subtitles: ffmpeg.SubtitlesSidecar},
+			},
+			wantEvents: []serverEvent{
+				{QueueUpdated: &eventQueueUpdated{Queue: []toDownload{
+					{RecordingId: 7890, OutputPath: "/tmp/test/my-file.mkv", Subtitles: ffmpeg.SubtitlesSidecar},
+				}}},
+			},
+		},
+		{
+			name:               "Status400/MalformedAudioOnly",
+			recordingId:        "4567",
+			requestContentType: "application/x-www-form-urlencoded",
+			requestBody:        []byte("filename=my-file.mka&audioOnly=maybe"),
+			wantStatus:         400,
+			wantBody: []byte(`{"code":"error_parsing_audioOnly","err":"strconv.ParseBool: parsing \"maybe\": invalid syntax"}
+`),
+		},
+		{
+			name:               "Status200/AudioOnly",
+			recordingId:        "8901",
+			requestContentType: "application/x-www-form-urlencoded",
+			requestBody:        []byte("filename=my-file.m4a&audioOnly=true"),
+			wantStatus:         200,
+			wantBody: []byte(`{"result":true}
+`),
+			wantQueue: []toDownload{
+				{RecordingId: 8901, OutputPath: "/tmp/test/my-file.m4a", AudioOnly: true},
+			},
+			wantEvents: []serverEvent{
+				{QueueUpdated: &eventQueueUpdated{Queue: []toDownload{
+					{RecordingId: 8901, OutputPath: "/tmp/test/my-file.m4a", AudioOnly: true},
+				}}},
+			},
+		},
+		{
+			name:               "Status200/WithContainer",
+			recordingId:        "5678",
+			requestContentType: "application/x-www-form-urlencoded",
+			requestBody:        []byte("filename=my-file&container=mkv"),
+			wantStatus:         200,
+			wantBody: []byte(`{"result":true}
+`),
+			wantQueue: []toDownload{
+				{RecordingId: 5678, OutputPath: "/tmp/test/my-file", Container: ffmpeg.ContainerMatroska},
+			},
+			wantEvents: []serverEvent{
+				{QueueUpdated: &eventQueueUpdated{Queue: []toDownload{
+					{RecordingId: 5678, OutputPath: "/tmp/test/my-file", Container: ffmpeg.ContainerMatroska},
+				}}},
+			},
+		},
+		{
+			name:               "Status400/MalformedJoin",
+			recordingId:        "4567",
+			requestContentType: "application/x-www-form-urlencoded",
+			requestBody:        []byte("filename=my-file.mkv&join=12,abc"),
+			wantStatus:         400,
+			wantBody: []byte(`{"code":"error_parsing_join","err":"strconv.ParseInt: parsing \"abc\": invalid syntax"}
+`),
+		},
+		{
+			name:               "Status400/DuplicateJoin",
+			recordingId:        "4567",
+			requestContentType: "application/x-www-form-urlencoded",
+			requestBody:        []byte("filename=my-file.mkv&join=4567"),
+			wantStatus:         400,
+			wantBody: []byte(`{"code":"duplicate_join","err":"recording 4567 is joined more than once"}
+`),
+		},
+		{
+			name: "Status409/JoinAlreadyInQueue",
+			startQueue: []toDownload{
+				{RecordingId: 111, OutputPath: "blah"},
+			},
+			recordingId:        "4567",
+			requestContentType: "application/x-www-form-urlencoded",
+			requestBody:        []byte("filename=my-file.mkv&join=111"),
+			wantStatus:         409,
+			wantBody: []byte(`{"code":"recording_already_queued"}
+`),
+			wantQueue: []toDownload{
+				{RecordingId: 111, OutputPath: "blah"},
+			},
+		},
+		{
+			name:               "Status400/MalformedTrimOverlap",
+			recordingId:        "4567",
+			requestContentType: "application/x-www-form-urlencoded",
+			requestBody:        []byte("filename=my-file.mkv&join=12&trimOverlap=maybe"),
+			wantStatus:         400,
+			wantBody: []byte(`{"code":"error_parsing_trimOverlap","err":"strconv.ParseBool: parsing \"maybe\": invalid syntax"}
+`),
+		},
+		{
+			name:               "Status200/Join",
+			recordingId:        "9012",
+			requestContentType: "application/x-www-form-urlencoded",
+			requestBody:        []byte("filename=my-file.mkv&join=9013,+9014&trimOverlap=true"),
+			wantStatus:         200,
+			wantBody: []byte(`{"result":true}
+`),
+			wantQueue: []toDownload{
+				{RecordingId: 9012, OutputPath: "/tmp/test/my-file.mkv", Join: []int64{9013, 9014}, TrimOverlap: true},
+			},
+			wantEvents: []serverEvent{
+				{QueueUpdated: &eventQueueUpdated{Queue: []toDownload{
+					{RecordingId: 9012, OutputPath: "/tmp/test/my-file.mkv", Join: []int64{9013, 9014}, TrimOverlap: true},
+				}}},
 			},
 		},
 		{
@@ -153,8 +482,9 @@ func Test_recordingsApiController_enqueueDownload(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			s := &server{
-				hub:    newHub(),
-				outdir: "/tmp/test",
+				hub:          newHub(),
+				outdir:       "/tmp/test",
+				capabilities: tt.capabilities,
 			}
 			s.dlq = newDownloadQueue(s)
 			if nil != tt.startQueue {
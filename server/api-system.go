@@ -0,0 +1,37 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+
+	"github.com/gorilla/mux"
+	"github.com/rokeller/zt-dl/ffmpeg"
+)
+
+type systemApiController struct {
+	*server
+}
+
+// systemInfo describes the system zt-dl runs on. Ffmpeg is null if the
+// capabilities of ffmpeg were not detected.
+type systemInfo struct {
+	Os     string               `json:"os"`
+	Arch   string               `json:"arch"`
+	Ffmpeg *ffmpeg.Capabilities `json:"ffmpeg"`
+}
+
+func AddSystemApi(s *server, api *mux.Router) {
+	c := systemApiController{s}
+	api.HandleFunc("/system", c.get).Methods(http.MethodGet)
+}
+
+func (c systemApiController) get(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(systemInfo{
+		Os:     runtime.GOOS,
+		Arch:   runtime.GOARCH,
+		Ffmpeg: c.capabilities,
+	})
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/rokeller/zt-dl/ffmpeg"
+)
+
+func Test_systemApiController_get(t *testing.T) {
+	tests := []struct {
+		name         string
+		capabilities *ffmpeg.Capabilities
+		wantFfmpeg   string
+	}{
+		{
+			name:       "NotDetected",
+			wantFfmpeg: "null",
+		},
+		{
+			name: "Detected",
+			capabilities: &ffmpeg.Capabilities{
+				FfmpegPath:     "/usr/bin/ffmpeg",
+				FfmpegVersion:  "7.0",
+				FfprobePath:    "/usr/bin/ffprobe",
+				FfprobeVersion: "7.0",
+				Protocols:      []string{"https"},
+				Muxers:         []string{"matroska"},
+				Encoders:       []string{"aac"},
+			},
+			wantFfmpeg: `{"ffmpegPath":"/usr/bin/ffmpeg","ffmpegVersion":"7.0","ffprobePath":"/usr/bin/ffprobe","ffprobeVersion":"7.0","protocols":["https"],"demuxers":null,"muxers":["matroska"],"encoders":["aac"],"filters":null}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := systemApiController{&server{capabilities: tt.capabilities}}
+
+			r, _ := http.NewRequest(http.MethodGet, "blah", nil)
+			w := httptest.NewRecorder()
+			c.get(w, r)
+
+			if w.Result().StatusCode != 200 {
+				t.Errorf("get() status = %d, want 200", w.Result().StatusCode)
+			}
+			want := fmt.Sprintf(`{"os":%q,"arch":%q,"ffmpeg":%s}
+`, runtime.GOOS, runtime.GOARCH, tt.wantFfmpeg)
+			if got := w.Body.String(); got != want {
+				t.Errorf("get() body = %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 import Box from '@mui/material/Box';
 import Typography from '@mui/material/Typography';
 import type { ProgressUpdatedEvent } from '../models';
+import { formatRate, formatSize } from '../utils';
 import ProgressWithLabel from './ProgressWithLabel';
 
 interface DownloadProgressProps {
@@ -19,6 +20,18 @@ export function DownloadProgress({ filename, progress }: DownloadProgressProps)
                 <Typography>{progress.remaining}</Typography>
                 <Typography variant='caption'>Remaining</Typography>
             </Box>
+            {progress.estimatedSize ?
+                <Box>
+                    <Typography>~{formatSize(progress.estimatedSize)}</Typography>
+                    <Typography variant='caption'>Estimated size</Typography>
+                </Box> : null
+            }
+            {progress.rate ?
+                <Box>
+                    <Typography>{formatRate(progress.rate)}</Typography>
+                    <Typography variant='caption'>Limit: {formatRate(progress.rateLimit || 0)}</Typography>
+                </Box> : null
+            }
             <Box sx={{ flexGrow: 1, }}>
                 <Typography variant='caption'>{filename}</Typography>
                 <ProgressWithLabel percentage={(progress.completed || 0) * 100} />
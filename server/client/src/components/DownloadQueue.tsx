@@ -5,13 +5,14 @@ import { useSnackbar } from 'notistack';
 import React from 'react';
 import type {
     ClientEvent, DownloadStartedEvent, PendingDownload, ProgressUpdatedEvent,
-    ServerEvent, SourceStream, StateUpdatedEvent
+    ServerEvent, SourceStream, StateUpdatedEvent, SubtitleMode
 } from '../models';
+import { formatRate, formatSize } from '../utils';
 import { DownloadProgress } from './DownloadProgress';
 import { QueueFabMenu } from './QueueFabMenu';
 import { StreamSelectionDialog } from './StreamSelectionDialog';
 
-type SourceStreamsSelectedHandler = (streams: SourceStream[]) => void;
+type SourceStreamsSelectedHandler = (streams: SourceStream[], subtitles: SubtitleMode) => void;
 
 function noopSourceStreamSelectionHandler() { }
 
@@ -23,14 +24,15 @@ function sendEvent(ws: WebSocket, e: ClientEvent) {
     ws.send(json);
 }
 
-function selectStreams(ws: WebSocket, correlation: string, streams: SourceStream[]) {
+function selectStreams(ws: WebSocket, correlation: string, streams: SourceStream[], subtitles: SubtitleMode) {
     streams = streams.map((s) => ({ index: s.index }));
-    sendEvent(ws, { correlation, streamsSelected: { streams } });
+    sendEvent(ws, { correlation, streamsSelected: { streams, subtitles } });
 }
 
 export function DownloadQueue() {
     const { enqueueSnackbar } = useSnackbar();
     const [pending, setPending] = React.useState<PendingDownload[]>([]);
+    const [pendingSize, setPendingSize] = React.useState<number>();
     const [progress, setProgress] = React.useState<ProgressUpdatedEvent>();
     const [downloading, setDownloading] = React.useState<DownloadStartedEvent>();
     const [state, setState] = React.useState<StateUpdatedEvent>();
@@ -60,28 +62,52 @@ export function DownloadQueue() {
             const e = JSON.parse(event.data) as ServerEvent;
             if (e.queueUpdated) {
                 setPending(e.queueUpdated.queue);
+                setPendingSize(e.queueUpdated.totalSize);
             } else if (e.downloadStarted) {
-                enqueueSnackbar(
-                    `Started download of "${e.downloadStarted.filename}" ...`,
-                    { variant: 'info', });
+                if (!e.downloadStarted.updated) {
+                    const size = e.downloadStarted.estimatedSize ?
+                        ` (~${formatSize(e.downloadStarted.estimatedSize)})` : '';
+                    enqueueSnackbar(
+                        `Started download of "${e.downloadStarted.filename}"${size} ...`,
+                        { variant: 'info', });
+                }
                 setDownloading(e.downloadStarted);
                 setState(undefined);
             } else if (e.progressUpdated) {
                 setProgress(e.progressUpdated);
                 setState(undefined);
             } else if (e.downloadErrored) {
+                const hint = e.downloadErrored.hint ? ` ${e.downloadErrored.hint}` : '';
                 enqueueSnackbar(
-                    `Download of "${e.downloadErrored.filename}" failed: ${e.downloadErrored.reason}`,
+                    `Download of "${e.downloadErrored.filename}" failed: ${e.downloadErrored.reason}.${hint}`,
                     { variant: 'error', });
+                if (e.downloadErrored.log) {
+                    console.error(`ffmpeg log for "${e.downloadErrored.filename}":\n${e.downloadErrored.log.join('\n')}`);
+                }
                 setState(undefined);
                 setProgress(undefined);
             } else if (e.stateUpdated) {
                 setState(e.stateUpdated);
                 setProgress(undefined);
+            } else if (e.hookFinished) {
+                if (e.hookFinished.err) {
+                    enqueueSnackbar(
+                        `Post-download hook for "${e.hookFinished.filename}" failed: ${e.hookFinished.err}`,
+                        { variant: 'warning', });
+                    console.warn(`post-download hook output for "${e.hookFinished.filename}":`, e.hookFinished.output);
+                } else {
+                    enqueueSnackbar(
+                        `Post-download hook for "${e.hookFinished.filename}" finished.`,
+                        { variant: 'info', });
+                }
+            } else if (e.rateLimitUpdated) {
+                enqueueSnackbar(
+                    `Download rate limit is now ${formatRate(e.rateLimitUpdated.limit)}.`,
+                    { variant: 'info', });
             } else if (e.selectStreams) {
                 setSourceStreams(e.selectStreams.streams);
-                const handler = (streams: SourceStream[]) => {
-                    selectStreams(websocket, e.correlation || '', streams);
+                const handler = (streams: SourceStream[], subtitles: SubtitleMode) => {
+                    selectStreams(websocket, e.correlation || '', streams, subtitles);
                     setOnSourceStreamsSelected(undefined);
                 }
                 setOnSourceStreamsSelected(() => handler);
@@ -111,7 +137,7 @@ export function DownloadQueue() {
                 open={onSourceStreamsSelected != undefined}
                 sourceStreams={sourceStreams}
                 onClose={onSourceStreamsSelected || noopSourceStreamSelectionHandler} />
-            <QueueFabMenu queue={pending} />
+            <QueueFabMenu queue={pending} totalSize={pendingSize} />
             {downloading ?
                 progress ?
                     <DownloadProgress filename={downloading.filename} progress={progress} /> :
@@ -7,9 +7,11 @@ import Typography from '@mui/material/Typography';
 import { useSnackbar } from 'notistack';
 import React from 'react';
 import type { PendingDownload } from '../models';
+import { formatSize } from '../utils';
 
 interface QueueFabMenuProps {
     queue?: PendingDownload[];
+    totalSize?: number;
 }
 
 function ellipsisStart(txt: string, maxLen: number) {
@@ -20,7 +22,7 @@ function ellipsisStart(txt: string, maxLen: number) {
     return '…' + txt.substring(txt.length - maxLen + 1);
 }
 
-export function QueueFabMenu({ queue }: QueueFabMenuProps) {
+export function QueueFabMenu({ queue, totalSize }: QueueFabMenuProps) {
     const { enqueueSnackbar } = useSnackbar();
     const [menuAnchorEl, setMenuAnchorEl] = React.useState<HTMLElement | null>(null);
     const fabId = React.useId();
@@ -63,8 +65,24 @@ export function QueueFabMenu({ queue }: QueueFabMenuProps) {
                 onClick={() => dequeueRecording(item)}>
                 <Icon color='error'>cancel</Icon>
                 <Typography>{ellipsisStart(item.filename, 50)}</Typography>
+                {item.join && item.join.length > 0 ?
+                    <Typography variant='caption' sx={{ ml: 1, }}>
+                        ({item.join.length + 1} recordings joined)
+                    </Typography> : null
+                }
+                {item.estimatedSize ?
+                    <Typography variant='caption' sx={{ ml: 1, }}>
+                        ~{formatSize(item.estimatedSize)}
+                    </Typography> : null
+                }
             </MenuItem>
-        )) :
+        )).concat(totalSize ? [(
+            <MenuItem key='pending_downloads_total' disabled>
+                <Typography variant='caption'>
+                    Estimated total: ~{formatSize(totalSize)}
+                </Typography>
+            </MenuItem>
+        )] : []) :
         [(
             <MenuItem key='no_pending_downloads' onClick={closeMenu}>
                 <Typography>No pending downloads in queue</Typography>
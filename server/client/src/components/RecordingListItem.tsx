@@ -7,9 +7,10 @@ import Skeleton from '@mui/material/Skeleton';
 import { styled } from '@mui/material/styles';
 import Typography from '@mui/material/Typography';
 import { useSnackbar } from 'notistack';
-import type React from 'react';
+import React from 'react';
 import type { Recording } from '../models';
 import { formatDate } from '../utils';
+import { StreamsPreviewDialog } from './StreamsPreviewDialog';
 
 const Thumbnail = styled('img')({
     maxWidth: 100,
@@ -29,12 +30,14 @@ function normalizeFilename(filename: string): string {
 
 function DownloadRecording({ recording }: React.PropsWithChildren<RecordingListItemProps>) {
     const { enqueueSnackbar } = useSnackbar();
+    const [previewOpen, setPreviewOpen] = React.useState(false);
 
-    async function startDownload() {
+    async function startDownload(audioOnly: boolean) {
+        const ext = audioOnly ? 'm4a' : 'mp4';
         const filename = normalizeFilename(
             recording.episode_title && recording.episode_title.length > 0 ?
-                `${recording.title} - ${recording.episode_title}.mp4` :
-                `${recording.title}.mp4`
+                `${recording.title} - ${recording.episode_title}.${ext}` :
+                `${recording.title}.${ext}`
         );
 
         try {
@@ -42,6 +45,7 @@ function DownloadRecording({ recording }: React.PropsWithChildren<RecordingListI
                 method: 'POST',
                 body: new URLSearchParams({
                     filename,
+                    audioOnly: String(audioOnly),
                 }),
             })
             if (resp.ok) {
@@ -66,9 +70,19 @@ function DownloadRecording({ recording }: React.PropsWithChildren<RecordingListI
     }
 
     return (
-        <IconButton edge='end' aria-label='comments' onClick={startDownload}>
-            <Icon>download</Icon>
-        </IconButton>
+        <>
+            <IconButton aria-label='show streams' onClick={() => setPreviewOpen(true)}>
+                <Icon>info</Icon>
+            </IconButton>
+            <StreamsPreviewDialog recording={recording} open={previewOpen}
+                onClose={() => setPreviewOpen(false)} />
+            <IconButton aria-label='download audio only' onClick={() => startDownload(true)}>
+                <Icon>audiotrack</Icon>
+            </IconButton>
+            <IconButton edge='end' aria-label='download' onClick={() => startDownload(false)}>
+                <Icon>download</Icon>
+            </IconButton>
+        </>
     );
 }
 
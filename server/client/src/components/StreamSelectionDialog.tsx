@@ -4,14 +4,17 @@ import Dialog from '@mui/material/Dialog';
 import DialogActions from '@mui/material/DialogActions';
 import DialogContent from '@mui/material/DialogContent';
 import DialogTitle from '@mui/material/DialogTitle';
+import FormControlLabel from '@mui/material/FormControlLabel';
 import List from '@mui/material/List';
 import ListItem from '@mui/material/ListItem';
 import ListItemButton from '@mui/material/ListItemButton';
 import ListItemIcon from '@mui/material/ListItemIcon';
 import ListItemText from '@mui/material/ListItemText';
 import ListSubheader from '@mui/material/ListSubheader';
+import Radio from '@mui/material/Radio';
+import RadioGroup from '@mui/material/RadioGroup';
 import React from 'react';
-import type { SourceStream } from '../models';
+import type { SourceStream, SubtitleMode } from '../models';
 
 function compareSourceStreams(a: SourceStream, b: SourceStream): number {
     let res = a.type?.localeCompare(b.type || '');
@@ -64,7 +67,7 @@ function SourceStreamsListItems({ sourceStreams, selectedStreams, onToggleItem }
 
 interface StreamSelectionDialogProps {
     open: boolean;
-    onClose: (selected: SourceStream[]) => void;
+    onClose: (selected: SourceStream[], subtitles: SubtitleMode) => void;
     sourceStreams: SourceStream[];
 }
 
@@ -73,9 +76,14 @@ export function StreamSelectionDialog({
     sourceStreams,
 }: StreamSelectionDialogProps) {
     const [selected, setSelected] = React.useState<SourceStream[]>([]);
+    const [subtitles, setSubtitles] = React.useState<SubtitleMode>('embed');
+
+    React.useEffect(() => {
+        setSelected(sourceStreams.filter((s) => s.selected));
+    }, [sourceStreams]);
 
     function handleClose() {
-        onClose(selected);
+        onClose(selected, subtitles);
     };
 
     function onToggleItem(s: SourceStream) {
@@ -96,6 +104,7 @@ export function StreamSelectionDialog({
             selectedStreams={selected} onToggleItem={onToggleItem} />
     );
     const numSelected = selected.length;
+    const hasSubtitles = selected.some((s) => s.type === 'Subtitle');
 
     return (
         <Dialog open={open}>
@@ -104,6 +113,14 @@ export function StreamSelectionDialog({
                 <List sx={{ pt: 0 }}>
                     {items}
                 </List>
+                {hasSubtitles ?
+                    <RadioGroup row value={subtitles}
+                        onChange={(e) => setSubtitles(e.target.value as SubtitleMode)}>
+                        <FormControlLabel value='embed' control={<Radio />} label='Embed subtitles' />
+                        <FormControlLabel value='sidecar' control={<Radio />} label='Sidecar files' />
+                        <FormControlLabel value='both' control={<Radio />} label='Both' />
+                    </RadioGroup>
+                    : null}
             </DialogContent>
             <DialogActions>
                 <Button disabled={numSelected <= 0} onClick={handleClose}>Submit</Button>
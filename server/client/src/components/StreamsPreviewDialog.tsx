@@ -0,0 +1,85 @@
+import Button from '@mui/material/Button';
+import CircularProgress from '@mui/material/CircularProgress';
+import Dialog from '@mui/material/Dialog';
+import DialogActions from '@mui/material/DialogActions';
+import DialogContent from '@mui/material/DialogContent';
+import DialogTitle from '@mui/material/DialogTitle';
+import Icon from '@mui/material/Icon';
+import List from '@mui/material/List';
+import ListItem from '@mui/material/ListItem';
+import ListItemIcon from '@mui/material/ListItemIcon';
+import ListItemText from '@mui/material/ListItemText';
+import Typography from '@mui/material/Typography';
+import React from 'react';
+import type { Recording, RecordingStreams } from '../models';
+
+interface StreamsPreviewDialogProps {
+    recording: Recording;
+    open: boolean;
+    onClose: () => void;
+}
+
+export function StreamsPreviewDialog({ recording, open, onClose }: StreamsPreviewDialogProps) {
+    const [streams, setStreams] = React.useState<RecordingStreams>();
+    const [error, setError] = React.useState<string>();
+
+    React.useEffect(() => {
+        if (!open || streams) {
+            return;
+        }
+
+        async function fetchStreams() {
+            try {
+                const resp = await fetch('/api/recordings/' + recording.id + '/streams');
+                const body = await resp.json();
+                if (resp.ok) {
+                    setStreams(body as RecordingStreams);
+                } else {
+                    setError(body.err || `status ${resp.status}`);
+                }
+            } catch (e) {
+                setError(String(e));
+                console.error('failed to get recording streams:', e);
+            }
+        }
+
+        setError(undefined);
+        fetchStreams();
+    }, [open, streams, recording.id]);
+
+    let content: React.ReactNode;
+    if (error) {
+        content = <Typography color='error'>Failed to detect streams: {error}</Typography>;
+    } else if (!streams) {
+        content = <CircularProgress />;
+    } else {
+        content = (
+            <>
+                <Typography variant='body2'>Duration: {streams.duration}</Typography>
+                <List dense>
+                    {streams.streams.map((s) => (
+                        <ListItem key={s.index}>
+                            <ListItemIcon>
+                                <Icon>{s.selected ? 'check_box' : 'check_box_outline_blank'}</Icon>
+                            </ListItemIcon>
+                            <ListItemText primary={s.desc} secondary={s.type} />
+                        </ListItem>
+                    ))}
+                </List>
+                {streams.warnings?.map((w) => (
+                    <Typography key={w} variant='caption' color='warning' component='p'>{w}</Typography>
+                ))}
+            </>
+        );
+    }
+
+    return (
+        <Dialog open={open} onClose={onClose}>
+            <DialogTitle>Streams of "{recording.title}"</DialogTitle>
+            <DialogContent>{content}</DialogContent>
+            <DialogActions>
+                <Button onClick={onClose}>Close</Button>
+            </DialogActions>
+        </Dialog>
+    );
+}
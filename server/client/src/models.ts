@@ -17,8 +17,17 @@ export interface SourceStream {
     index: number;
     type?: string;
     desc?: string;
+    selected?: boolean;
 }
 
+export interface RecordingStreams {
+    duration: string;
+    streams: SourceStream[];
+    warnings?: string[];
+}
+
+export type SubtitleMode = 'embed' | 'sidecar' | 'both';
+
 export function fixRecording(r: Recording) {
     r.start = ensureDate(r.start);
     r.end = ensureDate(r.end);
@@ -27,25 +36,64 @@ export function fixRecording(r: Recording) {
 export interface PendingDownload {
     recordingId: number;
     filename: string;
+    container?: string;
+    profile?: string;
+    subtitles?: SubtitleMode;
+    audioOnly?: boolean;
+    join?: number[];
+    trimOverlap?: boolean;
+    estimatedSize?: number;
+    rate?: number;
+    rateLimit?: number;
 }
 
 export interface QueueUpdatedEvent {
     queue: PendingDownload[];
+    totalSize?: number;
 }
 
 export interface DownloadStartedEvent {
     filename: string;
+    estimatedSize?: number;
+    updated?: boolean;
 }
 
 export interface ProgressUpdatedEvent {
     completed: number;
     elapsed: string;
     remaining: string;
+    estimatedSize?: number;
 }
 
 export interface DownloadErroredEvent {
     filename: string;
     reason: string;
+    class?: string;
+    hint?: string;
+    log?: Array<string>;
+}
+
+export interface HookFinishedEvent {
+    filename: string;
+    command: string;
+    exitCode: number;
+    output?: Array<string>;
+    err?: string;
+}
+
+export interface RateLimitRule {
+    from: string;
+    to: string;
+    limit: number;
+}
+
+export interface RateLimitUpdatedEvent {
+    limit: number;
+    override: number | null;
+    schedule: {
+        limit: number;
+        rules?: Array<RateLimitRule>;
+    };
 }
 
 export interface StateUpdatedEvent {
@@ -65,10 +113,13 @@ export interface ServerEvent {
     downloadErrored?: DownloadErroredEvent;
     stateUpdated?: StateUpdatedEvent;
     selectStreams?: StreamSelectionRequestedEvent;
+    hookFinished?: HookFinishedEvent;
+    rateLimitUpdated?: RateLimitUpdatedEvent;
 }
 
 export interface StreamsSelectedEvent {
     streams: Array<SourceStream>;
+    subtitles?: SubtitleMode;
 }
 
 export interface ClientEvent {
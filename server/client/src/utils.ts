@@ -26,3 +26,18 @@ export function formatDate(dt: string | Date): string {
 export function formatPercent(p: number): string {
     return percentFormat.format(p);
 }
+
+const sizeUnits = ['B', 'KiB', 'MiB', 'GiB', 'TiB', 'PiB'];
+
+export function formatSize(bytes: number): string {
+    let unit = 0;
+    while (bytes >= 1024 && unit < sizeUnits.length - 1) {
+        bytes /= 1024;
+        unit++;
+    }
+    return unit === 0 ? `${bytes} B` : `${bytes.toFixed(1)} ${sizeUnits[unit]}`;
+}
+
+export function formatRate(bytesPerSecond: number): string {
+    return bytesPerSecond > 0 ? `${formatSize(bytesPerSecond)}/s` : 'unlimited';
+}
@@ -2,8 +2,12 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -11,8 +15,21 @@ import (
 )
 
 type toDownload struct {
-	RecordingId int64  `json:"recordingId"`
-	OutputPath  string `json:"filename"`
+	RecordingId int64               `json:"recordingId"`
+	OutputPath  string              `json:"filename"`
+	Container   ffmpeg.Container    `json:"container,omitempty"`
+	Profile     string              `json:"profile,omitempty"`
+	Subtitles   ffmpeg.SubtitleMode `json:"subtitles,omitempty"`
+	AudioOnly   bool                `json:"audioOnly,omitempty"`
+	// Join holds the IDs of further recordings which are joined, in order,
+	// with the recording into one output.
+	Join []int64 `json:"join,omitempty"`
+	// TrimOverlap tells whether the start of joined recordings which overlaps
+	// with the previous recording is trimmed.
+	TrimOverlap bool `json:"trimOverlap,omitempty"`
+	// EstimatedSize is the estimated size of the output in bytes, if the
+	// streams of the recording were detected before.
+	EstimatedSize int64 `json:"estimatedSize,omitempty"`
 }
 
 type downloadQueue struct {
@@ -41,7 +58,7 @@ func (q *downloadQueue) Run(ctx context.Context) {
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				downloading, downloadDone = q.checkForDownloads()
+				downloading, downloadDone = q.checkForDownloads(ctx)
 			}
 		} else {
 			select {
@@ -55,7 +72,7 @@ func (q *downloadQueue) Run(ctx context.Context) {
 	}
 }
 
-func (q *downloadQueue) checkForDownloads() (bool, chan struct{}) {
+func (q *downloadQueue) checkForDownloads(ctx context.Context) (bool, chan struct{}) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
@@ -64,14 +81,13 @@ func (q *downloadQueue) checkForDownloads() (bool, chan struct{}) {
 		q.q = remaining
 
 		q.hub.outbox <- serverEvent{
-			DownloadStarted: &eventDownloadStarted{Filename: dl.OutputPath},
-		}
-		q.hub.outbox <- serverEvent{
-			QueueUpdated: &eventQueueUpdated{Queue: q.q},
+			DownloadStarted: &eventDownloadStarted{Filename: dl.OutputPath, EstimatedSize: dl.EstimatedSize},
 		}
+		q.hub.outbox <- serverEvent{QueueUpdated: q.queueUpdated()}
 
-		downloadDone := make(chan struct{})
-		go q.downloadRecording(dl, downloadDone)
+		// Buffered, so the download can finish after Run returned.
+		downloadDone := make(chan struct{}, 1)
+		go q.downloadRecording(ctx, dl, downloadDone)
 
 		return true, downloadDone
 	}
@@ -79,7 +95,8 @@ func (q *downloadQueue) checkForDownloads() (bool, chan struct{}) {
 	return false, nil
 }
 
-func (q *downloadQueue) downloadRecording(r toDownload, done chan<- struct{}) {
+// downloadRecording downloads the recording, until the given context is done.
+func (q *downloadQueue) downloadRecording(ctx context.Context, r toDownload, done chan<- struct{}) {
 	defer func() { done <- struct{}{} }()
 
 	q.hub.outbox <- serverEvent{
@@ -88,65 +105,242 @@ func (q *downloadQueue) downloadRecording(r toDownload, done chan<- struct{}) {
 	url, err := q.a.GetRecordingStreamUrl(r.RecordingId)
 	if nil != err {
 		q.hub.outbox <- serverEvent{
-			DownloadErrored: &eventDownloadErrored{Filename: r.OutputPath, Reason: err.Error()},
+			DownloadErrored: newEventDownloadErrored(r.OutputPath, err),
 		}
 		fmt.Fprintf(os.Stderr, "Failed to get recording stream: %v\n", err)
 		return
 	}
 
-	d := ffmpeg.NewDownloadable(url, r.OutputPath,
-		ffmpeg.WithOverwrite(q.server.overwrite))
+	opts, err := q.downloadableOptions(r)
+	if nil != err {
+		q.hub.outbox <- serverEvent{
+			DownloadErrored: newEventDownloadErrored(r.OutputPath, err),
+		}
+		fmt.Fprintf(os.Stderr, "Failed to prepare download: %v\n", err)
+		return
+	}
+	opts = append(opts, q.metadataOptions(r)...)
+	var d ffmpeg.Downloadable
+	if len(r.Join) > 0 {
+		inputs, err := q.joinInputs(r, url)
+		if nil != err {
+			q.hub.outbox <- serverEvent{
+				DownloadErrored: newEventDownloadErrored(r.OutputPath, err),
+			}
+			fmt.Fprintf(os.Stderr, "Failed to get recordings to join: %v\n", err)
+			return
+		}
+		d = ffmpeg.NewJoinedDownloadable(inputs, r.OutputPath, opts...)
+	} else {
+		if info, found := q.probes.Get(r.RecordingId); found {
+			opts = append(opts, ffmpeg.WithStreamInfo(info))
+		}
+		d = ffmpeg.NewDownloadable(q.streamUrl(r.RecordingId, url), r.OutputPath, opts...)
+	}
 	q.hub.outbox <- serverEvent{
 		StateUpdated: &eventStateUpdated{State: "detect_streams", Reason: "detecting recording audio and video streams ..."},
 	}
 	fmt.Println("Detecting streams ...")
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	detectCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	if err := d.DetectStreams(ctx); nil != err {
+	if err := d.DetectStreams(detectCtx); nil != err {
 		q.hub.outbox <- serverEvent{
-			DownloadErrored: &eventDownloadErrored{Filename: r.OutputPath, Reason: err.Error()},
+			DownloadErrored: newEventDownloadErrored(r.OutputPath, err),
 		}
 		fmt.Fprintf(os.Stderr, "Failed to detect recording streams: %v\n", err)
 		return
 	}
+	q.probes.Put(r.RecordingId, d.StreamInfo())
 
 	q.hub.outbox <- serverEvent{
 		StateUpdated: &eventStateUpdated{State: "download", Reason: "starting download ..."},
 	}
 	selector := q.streamsSelectorFactory()
+	if r.AudioOnly {
+		selector = ffmpeg.NewAudioOnlyStreamsSelector(selector)
+	}
 	progress := &broadcastDownloadProgressHandler{
-		server: q.server,
+		server:   q.server,
+		filename: r.OutputPath,
 		eventQueueUpdated: eventQueueUpdated{
 			Queue: q.q,
 		},
 	}
-	if err := d.Download(context.Background(), selector, progress); nil != err {
+	if err := d.Download(ctx, selector, progress); nil != err {
 		q.hub.outbox <- serverEvent{
-			DownloadErrored: &eventDownloadErrored{Filename: r.OutputPath, Reason: err.Error()},
+			DownloadErrored: newEventDownloadErrored(r.OutputPath, err),
 		}
 		fmt.Fprintf(os.Stderr, "Failed to download recording: %v\n", err)
+		return
+	}
+	q.library.Add(libraryEntry{
+		RecordingId: r.RecordingId,
+		OutputPath:  r.OutputPath,
+		Parts:       progress.parts,
+		Sidecars:    progress.sidecars,
+		Finished:    time.Now().UTC(),
+	})
+}
+
+// newEventDownloadErrored creates the event for a failed download, including
+// the class of and the log excerpt for ffmpeg failures.
+func newEventDownloadErrored(filename string, err error) *eventDownloadErrored {
+	evt := &eventDownloadErrored{Filename: filename, Reason: err.Error()}
+	var downloadErr *ffmpeg.DownloadError
+	if errors.As(err, &downloadErr) {
+		evt.Class = string(downloadErr.Class)
+		evt.Hint = downloadErr.Class.Hint()
+		evt.Log = downloadErr.LogTail
+	}
+	return evt
+}
+
+func (q *downloadQueue) downloadableOptions(r toDownload) ([]ffmpeg.DownloadableOption, error) {
+	container := r.Container
+	if container == "" {
+		container = q.server.container
+	}
+	if container == "" && r.AudioOnly && ffmpeg.ContainerFromPath(r.OutputPath) == "" {
+		container = ffmpeg.ContainerMatroskaAudio
+	}
+	opts := []ffmpeg.DownloadableOption{
+		ffmpeg.WithOverwrite(q.server.overwrite),
+		ffmpeg.WithContainer(container),
+		ffmpeg.WithPostProcessors(q.server.postProcessors...),
+	}
+	opts = append(opts, q.server.downloadableOptions...)
+	// Downloads go through the limiter such that a limit set at runtime applies
+	// to running downloads too. Without the proxy protocol the limiter needs,
+	// ffmpeg can only download through it when a limit applies at the start.
+	if nil != q.server.limiter &&
+		(q.server.rateLimited() || nil == q.server.capabilities.Check([]ffmpeg.Feature{ffmpeg.RateLimitFeature})) {
+		opts = append(opts, ffmpeg.WithRateLimiter(q.server.limiter))
+	}
+	if nil != q.server.postHook {
+		hook := *q.server.postHook
+		ids := []string{strconv.FormatInt(r.RecordingId, 10)}
+		for _, id := range r.Join {
+			ids = append(ids, strconv.FormatInt(id, 10))
+		}
+		hook.Env = append(slices.Clone(hook.Env), "ZTDL_RECORDING_ID="+strings.Join(ids, ","))
+		opts = append(opts, ffmpeg.WithPostHook(hook))
+	}
+	if r.Subtitles != "" {
+		opts = append(opts, ffmpeg.WithSubtitleMode(r.Subtitles))
+	}
+
+	profileName := r.Profile
+	if profileName == "" {
+		profileName = q.server.profile
+	}
+	if profileName != "" {
+		profile, err := ffmpeg.LookupProfile(profileName, q.server.profiles)
+		if nil != err {
+			return nil, err
+		}
+		opts = append(opts, ffmpeg.WithTranscodingProfile(profile))
+	}
+
+	return opts, nil
+}
+
+// metadataOptions returns the options to pass the program metadata of the
+// recording to the post-download hook, if any, and to write it and the cover
+// art to the output of audio-only downloads. Metadata is best-effort, so
+// failures to get the recording details are only logged.
+func (q *downloadQueue) metadataOptions(r toDownload) []ffmpeg.DownloadableOption {
+	hook := nil != q.server.postHook
+	if !r.AudioOnly && !hook {
+		return nil
+	}
+	details, err := q.a.GetRecordingDetails(r.RecordingId)
+	if nil != err {
+		fmt.Fprintf(os.Stderr, "Failed to get recording details, not writing metadata: %v\n", err)
+		return nil
+	}
+
+	metadata := ffmpeg.Metadata{
+		Title:        details.Title,
+		EpisodeTitle: details.EpisodeTitle,
+		Channel:      details.Channel,
+		Description:  details.Description,
+		Year:         details.Year,
+	}
+	opts := []ffmpeg.DownloadableOption{}
+	if hook {
+		opts = append(opts, ffmpeg.WithHookMetadata(metadata))
+	}
+	if r.AudioOnly {
+		opts = append(opts, ffmpeg.WithMetadata(metadata))
+		if details.ImageUrl != "" {
+			opts = append(opts, ffmpeg.WithCoverArt(details.ImageUrl))
+		}
+	}
+	return opts
+}
+
+// streamUrl returns the provider of the stream URL of the recording, which
+// provides the given URL first and gets a fresh URL when it expired, e.g. while
+// the download waited for streams to be selected.
+func (q *downloadQueue) streamUrl(recordingId int64, url string) ffmpeg.UrlProvider {
+	return ffmpeg.RefreshableUrl(url, func(ctx context.Context) (string, error) {
+		return q.a.GetRecordingStreamUrl(recordingId)
+	})
+}
+
+// joinInputs returns the inputs to join the recordings of the given download,
+// the first of which has the given stream URL.
+func (q *downloadQueue) joinInputs(r toDownload, firstUrl string) ([]ffmpeg.JoinInput, error) {
+	inputs := []ffmpeg.JoinInput{{Url: q.streamUrl(r.RecordingId, firstUrl)}}
+	for _, id := range r.Join {
+		url, err := q.a.GetRecordingStreamUrl(id)
+		if nil != err {
+			return nil, err
+		}
+		inputs = append(inputs, ffmpeg.JoinInput{Url: q.streamUrl(id, url)})
+	}
+	if !r.TrimOverlap {
+		return inputs, nil
+	}
+
+	previous, err := q.a.GetRecordingDetails(r.RecordingId)
+	if nil != err {
+		return nil, fmt.Errorf("failed to get details to trim overlap: %w", err)
+	}
+	for i, id := range r.Join {
+		details, err := q.a.GetRecordingDetails(id)
+		if nil != err {
+			return nil, fmt.Errorf("failed to get details to trim overlap: %w", err)
+		}
+		inputs[i+1].Trim = details.Overlap(previous)
+		previous = details
 	}
+	return inputs, nil
 }
 
+// InQueue tells whether the recording is queued for download, also as one of
+// the recordings of a joined download.
 func (q *downloadQueue) InQueue(recordingId int64) bool {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
 	for _, r := range q.q {
-		if r.RecordingId == recordingId {
+		if r.RecordingId == recordingId || slices.Contains(r.Join, recordingId) {
 			return true
 		}
 	}
 	return false
 }
 
-func (q *downloadQueue) Enqueue(recordingId int64, outputPath string) {
+func (q *downloadQueue) Enqueue(d toDownload) {
+	d.EstimatedSize = q.estimateSize(d)
+
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
-	q.q = append(q.q, toDownload{recordingId, outputPath})
-	q.hub.outbox <- serverEvent{QueueUpdated: &eventQueueUpdated{Queue: q.q}}
+	q.q = append(q.q, d)
+	q.hub.outbox <- serverEvent{QueueUpdated: q.queueUpdated()}
 }
 
 func (q *downloadQueue) Dequeue(recordingId int64) {
@@ -165,12 +359,51 @@ func (q *downloadQueue) Dequeue(recordingId int64) {
 	}
 
 	q.q = append(q.q[:index], q.q[index+1:]...)
-	q.hub.outbox <- serverEvent{QueueUpdated: &eventQueueUpdated{Queue: q.q}}
+	q.hub.outbox <- serverEvent{QueueUpdated: q.queueUpdated()}
+}
+
+// queueUpdated returns the event for the current queue, including the total
+// estimated size of the pending downloads. The caller must hold the lock.
+func (q *downloadQueue) queueUpdated() *eventQueueUpdated {
+	evt := &eventQueueUpdated{Queue: q.q}
+	for _, d := range q.q {
+		evt.TotalSize += d.EstimatedSize
+	}
+	return evt
+}
+
+// estimateSize estimates the size of the download from the streams previously
+// detected for the recording, selected like they would be without user
+// interaction. It returns zero if the streams were not detected yet, and for
+// joined downloads.
+func (q *downloadQueue) estimateSize(r toDownload) int64 {
+	info, found := q.probes.Get(r.RecordingId)
+	if !found || nil == q.automaticSelectorFactory || len(r.Join) > 0 {
+		return 0
+	}
+	opts, err := q.downloadableOptions(r)
+	if nil != err {
+		return 0
+	}
+	d := ffmpeg.NewDownloadable(nil, r.OutputPath, append(opts, ffmpeg.WithStreamInfo(info))...)
+	selector := q.automaticSelectorFactory()
+	if r.AudioOnly {
+		selector = ffmpeg.NewAudioOnlyStreamsSelector(selector)
+	}
+	streams, err := selector.SelectStreams(d.Streams())
+	if nil != err {
+		return 0
+	}
+	return d.EstimateSize(streams)
 }
 
 type broadcastDownloadProgressHandler struct {
 	*server
 	eventQueueUpdated
+	filename      string
+	estimatedSize int64
+	parts         []string
+	sidecars      []string
 }
 
 // Start implements ffmpeg.DownloadProgressHandler.
@@ -188,6 +421,53 @@ func (b *broadcastDownloadProgressHandler) Finished() {
 	fmt.Println("Queued download finished.")
 }
 
+// StageStarted implements ffmpeg.StageHandler.
+func (b *broadcastDownloadProgressHandler) StageStarted(stage ffmpeg.Stage) {
+	fmt.Println()
+	b.hub.outbox <- serverEvent{
+		StateUpdated: &eventStateUpdated{State: stage.Name, Reason: stage.Description + " ..."},
+	}
+}
+
+// HookFinished implements ffmpeg.HookHandler.
+func (b *broadcastDownloadProgressHandler) HookFinished(result ffmpeg.HookResult) {
+	evt := &eventHookFinished{
+		Filename: b.filename,
+		Command:  result.Command,
+		ExitCode: result.ExitCode,
+		Output:   result.Output,
+	}
+	if nil != result.Err {
+		evt.Err = result.Err.Error()
+		fmt.Fprintf(os.Stderr, "Post-download hook failed: %v\n", result.Err)
+	}
+	b.hub.outbox <- serverEvent{HookFinished: evt}
+}
+
+// SizeEstimated implements ffmpeg.SizeEstimateHandler.
+func (b *broadcastDownloadProgressHandler) SizeEstimated(bytes int64) {
+	b.estimatedSize = bytes
+	// The download started with the size estimated when it was enqueued,
+	// which may be for other streams than the ones selected now.
+	b.hub.outbox <- serverEvent{
+		DownloadStarted: &eventDownloadStarted{
+			Filename:      b.filename,
+			EstimatedSize: bytes,
+			Updated:       true,
+		},
+	}
+}
+
+// PartsWritten implements ffmpeg.PartsHandler.
+func (b *broadcastDownloadProgressHandler) PartsWritten(paths []string) {
+	b.parts = paths
+}
+
+// SidecarsWritten implements ffmpeg.SidecarsHandler.
+func (b *broadcastDownloadProgressHandler) SidecarsWritten(paths []string) {
+	b.sidecars = paths
+}
+
 // UpdateProgress implements ffmpeg.DownloadProgressHandler.
 func (b *broadcastDownloadProgressHandler) UpdateProgress(p ffmpeg.DownloadProgress) {
 	fmt.Printf("Queued download progress: %5.1f%% | Elapsed: %10s | Remaining: %10s\r",
@@ -197,6 +477,10 @@ func (b *broadcastDownloadProgressHandler) UpdateProgress(p ffmpeg.DownloadProgr
 			RelCompleted: p.RelCompleted,
 			Elapsed:      p.Elapsed.Truncate(time.Second).String(),
 			Remaining:    p.Remaining.String(),
+
+			EstimatedSize: b.estimatedSize,
+			Rate:          int64(p.Rate),
+			RateLimit:     int64(p.RateLimit),
 		},
 	}
 }
@@ -13,6 +13,7 @@ import (
 
 	e "github.com/rokeller/zt-dl/exec"
 	"github.com/rokeller/zt-dl/ffmpeg"
+	"github.com/rokeller/zt-dl/ratelimit"
 	"github.com/rokeller/zt-dl/test"
 	"github.com/rokeller/zt-dl/zattoo"
 )
@@ -45,7 +46,9 @@ func Test_downloadQueue_Run(t *testing.T) {
 				{RecordingId: 1234, OutputPath: "/tmp/foo/bar"},
 			},
 			ctxFactory: func(parent context.Context) (context.Context, context.CancelFunc) {
-				ctx, cancel := context.WithTimeout(parent, time.Second+time.Millisecond*10)
+				// Downloads run with the queue's context, so leave ffprobe the
+				// time to fail before the context is done.
+				ctx, cancel := context.WithTimeout(parent, time.Second+time.Millisecond*250)
 				return ctx, cancel
 			},
 			wantEvents: []serverEvent{
@@ -161,7 +164,7 @@ func Test_downloadQueue_checkForDownloads(t *testing.T) {
 				mu:     sync.Mutex{},
 				q:      tt.q,
 			}
-			got, gotCh := q.checkForDownloads()
+			got, gotCh := q.checkForDownloads(context.Background())
 			if got != tt.want {
 				t.Errorf("downloadQueue.checkForDownloads() got = %v, want %v", got, tt.want)
 			}
@@ -222,7 +225,7 @@ func Test_downloadQueue_downloadRecording(t *testing.T) {
 				q:      []toDownload{},
 			}
 			done := make(chan struct{}, 1)
-			q.downloadRecording(tt.r, done)
+			q.downloadRecording(context.Background(), tt.r, done)
 			<-done
 
 			consumeServerEvents(t, s.hub.outbox, tt.wantEvents)
@@ -274,7 +277,7 @@ func Test_downloadQueue_downloadRecording_DetectStreamsFails(t *testing.T) {
 		q:      []toDownload{},
 	}
 	done := make(chan struct{}, 1)
-	q.downloadRecording(toDownload{RecordingId: 1111}, done)
+	q.downloadRecording(context.Background(), toDownload{RecordingId: 1111}, done)
 	<-done
 
 	consumeServerEvents(t, s.hub.outbox, []serverEvent{
@@ -329,6 +332,7 @@ func Test_downloadQueue_downloadRecording_DownloadFails(t *testing.T) {
 ]}`)
 			os.Exit(0)
 		case "ffmpeg":
+			fmt.Fprintln(os.Stderr, "[out#0/matroska] Error opening output files: No space left on device")
 			os.Exit(1)
 		}
 		return
@@ -356,7 +360,7 @@ func Test_downloadQueue_downloadRecording_DownloadFails(t *testing.T) {
 	s := &server{
 		a:                      a,
 		hub:                    newHub(),
-		streamsSelectorFactory: bestStreamsSelectorFactory,
+		streamsSelectorFactory: func() ffmpeg.StreamsSelector { return ffmpeg.NewBestStreamsSelector() },
 	}
 	q := &downloadQueue{
 		server: s,
@@ -364,14 +368,20 @@ func Test_downloadQueue_downloadRecording_DownloadFails(t *testing.T) {
 		q:      []toDownload{},
 	}
 	done := make(chan struct{}, 1)
-	q.downloadRecording(toDownload{RecordingId: 1111}, done)
+	q.downloadRecording(context.Background(), toDownload{RecordingId: 1111}, done)
 	<-done
 
 	consumeServerEvents(t, s.hub.outbox, []serverEvent{
 		{StateUpdated: &eventStateUpdated{State: "get_stream_url", Reason: "getting recording stream URL ..."}},
 		{StateUpdated: &eventStateUpdated{State: "detect_streams", Reason: "detecting recording audio and video streams ..."}},
 		{StateUpdated: &eventStateUpdated{State: "download", Reason: "starting download ..."}},
-		{DownloadErrored: &eventDownloadErrored{Reason: "ffmpeg failed: exit status 1"}},
+		{DownloadStarted: &eventDownloadStarted{EstimatedSize: 58_429_629_097, Updated: true}},
+		{DownloadErrored: &eventDownloadErrored{
+			Reason: "ffmpeg failed (disk full): exit status 1",
+			Class:  "disk_full",
+			Hint:   "The disk is full. Free up some space and try again.",
+			Log:    []string{"[out#0/matroska] Error opening output files: No space left on device"},
+		}},
 	})
 	ensureNoMoreServerEvents(t, s.hub.outbox)
 }
@@ -447,7 +457,8 @@ func Test_downloadQueue_downloadRecording_DownloadSucceeds(t *testing.T) {
 	s := &server{
 		a:                      a,
 		hub:                    newHub(),
-		streamsSelectorFactory: bestStreamsSelectorFactory,
+		streamsSelectorFactory: func() ffmpeg.StreamsSelector { return ffmpeg.NewBestStreamsSelector() },
+		library:                newLibrary(),
 	}
 	q := &downloadQueue{
 		server: s,
@@ -455,15 +466,19 @@ func Test_downloadQueue_downloadRecording_DownloadSucceeds(t *testing.T) {
 		q:      []toDownload{},
 	}
 	done := make(chan struct{}, 1)
-	q.downloadRecording(toDownload{RecordingId: 1111}, done)
+	q.downloadRecording(context.Background(), toDownload{RecordingId: 1111}, done)
 	<-done
 
 	consumeServerEvents(t, s.hub.outbox, []serverEvent{
 		{StateUpdated: &eventStateUpdated{State: "get_stream_url", Reason: "getting recording stream URL ..."}},
 		{StateUpdated: &eventStateUpdated{State: "detect_streams", Reason: "detecting recording audio and video streams ..."}},
 		{StateUpdated: &eventStateUpdated{State: "download", Reason: "starting download ..."}},
+		{DownloadStarted: &eventDownloadStarted{EstimatedSize: 58_429_629_097, Updated: true}},
 	})
 	ensureNoMoreServerEvents(t, s.hub.outbox)
+	if _, found := s.library.Get(1111); !found {
+		t.Error("downloadRecording() did not add the download to the library")
+	}
 }
 
 func Test_downloadQueue_InQueue(t *testing.T) {
@@ -480,16 +495,22 @@ func Test_downloadQueue_InQueue(t *testing.T) {
 		},
 		{
 			name:        "NonEmptyQueue/ItemNotFound",
-			q:           []toDownload{{111, "blah"}},
+			q:           []toDownload{{RecordingId: 111, OutputPath: "blah"}},
 			recordingId: 456,
 			want:        false,
 		},
 		{
 			name:        "NonEmptyQueue/ItemFound",
-			q:           []toDownload{{111, "blah"}, {789, "blotz"}},
+			q:           []toDownload{{RecordingId: 111, OutputPath: "blah"}, {RecordingId: 789, OutputPath: "blotz"}},
 			recordingId: 789,
 			want:        true,
 		},
+		{
+			name:        "NonEmptyQueue/JoinedItemFound",
+			q:           []toDownload{{RecordingId: 111, OutputPath: "blah", Join: []int64{112, 113}}},
+			recordingId: 113,
+			want:        true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -510,20 +531,16 @@ func Test_downloadQueue_InQueue(t *testing.T) {
 }
 
 func Test_downloadQueue_Enqueue(t *testing.T) {
-	type args struct {
-		recordingId int64
-		outputPath  string
-	}
 	tests := []struct {
 		name         string
 		q            []toDownload
-		args         args
+		d            toDownload
 		wantQueueLen int
 	}{
 		{
 			name:         "EmptyQueue",
 			q:            []toDownload{},
-			args:         args{recordingId: 1234, outputPath: "test"},
+			d:            toDownload{RecordingId: 1234, OutputPath: "test"},
 			wantQueueLen: 1,
 		},
 		{
@@ -531,7 +548,7 @@ func Test_downloadQueue_Enqueue(t *testing.T) {
 			q: []toDownload{
 				{RecordingId: 11, OutputPath: "foo"},
 			},
-			args:         args{recordingId: 22, outputPath: "bar"},
+			d:            toDownload{RecordingId: 22, OutputPath: "bar", Container: ffmpeg.ContainerMatroska},
 			wantQueueLen: 2,
 		},
 	}
@@ -546,18 +563,59 @@ func Test_downloadQueue_Enqueue(t *testing.T) {
 				q:      tt.q,
 			}
 
-			q.Enqueue(tt.args.recordingId, tt.args.outputPath)
+			q.Enqueue(tt.d)
 			if len(q.q) != tt.wantQueueLen {
 				t.Errorf("queue length is %d, but want %d", len(q.q), tt.wantQueueLen)
 			}
 			consumeServerEvent(t, s.hub.outbox, serverEvent{QueueUpdated: &eventQueueUpdated{
-				Queue: append(tt.q, toDownload{tt.args.recordingId, tt.args.outputPath}),
+				Queue: append(tt.q, tt.d),
 			}})
 			ensureNoMoreServerEvents(t, s.hub.outbox)
 		})
 	}
 }
 
+func Test_downloadQueue_Enqueue_EstimatedSize(t *testing.T) {
+	s := &server{
+		hub:    newHub(),
+		probes: newProbeCache(time.Hour),
+		automaticSelectorFactory: func() ffmpeg.StreamsSelector {
+			return ffmpeg.NewBestStreamsSelector()
+		},
+	}
+	s.probes.Put(22, ffmpeg.StreamInfo{
+		Duration: 100 * time.Second,
+		Streams: []ffmpeg.SourceStream{
+			&ffmpeg.VideoStream{Stream: ffmpeg.Stream{Index: 0}, BitRate: 7_500_000},
+			&ffmpeg.AudioStream{Stream: ffmpeg.Stream{Index: 1}, BitRate: 500_000},
+		},
+	})
+	q := &downloadQueue{
+		server: s,
+		mu:     sync.Mutex{},
+		q:      []toDownload{{RecordingId: 11, OutputPath: "foo", EstimatedSize: 1000}},
+	}
+
+	q.Enqueue(toDownload{RecordingId: 22, OutputPath: "bar.mkv"})
+	// 8 Mbps for 100 seconds, plus 2% container overhead.
+	want := toDownload{RecordingId: 22, OutputPath: "bar.mkv", EstimatedSize: 102_000_000}
+	consumeServerEvent(t, s.hub.outbox, serverEvent{QueueUpdated: &eventQueueUpdated{
+		Queue:     []toDownload{{RecordingId: 11, OutputPath: "foo", EstimatedSize: 1000}, want},
+		TotalSize: 102_001_000,
+	}})
+
+	q.Enqueue(toDownload{RecordingId: 33, OutputPath: "baz.mkv"})
+	consumeServerEvent(t, s.hub.outbox, serverEvent{QueueUpdated: &eventQueueUpdated{
+		Queue: []toDownload{
+			{RecordingId: 11, OutputPath: "foo", EstimatedSize: 1000},
+			want,
+			{RecordingId: 33, OutputPath: "baz.mkv"},
+		},
+		TotalSize: 102_001_000,
+	}})
+	ensureNoMoreServerEvents(t, s.hub.outbox)
+}
+
 func Test_downloadQueue_Dequeue(t *testing.T) {
 	tests := []struct {
 		name         string // description of this test case
@@ -573,8 +631,8 @@ func Test_downloadQueue_Dequeue(t *testing.T) {
 		{
 			name: "NonEmptyQueue/NoMatch",
 			q: []toDownload{
-				{111, "blah"},
-				{333, "blotz"},
+				{RecordingId: 111, OutputPath: "blah"},
+				{RecordingId: 333, OutputPath: "blotz"},
 			},
 			recordingId:  222,
 			wantQueueLen: 2,
@@ -582,13 +640,13 @@ func Test_downloadQueue_Dequeue(t *testing.T) {
 		{
 			name: "NonEmptyQueue/FirstMatch",
 			q: []toDownload{
-				{333, "blotz"},
-				{111, "blah"},
+				{RecordingId: 333, OutputPath: "blotz"},
+				{RecordingId: 111, OutputPath: "blah"},
 			},
 			recordingId: 333,
 			wantEvents: []serverEvent{
 				{QueueUpdated: &eventQueueUpdated{
-					Queue: []toDownload{{111, "blah"}},
+					Queue: []toDownload{{RecordingId: 111, OutputPath: "blah"}},
 				}},
 			},
 			wantQueueLen: 1,
@@ -596,14 +654,14 @@ func Test_downloadQueue_Dequeue(t *testing.T) {
 		{
 			name: "NonEmptyQueue/MiddleMatch",
 			q: []toDownload{
-				{111, "blah"},
-				{444, "blimp"},
-				{333, "blotz"},
+				{RecordingId: 111, OutputPath: "blah"},
+				{RecordingId: 444, OutputPath: "blimp"},
+				{RecordingId: 333, OutputPath: "blotz"},
 			},
 			recordingId: 444,
 			wantEvents: []serverEvent{
 				{QueueUpdated: &eventQueueUpdated{
-					Queue: []toDownload{{111, "blah"}, {333, "blotz"}},
+					Queue: []toDownload{{RecordingId: 111, OutputPath: "blah"}, {RecordingId: 333, OutputPath: "blotz"}},
 				}},
 			},
 			wantQueueLen: 2,
@@ -611,13 +669,13 @@ func Test_downloadQueue_Dequeue(t *testing.T) {
 		{
 			name: "NonEmptyQueue/Last",
 			q: []toDownload{
-				{333, "blotz"},
-				{555, "blah"},
+				{RecordingId: 333, OutputPath: "blotz"},
+				{RecordingId: 555, OutputPath: "blah"},
 			},
 			recordingId: 555,
 			wantEvents: []serverEvent{
 				{QueueUpdated: &eventQueueUpdated{
-					Queue: []toDownload{{333, "blotz"}},
+					Queue: []toDownload{{RecordingId: 333, OutputPath: "blotz"}},
 				}},
 			},
 			wantQueueLen: 1,
@@ -717,9 +775,10 @@ func Test_broadcastDownloadProgressHandler_UpdateProgress(t *testing.T) {
 		eventQueueUpdated eventQueueUpdated
 	}
 	tests := []struct {
-		name   string
-		fields fields
-		p      ffmpeg.DownloadProgress
+		name          string
+		fields        fields
+		estimatedSize int64
+		p             ffmpeg.DownloadProgress
 	}{
 		{
 			name: "Success",
@@ -729,6 +788,15 @@ func Test_broadcastDownloadProgressHandler_UpdateProgress(t *testing.T) {
 				Remaining:    time.Millisecond * 98765,
 			},
 		},
+		{
+			name:          "WithEstimatedSize",
+			estimatedSize: 123456789,
+			p: ffmpeg.DownloadProgress{
+				RelCompleted: 0.5,
+				Elapsed:      time.Second * 10,
+				Remaining:    time.Second * 10,
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -739,13 +807,233 @@ func Test_broadcastDownloadProgressHandler_UpdateProgress(t *testing.T) {
 				server:            s,
 				eventQueueUpdated: tt.fields.eventQueueUpdated,
 			}
+			if tt.estimatedSize > 0 {
+				b.SizeEstimated(tt.estimatedSize)
+				consumeServerEvent(t, b.hub.outbox, serverEvent{DownloadStarted: &eventDownloadStarted{
+					EstimatedSize: tt.estimatedSize,
+					Updated:       true,
+				}})
+			}
 			b.UpdateProgress(tt.p)
 			consumeServerEvent(t, b.hub.outbox, serverEvent{ProgressUpdated: &eventProgressUpdated{
-				RelCompleted: tt.p.RelCompleted,
-				Elapsed:      tt.p.Elapsed.Truncate(time.Second).String(),
-				Remaining:    tt.p.Remaining.String(),
+				RelCompleted:  tt.p.RelCompleted,
+				Elapsed:       tt.p.Elapsed.Truncate(time.Second).String(),
+				Remaining:     tt.p.Remaining.String(),
+				EstimatedSize: tt.estimatedSize,
 			}})
 			ensureNoMoreServerEvents(t, s.hub.outbox)
 		})
 	}
 }
+
+func Test_broadcastDownloadProgressHandler_StageStarted(t *testing.T) {
+	s := &server{
+		hub: newHub(),
+	}
+	b := &broadcastDownloadProgressHandler{server: s}
+	b.StageStarted(ffmpeg.Stage{Name: "test_stage", Description: "testing stage"})
+	consumeServerEvent(t, b.hub.outbox, serverEvent{StateUpdated: &eventStateUpdated{
+		State:  "test_stage",
+		Reason: "testing stage ...",
+	}})
+	ensureNoMoreServerEvents(t, s.hub.outbox)
+}
+
+func Test_broadcastDownloadProgressHandler_HookFinished(t *testing.T) {
+	tests := []struct {
+		name   string
+		result ffmpeg.HookResult
+		want   *eventHookFinished
+	}{
+		{
+			name:   "Succeeded",
+			result: ffmpeg.HookResult{Command: "notify.sh", Output: []string{"notified"}},
+			want:   &eventHookFinished{Filename: "out.mkv", Command: "notify.sh", Output: []string{"notified"}},
+		},
+		{
+			name: "Failed",
+			result: ffmpeg.HookResult{
+				Command:  "notify.sh",
+				ExitCode: 2,
+				Err:      errors.New("post-download hook failed: exit status 2"),
+			},
+			want: &eventHookFinished{
+				Filename: "out.mkv",
+				Command:  "notify.sh",
+				ExitCode: 2,
+				Err:      "post-download hook failed: exit status 2",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &server{
+				hub: newHub(),
+			}
+			b := &broadcastDownloadProgressHandler{server: s, filename: "out.mkv"}
+			b.HookFinished(tt.result)
+			consumeServerEvent(t, b.hub.outbox, serverEvent{HookFinished: tt.want})
+			ensureNoMoreServerEvents(t, s.hub.outbox)
+		})
+	}
+}
+
+func Test_downloadQueue_downloadableOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        *server
+		r        toDownload
+		wantOpts int
+		wantErr  bool
+	}{
+		{
+			name:     "Defaults",
+			s:        &server{},
+			wantOpts: 3,
+		},
+		{
+			name:     "ServerDefaultProfile",
+			s:        &server{profile: "stereo-aac"},
+			wantOpts: 4,
+		},
+		{
+			name: "CustomProfile",
+			s: &server{profiles: map[string]ffmpeg.TranscodingProfile{
+				"custom": {Video: &ffmpeg.CodecSettings{Codec: "libx265"}},
+			}},
+			r:        toDownload{Profile: "custom"},
+			wantOpts: 4,
+		},
+		{
+			name: "DownloadableOptionsAndSubtitleMode",
+			s: &server{downloadableOptions: []ffmpeg.DownloadableOption{
+				ffmpeg.WithSubtitleFormat(ffmpeg.SubtitleFormatSrt),
+			}},
+			r:        toDownload{Subtitles: ffmpeg.SubtitlesBoth},
+			wantOpts: 5,
+		},
+		{
+			name:     "PostHook",
+			s:        &server{postHook: &ffmpeg.PostHook{Command: "notify.sh"}},
+			r:        toDownload{RecordingId: 1234},
+			wantOpts: 4,
+		},
+		{
+			name:     "RateLimiter",
+			s:        &server{limiter: ratelimit.NewLimiter(ratelimit.Schedule{})},
+			wantOpts: 4,
+		},
+		{
+			name: "RateLimiter/ProxyUnsupported",
+			s: &server{
+				limiter:      ratelimit.NewLimiter(ratelimit.Schedule{}),
+				capabilities: &ffmpeg.Capabilities{},
+			},
+			wantOpts: 3,
+		},
+		{
+			name: "RateLimiter/ProxyUnsupportedButLimited",
+			s: &server{
+				limiter:      ratelimit.NewLimiter(ratelimit.Schedule{Limit: 1024}),
+				capabilities: &ffmpeg.Capabilities{},
+			},
+			wantOpts: 4,
+		},
+		{
+			name:    "UnknownProfile",
+			s:       &server{},
+			r:       toDownload{Profile: "unknown"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newDownloadQueue(tt.s)
+			got, gotErr := q.downloadableOptions(tt.r)
+			if (nil != gotErr) != tt.wantErr {
+				t.Fatalf("downloadableOptions() error = %v, wantErr %v", gotErr, tt.wantErr)
+			}
+			if len(got) != tt.wantOpts {
+				t.Errorf("downloadableOptions() returned %d options, want %d", len(got), tt.wantOpts)
+			}
+		})
+	}
+}
+
+func Test_downloadQueue_metadataOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		r           toDownload
+		postHook    *ffmpeg.PostHook
+		playlist    test.HttpResponse
+		wantOpts    int
+		wantFetched bool
+	}{
+		{
+			name:     "NotAudioOnly",
+			r:        toDownload{RecordingId: 1234},
+			wantOpts: 0,
+		},
+		{
+			name:        "DetailsUnavailable",
+			r:           toDownload{RecordingId: 1234, AudioOnly: true},
+			playlist:    test.HttpResponse{StatusCode: 500},
+			wantOpts:    0,
+			wantFetched: true,
+		},
+		{
+			name: "MetadataAndCoverArt",
+			r:    toDownload{RecordingId: 1234, AudioOnly: true},
+			playlist: test.HttpResponse{
+				StatusCode: 200,
+				Body:       []byte(`{"success":true,"recordings":[{"id":1234,"title":"Concert","image_url":"https://img/1.jpg"}]}`),
+			},
+			wantOpts:    2,
+			wantFetched: true,
+		},
+		{
+			name:     "NotAudioOnlyWithHook",
+			r:        toDownload{RecordingId: 1234},
+			postHook: &ffmpeg.PostHook{Command: "notify.sh"},
+			playlist: test.HttpResponse{
+				StatusCode: 200,
+				Body:       []byte(`{"success":true,"recordings":[{"id":1234,"title":"Movie","image_url":"https://img/1.jpg"}]}`),
+			},
+			wantOpts:    1,
+			wantFetched: true,
+		},
+		{
+			name:     "AudioOnlyWithHook",
+			r:        toDownload{RecordingId: 1234, AudioOnly: true},
+			postHook: &ffmpeg.PostHook{Command: "notify.sh"},
+			playlist: test.HttpResponse{
+				StatusCode: 200,
+				Body:       []byte(`{"success":true,"recordings":[{"id":1234,"title":"Concert","image_url":"https://img/1.jpg"}]}`),
+			},
+			wantOpts:    3,
+			wantFetched: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetched := false
+			ts, client, host := test.NewHttpTestSetup(func(w http.ResponseWriter, r *http.Request) {
+				if r.RequestURI == "/zapi/v2/playlist" && r.Method == http.MethodGet {
+					fetched = true
+					tt.playlist.Respond(w)
+					return
+				}
+				w.Header().Add("x-reason", "unsupported-uri")
+				w.WriteHeader(404)
+			})
+			defer ts.Close()
+			q := newDownloadQueue(&server{a: zattoo.NewAccountWithSession(t, host, client), postHook: tt.postHook})
+			if got := q.metadataOptions(tt.r); len(got) != tt.wantOpts {
+				t.Errorf("metadataOptions() returned %d options, want %d", len(got), tt.wantOpts)
+			}
+			if fetched != tt.wantFetched {
+				t.Errorf("metadataOptions() fetched details %v, want %v", fetched, tt.wantFetched)
+			}
+		})
+	}
+}
@@ -1,5 +1,7 @@
 package server
 
+import "github.com/rokeller/zt-dl/ratelimit"
+
 // serverEvent defines the root object for an event sent by the server.
 type serverEvent struct {
 	Correlation              string                         `json:"correlation,omitempty"`
@@ -9,6 +11,8 @@ type serverEvent struct {
 	DownloadErrored          *eventDownloadErrored          `json:"downloadErrored,omitempty"`
 	StateUpdated             *eventStateUpdated             `json:"stateUpdated,omitempty"`
 	StreamSelectionRequested *eventStreamSelectionRequested `json:"selectStreams,omitempty"`
+	HookFinished             *eventHookFinished             `json:"hookFinished,omitempty"`
+	RateLimitUpdated         *rateLimitState                `json:"rateLimitUpdated,omitempty"`
 }
 
 type clientEvent struct {
@@ -18,21 +22,59 @@ type clientEvent struct {
 
 type eventQueueUpdated struct {
 	Queue []toDownload `json:"queue"`
+	// TotalSize is the sum of the estimated sizes of the pending downloads
+	// whose size could be estimated.
+	TotalSize int64 `json:"totalSize,omitempty"`
 }
 
 type eventDownloadStarted struct {
-	Filename string `json:"filename"`
+	Filename      string `json:"filename"`
+	EstimatedSize int64  `json:"estimatedSize,omitempty"`
+	// Updated is set when the event updates the download which already
+	// started, e.g. with the estimated size of the selected streams.
+	Updated bool `json:"updated,omitempty"`
 }
 
 type eventProgressUpdated struct {
 	RelCompleted float32 `json:"completed"`
 	Elapsed      string  `json:"elapsed"`
 	Remaining    string  `json:"remaining"`
+	// EstimatedSize is the estimated size of the output of the selected
+	// streams in bytes.
+	EstimatedSize int64 `json:"estimatedSize,omitempty"`
+	// Rate is the average download rate in bytes per second so far.
+	Rate int64 `json:"rate,omitempty"`
+	// RateLimit is the rate limit in bytes per second which currently applies,
+	// zero if unlimited.
+	RateLimit int64 `json:"rateLimit,omitempty"`
 }
 
 type eventDownloadErrored struct {
 	Filename string `json:"filename"`
 	Reason   string `json:"reason"`
+	// Class is the class of the ffmpeg failure, if ffmpeg failed.
+	Class string `json:"class,omitempty"`
+	// Hint tells users how to deal with the ffmpeg failure.
+	Hint string `json:"hint,omitempty"`
+	// Log holds the last lines logged by ffmpeg before it failed.
+	Log []string `json:"log,omitempty"`
+}
+
+type eventHookFinished struct {
+	Filename string   `json:"filename"`
+	Command  string   `json:"command"`
+	ExitCode int      `json:"exitCode"`
+	Output   []string `json:"output,omitempty"`
+	Err      string   `json:"err,omitempty"`
+}
+
+// rateLimitState describes the rate limit of downloads. It is both returned by
+// the rate limit API and broadcast when the rate limit changes.
+type rateLimitState struct {
+	// Limit is the limit which currently applies, zero if unlimited.
+	Limit    ratelimit.Rate     `json:"limit"`
+	Override *ratelimit.Rate    `json:"override"`
+	Schedule ratelimit.Schedule `json:"schedule"`
 }
 
 type eventStateUpdated struct {
@@ -46,10 +88,20 @@ type eventStreamSelectionRequested struct {
 
 type eventStreamsSelected struct {
 	SelectedStreams []sourceStream `json:"streams"`
+	SubtitleMode    string         `json:"subtitles,omitempty"`
+}
+
+// recordingStreams describes the streams of a recording, with the streams
+// picked by the automatic streams selection marked as selected.
+type recordingStreams struct {
+	Duration string         `json:"duration"`
+	Streams  []sourceStream `json:"streams"`
+	Warnings []string       `json:"warnings,omitempty"`
 }
 
 type sourceStream struct {
 	Index       int    `json:"index"`
 	Type        string `json:"type"`
 	Description string `json:"desc"`
+	Selected    bool   `json:"selected,omitempty"`
 }
@@ -173,14 +173,14 @@ func Test_wsHub_run(t *testing.T) {
 		{
 			name: "RegisterSendsBufferedEvents",
 			produce: func(t *testing.T, hub *wsHub, cancel context.CancelFunc) {
-				hub.lastQueueUpdated = &eventQueueUpdated{[]toDownload{{1, "a"}}}
-				hub.lastDownloadStarted = &eventDownloadStarted{"abc"}
+				hub.lastQueueUpdated = &eventQueueUpdated{Queue: []toDownload{{RecordingId: 1, OutputPath: "a"}}}
+				hub.lastDownloadStarted = &eventDownloadStarted{Filename: "abc"}
 				c := &wsClient{outbox: make(chan serverEvent, 2)}
 				hub.register <- c
 				blockingSleep(t, time.Millisecond)
 				consumeServerEvents(t, c.outbox, []serverEvent{
-					{QueueUpdated: &eventQueueUpdated{Queue: []toDownload{{1, "a"}}}},
-					{DownloadStarted: &eventDownloadStarted{"abc"}},
+					{QueueUpdated: &eventQueueUpdated{Queue: []toDownload{{RecordingId: 1, OutputPath: "a"}}}},
+					{DownloadStarted: &eventDownloadStarted{Filename: "abc"}},
 				})
 				cancel()
 			},
@@ -217,8 +217,8 @@ func Test_wsHub_run(t *testing.T) {
 		{
 			name: "OutboxEvent/BuffersEvents",
 			produce: func(t *testing.T, hub *wsHub, cancel context.CancelFunc) {
-				queueUpdated := &eventQueueUpdated{[]toDownload{{2, "b"}}}
-				downloadStarted := &eventDownloadStarted{"def"}
+				queueUpdated := &eventQueueUpdated{Queue: []toDownload{{RecordingId: 2, OutputPath: "b"}}}
+				downloadStarted := &eventDownloadStarted{Filename: "def"}
 				hub.outbox <- serverEvent{QueueUpdated: queueUpdated}
 				hub.outbox <- serverEvent{DownloadStarted: downloadStarted}
 				blockingSleep(t, time.Millisecond)
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// libraryEntry describes a finished download.
+type libraryEntry struct {
+	RecordingId int64  `json:"recordingId"`
+	OutputPath  string `json:"filename"`
+	// Parts are the paths of the parts of split outputs.
+	Parts []string `json:"parts,omitempty"`
+	// Sidecars are the paths of the subtitle sidecar files.
+	Sidecars []string  `json:"sidecars,omitempty"`
+	Finished time.Time `json:"finished"`
+}
+
+// libraryFileName is the name of the file in the output directory which keeps
+// the library across restarts of the server. It must not start with the prefix
+// of staging files, which are swept from the output directory at startup.
+const libraryFileName = ".ztdl-library.json"
+
+// library keeps track of the finished downloads, by recording. A nil *library
+// keeps track of nothing.
+type library struct {
+	mu      sync.Mutex
+	entries map[int64]libraryEntry
+	// path is the path of the file the library is saved to, if any.
+	path string
+}
+
+func newLibrary() *library {
+	return &library{entries: map[int64]libraryEntry{}}
+}
+
+// loadLibrary loads the library saved to the given path, if any, and saves it
+// there when downloads are added.
+func loadLibrary(path string) (*library, error) {
+	l := newLibrary()
+	l.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return l, nil
+	} else if nil != err {
+		return l, fmt.Errorf("failed to read library: %w", err)
+	}
+	entries := []libraryEntry{}
+	if err := json.Unmarshal(data, &entries); nil != err {
+		return l, fmt.Errorf("failed to parse library %q: %w", path, err)
+	}
+	for _, entry := range entries {
+		l.entries[entry.RecordingId] = entry
+	}
+	return l, nil
+}
+
+// Add adds the finished download, replacing an earlier download of the same
+// recording.
+func (l *library) Add(entry libraryEntry) {
+	if nil == l {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries[entry.RecordingId] = entry
+	if err := l.save(); nil != err {
+		fmt.Fprintf(os.Stderr, "WARN: Failed to save library: %v\n", err)
+	}
+}
+
+// save writes the entries to the library's file, if any. The file gets
+// replaced only once it was written completely.
+func (l *library) save() error {
+	if l.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(l.list(), "", "  ")
+	if nil != err {
+		return err
+	}
+	tmpPath := l.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); nil != err {
+		return err
+	}
+	return os.Rename(tmpPath, l.path)
+}
+
+// Get returns the finished download of the recording, if any.
+func (l *library) Get(recordingId int64) (libraryEntry, bool) {
+	if nil == l {
+		return libraryEntry{}, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, found := l.entries[recordingId]
+	return entry, found
+}
+
+// List returns the finished downloads, most recent first.
+func (l *library) List() []libraryEntry {
+	if nil == l {
+		return []libraryEntry{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.list()
+}
+
+func (l *library) list() []libraryEntry {
+	entries := []libraryEntry{}
+	for _, entry := range l.entries {
+		entries = append(entries, entry)
+	}
+	slices.SortFunc(entries, func(a, b libraryEntry) int {
+		return b.Finished.Compare(a.Finished)
+	})
+	return entries
+}
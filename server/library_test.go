@@ -0,0 +1,116 @@
+package server
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rokeller/zt-dl/ffmpeg"
+)
+
+func Test_library(t *testing.T) {
+	l := newLibrary()
+	first := libraryEntry{
+		RecordingId: 1234,
+		OutputPath:  "/tmp/first.mkv",
+		Finished:    time.Date(2026, 1, 1, 20, 0, 0, 0, time.UTC),
+	}
+	second := libraryEntry{
+		RecordingId: 2345,
+		OutputPath:  "/tmp/second.mkv",
+		Parts:       []string{"/tmp/second.part01.mkv", "/tmp/second.part02.mkv"},
+		Finished:    time.Date(2026, 1, 1, 21, 0, 0, 0, time.UTC),
+	}
+
+	if _, found := l.Get(1234); found {
+		t.Error("Get() found entry in empty library")
+	}
+	l.Add(first)
+	l.Add(second)
+	if got, found := l.Get(1234); !found || !reflect.DeepEqual(got, first) {
+		t.Errorf("Get() = %v, %v, want %v, true", got, found, first)
+	}
+	if got := l.List(); !reflect.DeepEqual(got, []libraryEntry{second, first}) {
+		t.Errorf("List() = %v, want most recent first", got)
+	}
+
+	// Downloading a recording again replaces the earlier download.
+	again := first
+	again.Finished = first.Finished.Add(2 * time.Hour)
+	l.Add(again)
+	if got := l.List(); !reflect.DeepEqual(got, []libraryEntry{again, second}) {
+		t.Errorf("List() = %v, want replaced entry first", got)
+	}
+}
+
+func Test_library_Nil(t *testing.T) {
+	var l *library
+	l.Add(libraryEntry{RecordingId: 1234})
+	if _, found := l.Get(1234); found {
+		t.Error("Get() found entry in nil library")
+	}
+	if got := l.List(); len(got) != 0 {
+		t.Errorf("List() = %v, want empty", got)
+	}
+}
+
+func Test_loadLibrary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), libraryFileName)
+	entry := libraryEntry{
+		RecordingId: 1234,
+		OutputPath:  "/tmp/first.mkv",
+		Parts:       []string{"/tmp/first.part01.mkv"},
+		Finished:    time.Date(2026, 1, 1, 20, 0, 0, 0, time.UTC),
+	}
+
+	l, err := loadLibrary(path)
+	if nil != err {
+		t.Fatalf("loadLibrary() failed for missing file: %v", err)
+	}
+	l.Add(entry)
+
+	// The entries are kept across restarts of the server.
+	l, err = loadLibrary(path)
+	if nil != err {
+		t.Fatalf("loadLibrary() failed: %v", err)
+	}
+	if got, found := l.Get(1234); !found || !reflect.DeepEqual(got, entry) {
+		t.Errorf("Get() = %v, %v, want %v, true", got, found, entry)
+	}
+
+	if err := os.WriteFile(path, []byte("not json"), 0o644); nil != err {
+		t.Fatal(err)
+	}
+	if l, err := loadLibrary(path); nil == err || len(l.List()) != 0 {
+		t.Errorf("loadLibrary() = %v, %v, want empty library and error for invalid file", l.List(), err)
+	}
+}
+
+func Test_loadLibrary_AfterSweep(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, libraryFileName)
+	entry := libraryEntry{RecordingId: 1234, OutputPath: "/tmp/first.mkv"}
+	l, err := loadLibrary(path)
+	if nil != err {
+		t.Fatalf("loadLibrary() failed for missing file: %v", err)
+	}
+	l.Add(entry)
+	old := time.Now().Add(-24 * time.Hour)
+	os.Chtimes(path, old, old)
+
+	// Restarts sweep orphaned staging files from the output directory before
+	// the library is loaded.
+	if err := ffmpeg.SweepStaging(dir, io.Discard); nil != err {
+		t.Fatalf("SweepStaging() failed: %v", err)
+	}
+	l, err = loadLibrary(path)
+	if nil != err {
+		t.Fatalf("loadLibrary() failed: %v", err)
+	}
+	if got, found := l.Get(1234); !found || !reflect.DeepEqual(got, entry) {
+		t.Errorf("Get() = %v, %v, want %v, true", got, found, entry)
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rokeller/zt-dl/ffmpeg"
+)
+
+type probeCacheEntry struct {
+	info    ffmpeg.StreamInfo
+	expires time.Time
+}
+
+// probeCache caches the streams detected per recording, such that previewing
+// the streams of a recording or enqueuing it again doesn't detect them again.
+// A nil *probeCache caches nothing.
+type probeCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[int64]probeCacheEntry
+
+	now func() time.Time
+}
+
+func newProbeCache(ttl time.Duration) *probeCache {
+	return &probeCache{
+		ttl:     ttl,
+		entries: map[int64]probeCacheEntry{},
+		now:     time.Now,
+	}
+}
+
+// Get returns the cached stream info of the recording, if any.
+func (c *probeCache) Get(recordingId int64) (ffmpeg.StreamInfo, bool) {
+	if nil == c {
+		return ffmpeg.StreamInfo{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, found := c.entries[recordingId]
+	if !found {
+		return ffmpeg.StreamInfo{}, false
+	}
+	if c.now().After(entry.expires) {
+		delete(c.entries, recordingId)
+		return ffmpeg.StreamInfo{}, false
+	}
+	return entry.info, true
+}
+
+// Put caches the stream info of the recording.
+func (c *probeCache) Put(recordingId int64, info ffmpeg.StreamInfo) {
+	if nil == c {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for id, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, id)
+		}
+	}
+	c.entries[recordingId] = probeCacheEntry{info: info, expires: now.Add(c.ttl)}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rokeller/zt-dl/ffmpeg"
+)
+
+func Test_probeCache(t *testing.T) {
+	now := time.Date(2026, 1, 1, 20, 0, 0, 0, time.UTC)
+	c := newProbeCache(time.Hour)
+	c.now = func() time.Time { return now }
+
+	info := ffmpeg.StreamInfo{
+		Duration: time.Minute,
+		Streams:  []ffmpeg.SourceStream{&ffmpeg.AudioStream{Stream: ffmpeg.Stream{Index: 1}}},
+	}
+	if _, found := c.Get(1234); found {
+		t.Error("Get() found entry in empty cache")
+	}
+	c.Put(1234, info)
+	if got, found := c.Get(1234); !found || !reflect.DeepEqual(got, info) {
+		t.Errorf("Get() = %v, %v, want %v, true", got, found, info)
+	}
+
+	now = now.Add(time.Hour + time.Second)
+	if _, found := c.Get(1234); found {
+		t.Error("Get() found expired entry")
+	}
+	if len(c.entries) != 0 {
+		t.Errorf("entries = %v, want expired entry removed", c.entries)
+	}
+}
+
+func Test_probeCache_Nil(t *testing.T) {
+	var c *probeCache
+	c.Put(1234, ffmpeg.StreamInfo{Duration: time.Minute})
+	if _, found := c.Get(1234); found {
+		t.Error("Get() found entry in nil cache")
+	}
+}
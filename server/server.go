@@ -7,6 +7,7 @@ import (
 	"io/fs"
 	"net/http"
 	"os"
+	"path/filepath"
 	"runtime"
 	"sync"
 	"time"
@@ -14,6 +15,8 @@ import (
 	"github.com/gorilla/mux"
 	e "github.com/rokeller/zt-dl/exec"
 	"github.com/rokeller/zt-dl/ffmpeg"
+	"github.com/rokeller/zt-dl/ratelimit"
+	"github.com/rokeller/zt-dl/relay"
 	"github.com/rokeller/zt-dl/zattoo"
 )
 
@@ -21,18 +24,41 @@ import (
 var content embed.FS
 
 type server struct {
-	a   *zattoo.Account
-	dlq *downloadQueue
-	hub *wsHub
+	a      *zattoo.Account
+	dlq    *downloadQueue
+	hub    *wsHub
+	probes *probeCache
+	// library keeps track of the downloads which finished.
+	library *library
 
 	port      uint16
 	outdir    string
 	overwrite bool
 	openWebUI bool
+	container ffmpeg.Container
+	profiles  map[string]ffmpeg.TranscodingProfile
+	profile   string
 
 	streamsSelectorFactory func() ffmpeg.StreamsSelector
+	// automaticSelectorFactory creates the selector which picks streams
+	// without user interaction, e.g. to preview the selection.
+	automaticSelectorFactory func() ffmpeg.StreamsSelector
+	postProcessors           []ffmpeg.PostProcessor
+	downloadableOptions      []ffmpeg.DownloadableOption
+	postHook                 *ffmpeg.PostHook
+	// limiter limits the total rate of all downloads.
+	limiter *ratelimit.Limiter
+	// capabilities holds the detected capabilities of ffmpeg, if detected.
+	capabilities *ffmpeg.Capabilities
+	// relays holds the HLS relays of the recordings being played.
+	relays *relays
+	// player is the player to start for recordings being played, if any.
+	player relay.Player
 }
 
+// probeCacheTtl is how long the streams detected for a recording are reused.
+const probeCacheTtl = 6 * time.Hour
+
 type ServeOption func(*server)
 
 func Serve(
@@ -43,12 +69,21 @@ func Serve(
 	wg.Add(1)
 
 	s := &server{
-		hub: newHub(),
+		hub:     newHub(),
+		probes:  newProbeCache(probeCacheTtl),
+		relays:  newRelays(),
+		limiter: ratelimit.NewLimiter(ratelimit.Schedule{}),
 	}
 
 	for _, option := range options {
 		option(s)
 	}
+	// The library is kept in the output directory, which is known only now.
+	library, err := loadLibrary(filepath.Join(s.outdir, libraryFileName))
+	if nil != err {
+		fmt.Fprintf(os.Stderr, "WARN: %v. Starting with an empty library.\n", err)
+	}
+	s.library = library
 
 	srv := s.startHttpServer(ctx, wg)
 	if s.openWebUI {
@@ -68,6 +103,12 @@ func Serve(
 	return nil
 }
 
+// rateLimited tells whether downloads are limited by the schedule or by a limit
+// set at runtime.
+func (s *server) rateLimited() bool {
+	return nil != s.limiter && (!s.limiter.Schedule().IsZero() || nil != s.limiter.Override())
+}
+
 func (s *server) startHttpServer(ctx context.Context, wg *sync.WaitGroup) *http.Server {
 	sub, err := fs.Sub(content, "client/dist")
 	if nil != err {
@@ -85,6 +126,10 @@ func (s *server) startHttpServer(ctx context.Context, wg *sync.WaitGroup) *http.
 
 	AddRecordingsApi(s, api)
 	AddQueuesApis(s, api)
+	AddRateLimitApi(s, api)
+	AddLibraryApi(s, api)
+	AddSystemApi(s, api)
+	AddPlayApi(s, api)
 	r.PathPrefix("/").Handler(http.FileServer(http.FS(sub)))
 
 	srv := &http.Server{
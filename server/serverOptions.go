@@ -2,6 +2,8 @@ package server
 
 import (
 	"github.com/rokeller/zt-dl/ffmpeg"
+	"github.com/rokeller/zt-dl/ratelimit"
+	"github.com/rokeller/zt-dl/relay"
 	"github.com/rokeller/zt-dl/zattoo"
 )
 
@@ -29,26 +31,107 @@ func WithOverwrite(overwrite bool) ServeOption {
 	}
 }
 
+func WithContainer(container ffmpeg.Container) ServeOption {
+	return func(s *server) {
+		s.container = container
+	}
+}
+
+// WithTranscodingProfiles sets the custom transcoding profiles available for
+// downloads, and the name of the profile to use when none is requested.
+func WithTranscodingProfiles(
+	profiles map[string]ffmpeg.TranscodingProfile,
+	defaultProfile string,
+) ServeOption {
+	return func(s *server) {
+		s.profiles = profiles
+		s.profile = defaultProfile
+	}
+}
+
 func WithOpenWebUI(openWebUI bool) ServeOption {
 	return func(s *server) {
 		s.openWebUI = openWebUI
 	}
 }
 
-func WithBestStreamsSelection() ServeOption {
+func WithBestStreamsSelection(options ...ffmpeg.BestStreamsSelectorOption) ServeOption {
 	return func(s *server) {
-		s.streamsSelectorFactory = bestStreamsSelectorFactory
+		s.streamsSelectorFactory = func() ffmpeg.StreamsSelector {
+			return ffmpeg.NewBestStreamsSelector(options...)
+		}
+		s.automaticSelectorFactory = s.streamsSelectorFactory
 	}
 }
 
+// WithStreamsSelector selects streams automatically using the given selector,
+// e.g. a rule-based one. The selector is shared by all downloads.
+func WithStreamsSelector(selector ffmpeg.StreamsSelector) ServeOption {
+	return func(s *server) {
+		s.streamsSelectorFactory = func() ffmpeg.StreamsSelector {
+			return selector
+		}
+		s.automaticSelectorFactory = s.streamsSelectorFactory
+	}
+}
+
+// WithInteractiveStreamsSelection lets the user select the streams in the web
+// UI. The streams which the previously configured streams selection picks are
+// preselected.
 func WithInteractiveStreamsSelection() ServeOption {
 	return func(s *server) {
+		preselect := s.automaticSelectorFactory
 		s.streamsSelectorFactory = func() ffmpeg.StreamsSelector {
-			return newInteractiveStreamsSelector(s.hub)
+			var preselector ffmpeg.StreamsSelector
+			if nil != preselect {
+				preselector = preselect()
+			}
+			return newInteractiveStreamsSelector(s.hub, preselector)
 		}
 	}
 }
 
-func bestStreamsSelectorFactory() ffmpeg.StreamsSelector {
-	return ffmpeg.NewBestStreamsSelector()
+func WithPostProcessors(postProcessors ...ffmpeg.PostProcessor) ServeOption {
+	return func(s *server) {
+		s.postProcessors = append(s.postProcessors, postProcessors...)
+	}
+}
+
+// WithDownloadableOptions sets options applied to all downloads before the
+// options requested for the individual download.
+func WithDownloadableOptions(options ...ffmpeg.DownloadableOption) ServeOption {
+	return func(s *server) {
+		s.downloadableOptions = append(s.downloadableOptions, options...)
+	}
+}
+
+// WithPostHook runs the given command after each download, with the ID of the
+// recording in the ZTDL_RECORDING_ID environment variable.
+func WithPostHook(hook ffmpeg.PostHook) ServeOption {
+	return func(s *server) {
+		s.postHook = &hook
+	}
+}
+
+// WithRateLimit limits the total rate of all downloads according to the given
+// schedule. The limit can be overridden at runtime through the API.
+func WithRateLimit(schedule ratelimit.Schedule) ServeOption {
+	return func(s *server) {
+		s.limiter = ratelimit.NewLimiter(schedule)
+	}
+}
+
+// WithCapabilities sets the detected capabilities of ffmpeg, which downloads
+// are checked against when they are enqueued.
+func WithCapabilities(caps ffmpeg.Capabilities) ServeOption {
+	return func(s *server) {
+		s.capabilities = &caps
+	}
+}
+
+// WithPlayer sets the player which the API can start to play recordings.
+func WithPlayer(player relay.Player) ServeOption {
+	return func(s *server) {
+		s.player = player
+	}
 }
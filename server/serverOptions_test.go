@@ -3,6 +3,8 @@ package server
 import (
 	"reflect"
 	"testing"
+
+	"github.com/rokeller/zt-dl/ffmpeg"
 )
 
 func TestWithBestStreamsSelection(t *testing.T) {
@@ -62,3 +64,38 @@ func TestWithInteractiveStreamsSelection(t *testing.T) {
 		})
 	}
 }
+
+func TestWithStreamsSelector(t *testing.T) {
+	selector, _ := ffmpeg.NewRuleBasedStreamsSelector(ffmpeg.SelectionRules{}, nil)
+	s := &server{}
+	WithStreamsSelector(selector)(s)
+	if got := s.streamsSelectorFactory(); !reflect.DeepEqual(got, selector) {
+		t.Errorf("streamsSelectorFactory() = %v, want %v", got, selector)
+	}
+	WithInteractiveStreamsSelection()(s)
+	if got := s.automaticSelectorFactory(); !reflect.DeepEqual(got, selector) {
+		t.Errorf("automaticSelectorFactory() = %v, want %v", got, selector)
+	}
+}
+
+func TestWithInteractiveStreamsSelection_Preselector(t *testing.T) {
+	s := &server{hub: &wsHub{}}
+	WithBestStreamsSelection()(s)
+	WithInteractiveStreamsSelection()(s)
+	sel, ok := s.streamsSelectorFactory().(*interactiveStreamsSelector)
+	if !ok {
+		t.Fatalf("streamsSelectorFactory() returned %T, want *interactiveStreamsSelector", sel)
+	}
+	if tt := reflect.TypeOf(sel.preselector); nil == tt || tt.String() != "ffmpeg.bestStreamsSelector" {
+		t.Errorf("preselector: got type %v, want ffmpeg.bestStreamsSelector", tt)
+	}
+}
+
+func TestWithPostProcessors(t *testing.T) {
+	pp := ffmpeg.NewChapterDetector()
+	s := &server{}
+	WithPostProcessors(pp)(s)
+	if len(s.postProcessors) != 1 || s.postProcessors[0] != pp {
+		t.Errorf("postProcessors: got %v, want [%v]", s.postProcessors, pp)
+	}
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/google/uuid"
 	"github.com/rokeller/zt-dl/ffmpeg"
@@ -11,13 +12,21 @@ type interactiveStreamsSelector struct {
 	add    chan clientEventHandler
 	remove chan clientEventHandler
 	outbox chan serverEvent
+
+	// preselector selects the streams which are preselected for the user.
+	preselector  ffmpeg.StreamsSelector
+	subtitleMode ffmpeg.SubtitleMode
 }
 
-func newInteractiveStreamsSelector(hub *wsHub) ffmpeg.StreamsSelector {
+var _ ffmpeg.SubtitleModeSelector = &interactiveStreamsSelector{}
+
+func newInteractiveStreamsSelector(hub *wsHub, preselector ffmpeg.StreamsSelector) ffmpeg.StreamsSelector {
 	return &interactiveStreamsSelector{
 		add:    hub.addHandler,
 		remove: hub.removeHandler,
 		outbox: hub.outbox,
+
+		preselector: preselector,
 	}
 }
 
@@ -36,10 +45,11 @@ func (s *interactiveStreamsSelector) SelectStreams(
 	// Register the event handler in the hub.
 	s.add <- h
 	// Notify the hub clients about the requested stream selection.
+	descs := describeStreams(streams, s.preselector)
 	s.outbox <- serverEvent{
 		Correlation: correlation,
 		StreamSelectionRequested: &eventStreamSelectionRequested{
-			SourceStreams: ffmpeg.TransformStreams(streams, sourceStreamToSourceStreamDesc),
+			SourceStreams: descs,
 		},
 	}
 	fmt.Println("Waiting for source stream selection by user ...")
@@ -57,6 +67,11 @@ func (s *interactiveStreamsSelector) SelectStreams(
 	}), nil
 }
 
+// SelectedSubtitleMode implements [ffmpeg.SubtitleModeSelector].
+func (s *interactiveStreamsSelector) SelectedSubtitleMode() ffmpeg.SubtitleMode {
+	return s.subtitleMode
+}
+
 type sourceStreamSelectedHandler struct {
 	owner       *interactiveStreamsSelector
 	correlation string
@@ -75,26 +90,37 @@ func (h *sourceStreamSelectedHandler) Handle(e sourcedClientEvent) {
 	// Remove this handler now so it won't be called for other client events.
 	h.owner.remove <- h
 
+	if mode, err := ffmpeg.ParseSubtitleMode(se.StreamsSelected.SubtitleMode); nil == err {
+		h.owner.subtitleMode = mode
+	}
 	selected := se.StreamsSelected.SelectedStreams
 	fmt.Printf("User selected %d stream(s) for download.\n", len(selected))
 	h.done <- selected
 }
 
 func sourceStreamToSourceStreamDesc(s ffmpeg.SourceStream) sourceStream {
-	var t string
-	switch s.(type) {
-	case *ffmpeg.AudioStream:
-		t = "Audio"
-	case *ffmpeg.SubtitleStream:
-		t = "Subtitle"
-	case *ffmpeg.VideoStream:
-		t = "Video"
-	default:
-		t = "Unknown"
-	}
 	return sourceStream{
 		Index:       s.Index(),
-		Type:        t,
+		Type:        ffmpeg.StreamType(s),
 		Description: s.String(),
 	}
 }
+
+// describeStreams describes the given streams, marking the ones the
+// preselector picks as selected. Preselection is best-effort.
+func describeStreams(
+	streams []ffmpeg.SourceStream,
+	preselector ffmpeg.StreamsSelector,
+) []sourceStream {
+	descs := ffmpeg.TransformStreams(streams, sourceStreamToSourceStreamDesc)
+	if nil != preselector {
+		if preselected, err := preselector.SelectStreams(streams); nil == err {
+			for i := range descs {
+				descs[i].Selected = slices.ContainsFunc(preselected, func(p ffmpeg.SourceStream) bool {
+					return p.Index() == descs[i].Index
+				})
+			}
+		}
+	}
+	return descs
+}
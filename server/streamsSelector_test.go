@@ -35,7 +35,7 @@ func Test_newInteractiveStreamsSelector(t *testing.T) {
 		remove: hub.removeHandler,
 		outbox: hub.outbox,
 	}
-	if got := newInteractiveStreamsSelector(hub); !reflect.DeepEqual(got, want) {
+	if got := newInteractiveStreamsSelector(hub, nil); !reflect.DeepEqual(got, want) {
 		t.Errorf("newInteractiveStreamsSelector() = %v, want %v", got, want)
 	}
 }
@@ -109,6 +109,7 @@ func Test_interactiveStreamsSelector_SelectStreams(t *testing.T) {
 					{Index: 2},
 					{Index: 3},
 				},
+				SubtitleMode: "sidecar",
 			},
 		}
 		go handler.Handle(sourcedClientEvent{event: clientEvent})
@@ -127,6 +128,54 @@ func Test_interactiveStreamsSelector_SelectStreams(t *testing.T) {
 	if !reflect.DeepEqual(got, want) {
 		t.Errorf("SelectStreams() got streams %#v, want %#v", got, want)
 	}
+	if mode := s.SelectedSubtitleMode(); mode != ffmpeg.SubtitlesSidecar {
+		t.Errorf("SelectedSubtitleMode() got %q, want %q", mode, ffmpeg.SubtitlesSidecar)
+	}
+}
+
+func Test_interactiveStreamsSelector_SelectStreams_Preselected(t *testing.T) {
+	s := &interactiveStreamsSelector{
+		add:    make(chan clientEventHandler),
+		remove: make(chan clientEventHandler),
+		outbox: make(chan serverEvent),
+
+		preselector: ffmpeg.NewBestStreamsSelector(),
+	}
+
+	ss := []ffmpeg.SourceStream{
+		&ffmpeg.AudioStream{Stream: ffmpeg.Stream{Index: 0}, SampleRate: 22000},
+		&ffmpeg.AudioStream{Stream: ffmpeg.Stream{Index: 1}, SampleRate: 44000},
+		&ffmpeg.VideoStream{Stream: ffmpeg.Stream{Index: 2}, Width: 1280, Height: 720},
+	}
+
+	go func() {
+		handler := <-s.add
+		serverEvent := <-s.outbox
+		want := []sourceStream{
+			{Index: 0, Type: "Audio", Description: ss[0].String()},
+			{Index: 1, Type: "Audio", Description: ss[1].String(), Selected: true},
+			{Index: 2, Type: "Video", Description: ss[2].String(), Selected: true},
+		}
+		if got := serverEvent.StreamSelectionRequested.SourceStreams; !reflect.DeepEqual(got, want) {
+			t.Errorf("Outgoing event got streams %v, want %v", got, want)
+		}
+
+		go handler.Handle(sourcedClientEvent{event: clientEvent{
+			Correlation: serverEvent.Correlation,
+			StreamsSelected: &eventStreamsSelected{
+				SelectedStreams: []sourceStream{{Index: 1}},
+			},
+		}})
+		<-s.remove
+	}()
+
+	got, err := s.SelectStreams(ss)
+	if nil != err {
+		t.Errorf("SelectStreams() got error %v, want nil", err)
+	}
+	if want := []ffmpeg.SourceStream{ss[1]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SelectStreams() got streams %v, want %v", got, want)
+	}
 }
 
 func Test_sourceStreamSelectedHandler_Handle(t *testing.T) {
@@ -0,0 +1,39 @@
+// Package units parses numbers with unit suffixes, like sizes and rates.
+package units
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Multipliers maps lower case unit suffixes to the multipliers they stand for.
+type Multipliers map[string]float64
+
+var (
+	// Binary holds the binary multipliers for sizes and transfer rates, e.g.
+	// 2M for 2 MiB.
+	Binary = Multipliers{"k": 1 << 10, "m": 1 << 20, "g": 1 << 30, "t": 1 << 40}
+	// Decimal holds the decimal multipliers for bit rates, e.g. 5M for 5
+	// megabits.
+	Decimal = Multipliers{"k": 1e3, "m": 1e6, "g": 1e9}
+)
+
+// Parse parses a non-negative number with an optional unit suffix in either
+// case, e.g. 1.5G, and returns the number multiplied by the suffix's
+// multiplier.
+func (m Multipliers) Parse(value string) (float64, error) {
+	number, multiplier := strings.TrimSpace(value), 1.0
+	if number != "" {
+		if mult, found := m[strings.ToLower(number[len(number)-1:])]; found {
+			number, multiplier = number[:len(number)-1], mult
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if nil != err {
+		return 0, err
+	} else if n < 0 {
+		return 0, errors.New("must not be negative")
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,37 @@
+package units
+
+import "testing"
+
+func TestMultipliers_Parse(t *testing.T) {
+	tests := []struct {
+		name        string // description of this test case
+		multipliers Multipliers
+		value       string
+		want        float64
+		wantErr     bool
+	}{
+		{name: "Binary/NoSuffix", multipliers: Binary, value: "1000", want: 1000},
+		{name: "Binary/LowerCase", multipliers: Binary, value: "500k", want: 500 << 10},
+		{name: "Binary/UpperCase", multipliers: Binary, value: "2M", want: 2 << 20},
+		{name: "Binary/Fraction", multipliers: Binary, value: "1.5G", want: 1.5 * (1 << 30)},
+		{name: "Binary/Tera", multipliers: Binary, value: " 1t ", want: 1 << 40},
+		{name: "Decimal/Kilo", multipliers: Decimal, value: "800K", want: 800_000},
+		{name: "Decimal/Mega", multipliers: Decimal, value: "2.5m", want: 2_500_000},
+		{name: "Decimal/UnknownSuffix", multipliers: Decimal, value: "1t", wantErr: true},
+		{name: "Empty", multipliers: Binary, value: "", wantErr: true},
+		{name: "SuffixOnly", multipliers: Binary, value: "M", wantErr: true},
+		{name: "NotANumber", multipliers: Binary, value: "fast", wantErr: true},
+		{name: "Negative", multipliers: Binary, value: "-1M", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.multipliers.Parse(tt.value)
+			if (nil != err) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Parse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
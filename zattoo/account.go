@@ -77,6 +77,37 @@ func (a *Account) GetProgramDetails(id int64) (programDetails, error) {
 	return a.s.getProgramDetails(*a, id)
 }
 
+// GetRecordingDetails gets the recording with the given ID along with the
+// details of its program. Program details are looked up on a best-effort basis;
+// the channel falls back to the channel ID if they are not available.
+func (a *Account) GetRecordingDetails(id int64) (RecordingDetails, error) {
+	recordings, err := a.GetAllRecordings()
+	if nil != err {
+		return RecordingDetails{}, err
+	}
+
+	for _, r := range recordings {
+		if r.Id != id {
+			continue
+		}
+
+		details := RecordingDetails{
+			recording: r,
+			Channel:   r.ChannelId,
+		}
+		if program, err := a.GetProgramDetails(r.ProgramId); nil == err {
+			if program.ChannelName != "" {
+				details.Channel = program.ChannelName
+			}
+			details.Description = program.Description
+			details.Year = program.Year
+		}
+		return details, nil
+	}
+
+	return RecordingDetails{}, fmt.Errorf("recording %d not found", id)
+}
+
 func (a *Account) GetRecordingStreamUrl(id int64) (string, error) {
 	stream, err := a.s.getRecording(*a, id)
 	if nil != err {
@@ -85,8 +116,16 @@ func (a *Account) GetRecordingStreamUrl(id int64) (string, error) {
 	return stream.Url, nil
 }
 
+// HttpClient returns the HTTP client of the logged in account's session, e.g.
+// to fetch the streams of recordings.
+func (a *Account) HttpClient() *http.Client {
+	return a.s.client
+}
+
 func (a *Account) readPassword() error {
-	fmt.Println("Please enter your password:")
+	// Prompt on stderr, such that the prompt stays out of output written to
+	// stdout, e.g. recordings streamed to a pipe.
+	fmt.Fprintln(os.Stderr, "Please enter your password:")
 	password, err := readPassword()
 
 	if nil != err {
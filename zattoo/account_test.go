@@ -323,6 +323,104 @@ func TestAccount_GetProgramDetails(t *testing.T) {
 	}
 }
 
+func TestAccount_GetRecordingDetails(t *testing.T) {
+	r := recording{
+		Id:           123,
+		ProgramId:    456,
+		ChannelId:    "test",
+		Title:        "A Test Tale",
+		EpisodeTitle: "Unit Tests",
+	}
+	playlistResp := test.HttpResponse{
+		StatusCode: 200,
+		Body: test.MakeJson(map[string]any{
+			"success":    true,
+			"recordings": []any{r},
+		}),
+	}
+	tests := []struct {
+		name        string // description of this test case
+		id          int64
+		want        RecordingDetails
+		wantErr     bool
+		playlist    test.HttpResponse
+		programResp test.HttpResponse
+	}{
+		{
+			name:    "PlaylistFailure",
+			id:      123,
+			wantErr: true,
+		},
+		{
+			name:     "NotFound",
+			id:       234,
+			wantErr:  true,
+			playlist: playlistResp,
+		},
+		{
+			name:     "WithoutProgramDetails",
+			id:       123,
+			want:     RecordingDetails{recording: r, Channel: "test"},
+			playlist: playlistResp,
+		},
+		{
+			name: "WithProgramDetails",
+			id:   123,
+			want: RecordingDetails{
+				recording:   r,
+				Channel:     "Test TV",
+				Description: "Tales of tests.",
+				Year:        2025,
+			},
+			playlist: playlistResp,
+			programResp: test.HttpResponse{
+				StatusCode: 200,
+				Body: test.MakeJson(map[string]any{
+					"success": true,
+					"programs": []any{programDetails{
+						ChannelName: "Test TV",
+						Description: "Tales of tests.",
+						Year:        2025,
+					}},
+				}),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, client, host := test.NewHttpTestSetup(func(w http.ResponseWriter, r *http.Request) {
+				switch r.RequestURI {
+				case "/zapi/v2/playlist":
+					tt.playlist.Respond(w)
+					return
+				case "/zapi/v2/cached/program/power_details/pwrgdhsh?program_ids=456":
+					tt.programResp.Respond(w)
+					return
+				}
+				w.Header().Add("x-reason", "unsupported-uri")
+				w.WriteHeader(404)
+			})
+			defer ts.Close()
+
+			a := NewAccount("user@test.com", host)
+			a.s = &session{client: client, powerGuideHash: "pwrgdhsh"}
+			got, gotErr := a.GetRecordingDetails(tt.id)
+			if gotErr != nil {
+				if !tt.wantErr {
+					t.Errorf("GetRecordingDetails() failed: %v", gotErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("GetRecordingDetails() succeeded unexpectedly")
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetRecordingDetails() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestAccount_GetRecordingStreamUrl(t *testing.T) {
 	tests := []struct {
 		name         string // description of this test case
@@ -29,6 +29,21 @@ type recording struct {
 	End          time.Time `json:"end"`
 }
 
+// RecordingDetails combines a recording with the details of its program.
+type RecordingDetails struct {
+	recording
+	Channel     string
+	Description string
+	Year        int
+}
+
+// Overlap returns how long the start of the recording overlaps with the end of
+// the given previous recording, e.g. when both were recorded with padding. It
+// returns zero if the recordings do not overlap.
+func (r recording) Overlap(previous RecordingDetails) time.Duration {
+	return max(0, previous.End.Sub(r.Start))
+}
+
 type watchRecordingResponse struct {
 	Csid            string `json:"csid"`
 	Stream          stream `json:"stream"`
@@ -139,6 +154,8 @@ func (s *session) getProgramDetails(a Account, id int64) (programDetails, error)
 
 	if !res.Success {
 		return programDetails{}, errors.New("failed to get program details")
+	} else if len(res.Programs) <= 0 {
+		return programDetails{}, fmt.Errorf("no details found for program %d", id)
 	}
 
 	return res.Programs[0], nil
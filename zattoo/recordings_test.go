@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/rokeller/zt-dl/test"
 )
@@ -266,3 +267,29 @@ func Test_session_getProgramDetails(t *testing.T) {
 		})
 	}
 }
+
+func Test_recording_Overlap(t *testing.T) {
+	at := func(hhmm string) time.Time {
+		t, _ := time.Parse("15:04", hhmm)
+		return t
+	}
+	previous := RecordingDetails{recording: recording{Start: at("20:00"), End: at("21:05")}}
+
+	tests := []struct {
+		name  string
+		start time.Time
+		want  time.Duration
+	}{
+		{name: "Overlapping", start: at("20:55"), want: 10 * time.Minute},
+		{name: "Adjacent", start: at("21:05"), want: 0},
+		{name: "Gap", start: at("21:15"), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := recording{Start: tt.start, End: tt.start.Add(time.Hour)}
+			if got := r.Overlap(previous); got != tt.want {
+				t.Errorf("recording.Overlap() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}